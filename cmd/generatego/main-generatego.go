@@ -37,6 +37,8 @@ func GenerateWshClient() {
 			gogen.GenMethod_ResponseStream(&buf, methodDecl)
 		} else if methodDecl.CommandType == wshrpc.RpcType_Call {
 			gogen.GenMethod_Call(&buf, methodDecl)
+		} else if methodDecl.CommandType == wshrpc.RpcType_StreamingRequest {
+			gogen.GenMethod_StreamingRequest(&buf, methodDecl)
 		} else {
 			panic("unsupported command type " + methodDecl.CommandType)
 		}
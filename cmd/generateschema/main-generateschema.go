@@ -0,0 +1,78 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/wavetermdev/waveterm/pkg/schemagen"
+	"github.com/wavetermdev/waveterm/pkg/web"
+)
+
+const JsonSchemaFileName = "schema/wshrpc.schema.json"
+const OpenApiFileName = "schema/wshrpc.openapi.json"
+
+func getWaveVersion() (string, error) {
+	barr, err := os.ReadFile("package.json")
+	if err != nil {
+		return "", err
+	}
+	var pkgJson struct {
+		Version string `json:"version"`
+	}
+	err = json.Unmarshal(barr, &pkgJson)
+	if err != nil {
+		return "", fmt.Errorf("error parsing package.json: %w", err)
+	}
+	return pkgJson.Version, nil
+}
+
+func writeJsonFile(fileName string, doc map[string]any) error {
+	fmt.Fprintf(os.Stderr, "generating schema file to %s\n", fileName)
+	barr, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	barr = append(barr, '\n')
+	return os.WriteFile(fileName, barr, 0644)
+}
+
+func main() {
+	err := os.MkdirAll("schema", 0755)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating schema dir: %v\n", err)
+		os.Exit(1)
+	}
+	jsonSchema, err := schemagen.GenerateWshRpcJsonSchema()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating json schema: %v\n", err)
+		os.Exit(1)
+	}
+	err = writeJsonFile(JsonSchemaFileName, jsonSchema)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing json schema: %v\n", err)
+		os.Exit(1)
+	}
+	version, err := getWaveVersion()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting wave version: %v\n", err)
+		os.Exit(1)
+	}
+	openApi, err := schemagen.GenerateWshRpcOpenApi(schemagen.OpenApiOpts{
+		Version: version,
+		RpcPath: web.GatewayRpcPath,
+		WsPath:  web.GatewayWsPath,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating openapi document: %v\n", err)
+		os.Exit(1)
+	}
+	err = writeJsonFile(OpenApiFileName, openApi)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing openapi document: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -99,6 +99,9 @@ func generateWshClientApiFile(tsTypeMap map[reflect.Type]string) error {
 	for _, methodDecl := range orderedKeys {
 		methodDecl := declMap[methodDecl]
 		methodStr := tsgen.GenerateWshClientApiMethod(methodDecl, tsTypeMap)
+		if methodStr == "" {
+			continue
+		}
 		fmt.Fprint(fd, methodStr)
 		fmt.Fprintf(fd, "\n")
 	}
@@ -20,6 +20,7 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/authkey"
 	"github.com/wavetermdev/waveterm/pkg/blockcontroller"
 	"github.com/wavetermdev/waveterm/pkg/filestore"
+	"github.com/wavetermdev/waveterm/pkg/remote/conncontroller"
 	"github.com/wavetermdev/waveterm/pkg/service"
 	"github.com/wavetermdev/waveterm/pkg/telemetry"
 	"github.com/wavetermdev/waveterm/pkg/util/shellutil"
@@ -31,6 +32,8 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/web"
 	"github.com/wavetermdev/waveterm/pkg/wlayout"
 	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wpsstore"
+	"github.com/wavetermdev/waveterm/pkg/wpswebhook"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshremote"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshserver"
@@ -60,6 +63,7 @@ func doShutdown(reason string) {
 		sendTelemetryWrapper()
 		// TODO deal with flush in progress
 		filestore.WFS.FlushCache(ctx)
+		wpsstore.EventStore.Flush(ctx)
 		watcher := wconfig.GetWatcher()
 		if watcher != nil {
 			watcher.Close()
@@ -159,6 +163,10 @@ func shutdownActivityUpdate() {
 func createMainWshClient() {
 	rpc := wshserver.GetMainRpcClient()
 	wshutil.DefaultRouter.RegisterRoute(wshutil.DefaultRoute, rpc)
+	wshutil.DefaultRouter.SetConnResolver(wcore.ResolveObjConns)
+	wshutil.DefaultRouter.SetRouteUnresponsiveHandler(conncontroller.HandleUnresponsiveRoute)
+	wshutil.DefaultRouter.StartKeepAlive(conncontroller.GetRouteKeepAliveOpts)
+	conncontroller.SetReconnectHandler(blockcontroller.RestartCmdBlocksOnReconnect)
 	wps.Broker.SetClient(wshutil.DefaultRouter)
 	localConnWsh := wshutil.MakeWshRpc(nil, nil, wshrpc.RpcContext{Conn: wshrpc.LocalConnName}, &wshremote.ServerImpl{})
 	go wshremote.RunSysInfoLoop(localConnWsh, wshrpc.LocalConnName)
@@ -219,6 +227,12 @@ func main() {
 		log.Printf("error initializing wstore: %v\n", err)
 		return
 	}
+	err = wpsstore.InitEventStore()
+	if err != nil {
+		log.Printf("error initializing wps event store: %v\n", err)
+	} else {
+		wps.Broker.SetEventStore(wpsstore.EventStore)
+	}
 	migrateErr := wstore.TryMigrateOldHistory()
 	if migrateErr != nil {
 		log.Printf("error migrating old history: %v\n", migrateErr)
@@ -251,11 +265,16 @@ func main() {
 	go stdinReadWatch()
 	go telemetryLoop()
 	configWatcher()
+	wpswebhook.StartWebhookBridge()
 	webListener, err := web.MakeTCPListener("web")
 	if err != nil {
 		log.Printf("error creating web listener: %v\n", err)
 		return
 	}
+	err = web.WriteGatewayDiscoveryFile(webListener.Addr())
+	if err != nil {
+		log.Printf("error writing gateway discovery file: %v\n", err)
+	}
 	wsListener, err := web.MakeTCPListener("websocket")
 	if err != nil {
 		log.Printf("error creating websocket listener: %v\n", err)
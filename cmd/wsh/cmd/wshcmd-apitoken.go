@@ -0,0 +1,96 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var apiTokenCaps []string
+
+var apiTokenCmd = &cobra.Command{
+	Use:   "apitoken [create|list|delete]",
+	Short: "manage api tokens for the local rpc gateway",
+}
+
+var apiTokenCreateCmd = &cobra.Command{
+	Use:     "create name",
+	Short:   "create an api token (the token is only printed once)",
+	Args:    cobra.ExactArgs(1),
+	RunE:    apiTokenCreateRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var apiTokenListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "list api tokens",
+	Args:    cobra.NoArgs,
+	RunE:    apiTokenListRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var apiTokenDeleteCmd = &cobra.Command{
+	Use:     "delete tokenid",
+	Short:   "delete an api token (open gateway sessions using it are closed)",
+	Args:    cobra.ExactArgs(1),
+	RunE:    apiTokenDeleteRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	apiTokenCreateCmd.Flags().StringArrayVarP(&apiTokenCaps, "cap", "c", nil, "token capability (can be repeated, defaults to read and events)")
+	apiTokenCmd.AddCommand(apiTokenCreateCmd)
+	apiTokenCmd.AddCommand(apiTokenListCmd)
+	apiTokenCmd.AddCommand(apiTokenDeleteCmd)
+	rootCmd.AddCommand(apiTokenCmd)
+}
+
+func apiTokenCreateRun(cmd *cobra.Command, args []string) error {
+	data := wshrpc.CommandApiTokenCreateData{Name: args[0], Caps: apiTokenCaps}
+	rtn, err := wshclient.ApiTokenCreateCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("creating api token: %w", err)
+	}
+	WriteStdout("created api token %q (%s), caps: %s\n", rtn.TokenInfo.Name, rtn.TokenInfo.TokenId, strings.Join(rtn.TokenInfo.Caps, ","))
+	WriteStdout("%s\n", rtn.Token)
+	return nil
+}
+
+func formatApiTokenTs(ts int64) string {
+	if ts == 0 {
+		return "never"
+	}
+	return time.UnixMilli(ts).Format("2006-01-02 15:04")
+}
+
+func apiTokenListRun(cmd *cobra.Command, args []string) error {
+	tokens, err := wshclient.ApiTokenListCommand(RpcClient, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("listing api tokens: %w", err)
+	}
+	if len(tokens) == 0 {
+		WriteStdout("no api tokens\n")
+		return nil
+	}
+	WriteStdout("%-36s %-20s %-16s %-16s %s\n", "tokenid", "name", "created", "lastused", "caps")
+	for _, token := range tokens {
+		WriteStdout("%-36s %-20s %-16s %-16s %s\n", token.TokenId, token.Name, formatApiTokenTs(token.CreatedTs), formatApiTokenTs(token.LastUsedTs), strings.Join(token.Caps, ","))
+	}
+	return nil
+}
+
+func apiTokenDeleteRun(cmd *cobra.Command, args []string) error {
+	err := wshclient.ApiTokenDeleteCommand(RpcClient, args[0], &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("deleting api token: %w", err)
+	}
+	WriteStdout("deleted api token %s\n", args[0])
+	return nil
+}
@@ -13,7 +13,7 @@ import (
 )
 
 var connCmd = &cobra.Command{
-	Use:     "conn [status|reinstall|disconnect|connect|ensure] [connection-name]",
+	Use:     "conn [status|reinstall|disconnect|connect|ensure|forward] [connection-name]",
 	Short:   "implements connection commands",
 	Args:    cobra.RangeArgs(1, 2),
 	RunE:    connRun,
@@ -40,6 +40,12 @@ func connStatus() error {
 		if conn.Error != "" {
 			str += fmt.Sprintf(" (%s)", conn.Error)
 		}
+		if conn.Reconnecting {
+			str += fmt.Sprintf(" reconnecting:%d/%d", conn.ReconnectAttempt, conn.ReconnectMaxAttempts)
+		}
+		if len(conn.Forwards) > 0 {
+			str += fmt.Sprintf(" forwards:%d", len(conn.Forwards))
+		}
 		str += "\n"
 		WriteStdout("%s\n", str)
 	}
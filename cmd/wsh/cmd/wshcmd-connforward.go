@@ -0,0 +1,147 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/remote"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var connForwardLocal string
+var connForwardRemote string
+var connForwardDynamic string
+
+var connForwardCmd = &cobra.Command{
+	Use:   "forward [list|add|remove]",
+	Short: "manage port forwards for a connection",
+}
+
+var connForwardListCmd = &cobra.Command{
+	Use:     "list connection-name",
+	Short:   "list the port forwards of a connection",
+	Args:    cobra.ExactArgs(1),
+	RunE:    connForwardListRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connForwardAddCmd = &cobra.Command{
+	Use:     "add connection-name (-L [bind_address:]port:host:hostport | -R [bind_address:]port:host:hostport | -D [bind_address:]port)",
+	Short:   "add a port forward to a connection (started now if connected, otherwise on connect)",
+	Args:    cobra.ExactArgs(1),
+	RunE:    connForwardAddRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var connForwardRemoveCmd = &cobra.Command{
+	Use:     "remove connection-name forwardid",
+	Short:   "stop and remove a port forward",
+	Args:    cobra.ExactArgs(2),
+	RunE:    connForwardRemoveRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	connForwardAddCmd.Flags().StringVarP(&connForwardLocal, "local", "L", "", "local forward, listens here and connects from the remote host")
+	connForwardAddCmd.Flags().StringVarP(&connForwardRemote, "remote", "R", "", "remote forward, listens on the remote host and connects from here")
+	connForwardAddCmd.Flags().StringVarP(&connForwardDynamic, "dynamic", "D", "", "dynamic forward, a socks5 proxy listening here")
+	connForwardAddCmd.MarkFlagsOneRequired("local", "remote", "dynamic")
+	connForwardAddCmd.MarkFlagsMutuallyExclusive("local", "remote", "dynamic")
+	connForwardCmd.AddCommand(connForwardListCmd)
+	connForwardCmd.AddCommand(connForwardAddCmd)
+	connForwardCmd.AddCommand(connForwardRemoveCmd)
+	connCmd.AddCommand(connForwardCmd)
+}
+
+func validateForwardConnName(connName string) error {
+	_, err := remote.ParseOpts(connName)
+	if err != nil {
+		return fmt.Errorf("cannot parse connection name: %w", err)
+	}
+	return nil
+}
+
+func formatConnForward(fwd wshrpc.ConnForward) string {
+	target := fwd.Spec.TargetAddr
+	if fwd.Spec.Type == wshrpc.ConnForwardType_Dynamic {
+		target = "(socks5)"
+	}
+	status := fwd.Status
+	if fwd.Error != "" {
+		status += fmt.Sprintf(" (%s)", fwd.Error)
+	} else if fwd.Status == wshrpc.ConnForwardStatus_Active {
+		status += fmt.Sprintf(" conns:%d", fwd.ActiveConns)
+	}
+	var source string
+	if fwd.FromConfig {
+		source = "config"
+	}
+	return fmt.Sprintf("%-10s %-8s %-24s %-24s %-7s %s", fwd.ForwardId, fwd.Spec.Type, fwd.Spec.ListenAddr, target, source, status)
+}
+
+func connForwardListRun(cmd *cobra.Command, args []string) error {
+	connName := args[0]
+	err := validateForwardConnName(connName)
+	if err != nil {
+		return err
+	}
+	forwards, err := wshclient.ConnForwardListCommand(RpcClient, connName, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("listing forwards: %w", err)
+	}
+	if len(forwards) == 0 {
+		WriteStdout("no forwards on %q\n", connName)
+		return nil
+	}
+	WriteStdout("%-10s %-8s %-24s %-24s %-7s %s\n", "id", "type", "listen", "target", "source", "status")
+	for _, fwd := range forwards {
+		WriteStdout("%s\n", formatConnForward(fwd))
+	}
+	return nil
+}
+
+func connForwardAddRun(cmd *cobra.Command, args []string) error {
+	connName := args[0]
+	err := validateForwardConnName(connName)
+	if err != nil {
+		return err
+	}
+	var spec *wshrpc.ConnForwardSpec
+	if connForwardLocal != "" {
+		spec, err = remote.ParseForwardArg(wshrpc.ConnForwardType_Local, connForwardLocal)
+	} else if connForwardRemote != "" {
+		spec, err = remote.ParseForwardArg(wshrpc.ConnForwardType_Remote, connForwardRemote)
+	} else {
+		spec, err = remote.ParseForwardArg(wshrpc.ConnForwardType_Dynamic, connForwardDynamic)
+	}
+	if err != nil {
+		return err
+	}
+	data := wshrpc.CommandConnForwardAddData{ConnName: connName, Spec: *spec}
+	fwd, err := wshclient.ConnForwardAddCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 30000})
+	if err != nil {
+		return fmt.Errorf("adding forward: %w", err)
+	}
+	WriteStdout("added forward on %q\n", connName)
+	WriteStdout("%s\n", formatConnForward(*fwd))
+	return nil
+}
+
+func connForwardRemoveRun(cmd *cobra.Command, args []string) error {
+	connName := args[0]
+	err := validateForwardConnName(connName)
+	if err != nil {
+		return err
+	}
+	data := wshrpc.CommandConnForwardRemoveData{ConnName: connName, ForwardId: args[1]}
+	err = wshclient.ConnForwardRemoveCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 10000})
+	if err != nil {
+		return fmt.Errorf("removing forward: %w", err)
+	}
+	WriteStdout("removed forward %s from %q\n", args[1], connName)
+	return nil
+}
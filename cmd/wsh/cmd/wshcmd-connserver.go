@@ -4,29 +4,58 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshremote"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
 )
 
 var serverCmd = &cobra.Command{
-	Use:     "connserver",
-	Hidden:  true,
-	Short:   "remote server to power wave blocks",
-	Args:    cobra.NoArgs,
-	Run:     serverRun,
-	PreRunE: preRunSetupRpcClient,
+	Use:    "connserver",
+	Hidden: true,
+	Short:  "remote server to power wave blocks",
+	Args:   cobra.NoArgs,
+	RunE:   serverRun,
 }
 
 func init() {
 	rootCmd.AddCommand(serverCmd)
 }
 
-func serverRun(cmd *cobra.Command, args []string) {
+// the connserver runs a sub-router (see wshutil/wshsubrouter.go).  its own rpc client is a local route,
+// and wsh clients on nested hosts can connect to the sub-router socket (see wsh sshnested).
+func serverRun(cmd *cobra.Command, args []string) error {
+	jwtToken := os.Getenv(wshutil.WaveJwtTokenVarName)
+	if jwtToken == "" {
+		return fmt.Errorf("no %s set", wshutil.WaveJwtTokenVarName)
+	}
+	rpcCtx, err := wshutil.ExtractUnverifiedRpcContext(jwtToken)
+	if err != nil {
+		return fmt.Errorf("error extracting rpc context from %s: %v", wshutil.WaveJwtTokenVarName, err)
+	}
+	RpcContext = *rpcCtx
+	sockName, err := wshutil.ExtractUnverifiedSocketName(jwtToken)
+	if err != nil {
+		return fmt.Errorf("error extracting socket name from %s: %v", wshutil.WaveJwtTokenVarName, err)
+	}
+	upstreamDoneCh, err := wshutil.DefaultRouter.ConnectUpstream(sockName, jwtToken)
+	if err != nil {
+		return err
+	}
+	RpcClient = wshutil.MakeWshRpc(nil, nil, RpcContext, &wshremote.ServerImpl{LogWriter: os.Stdout})
+	wshutil.DefaultRouter.RegisterRoute(wshutil.MakeConnectionRouteId(RpcContext.Conn), RpcClient)
+	subRouterSockName := wshutil.MakeSubRouterSockName(sockName)
+	listener, err := wshutil.RunSubRouterListener(subRouterSockName)
+	if err != nil {
+		// nested connections won't work, but the connserver itself is fine
+		WriteStderr("[error] %v\n", err)
+	} else {
+		defer listener.Close()
+	}
 	WriteStdout("running wsh connserver (%s)\n", RpcContext.Conn)
 	go wshremote.RunSysInfoLoop(RpcClient, RpcContext.Conn)
-	RpcClient.SetServerImpl(&wshremote.ServerImpl{LogWriter: os.Stdout})
-
-	select {} // run forever
+	<-upstreamDoneCh
+	return nil
 }
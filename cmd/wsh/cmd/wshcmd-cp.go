@@ -0,0 +1,235 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+var cpCmd = &cobra.Command{
+	Use:   "cp [connection:]src-file connection:path",
+	Short: "copy a file to a connection (use \"local\" for the wave host)",
+	Long: `copy a file to a connection (use "local" for the wave host).
+a plain source path is a file on this host.  with connection:path sources the file is copied
+between connections through wave (local to remote, remote to local, or remote to remote).
+a source is only treated as connection:path when wave knows the connection ("local", connections.json,
+or one that has been connected), use "./notes:2024.txt" to copy a local file whose name looks like one.`,
+	Args:    cobra.ExactArgs(2),
+	RunE:    cpRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+const cpProgressInterval = 250 * time.Millisecond
+
+var cpResume bool
+var cpNoClobber bool
+
+var connPortRe = regexp.MustCompile(`^[0-9]+:`)
+var windowsDriveRe = regexp.MustCompile(`^[A-Za-z]:[\\/]`)
+
+func init() {
+	cpCmd.Flags().BoolVar(&cpResume, "resume", false, "continue an interrupted copy between connections")
+	cpCmd.Flags().BoolVarP(&cpNoClobber, "no-clobber", "n", false, "do not overwrite an existing file (copies between connections)")
+	rootCmd.AddCommand(cpCmd)
+}
+
+// parses "connection:path" (the connection can have a port, "user@host:2222:path")
+func parseConnPath(arg string) (string, string, error) {
+	connName, filePath, found := strings.Cut(arg, ":")
+	if found && connPortRe.MatchString(filePath) {
+		port, rest, _ := strings.Cut(filePath, ":")
+		connName, filePath = connName+":"+port, rest
+	}
+	if !found || connName == "" || filePath == "" {
+		return "", "", fmt.Errorf("invalid destination %q (must be connection:path)", arg)
+	}
+	return connName, filePath, nil
+}
+
+// could the source be connection:path (the connection still has to be known, see isKnownConn)
+func looksLikeConnPathArg(arg string) bool {
+	if strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, ".") || strings.HasPrefix(arg, "~") || windowsDriveRe.MatchString(arg) {
+		return false
+	}
+	_, _, err := parseConnPath(arg)
+	return err == nil
+}
+
+// sources are files on this host unless they are connection:path with a known connection
+// (so local files like "notes:2024.txt" are not mistaken for remote paths)
+func isConnPathArg(arg string, knownConns []string) bool {
+	if !looksLikeConnPathArg(arg) {
+		return false
+	}
+	connName, _, _ := parseConnPath(arg)
+	return isKnownConn(connName, knownConns)
+}
+
+func isKnownConn(connName string, knownConns []string) bool {
+	if connName == "local" {
+		return true
+	}
+	for _, known := range knownConns {
+		if known == connName {
+			return true
+		}
+	}
+	return false
+}
+
+// the connection wsh is running on, plus the connections wave knows about (connected, or from connections.json)
+func getKnownConns() ([]string, error) {
+	connList, err := wshclient.ConnListCommand(RpcClient, &wshrpc.RpcOpts{Timeout: 2000})
+	if err != nil {
+		return nil, fmt.Errorf("listing connections: %w", err)
+	}
+	if RpcContext.Conn != "" {
+		connList = append(connList, RpcContext.Conn)
+	}
+	return connList, nil
+}
+
+func cpRun(cmd *cobra.Command, args []string) error {
+	srcPath := args[0]
+	connName, destPath, err := parseConnPath(args[1])
+	if err != nil {
+		return err
+	}
+	if looksLikeConnPathArg(srcPath) {
+		knownConns, err := getKnownConns()
+		if err != nil {
+			return err
+		}
+		if isConnPathArg(srcPath, knownConns) {
+			srcConn, srcConnPath, _ := parseConnPath(srcPath)
+			return cpConnRun(srcConn, srcConnPath, connName, destPath)
+		}
+	}
+	if cpResume {
+		return fmt.Errorf("--resume is only supported for copies between connections")
+	}
+	srcFile, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	srcInfo, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+	if srcInfo.IsDir() {
+		return fmt.Errorf("%q is a directory", srcPath)
+	}
+	route := wshutil.MakeConnectionRouteId(connName)
+	destInfo, err := wshclient.RemoteFileInfoCommand(RpcClient, destPath, &wshrpc.RpcOpts{Route: route, Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("getting destination info: %w", err)
+	}
+	if destInfo.IsDir {
+		// remote paths are always unix style
+		destPath = path.Join(destPath, filepath.Base(srcPath))
+	}
+	ctx, cancelFn := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancelFn()
+	var lastProgressTs time.Time
+	progressFn := func(total int64) {
+		if time.Since(lastProgressTs) < cpProgressInterval {
+			return
+		}
+		lastProgressTs = time.Now()
+		WriteStderr("\r%d / %d bytes", total, srcInfo.Size())
+	}
+	reqCh := wshclient.ReaderToFileChunkCh(ctx, srcFile, progressFn)
+	writeData := wshrpc.CommandRemoteWriteFileStreamData{Path: destPath, Size: srcInfo.Size(), CreateMode: srcInfo.Mode().Perm()}
+	opts := &wshrpc.RpcOpts{Route: route, Timeout: wshutil.StreamTimeoutMs(srcInfo.Size())}
+	finfo, err := wshclient.RemoteWriteFileStreamCommand(RpcClient, writeData, reqCh, opts)
+	if !lastProgressTs.IsZero() {
+		WriteStderr("\n")
+	}
+	if err != nil {
+		return fmt.Errorf("copying to %s:%s: %w", connName, destPath, err)
+	}
+	WriteStdout("copied %d bytes to %s:%s\n", finfo.Size, connName, finfo.Path)
+	return nil
+}
+
+// copies between connections through wavesrv (ConnCopyFileCommand)
+func cpConnRun(srcConn string, srcPath string, destConn string, destPath string) error {
+	srcInfo, err := wshclient.RemoteFileInfoCommand(RpcClient, srcPath, &wshrpc.RpcOpts{Route: wshutil.MakeConnectionRouteId(srcConn), Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("getting source info: %w", err)
+	}
+	if srcInfo.NotFound {
+		return fmt.Errorf("%s:%s not found", srcConn, srcPath)
+	}
+	ctx, cancelFn := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancelFn()
+	copyData := wshrpc.CommandConnCopyFileData{
+		SrcConn:   srcConn,
+		SrcPath:   srcPath,
+		DestConn:  destConn,
+		DestPath:  destPath,
+		Overwrite: !cpNoClobber,
+		Resume:    cpResume,
+	}
+	opts := &wshrpc.RpcOpts{Timeout: wshutil.StreamTimeoutMs(srcInfo.Size)}
+	respCh := wshclient.ConnCopyFileCommand(RpcClient, copyData, opts)
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if opts.StreamCancelFn != nil {
+				opts.StreamCancelFn()
+			}
+		case <-doneCh:
+		}
+	}()
+	var lastProgress wshrpc.ConnCopyFileProgress
+	var shownProgress bool
+	for respUnion := range respCh {
+		if respUnion.Error != nil {
+			if shownProgress {
+				WriteStderr("\n")
+			}
+			if ctx.Err() != nil {
+				return fmt.Errorf("copy canceled (use --resume to continue it)")
+			}
+			return respUnion.Error
+		}
+		lastProgress = respUnion.Response
+		if lastProgress.Done {
+			break
+		}
+		if lastProgress.ResumedFrom > 0 && !shownProgress {
+			WriteStderr("resuming at %d bytes\n", lastProgress.ResumedFrom)
+		}
+		shownProgress = true
+		WriteStderr("\r%d / %d bytes", lastProgress.Copied, lastProgress.Size)
+	}
+	if shownProgress {
+		WriteStderr("\n")
+	}
+	if !lastProgress.Done {
+		if ctx.Err() != nil {
+			return fmt.Errorf("copy canceled (use --resume to continue it)")
+		}
+		return fmt.Errorf("copy did not complete")
+	}
+	WriteStdout("copied %d bytes to %s:%s\n", lastProgress.Size, destConn, lastProgress.FileInfo.Path)
+	return nil
+}
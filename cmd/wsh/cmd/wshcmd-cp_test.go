@@ -0,0 +1,30 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import "testing"
+
+func TestIsConnPathArg(t *testing.T) {
+	knownConns := []string{"user@host", "user@host:2222"}
+	tests := []struct {
+		arg  string
+		want bool
+	}{
+		{"user@host:/tmp/x", true},
+		{"user@host:2222:/tmp/x", true},
+		{"local:/tmp/x", true},
+		{"notes:2024.txt", false},
+		{"a:b", false},
+		{"other@host:/tmp/x", false},
+		{"./user@host:/tmp/x", false},
+		{"/tmp/user@host:x", false},
+		{"C:\\tmp\\x", false},
+		{"notes.txt", false},
+	}
+	for _, tc := range tests {
+		if got := isConnPathArg(tc.arg, knownConns); got != tc.want {
+			t.Errorf("isConnPathArg(%q) = %v, want %v", tc.arg, got, tc.want)
+		}
+	}
+}
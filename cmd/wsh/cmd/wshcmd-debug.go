@@ -0,0 +1,99 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var debugRpcStatsReset bool
+var debugRpcStatsJson bool
+var debugRpcTraceFile string
+
+var debugCmd = &cobra.Command{
+	Use:   "debug [rpcstats|rpctrace]",
+	Short: "debugging commands",
+}
+
+var debugRpcStatsCmd = &cobra.Command{
+	Use:     "rpcstats",
+	Short:   "show per-command rpc stats (counts, errors, latency) from the wave router",
+	Args:    cobra.NoArgs,
+	RunE:    debugRpcStatsRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var debugRpcTraceCmd = &cobra.Command{
+	Use:     "rpctrace [on|off]",
+	Short:   "start or stop writing an rpc trace file (jsonl)",
+	Args:    cobra.ExactArgs(1),
+	RunE:    debugRpcTraceRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	debugRpcStatsCmd.Flags().BoolVar(&debugRpcStatsReset, "reset", false, "reset the stats after printing them")
+	debugRpcStatsCmd.Flags().BoolVar(&debugRpcStatsJson, "json", false, "print the stats as json")
+	debugRpcTraceCmd.Flags().StringVarP(&debugRpcTraceFile, "file", "f", "", "trace file name (written to the rpctrace dir in the wave home dir, defaults to a new file)")
+	debugCmd.AddCommand(debugRpcStatsCmd)
+	debugCmd.AddCommand(debugRpcTraceCmd)
+	rootCmd.AddCommand(debugCmd)
+}
+
+func debugRpcStatsRun(cmd *cobra.Command, args []string) error {
+	stats, err := wshclient.RpcStatsCommand(RpcClient, wshrpc.CommandRpcStatsData{Reset: debugRpcStatsReset}, &wshrpc.RpcOpts{Timeout: 2000})
+	if err != nil {
+		return fmt.Errorf("getting rpc stats: %w", err)
+	}
+	if debugRpcStatsJson {
+		barr, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return fmt.Errorf("formatting rpc stats: %w", err)
+		}
+		WriteStdout("%s\n", barr)
+		return nil
+	}
+	if len(stats) == 0 {
+		WriteStdout("no rpc stats\n")
+		return nil
+	}
+	WriteStdout("%-24s %8s %7s %7s %8s %8s %8s %8s %10s %10s\n", "command", "count", "errors", "pending", "avg(ms)", "p50(ms)", "p95(ms)", "max(ms)", "req(kb)", "resp(kb)")
+	for _, s := range stats {
+		var avgMs int64
+		if numTimed := s.Count - s.NoResponse - s.Pending; numTimed > 0 {
+			avgMs = s.TotalMs / numTimed
+		}
+		WriteStdout("%-24s %8d %7d %7d %8d %8d %8d %8d %10.1f %10.1f\n", s.Command, s.Count, s.Errors, s.Pending, avgMs, s.P50Ms, s.P95Ms, s.MaxMs, float64(s.ReqBytes)/1024, float64(s.RespBytes)/1024)
+	}
+	return nil
+}
+
+func debugRpcTraceRun(cmd *cobra.Command, args []string) error {
+	var data wshrpc.CommandRpcTraceData
+	switch args[0] {
+	case "on":
+		data = wshrpc.CommandRpcTraceData{Enabled: true}
+		// the file is written by wavesrv (not wsh), always in the rpctrace dir
+		data.FileName = debugRpcTraceFile
+	case "off":
+		data = wshrpc.CommandRpcTraceData{Enabled: false}
+	default:
+		return fmt.Errorf("invalid argument %q (must be on or off)", args[0])
+	}
+	fileName, err := wshclient.RpcTraceCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 2000})
+	if err != nil {
+		return fmt.Errorf("setting rpc trace: %w", err)
+	}
+	if fileName != "" {
+		WriteStdout("writing rpc trace to %s\n", fileName)
+	} else {
+		WriteStdout("rpc trace stopped\n")
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+)
+
+var eventScopes []string
+var eventHistoryScope string
+var eventData string
+var eventPersist int
+var eventJson bool
+var eventFilter string
+var eventSince int64
+var eventCount int
+var eventMaxItems int
+var eventRetentionScope string
+var eventRetentionMax int
+var eventRetentionMaxAge time.Duration
+
+var eventCmd = &cobra.Command{
+	Use:   "event [pub|sub|history|retention]",
+	Short: "publish, subscribe to, and read the history of wave events",
+}
+
+var eventPubCmd = &cobra.Command{
+	Use:     "pub eventname",
+	Short:   "publish an event",
+	Args:    cobra.ExactArgs(1),
+	RunE:    eventPubRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var eventSubCmd = &cobra.Command{
+	Use:     "sub eventname",
+	Short:   "subscribe to an event (prints events to stdout until interrupted)",
+	Args:    cobra.ExactArgs(1),
+	RunE:    eventSubRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var eventHistoryCmd = &cobra.Command{
+	Use:     "history eventname",
+	Short:   "print the persisted history of an event (oldest first)",
+	Args:    cobra.ExactArgs(1),
+	RunE:    eventHistoryRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var eventRetentionCmd = &cobra.Command{
+	Use:     "retention [eventname]",
+	Short:   "list durable event history settings, or set them for an event (--max 0 removes the setting)",
+	Args:    cobra.MaximumNArgs(1),
+	RunE:    eventRetentionRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	eventPubCmd.Flags().StringArrayVarP(&eventScopes, "scope", "s", nil, "event scope (can be repeated)")
+	eventPubCmd.Flags().StringVarP(&eventData, "data", "d", "", "event data (json)")
+	eventPubCmd.Flags().IntVar(&eventPersist, "persist", 0, "number of events to keep in the event's history")
+	eventSubCmd.Flags().StringArrayVarP(&eventScopes, "scope", "s", nil, "only receive events with this scope (can be repeated, supports * and **)")
+	eventSubCmd.Flags().BoolVar(&eventJson, "json", false, "print events as json (one per line)")
+	eventSubCmd.Flags().StringVarP(&eventFilter, "filter", "f", "", "data filter (e.g. \"status == done\")")
+	eventSubCmd.Flags().Int64Var(&eventSince, "since", 0, "replay persisted events after this seq before receiving live events")
+	eventSubCmd.Flags().IntVarP(&eventCount, "count", "n", 0, "exit after receiving this many events")
+	eventHistoryCmd.Flags().StringVarP(&eventHistoryScope, "scope", "s", "", "event scope")
+	eventHistoryCmd.Flags().IntVarP(&eventMaxItems, "max", "m", 20, "maximum number of events to print")
+	eventHistoryCmd.Flags().BoolVar(&eventJson, "json", false, "print events as json (one per line)")
+	eventRetentionCmd.Flags().StringVarP(&eventRetentionScope, "scope", "s", "", "event scope (default is all scopes of the event)")
+	eventRetentionCmd.Flags().IntVarP(&eventRetentionMax, "max", "m", 0, "number of events to keep (0 removes the setting and the stored events)")
+	eventRetentionCmd.Flags().DurationVar(&eventRetentionMaxAge, "maxage", 0, "drop stored events older than this (e.g. 24h)")
+	eventCmd.AddCommand(eventPubCmd)
+	eventCmd.AddCommand(eventSubCmd)
+	eventCmd.AddCommand(eventHistoryCmd)
+	eventCmd.AddCommand(eventRetentionCmd)
+	rootCmd.AddCommand(eventCmd)
+}
+
+func eventPubRun(cmd *cobra.Command, args []string) error {
+	event := wps.WaveEvent{
+		Event:   args[0],
+		Scopes:  eventScopes,
+		Persist: eventPersist,
+	}
+	if eventData != "" {
+		var data any
+		err := json.Unmarshal([]byte(eventData), &data)
+		if err != nil {
+			return fmt.Errorf("invalid json data: %w", err)
+		}
+		event.Data = data
+	}
+	err := wshclient.EventPublishCommand(RpcClient, event, &wshrpc.RpcOpts{Timeout: 2000})
+	if err != nil {
+		return fmt.Errorf("publishing event: %w", err)
+	}
+	return nil
+}
+
+func eventSubRun(cmd *cobra.Command, args []string) error {
+	eventName := args[0]
+	eventCh := make(chan *wps.WaveEvent, 100)
+	RpcClient.EventListener.On(eventName, func(event *wps.WaveEvent) {
+		eventCh <- event
+	})
+	subReq := wps.SubscriptionRequest{
+		Event:     eventName,
+		Scopes:    eventScopes,
+		AllScopes: len(eventScopes) == 0,
+		Since:     eventSince,
+		Filter:    eventFilter,
+	}
+	err := wshclient.EventSubCommand(RpcClient, subReq, &wshrpc.RpcOpts{Timeout: 2000})
+	if err != nil {
+		return fmt.Errorf("subscribing to event: %w", err)
+	}
+	var numEvents int
+	for {
+		select {
+		case event := <-eventCh:
+			err = printEvent(event)
+			if err != nil {
+				return err
+			}
+			numEvents++
+			if eventCount > 0 && numEvents >= eventCount {
+				return nil
+			}
+		case <-RpcClient.DisconnectCh:
+			// nil in terminal mode (blocks forever), closed when the domain socket connection drops
+			return fmt.Errorf("connection to wave closed")
+		}
+	}
+}
+
+func eventHistoryRun(cmd *cobra.Command, args []string) error {
+	data := wshrpc.CommandEventReadHistoryData{
+		Event:    args[0],
+		Scope:    eventHistoryScope,
+		MaxItems: eventMaxItems,
+	}
+	events, err := wshclient.EventReadHistoryCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("reading event history: %w", err)
+	}
+	for _, event := range events {
+		err = printEvent(event)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func eventRetentionRun(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		retentions, err := wshclient.EventRetentionListCommand(RpcClient, &wshrpc.RpcOpts{Timeout: 2000})
+		if err != nil {
+			return fmt.Errorf("listing event retention: %w", err)
+		}
+		for _, r := range retentions {
+			scope := r.Scope
+			if scope == "" {
+				scope = "*"
+			}
+			maxAge := "-"
+			if r.MaxAgeMs > 0 {
+				maxAge = (time.Duration(r.MaxAgeMs) * time.Millisecond).String()
+			}
+			WriteStdout("%-30s %-30s max:%-8d maxage:%s\n", r.Event, scope, r.MaxItems, maxAge)
+		}
+		return nil
+	}
+	if !cmd.Flags().Changed("max") {
+		return fmt.Errorf("--max is required to set the retention for %s", args[0])
+	}
+	if eventRetentionMaxAge < 0 {
+		return fmt.Errorf("--maxage must not be negative")
+	}
+	data := wshrpc.EventRetention{
+		Event:    args[0],
+		Scope:    eventRetentionScope,
+		MaxItems: eventRetentionMax,
+		MaxAgeMs: eventRetentionMaxAge.Milliseconds(),
+	}
+	err := wshclient.EventRetentionSetCommand(RpcClient, data, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("setting event retention: %w", err)
+	}
+	return nil
+}
+
+func printEvent(event *wps.WaveEvent) error {
+	if eventJson {
+		barr, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("formatting event: %w", err)
+		}
+		WriteStdout("%s\n", barr)
+		return nil
+	}
+	var dataStr string
+	if event.Data != nil {
+		barr, err := json.Marshal(event.Data)
+		if err != nil {
+			return fmt.Errorf("formatting event data: %w", err)
+		}
+		dataStr = string(barr)
+	}
+	WriteStdout("#%d %s [%s] %s\n", event.Seq, event.Event, strings.Join(event.Scopes, ","), dataStr)
+	return nil
+}
@@ -4,8 +4,6 @@
 package cmd
 
 import (
-	"encoding/base64"
-
 	"github.com/spf13/cobra"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
@@ -39,15 +37,10 @@ func runReadFile(cmd *cobra.Command, args []string) {
 		WriteStderr("error resolving oref: %v\n", err)
 		return
 	}
-	resp64, err := wshclient.FileReadCommand(RpcClient, wshrpc.CommandFileData{ZoneId: fullORef.OID, FileName: args[1]}, &wshrpc.RpcOpts{Timeout: 5000})
+	resp, err := wshclient.FileReadCommand(RpcClient, wshrpc.CommandFileData{ZoneId: fullORef.OID, FileName: args[1]}, &wshrpc.RpcOpts{Timeout: 5000})
 	if err != nil {
 		WriteStderr("[error] reading file: %v\n", err)
 		return
 	}
-	resp, err := base64.StdEncoding.DecodeString(resp64)
-	if err != nil {
-		WriteStderr("[error] decoding file: %v\n", err)
-		return
-	}
 	WriteStdout(string(resp))
 }
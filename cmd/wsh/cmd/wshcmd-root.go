@@ -6,6 +6,7 @@ package cmd
 import (
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"regexp"
 	"runtime/debug"
@@ -88,6 +89,19 @@ func setupRpcClient(serverImpl wshutil.ServerImpl) error {
 	if err != nil {
 		return fmt.Errorf("error extracting socket name from %s: %v", wshutil.WaveJwtTokenVarName, err)
 	}
+	if wshutil.IsUnverifiedTokenExpired(jwtToken) {
+		jwtToken, err = refreshExpiredToken(sockName, jwtToken)
+		if err != nil {
+			return fmt.Errorf("error refreshing expired %s (restart the shell to get a new token): %v", wshutil.WaveJwtTokenVarName, err)
+		}
+		// commands started from here (and "wsh token refresh") see the new token
+		os.Setenv(wshutil.WaveJwtTokenVarName, jwtToken)
+		rpcCtx, err = wshutil.ExtractUnverifiedRpcContext(jwtToken)
+		if err != nil {
+			return fmt.Errorf("error extracting rpc context from %s: %v", wshutil.WaveJwtTokenVarName, err)
+		}
+		RpcContext = *rpcCtx
+	}
 	RpcClient, err = wshutil.SetupDomainSocketRpcClient(sockName, serverImpl)
 	if err != nil {
 		return fmt.Errorf("error setting up domain socket rpc client: %v", err)
@@ -97,6 +111,21 @@ func setupRpcClient(serverImpl wshutil.ServerImpl) error {
 	return nil
 }
 
+// an expired token only authenticates a session that can refresh it (wavesrv allows this for a while after it expires)
+func refreshExpiredToken(sockName string, jwtToken string) (string, error) {
+	conn, err := net.Dial("unix", sockName)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to Unix domain socket: %w", err)
+	}
+	defer conn.Close()
+	client, _, err := wshutil.SetupConnRpcClient(conn, nil)
+	if err != nil {
+		return "", err
+	}
+	wshclient.AuthenticateCommand(client, jwtToken, &wshrpc.RpcOpts{NoResponse: true})
+	return wshclient.AuthRefreshCommand(client, jwtToken, &wshrpc.RpcOpts{Timeout: 5000})
+}
+
 func setTermHtmlMode() {
 	wshutil.SetExtraShutdownFunc(extraShutdownFn)
 	cmd := &wshrpc.CommandSetMetaData{
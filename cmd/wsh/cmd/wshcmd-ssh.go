@@ -4,14 +4,19 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/remote"
 	"github.com/wavetermdev/waveterm/pkg/waveobj"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
 )
 
+var sshProxyJump string
+
 var sshCmd = &cobra.Command{
-	Use:     "ssh",
+	Use:     "ssh [-J jumphost[,jumphost...]] [user@]host[:port]",
 	Short:   "connect this terminal to a remote host",
 	Args:    cobra.ExactArgs(1),
 	Run:     sshRun,
@@ -19,11 +24,21 @@ var sshCmd = &cobra.Command{
 }
 
 func init() {
+	sshCmd.Flags().StringVarP(&sshProxyJump, "jump", "J", "", "connect through jump hosts (same as ProxyJump in ssh config, \"none\" ignores the ProxyJump from ssh config)")
 	rootCmd.AddCommand(sshCmd)
 }
 
 func sshRun(cmd *cobra.Command, args []string) {
 	sshArg := args[0]
+	if sshProxyJump != "" {
+		sshArg = fmt.Sprintf("-J %s %s", sshProxyJump, sshArg)
+	}
+	opts, err := remote.ParseOpts(sshArg)
+	if err != nil {
+		WriteStderr("[error] %v\n", err)
+		return
+	}
+	sshArg = opts.String()
 	blockId := RpcContext.BlockId
 	if blockId == "" {
 		WriteStderr("[error] cannot determine blockid (not in JWT)\n")
@@ -35,7 +50,7 @@ func sshRun(cmd *cobra.Command, args []string) {
 			waveobj.MetaKey_Connection: sshArg,
 		},
 	}
-	err := wshclient.SetMetaCommand(RpcClient, data, nil)
+	err = wshclient.SetMetaCommand(RpcClient, data, nil)
 	if err != nil {
 		WriteStderr("[error] setting switching connection: %v\n", err)
 		return
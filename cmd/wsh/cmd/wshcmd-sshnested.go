@@ -0,0 +1,80 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+var sshNestedCmd = &cobra.Command{
+	Use:     "sshnested [user@]host [-- ssh-args...]",
+	Short:   "ssh to a host from this terminal, with wsh access to wave (wsh must be installed on the host)",
+	Args:    cobra.MinimumNArgs(1),
+	RunE:    sshNestedRun,
+	PreRunE: sshNestedPreRun,
+}
+
+func init() {
+	rootCmd.AddCommand(sshNestedCmd)
+}
+
+func sshNestedPreRun(cmd *cobra.Command, args []string) error {
+	if os.Getenv(wshutil.WaveJwtTokenVarName) == "" {
+		return fmt.Errorf("sshnested must be run from a wave terminal (no %s set)", wshutil.WaveJwtTokenVarName)
+	}
+	return preRunSetupRpcClient(cmd, args)
+}
+
+// the ssh session forwards a domain socket on the nested host to the router for this terminal's connection
+// (wavesrv for local terminals, the connserver's sub-router for remote ones).  it starts a connserver on the
+// nested host (so wave can read its files) and a login shell with a WAVETERM_JWT for the nested connection.
+func sshNestedRun(cmd *cobra.Command, args []string) error {
+	host := args[0]
+	sockName, err := wshutil.ExtractUnverifiedSocketName(os.Getenv(wshutil.WaveJwtTokenVarName))
+	if err != nil {
+		return fmt.Errorf("error extracting socket name from %s: %v", wshutil.WaveJwtTokenVarName, err)
+	}
+	routerSockName := sockName
+	if RpcContext.Conn != "" {
+		routerSockName = wshutil.MakeSubRouterSockName(sockName)
+	}
+	if _, err := os.Stat(routerSockName); err != nil {
+		return fmt.Errorf("cannot find the wave router socket %q (is the connserver running?): %w", routerSockName, err)
+	}
+	randStr, err := utilfn.RandomHexString(16)
+	if err != nil {
+		return fmt.Errorf("error generating random string: %w", err)
+	}
+	remoteSockName := fmt.Sprintf("/tmp/waveterm-%s.sock", randStr)
+	tokens, err := wshclient.ConnNestedTokensCommand(RpcClient, wshrpc.CommandConnNestedTokensData{Host: host, SockName: remoteSockName}, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("getting nested connection tokens: %w", err)
+	}
+	remoteCmd := fmt.Sprintf(`wshpath="$HOME/.waveterm/bin/wsh"; `+
+		`if [ -x "$wshpath" ]; then %s="%s" "$wshpath" connserver </dev/null >/dev/null 2>&1 & `+
+		`else echo "wsh is not installed on this host, wave integration is disabled" >&2; fi; `+
+		`PATH="$HOME/.waveterm/bin:$PATH" %s="%s" exec "${SHELL:-/bin/sh}" -l`,
+		wshutil.WaveJwtTokenVarName, tokens.ConnServerToken, wshutil.WaveJwtTokenVarName, tokens.ShellToken)
+	sshArgs := []string{"-t", "-o", "StreamLocalBindUnlink=yes", "-R", remoteSockName + ":" + routerSockName}
+	sshArgs = append(sshArgs, args[1:]...)
+	sshArgs = append(sshArgs, host, remoteCmd)
+	sshCmd := exec.Command("ssh", sshArgs...)
+	sshCmd.Stdin = os.Stdin
+	sshCmd.Stdout = os.Stdout
+	sshCmd.Stderr = os.Stderr
+	WriteStderr("connecting to %q (wave connection %q)\n", host, tokens.Conn)
+	err = sshCmd.Run()
+	if err != nil {
+		return fmt.Errorf("ssh: %w", err)
+	}
+	return nil
+}
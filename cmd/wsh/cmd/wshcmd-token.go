@@ -0,0 +1,48 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+var tokenCmd = &cobra.Command{
+	Use:   "token [refresh]",
+	Short: "manage this terminal's wave token (WAVETERM_JWT)",
+}
+
+var tokenRefreshCmd = &cobra.Command{
+	Use:     "refresh",
+	Short:   "print a new token for this terminal (the shell integration runs this from the prompt)",
+	Args:    cobra.NoArgs,
+	RunE:    tokenRefreshRun,
+	PreRunE: tokenRefreshPreRun,
+}
+
+func init() {
+	tokenCmd.AddCommand(tokenRefreshCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
+
+func tokenRefreshPreRun(cmd *cobra.Command, args []string) error {
+	if os.Getenv(wshutil.WaveJwtTokenVarName) == "" {
+		return fmt.Errorf("token refresh must be run from a wave terminal (no %s set)", wshutil.WaveJwtTokenVarName)
+	}
+	return preRunSetupRpcClient(cmd, args)
+}
+
+func tokenRefreshRun(cmd *cobra.Command, args []string) error {
+	newToken, err := wshclient.AuthRefreshCommand(RpcClient, os.Getenv(wshutil.WaveJwtTokenVarName), &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("refreshing token: %w", err)
+	}
+	WriteStdout("%s\n", newToken)
+	return nil
+}
@@ -0,0 +1,11 @@
+CREATE TABLE db_file_version (
+    zoneid varchar(36) NOT NULL,
+    name varchar(200) NOT NULL,
+    version int NOT NULL,
+    size bigint NOT NULL,
+    modts bigint NOT NULL,
+    createdts bigint NOT NULL,
+    meta json NOT NULL,
+    data blob NOT NULL,
+    PRIMARY KEY (zoneid, name, version)
+);
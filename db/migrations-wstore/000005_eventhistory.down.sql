@@ -0,0 +1,3 @@
+DROP TABLE db_event_history;
+
+DROP TABLE db_event_retention;
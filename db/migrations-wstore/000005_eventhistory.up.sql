@@ -0,0 +1,19 @@
+CREATE TABLE db_event_history (
+    event varchar(100) NOT NULL,
+    scope varchar(300) NOT NULL,
+    seq bigint NOT NULL,
+    ts bigint NOT NULL,
+    data json NOT NULL,
+    PRIMARY KEY (event, scope, seq)
+);
+
+CREATE TABLE db_event_retention (
+    event varchar(100) NOT NULL,
+    scope varchar(300) NOT NULL,
+    maxitems int NOT NULL,
+    maxagems bigint NOT NULL,
+    PRIMARY KEY (event, scope)
+);
+
+-- keep an hour of sysinfo history (per connection) for the graph blocks
+INSERT INTO db_event_retention (event, scope, maxitems, maxagems) VALUES ('sysinfo', '', 3600, 86400000);
@@ -0,0 +1,9 @@
+-- api tokens for the local rpc gateway (see pkg/web/webgateway.go), only the sha256 of the token is stored
+CREATE TABLE db_apitoken (
+    tokenid varchar(36) PRIMARY KEY,
+    name varchar(200) NOT NULL,
+    tokenhash varchar(64) NOT NULL UNIQUE,
+    caps json NOT NULL,
+    createdts bigint NOT NULL,
+    lastusedts bigint NOT NULL DEFAULT 0
+);
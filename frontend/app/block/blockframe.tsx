@@ -317,6 +317,8 @@ const ConnStatusOverlay = React.memo(
         if (connStatus.status == "connecting") {
             statusText = `Connecting to "${connName}"...`;
             showReconnect = false;
+        } else if (connStatus.status == "unresponsive") {
+            statusText = `Connection to "${connName}" is unresponsive`;
         }
         let reconDisplay = null;
         let reconClassName = "outlined grey";
@@ -603,7 +605,10 @@ const ChangeConnectionBlockModal = React.memo(
         if (createNew) {
             priorityItems.push(newConnectionSuggestion);
         }
-        if (showReconnect && (connStatus.status == "disconnected" || connStatus.status == "error")) {
+        if (
+            showReconnect &&
+            (connStatus.status == "disconnected" || connStatus.status == "error" || connStatus.status == "unresponsive")
+        ) {
             priorityItems.push(reconnectSuggestion);
         }
         const prioritySuggestions: SuggestionConnectionScope = {
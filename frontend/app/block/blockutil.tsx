@@ -215,7 +215,8 @@ export const ConnectionButton = React.memo(
             let showDisconnectedSlash = false;
             let connIconElem: React.ReactNode = null;
             const connColorNum = computeConnColorNum(connStatus);
-            let color = `var(--conn-icon-color-${connColorNum})`;
+            let color = connStatus?.displaycolor ?? `var(--conn-icon-color-${connColorNum})`;
+            const displayName = connStatus?.displayname ?? connection;
             const clickHandler = function () {
                 setConnModalOpen(true);
             };
@@ -250,6 +251,10 @@ export const ConnectionButton = React.memo(
                         titleText += " (" + connStatus.error + ")";
                     }
                     showDisconnectedSlash = true;
+                } else if (connStatus?.status == "unresponsive") {
+                    color = "var(--warning-color)";
+                    titleText = "Connection to " + connection + " is unresponsive";
+                    showDisconnectedSlash = true;
                 } else if (!connStatus?.connected) {
                     color = "var(--grey-text-color)";
                     titleText = "Disconnected from " + connection;
@@ -281,7 +286,7 @@ export const ConnectionButton = React.memo(
                             }}
                         />
                     </span>
-                    {isLocal ? null : <div className="connection-name">{connection}</div>}
+                    {isLocal ? null : <div className="connection-name">{displayName}</div>}
                 </div>
             );
         }
@@ -56,8 +56,18 @@ export const ClientService = new ClientServiceType();
 
 // fileservice.FileService (file)
 class FileServiceType {
-    // delete file
-    DeleteFile(connection: string, path: string): Promise<void> {
+    // change file permissions
+    ChmodFile(connection: string, path: string, mode: number): Promise<FileInfo> {
+        return WOS.callBackendService("file", "ChmodFile", Array.from(arguments))
+    }
+
+    // copy a file or directory (on the same connection)
+    CopyFile(connection: string, srcpath: string, destpath: string, overwrite: boolean, recursive: boolean): Promise<FileInfo> {
+        return WOS.callBackendService("file", "CopyFile", Array.from(arguments))
+    }
+
+    // delete file (recursive is required for non-empty directories)
+    DeleteFile(connection: string, path: string, recursive: boolean): Promise<void> {
         return WOS.callBackendService("file", "DeleteFile", Array.from(arguments))
     }
     GetFullConfig(): Promise<FullConfigType> {
@@ -67,11 +77,26 @@ class FileServiceType {
         return WOS.callBackendService("file", "GetWaveFile", Array.from(arguments))
     }
 
+    // list a directory (sorted and paged)
+    ListDir(connection: string, data: CommandRemoteListDirData): Promise<CommandRemoteListDirRtnData> {
+        return WOS.callBackendService("file", "ListDir", Array.from(arguments))
+    }
+
+    // create a directory
+    Mkdir(connection: string, path: string, parents: boolean): Promise<FileInfo> {
+        return WOS.callBackendService("file", "Mkdir", Array.from(arguments))
+    }
+
     // read file
     ReadFile(connection: string, path: string): Promise<FullFile> {
         return WOS.callBackendService("file", "ReadFile", Array.from(arguments))
     }
 
+    // rename (move) a file or directory
+    RenameFile(connection: string, srcpath: string, destpath: string, overwrite: boolean): Promise<FileInfo> {
+        return WOS.callBackendService("file", "RenameFile", Array.from(arguments))
+    }
+
     // save file
     SaveFile(connection: string, path: string, data64: string): Promise<void> {
         return WOS.callBackendService("file", "SaveFile", Array.from(arguments))
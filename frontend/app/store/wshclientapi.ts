@@ -7,11 +7,31 @@ import { WshClient } from "./wshclient";
 
 // WshServerCommandToDeclMap
 class RpcApiType {
+    // command "apitokencreate" [call]
+    ApiTokenCreateCommand(client: WshClient, data: CommandApiTokenCreateData, opts?: RpcOpts): Promise<CommandApiTokenCreateRtnData> {
+        return client.wshRpcCall("apitokencreate", data, opts);
+    }
+
+    // command "apitokendelete" [call]
+    ApiTokenDeleteCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("apitokendelete", data, opts);
+    }
+
+    // command "apitokenlist" [call]
+    ApiTokenListCommand(client: WshClient, opts?: RpcOpts): Promise<ApiTokenInfo[]> {
+        return client.wshRpcCall("apitokenlist", null, opts);
+    }
+
     // command "authenticate" [call]
     AuthenticateCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<CommandAuthenticateRtnData> {
         return client.wshRpcCall("authenticate", data, opts);
     }
 
+    // command "authrefresh" [call]
+    AuthRefreshCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<string> {
+        return client.wshRpcCall("authrefresh", data, opts);
+    }
+
     // command "blockinfo" [call]
     BlockInfoCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<BlockInfoData> {
         return client.wshRpcCall("blockinfo", data, opts);
@@ -22,6 +42,11 @@ class RpcApiType {
         return client.wshRpcCall("connconnect", data, opts);
     }
 
+    // command "conncopyfile" [responsestream]
+	ConnCopyFileCommand(client: WshClient, data: CommandConnCopyFileData, opts?: RpcOpts): AsyncGenerator<ConnCopyFileProgress, void, boolean> {
+        return client.wshRpcStream("conncopyfile", data, opts);
+    }
+
     // command "conndisconnect" [call]
     ConnDisconnectCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("conndisconnect", data, opts);
@@ -32,11 +57,31 @@ class RpcApiType {
         return client.wshRpcCall("connensure", data, opts);
     }
 
+    // command "connforwardadd" [call]
+    ConnForwardAddCommand(client: WshClient, data: CommandConnForwardAddData, opts?: RpcOpts): Promise<ConnForward> {
+        return client.wshRpcCall("connforwardadd", data, opts);
+    }
+
+    // command "connforwardlist" [call]
+    ConnForwardListCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<ConnForward[]> {
+        return client.wshRpcCall("connforwardlist", data, opts);
+    }
+
+    // command "connforwardremove" [call]
+    ConnForwardRemoveCommand(client: WshClient, data: CommandConnForwardRemoveData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("connforwardremove", data, opts);
+    }
+
     // command "connlist" [call]
     ConnListCommand(client: WshClient, opts?: RpcOpts): Promise<string[]> {
         return client.wshRpcCall("connlist", null, opts);
     }
 
+    // command "connnestedtokens" [call]
+    ConnNestedTokensCommand(client: WshClient, data: CommandConnNestedTokensData, opts?: RpcOpts): Promise<CommandConnNestedTokensRtnData> {
+        return client.wshRpcCall("connnestedtokens", data, opts);
+    }
+
     // command "connreinstallwsh" [call]
     ConnReinstallWshCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("connreinstallwsh", data, opts);
@@ -77,6 +122,11 @@ class RpcApiType {
         return client.wshRpcCall("eventpublish", data, opts);
     }
 
+    // command "eventqueuestats" [call]
+    EventQueueStatsCommand(client: WshClient, opts?: RpcOpts): Promise<EventQueueStats[]> {
+        return client.wshRpcCall("eventqueuestats", null, opts);
+    }
+
     // command "eventreadhistory" [call]
     EventReadHistoryCommand(client: WshClient, data: CommandEventReadHistoryData, opts?: RpcOpts): Promise<WaveEvent[]> {
         return client.wshRpcCall("eventreadhistory", data, opts);
@@ -87,6 +137,16 @@ class RpcApiType {
         return client.wshRpcCall("eventrecv", data, opts);
     }
 
+    // command "eventretentionlist" [call]
+    EventRetentionListCommand(client: WshClient, opts?: RpcOpts): Promise<EventRetention[]> {
+        return client.wshRpcCall("eventretentionlist", null, opts);
+    }
+
+    // command "eventretentionset" [call]
+    EventRetentionSetCommand(client: WshClient, data: EventRetention, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("eventretentionset", data, opts);
+    }
+
     // command "eventsub" [call]
     EventSubCommand(client: WshClient, data: SubscriptionRequest, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("eventsub", data, opts);
@@ -112,11 +172,26 @@ class RpcApiType {
         return client.wshRpcCall("fileappendijson", data, opts);
     }
 
+    // command "filelistversions" [call]
+    FileListVersionsCommand(client: WshClient, data: CommandFileData, opts?: RpcOpts): Promise<FileVersionInfo[]> {
+        return client.wshRpcCall("filelistversions", data, opts);
+    }
+
     // command "fileread" [call]
     FileReadCommand(client: WshClient, data: CommandFileData, opts?: RpcOpts): Promise<string> {
         return client.wshRpcCall("fileread", data, opts);
     }
 
+    // command "filereadversion" [call]
+    FileReadVersionCommand(client: WshClient, data: CommandFileVersionData, opts?: RpcOpts): Promise<string> {
+        return client.wshRpcCall("filereadversion", data, opts);
+    }
+
+    // command "filerestoreversion" [call]
+    FileRestoreVersionCommand(client: WshClient, data: CommandFileVersionData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("filerestoreversion", data, opts);
+    }
+
     // command "filewrite" [call]
     FileWriteCommand(client: WshClient, data: CommandFileData, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("filewrite", data, opts);
@@ -132,8 +207,18 @@ class RpcApiType {
         return client.wshRpcCall("message", data, opts);
     }
 
+    // command "remotefilechmod" [call]
+    RemoteFileChmodCommand(client: WshClient, data: CommandRemoteFileChmodData, opts?: RpcOpts): Promise<FileInfo> {
+        return client.wshRpcCall("remotefilechmod", data, opts);
+    }
+
+    // command "remotefilecopy" [call]
+    RemoteFileCopyCommand(client: WshClient, data: CommandRemoteFileCopyData, opts?: RpcOpts): Promise<FileInfo> {
+        return client.wshRpcCall("remotefilecopy", data, opts);
+    }
+
     // command "remotefiledelete" [call]
-    RemoteFileDeleteCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
+    RemoteFileDeleteCommand(client: WshClient, data: CommandRemoteFileDeleteData, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("remotefiledelete", data, opts);
     }
 
@@ -147,6 +232,21 @@ class RpcApiType {
         return client.wshRpcCall("remotefilejoin", data, opts);
     }
 
+    // command "remotefilerename" [call]
+    RemoteFileRenameCommand(client: WshClient, data: CommandRemoteFileRenameData, opts?: RpcOpts): Promise<FileInfo> {
+        return client.wshRpcCall("remotefilerename", data, opts);
+    }
+
+    // command "remotelistdir" [call]
+    RemoteListDirCommand(client: WshClient, data: CommandRemoteListDirData, opts?: RpcOpts): Promise<CommandRemoteListDirRtnData> {
+        return client.wshRpcCall("remotelistdir", data, opts);
+    }
+
+    // command "remotemkdir" [call]
+    RemoteMkdirCommand(client: WshClient, data: CommandRemoteMkdirData, opts?: RpcOpts): Promise<FileInfo> {
+        return client.wshRpcCall("remotemkdir", data, opts);
+    }
+
     // command "remotestreamcpudata" [responsestream]
 	RemoteStreamCpuDataCommand(client: WshClient, opts?: RpcOpts): AsyncGenerator<TimeSeriesData, void, boolean> {
         return client.wshRpcStream("remotestreamcpudata", null, opts);
@@ -172,11 +272,26 @@ class RpcApiType {
         return client.wshRpcCall("routeannounce", null, opts);
     }
 
+    // command "routeping" [call]
+    RoutePingCommand(client: WshClient, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("routeping", null, opts);
+    }
+
     // command "routeunannounce" [call]
     RouteUnannounceCommand(client: WshClient, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("routeunannounce", null, opts);
     }
 
+    // command "rpcstats" [call]
+    RpcStatsCommand(client: WshClient, data: CommandRpcStatsData, opts?: RpcOpts): Promise<RpcCommandStats[]> {
+        return client.wshRpcCall("rpcstats", data, opts);
+    }
+
+    // command "rpctrace" [call]
+    RpcTraceCommand(client: WshClient, data: CommandRpcTraceData, opts?: RpcOpts): Promise<string> {
+        return client.wshRpcCall("rpctrace", data, opts);
+    }
+
     // command "setconfig" [call]
     SetConfigCommand(client: WshClient, data: SettingsType, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("setconfig", data, opts);
@@ -456,7 +456,7 @@ function TableBody({
             menu.push({
                 label: "Delete File",
                 click: async () => {
-                    await services.FileService.DeleteFile(conn, path).catch((e) => console.log(e));
+                    await services.FileService.DeleteFile(conn, path, false).catch((e) => console.log(e));
                     setRefreshVersion((current) => current + 1);
                 },
             });
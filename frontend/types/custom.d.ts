@@ -251,7 +251,7 @@ declare global {
         viewModel: ViewModel;
     };
 
-    type ConnStatusType = "connected" | "connecting" | "disconnected" | "error" | "init";
+    type ConnStatusType = "connected" | "connecting" | "disconnected" | "error" | "init" | "unresponsive";
 
     interface SuggestionBaseItem {
         label: string;
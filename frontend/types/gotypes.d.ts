@@ -5,6 +5,15 @@
 
 declare global {
 
+    // wshrpc.ApiTokenInfo
+    type ApiTokenInfo = {
+        tokenid: string;
+        name: string;
+        caps: string[];
+        createdts: number;
+        lastusedts?: number;
+    };
+
     // waveobj.Block
     type Block = WaveObj & {
         blockdef: BlockDef;
@@ -47,6 +56,18 @@ declare global {
         historymigrated?: boolean;
     };
 
+    // wshrpc.CommandApiTokenCreateData
+    type CommandApiTokenCreateData = {
+        name: string;
+        caps?: string[];
+    };
+
+    // wshrpc.CommandApiTokenCreateRtnData
+    type CommandApiTokenCreateRtnData = {
+        tokeninfo: ApiTokenInfo;
+        token: string;
+    };
+
     // wshrpc.CommandAppendIJsonData
     type CommandAppendIJsonData = {
         zoneid: string;
@@ -73,6 +94,41 @@ declare global {
         view: string;
     };
 
+    // wshrpc.CommandConnCopyFileData
+    type CommandConnCopyFileData = {
+        srcconn: string;
+        srcpath: string;
+        destconn: string;
+        destpath: string;
+        overwrite?: boolean;
+        resume?: boolean;
+    };
+
+    // wshrpc.CommandConnForwardAddData
+    type CommandConnForwardAddData = {
+        connname: string;
+        spec: ConnForwardSpec;
+    };
+
+    // wshrpc.CommandConnForwardRemoveData
+    type CommandConnForwardRemoveData = {
+        connname: string;
+        forwardid: string;
+    };
+
+    // wshrpc.CommandConnNestedTokensData
+    type CommandConnNestedTokensData = {
+        host: string;
+        sockname: string;
+    };
+
+    // wshrpc.CommandConnNestedTokensRtnData
+    type CommandConnNestedTokensRtnData = {
+        conn: string;
+        connservertoken: string;
+        shelltoken: string;
+    };
+
     // wshrpc.CommandControllerResyncData
     type CommandControllerResyncData = {
         forcerestart?: boolean;
@@ -101,6 +157,11 @@ declare global {
         maxitems: number;
     };
 
+    // wshrpc.CommandFileChunkData
+    type CommandFileChunkData = {
+        data64?: string;
+    };
+
     // wshrpc.CommandFileData
     type CommandFileData = {
         zoneid: string;
@@ -108,6 +169,13 @@ declare global {
         data64?: string;
     };
 
+    // wshrpc.CommandFileVersionData
+    type CommandFileVersionData = {
+        zoneid: string;
+        filename: string;
+        version: number;
+    };
+
     // wshrpc.CommandGetMetaData
     type CommandGetMetaData = {
         oref: ORef;
@@ -119,6 +187,59 @@ declare global {
         message: string;
     };
 
+    // wshrpc.CommandRemoteFileChmodData
+    type CommandRemoteFileChmodData = {
+        path: string;
+        mode: number;
+    };
+
+    // wshrpc.CommandRemoteFileCopyData
+    type CommandRemoteFileCopyData = {
+        srcpath: string;
+        destpath: string;
+        overwrite?: boolean;
+        recursive?: boolean;
+    };
+
+    // wshrpc.CommandRemoteFileDeleteData
+    type CommandRemoteFileDeleteData = {
+        path: string;
+        recursive?: boolean;
+    };
+
+    // wshrpc.CommandRemoteFileRenameData
+    type CommandRemoteFileRenameData = {
+        srcpath: string;
+        destpath: string;
+        overwrite?: boolean;
+    };
+
+    // wshrpc.CommandRemoteListDirData
+    type CommandRemoteListDirData = {
+        path: string;
+        offset?: number;
+        limit?: number;
+        sortby?: string;
+        sortdesc?: boolean;
+        dirsfirst?: boolean;
+        nohidden?: boolean;
+    };
+
+    // wshrpc.CommandRemoteListDirRtnData
+    type CommandRemoteListDirRtnData = {
+        dir: FileInfo;
+        entries: FileInfo[];
+        total: number;
+        hasmore?: boolean;
+    };
+
+    // wshrpc.CommandRemoteMkdirData
+    type CommandRemoteMkdirData = {
+        path: string;
+        parents?: boolean;
+        mode?: number;
+    };
+
     // wshrpc.CommandRemoteStreamFileData
     type CommandRemoteStreamFileData = {
         path: string;
@@ -134,10 +255,19 @@ declare global {
     // wshrpc.CommandRemoteWriteFileData
     type CommandRemoteWriteFileData = {
         path: string;
-        data64: string;
+        data64?: string;
         createmode?: number;
     };
 
+    // wshrpc.CommandRemoteWriteFileStreamData
+    type CommandRemoteWriteFileStreamData = {
+        path: string;
+        size?: number;
+        createmode?: number;
+        partial?: boolean;
+        offset?: number;
+    };
+
     // wshrpc.CommandResolveIdsData
     type CommandResolveIdsData = {
         blockid: string;
@@ -149,6 +279,17 @@ declare global {
         resolvedids: {[key: string]: ORef};
     };
 
+    // wshrpc.CommandRpcStatsData
+    type CommandRpcStatsData = {
+        reset?: boolean;
+    };
+
+    // wshrpc.CommandRpcTraceData
+    type CommandRpcTraceData = {
+        enabled: boolean;
+        filename?: string;
+    };
+
     // wshrpc.CommandSetMetaData
     type CommandSetMetaData = {
         oref: ORef;
@@ -170,6 +311,48 @@ declare global {
         err: string;
     };
 
+    // wconfig.ConnConfigType
+    type ConnConfigType = {
+        "display:name"?: string;
+        "display:color"?: string;
+        "shell:path"?: string;
+        "shell:env"?: {[key: string]: string};
+        "shell:cwd"?: string;
+        "shell:initscript"?: string;
+        "wsh:enabled"?: boolean;
+        "conn:rpccaps"?: string[];
+        "conn:autoreconnect"?: boolean;
+        "conn:reconnectmaxattempts"?: number;
+    };
+
+    // wshrpc.ConnCopyFileProgress
+    type ConnCopyFileProgress = {
+        destpath: string;
+        size: number;
+        copied: number;
+        resumedfrom?: number;
+        done?: boolean;
+        fileinfo?: FileInfo;
+    };
+
+    // wshrpc.ConnForward
+    type ConnForward = {
+        forwardid: string;
+        spec: ConnForwardSpec;
+        fromconfig?: boolean;
+        status: string;
+        error?: string;
+        boundaddr?: string;
+        activeconns: number;
+    };
+
+    // wshrpc.ConnForwardSpec
+    type ConnForwardSpec = {
+        type: string;
+        listenaddr: string;
+        targetaddr?: string;
+    };
+
     // wshrpc.ConnStatus
     type ConnStatus = {
         status: string;
@@ -178,6 +361,13 @@ declare global {
         hasconnected: boolean;
         activeconnnum: number;
         error?: string;
+        forwards?: ConnForward[];
+        reconnecting?: boolean;
+        reconnectattempt?: number;
+        reconnectmaxattempts?: number;
+        nextreconnectts?: number;
+        displayname?: string;
+        displaycolor?: string;
     };
 
     // wshrpc.CpuDataRequest
@@ -186,6 +376,25 @@ declare global {
         count: number;
     };
 
+    // wshrpc.EventQueueStats
+    type EventQueueStats = {
+        routeid: string;
+        queuedepth: number;
+        maxdepth: number;
+        sent: number;
+        dropped: number;
+        coalesced: number;
+        delayed: number;
+    };
+
+    // wshrpc.EventRetention
+    type EventRetention = {
+        event: string;
+        scope?: string;
+        maxitems: number;
+        maxagems?: number;
+    };
+
     // waveobj.FileDef
     type FileDef = {
         filetype?: string;
@@ -216,6 +425,15 @@ declare global {
         circular?: boolean;
         ijson?: boolean;
         ijsonbudget?: number;
+        maxversions?: number;
+    };
+
+    // wshrpc.FileVersionInfo
+    type FileVersionInfo = {
+        version: number;
+        size: number;
+        modts: number;
+        createdts: number;
     };
 
     // wconfig.FullConfigType
@@ -226,6 +444,8 @@ declare global {
         widgets: {[key: string]: WidgetConfigType};
         presets: {[key: string]: MetaType};
         termthemes: {[key: string]: TermThemeType};
+        webhooks: {[key: string]: WebhookConfigType};
+        connections: {[key: string]: ConnConfigType};
         configerrors: ConfigError[];
     };
 
@@ -286,6 +506,7 @@ declare global {
         "cmd:runonstart"?: boolean;
         "cmd:clearonstart"?: boolean;
         "cmd:clearonrestart"?: boolean;
+        "cmd:restartonreconnect"?: boolean;
         "cmd:env"?: {[key: string]: string};
         "cmd:cwd"?: string;
         "cmd:nowsh"?: boolean;
@@ -369,6 +590,22 @@ declare global {
         y: number;
     };
 
+    // wshrpc.RpcCommandStats
+    type RpcCommandStats = {
+        command: string;
+        count: number;
+        errors: number;
+        noresponse: number;
+        pending: number;
+        totalms: number;
+        maxms: number;
+        p50ms: number;
+        p95ms: number;
+        reqbytes: number;
+        respbytes: number;
+        histogram: number[];
+    };
+
     // wshutil.RpcMessage
     type RpcMessage = {
         command?: string;
@@ -382,6 +619,7 @@ declare global {
         error?: string;
         datatype?: string;
         data?: any;
+        binfield?: string;
     };
 
     // wshrpc.RpcOpts
@@ -441,6 +679,15 @@ declare global {
         "window:tilegapsize"?: number;
         "telemetry:*"?: boolean;
         "telemetry:enabled"?: boolean;
+        "conn:*"?: boolean;
+        "conn:rpccaps"?: string[];
+        "conn:rpccapsbyconn"?: {[key: string]: string[]};
+        "conn:keepaliveintervalms"?: number;
+        "conn:keepalivemaxmissed"?: number;
+        "conn:autoreconnect"?: boolean;
+        "conn:reconnectmaxattempts"?: number;
+        "gateway:*"?: boolean;
+        "gateway:enabled"?: boolean;
     };
 
     // waveobj.StickerClickOptsType
@@ -469,6 +716,8 @@ declare global {
         event: string;
         scopes?: string[];
         allscopes?: boolean;
+        since?: number;
+        filter?: string;
     };
 
     // waveobj.Tab
@@ -518,6 +767,18 @@ declare global {
         values: {[key: string]: number};
     };
 
+    // wpsevents.TypedWaveEvent
+    type TypedWaveEvent = Omit<WaveEvent, "event" | "data"> & (
+          { event: "blockclose"; data: string }
+        | { event: "connchange"; data: ConnStatus }
+        | { event: "sysinfo"; data: TimeSeriesData }
+        | { event: "controllerstatus"; data: BlockControllerRuntimeStatus }
+        | { event: "waveobj:update"; data: WaveObjUpdate }
+        | { event: "blockfile"; data: WSFileEventData }
+        | { event: "config"; data: WatcherUpdate }
+        | { event: "userinput"; data: UserInputRequest }
+    );
+
     // waveobj.UIContext
     type UIContext = {
         windowid: string;
@@ -605,6 +866,7 @@ declare global {
         scopes?: string[];
         sender?: string;
         persist?: number;
+        seq?: number;
         data?: any;
     };
 
@@ -666,6 +928,16 @@ declare global {
         inner?: boolean;
     };
 
+    // wconfig.WebhookConfigType
+    type WebhookConfigType = {
+        event: string;
+        scope?: string;
+        url: string;
+        filter?: string;
+        headers?: {[key: string]: string};
+        disabled?: boolean;
+    };
+
     // wconfig.WidgetConfigType
     type WidgetConfigType = {
         "display:order"?: number;
@@ -223,18 +223,12 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 		cmdOpts.Interactive = true
 		cmdOpts.Login = true
 		cmdOpts.Cwd = blockMeta.GetString(waveobj.MetaKey_CmdCwd, "")
-		if cmdOpts.Cwd != "" {
-			cmdOpts.Cwd = wavebase.ExpandHomeDir(cmdOpts.Cwd)
-		}
 	} else if bc.ControllerType == BlockController_Cmd {
 		cmdStr = blockMeta.GetString(waveobj.MetaKey_Cmd, "")
 		if cmdStr == "" {
 			return fmt.Errorf("missing cmd in block meta")
 		}
 		cmdOpts.Cwd = blockMeta.GetString(waveobj.MetaKey_CmdCwd, "")
-		if cmdOpts.Cwd != "" {
-			cmdOpts.Cwd = wavebase.ExpandHomeDir(cmdOpts.Cwd)
-		}
 		cmdOpts.Interactive = blockMeta.GetBool(waveobj.MetaKey_CmdInteractive, false)
 		cmdOpts.Login = blockMeta.GetBool(waveobj.MetaKey_CmdLogin, false)
 		cmdEnv := blockMeta.GetMap(waveobj.MetaKey_CmdEnv)
@@ -252,6 +246,10 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 	} else {
 		return fmt.Errorf("unknown controller type %q", bc.ControllerType)
 	}
+	if cmdOpts.Cwd != "" && remoteName == "" {
+		// remote cwds are expanded by the remote shell
+		cmdOpts.Cwd = wavebase.ExpandHomeDir(cmdOpts.Cwd)
+	}
 	var shellProc *shellexec.ShellProc
 	if remoteName != "" {
 		credentialCtx, cancelFunc := context.WithTimeout(context.Background(), 60*time.Second)
@@ -267,7 +265,7 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 			return fmt.Errorf("not connected, cannot start shellproc")
 		}
 		if !blockMeta.GetBool(waveobj.MetaKey_CmdNoWsh, false) {
-			jwtStr, err := wshutil.MakeClientJWTToken(wshrpc.RpcContext{TabId: bc.TabId, BlockId: bc.BlockId, Conn: conn.Opts.String()}, conn.GetDomainSocketName())
+			jwtStr, err := wshutil.MakeClientJWTToken(wshrpc.RpcContext{TabId: bc.TabId, BlockId: bc.BlockId, Conn: conn.Opts.String(), Caps: conncontroller.GetConnRpcCaps(conn.GetName())}, conn.GetDomainSocketName())
 			if err != nil {
 				return fmt.Errorf("error making jwt token: %w", err)
 			}
@@ -279,7 +277,7 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 		}
 	} else {
 		if !blockMeta.GetBool(waveobj.MetaKey_CmdNoWsh, false) {
-			jwtStr, err := wshutil.MakeClientJWTToken(wshrpc.RpcContext{TabId: bc.TabId, BlockId: bc.BlockId}, wavebase.GetDomainSocketName())
+			jwtStr, err := wshutil.MakeClientJWTToken(wshrpc.RpcContext{TabId: bc.TabId, BlockId: bc.BlockId, Caps: []string{wshrpc.Cap_All}}, wavebase.GetDomainSocketName())
 			if err != nil {
 				return fmt.Errorf("error making jwt token: %w", err)
 			}
@@ -361,6 +359,11 @@ func (bc *BlockController) DoRunShellCommand(rc *RunShellOpts, blockMeta waveobj
 	go func() {
 		// handles outputCh -> shellInputCh
 		for msg := range wshProxy.ToRemoteCh {
+			msg, err := wshutil.BinFrameToJson(msg)
+			if err != nil {
+				log.Printf("error converting binary frame to json: %v\n", err)
+				continue
+			}
 			encodedMsg := wshutil.EncodeWaveOSCBytes(wshutil.WaveServerOSC, msg)
 			shellInputCh <- &BlockInputUnion{InputData: encodedMsg}
 		}
@@ -609,6 +612,34 @@ func StopBlockController(blockId string) {
 
 }
 
+// called after a connection reconnects automatically (see conncontroller.SetReconnectHandler).
+// restarts the cmd blocks on the connection that set cmd:restartonreconnect.
+func RestartCmdBlocksOnReconnect(connName string) {
+	for _, bc := range getControllerList() {
+		if bc.ControllerType != BlockController_Cmd {
+			continue
+		}
+		bcStatus := bc.GetRuntimeStatus()
+		if bcStatus.ShellProcStatus == Status_Running || bcStatus.ShellProcConnName != connName {
+			continue
+		}
+		ctx, cancelFn := context.WithTimeout(context.Background(), DefaultTimeout)
+		blockData, err := wstore.DBGet[*waveobj.Block](ctx, bc.BlockId)
+		cancelFn()
+		if err != nil || blockData == nil {
+			continue
+		}
+		if !blockData.Meta.GetBool(waveobj.MetaKey_CmdRestartOnReconnect, false) || blockData.Meta.GetString(waveobj.MetaKey_Connection, "") != connName {
+			continue
+		}
+		log.Printf("restarting cmd block %s on reconnect to %q\n", bc.BlockId, connName)
+		err = bc.DoRunShellCommand(&RunShellOpts{TermSize: getTermSize(blockData)}, blockData.Meta)
+		if err != nil {
+			log.Printf("error restarting cmd block %s: %v\n", bc.BlockId, err)
+		}
+	}
+}
+
 func getControllerList() []*BlockController {
 	globalLock.Lock()
 	defer globalLock.Unlock()
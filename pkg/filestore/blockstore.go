@@ -54,6 +54,7 @@ type FileOptsType struct {
 	Circular    bool  `json:"circular,omitempty"`
 	IJson       bool  `json:"ijson,omitempty"`
 	IJsonBudget int   `json:"ijsonbudget,omitempty"`
+	MaxVersions int   `json:"maxversions,omitempty"` // number of old versions to keep on WriteFile (0 = no versions)
 }
 
 type FileMeta = map[string]any
@@ -118,6 +119,19 @@ type FileData struct {
 
 func (FileData) UseDBMap() {}
 
+// a saved copy of a file's contents from before a WriteFile (only for files with MaxVersions > 0)
+type WaveFileVersion struct {
+	ZoneId    string   `json:"zoneid"`
+	Name      string   `json:"name"`
+	Version   int      `json:"version"`
+	Size      int64    `json:"size"`
+	ModTs     int64    `json:"modts"`     // modts of the file when this version was current
+	CreatedTs int64    `json:"createdts"` // when this version was saved
+	Meta      FileMeta `json:"meta"`
+}
+
+func (WaveFileVersion) UseDBMap() {}
+
 // synchronous (does not interact with the cache)
 func (s *FileStore) MakeFile(ctx context.Context, zoneId string, name string, meta FileMeta, opts FileOptsType) error {
 	if opts.MaxSize < 0 {
@@ -140,6 +154,12 @@ func (s *FileStore) MakeFile(ctx context.Context, zoneId string, name string, me
 	if opts.IJsonBudget < 0 {
 		return fmt.Errorf("ijson budget must be non-negative")
 	}
+	if opts.MaxVersions < 0 {
+		return fmt.Errorf("max versions must be non-negative")
+	}
+	if opts.Circular && opts.MaxVersions > 0 {
+		return fmt.Errorf("circular file cannot have versions")
+	}
 	return withLock(s, zoneId, name, func(entry *CacheEntry) error {
 		if entry.File != nil {
 			return fs.ErrExist
@@ -234,13 +254,42 @@ func (s *FileStore) WriteMeta(ctx context.Context, zoneId string, name string, m
 
 func (s *FileStore) WriteFile(ctx context.Context, zoneId string, name string, data []byte) error {
 	return withLock(s, zoneId, name, func(entry *CacheEntry) error {
-		err := entry.loadFileIntoCache(ctx)
+		return entry.replaceFileData(ctx, data)
+	})
+}
+
+// lists the saved versions of a file (newest first), does not return the version data
+func (s *FileStore) ListFileVersions(ctx context.Context, zoneId string, name string) ([]*WaveFileVersion, error) {
+	versions, err := dbGetFileVersions(ctx, zoneId, name)
+	if err != nil {
+		return nil, fmt.Errorf("error getting file versions: %v", err)
+	}
+	return versions, nil
+}
+
+// if version doesn't exist, returns fs.ErrNotExist
+func (s *FileStore) ReadFileVersion(ctx context.Context, zoneId string, name string, version int) (*WaveFileVersion, []byte, error) {
+	fileVersion, data, err := dbGetFileVersion(ctx, zoneId, name, version)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting file version: %v", err)
+	}
+	if fileVersion == nil {
+		return nil, nil, fs.ErrNotExist
+	}
+	return fileVersion, data, nil
+}
+
+// replaces the file contents with the given version (the current contents are saved as a new version)
+func (s *FileStore) RestoreFileVersion(ctx context.Context, zoneId string, name string, version int) error {
+	return withLock(s, zoneId, name, func(entry *CacheEntry) error {
+		fileVersion, data, err := dbGetFileVersion(ctx, zoneId, name, version)
 		if err != nil {
-			return err
+			return fmt.Errorf("error getting file version: %v", err)
+		}
+		if fileVersion == nil {
+			return fs.ErrNotExist
 		}
-		entry.writeAt(0, data, true)
-		// since WriteFile can *truncate* the file, we need to flush the file to the DB immediately
-		return entry.flushToDB(ctx, true)
+		return entry.replaceFileData(ctx, data)
 	})
 }
 
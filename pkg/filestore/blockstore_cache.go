@@ -323,6 +323,27 @@ func makeCacheEntry(zoneId string, name string) *CacheEntry {
 	}
 }
 
+// used by WriteFile, snapshots the current contents (if versioned), then replaces the data and flushes
+func (entry *CacheEntry) replaceFileData(ctx context.Context, data []byte) error {
+	err := entry.loadFileIntoCache(ctx)
+	if err != nil {
+		return err
+	}
+	if entry.File.Opts.MaxVersions > 0 && entry.File.Size > 0 {
+		_, oldData, err := entry.readAt(ctx, 0, 0, true)
+		if err != nil {
+			return fmt.Errorf("error reading file for version: %w", err)
+		}
+		err = dbInsertFileVersion(ctx, entry.File, oldData)
+		if err != nil {
+			return fmt.Errorf("error saving file version: %w", err)
+		}
+	}
+	entry.writeAt(0, data, true)
+	// since WriteFile can *truncate* the file, we need to flush the file to the DB immediately
+	return entry.flushToDB(ctx, true)
+}
+
 func (entry *CacheEntry) flushToDB(ctx context.Context, replace bool) error {
 	if entry.File == nil {
 		return nil
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"time"
 
 	"github.com/wavetermdev/waveterm/pkg/util/dbutil"
 )
@@ -32,6 +33,8 @@ func dbDeleteFile(ctx context.Context, zoneId string, name string) error {
 		tx.Exec(query, zoneId, name)
 		query = "DELETE FROM db_file_data WHERE zoneid = ? AND name = ?"
 		tx.Exec(query, zoneId, name)
+		query = "DELETE FROM db_file_version WHERE zoneid = ? AND name = ?"
+		tx.Exec(query, zoneId, name)
 		return nil
 	})
 }
@@ -115,3 +118,40 @@ func dbWriteCacheEntry(ctx context.Context, file *WaveFile, dataEntries map[int]
 		return nil
 	})
 }
+
+// saves data as the newest version of file, and prunes versions past file.Opts.MaxVersions
+func dbInsertFileVersion(ctx context.Context, file *WaveFile, data []byte) error {
+	return WithTx(ctx, func(tx *TxWrap) error {
+		query := `SELECT COALESCE(MAX(version), 0) FROM db_file_version WHERE zoneid = ? AND name = ?`
+		newVersion := tx.GetInt(query, file.ZoneId, file.Name) + 1
+		query = `INSERT INTO db_file_version (zoneid, name, version, size, modts, createdts, meta, data) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+		tx.Exec(query, file.ZoneId, file.Name, newVersion, len(data), file.ModTs, time.Now().UnixMilli(), dbutil.QuickJson(file.Meta), data)
+		query = `DELETE FROM db_file_version WHERE zoneid = ? AND name = ? AND version <= ?`
+		tx.Exec(query, file.ZoneId, file.Name, newVersion-file.Opts.MaxVersions)
+		return nil
+	})
+}
+
+func dbGetFileVersions(ctx context.Context, zoneId string, name string) ([]*WaveFileVersion, error) {
+	return WithTxRtn(ctx, func(tx *TxWrap) ([]*WaveFileVersion, error) {
+		query := `SELECT zoneid, name, version, size, modts, createdts, meta FROM db_file_version WHERE zoneid = ? AND name = ? ORDER BY version DESC`
+		versions := dbutil.SelectMappable[*WaveFileVersion](tx, query, zoneId, name)
+		return versions, nil
+	})
+}
+
+// returns nil (with no error) if the version does not exist
+func dbGetFileVersion(ctx context.Context, zoneId string, name string, version int) (*WaveFileVersion, []byte, error) {
+	var data []byte
+	fileVersion, err := WithTxRtn(ctx, func(tx *TxWrap) (*WaveFileVersion, error) {
+		query := `SELECT zoneid, name, version, size, modts, createdts, meta FROM db_file_version WHERE zoneid = ? AND name = ? AND version = ?`
+		fileVersion := dbutil.GetMappable[*WaveFileVersion](tx, query, zoneId, name, version)
+		if fileVersion == nil {
+			return nil, nil
+		}
+		query = `SELECT data FROM db_file_version WHERE zoneid = ? AND name = ? AND version = ?`
+		tx.Get(&data, query, zoneId, name, version)
+		return fileVersion, nil
+	})
+	return fileVersion, data, err
+}
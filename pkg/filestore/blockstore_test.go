@@ -388,6 +388,82 @@ func TestWriteFile(t *testing.T) {
 	checkFileData(t, ctx, zoneId, "c1", "3456789 123456789 123456789 123456789 apple banana")
 }
 
+func TestFileVersions(t *testing.T) {
+	initDb(t)
+	defer cleanupDb(t)
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	zoneId := uuid.NewString()
+	fileName := "v1"
+	err := WFS.MakeFile(ctx, zoneId, "c1", nil, FileOptsType{Circular: true, MaxSize: 50, MaxVersions: 2})
+	if err == nil {
+		t.Fatalf("circular file with versions should fail")
+	}
+	err = WFS.MakeFile(ctx, zoneId, fileName, nil, FileOptsType{MaxVersions: 2})
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	for _, data := range []string{"one", "two", "three", "four"} {
+		err = WFS.WriteFile(ctx, zoneId, fileName, []byte(data))
+		if err != nil {
+			t.Fatalf("error writing data: %v", err)
+		}
+	}
+	checkFileData(t, ctx, zoneId, fileName, "four")
+	versions, err := WFS.ListFileVersions(ctx, zoneId, fileName)
+	if err != nil {
+		t.Fatalf("error listing versions: %v", err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(versions))
+	}
+	if versions[0].Version != 3 || versions[1].Version != 2 {
+		t.Fatalf("unexpected versions: %d, %d", versions[0].Version, versions[1].Version)
+	}
+	if versions[0].Size != int64(len("three")) {
+		t.Fatalf("version size mismatch: %d", versions[0].Size)
+	}
+	_, data, err := WFS.ReadFileVersion(ctx, zoneId, fileName, 2)
+	if err != nil {
+		t.Fatalf("error reading version: %v", err)
+	}
+	if string(data) != "two" {
+		t.Fatalf("version data mismatch: %q", string(data))
+	}
+	_, _, err = WFS.ReadFileVersion(ctx, zoneId, fileName, 1)
+	if err != fs.ErrNotExist {
+		t.Fatalf("expected pruned version to not exist, got: %v", err)
+	}
+	err = WFS.RestoreFileVersion(ctx, zoneId, fileName, 2)
+	if err != nil {
+		t.Fatalf("error restoring version: %v", err)
+	}
+	checkFileData(t, ctx, zoneId, fileName, "two")
+	versions, err = WFS.ListFileVersions(ctx, zoneId, fileName)
+	if err != nil {
+		t.Fatalf("error listing versions: %v", err)
+	}
+	if len(versions) != 2 || versions[0].Version != 4 {
+		t.Fatalf("expected restore to save the current data as version 4")
+	}
+	_, data, err = WFS.ReadFileVersion(ctx, zoneId, fileName, 4)
+	if err != nil || string(data) != "four" {
+		t.Fatalf("version 4 mismatch: %q, err:%v", string(data), err)
+	}
+	err = WFS.DeleteFile(ctx, zoneId, fileName)
+	if err != nil {
+		t.Fatalf("error deleting file: %v", err)
+	}
+	versions, err = WFS.ListFileVersions(ctx, zoneId, fileName)
+	if err != nil {
+		t.Fatalf("error listing versions: %v", err)
+	}
+	if len(versions) != 0 {
+		t.Fatalf("expected versions to be deleted with file")
+	}
+}
+
 func TestCircularWrites(t *testing.T) {
 	initDb(t)
 	defer cleanupDb(t)
@@ -61,21 +61,26 @@ func GenerateMetaMapConsts(buf *strings.Builder, constPrefix string, rtype refle
 	buf.WriteString(")\n")
 }
 
+// reflect names []byte "[]uint8"
+func typeString(rtype reflect.Type) string {
+	return strings.ReplaceAll(rtype.String(), "[]uint8", "[]byte")
+}
+
 func GenMethod_Call(buf *strings.Builder, methodDecl *wshrpc.WshRpcMethodDecl) {
 	fmt.Fprintf(buf, "// command %q, wshserver.%s\n", methodDecl.Command, methodDecl.MethodName)
 	var dataType string
 	dataVarName := "nil"
 	if methodDecl.CommandDataType != nil {
-		dataType = ", data " + methodDecl.CommandDataType.String()
+		dataType = ", data " + typeString(methodDecl.CommandDataType)
 		dataVarName = "data"
 	}
 	returnType := "error"
 	respName := "_"
 	tParamVal := "any"
 	if methodDecl.DefaultResponseDataType != nil {
-		returnType = "(" + methodDecl.DefaultResponseDataType.String() + ", error)"
+		returnType = "(" + typeString(methodDecl.DefaultResponseDataType) + ", error)"
 		respName = "resp"
-		tParamVal = methodDecl.DefaultResponseDataType.String()
+		tParamVal = typeString(methodDecl.DefaultResponseDataType)
 	}
 	fmt.Fprintf(buf, "func %s(w *wshutil.WshRpc%s, opts *wshrpc.RpcOpts) %s {\n", methodDecl.MethodName, dataType, returnType)
 	fmt.Fprintf(buf, "\t%s, err := sendRpcRequestCallHelper[%s](w, %q, %s, opts)\n", respName, tParamVal, methodDecl.Command, dataVarName)
@@ -87,17 +92,38 @@ func GenMethod_Call(buf *strings.Builder, methodDecl *wshrpc.WshRpcMethodDecl) {
 	fmt.Fprintf(buf, "}\n\n")
 }
 
+func GenMethod_StreamingRequest(buf *strings.Builder, methodDecl *wshrpc.WshRpcMethodDecl) {
+	fmt.Fprintf(buf, "// command %q, wshserver.%s\n", methodDecl.Command, methodDecl.MethodName)
+	reqType := typeString(methodDecl.RequestStreamDataType)
+	returnType := "error"
+	respName := "_"
+	tParamVal := "any"
+	if methodDecl.DefaultResponseDataType != nil {
+		returnType = "(" + typeString(methodDecl.DefaultResponseDataType) + ", error)"
+		respName = "resp"
+		tParamVal = typeString(methodDecl.DefaultResponseDataType)
+	}
+	fmt.Fprintf(buf, "func %s(w *wshutil.WshRpc, data %s, reqCh <-chan wshrpc.RespOrErrorUnion[%s], opts *wshrpc.RpcOpts) %s {\n", methodDecl.MethodName, typeString(methodDecl.CommandDataType), reqType, returnType)
+	fmt.Fprintf(buf, "\t%s, err := sendRpcStreamingRequestHelper[%s](w, %q, data, reqCh, opts)\n", respName, tParamVal, methodDecl.Command)
+	if methodDecl.DefaultResponseDataType != nil {
+		fmt.Fprintf(buf, "\treturn resp, err\n")
+	} else {
+		fmt.Fprintf(buf, "\treturn err\n")
+	}
+	fmt.Fprintf(buf, "}\n\n")
+}
+
 func GenMethod_ResponseStream(buf *strings.Builder, methodDecl *wshrpc.WshRpcMethodDecl) {
 	fmt.Fprintf(buf, "// command %q, wshserver.%s\n", methodDecl.Command, methodDecl.MethodName)
 	var dataType string
 	dataVarName := "nil"
 	if methodDecl.CommandDataType != nil {
-		dataType = ", data " + methodDecl.CommandDataType.String()
+		dataType = ", data " + typeString(methodDecl.CommandDataType)
 		dataVarName = "data"
 	}
 	respType := "any"
 	if methodDecl.DefaultResponseDataType != nil {
-		respType = methodDecl.DefaultResponseDataType.String()
+		respType = typeString(methodDecl.DefaultResponseDataType)
 	}
 	fmt.Fprintf(buf, "func %s(w *wshutil.WshRpc%s, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[%s] {\n", methodDecl.MethodName, dataType, respType)
 	fmt.Fprintf(buf, "\treturn sendRpcRequestResponseStreamHelper[%s](w, %q, %s, opts)\n", respType, methodDecl.Command, dataVarName)
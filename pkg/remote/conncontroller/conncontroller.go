@@ -25,6 +25,7 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/util/shellutil"
 	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
 	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
 	"github.com/wavetermdev/waveterm/pkg/wps"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshutil"
@@ -37,6 +38,7 @@ const (
 	Status_Connected    = "connected"
 	Status_Disconnected = "disconnected"
 	Status_Error        = "error"
+	Status_Unresponsive = "unresponsive" // the connserver stopped answering router keepalives (see wshutil/wshkeepalive.go)
 )
 
 const DefaultConnectionTimeout = 60 * time.Second
@@ -57,6 +59,13 @@ type SSHConn struct {
 	HasWaiter          *atomic.Bool
 	LastConnectTime    int64
 	ActiveConnNum      int
+	Forwards           []*connForward // port forwards, see connforward.go
+
+	// automatic reconnect state, see connreconnect.go
+	ReconnectCancelFn    context.CancelFunc
+	ReconnectAttempt     int
+	ReconnectMaxAttempts int
+	NextReconnectTime    int64
 }
 
 func GetAllConnStatus() []wshrpc.ConnStatus {
@@ -71,6 +80,7 @@ func GetAllConnStatus() []wshrpc.ConnStatus {
 }
 
 func (conn *SSHConn) DeriveConnStatus() wshrpc.ConnStatus {
+	connConfig := wconfig.GetConnConfig(conn.GetName())
 	conn.Lock.Lock()
 	defer conn.Lock.Unlock()
 	return wshrpc.ConnStatus{
@@ -80,6 +90,15 @@ func (conn *SSHConn) DeriveConnStatus() wshrpc.ConnStatus {
 		HasConnected:  (conn.LastConnectTime > 0),
 		ActiveConnNum: conn.ActiveConnNum,
 		Error:         conn.Error,
+		Forwards:      conn.getForwards_nolock(),
+
+		Reconnecting:         conn.ReconnectCancelFn != nil,
+		ReconnectAttempt:     conn.ReconnectAttempt,
+		ReconnectMaxAttempts: conn.ReconnectMaxAttempts,
+		NextReconnectTs:      conn.NextReconnectTime,
+
+		DisplayName:  connConfig.DisplayName,
+		DisplayColor: connConfig.DisplayColor,
 	}
 }
 
@@ -99,6 +118,7 @@ func (conn *SSHConn) FireConnChangeEvent() {
 func (conn *SSHConn) Close() error {
 	defer conn.FireConnChangeEvent()
 	conn.WithLock(func() {
+		conn.cancelReconnect_nolock()
 		if conn.Status == Status_Connected || conn.Status == Status_Connecting {
 			// if status is init, disconnected, or error don't change it
 			conn.Status = Status_Disconnected
@@ -118,6 +138,7 @@ func (conn *SSHConn) Close() error {
 
 func (conn *SSHConn) close_nolock() {
 	// does not set status (that should happen at another level)
+	conn.stopForwards_nolock()
 	if conn.DomainSockListener != nil {
 		conn.DomainSockListener.Close()
 		conn.DomainSockListener = nil
@@ -203,6 +224,7 @@ func (conn *SSHConn) StartConnServer() error {
 	rpcCtx := wshrpc.RpcContext{
 		ClientType: wshrpc.ClientType_ConnServer,
 		Conn:       conn.GetName(),
+		Caps:       GetConnRpcCaps(conn.GetName()),
 	}
 	sockName := conn.GetDomainSocketName()
 	jwtToken, err := wshutil.MakeClientJWTToken(rpcCtx, sockName)
@@ -274,6 +296,9 @@ func (conn *SSHConn) CheckAndInstallWsh(ctx context.Context, clientDisplayName s
 	if opts == nil {
 		opts = &WshInstallOpts{}
 	}
+	if !wconfig.GetConnConfig(conn.GetName()).IsWshEnabled() {
+		return fmt.Errorf("wsh is disabled for %s in connections.json", conn.GetName())
+	}
 	client := conn.GetClient()
 	if client == nil {
 		return fmt.Errorf("client is nil")
@@ -368,12 +393,23 @@ func (conn *SSHConn) WaitForConnect(ctx context.Context) error {
 		if status.Status == Status_Error {
 			return fmt.Errorf("error: %v", status.Error)
 		}
+		if status.Status == Status_Unresponsive {
+			return fmt.Errorf("unresponsive: %v", status.Error)
+		}
 		return fmt.Errorf("unknown status: %q", status.Status)
 	}
 }
 
 // does not return an error since that error is stored inside of SSHConn
 func (conn *SSHConn) Connect(ctx context.Context) error {
+	// an explicit connect replaces a pending automatic reconnect
+	conn.WithLock(func() {
+		conn.cancelReconnect_nolock()
+	})
+	return conn.connect(ctx)
+}
+
+func (conn *SSHConn) connect(ctx context.Context) error {
 	var connectAllowed bool
 	conn.WithLock(func() {
 		if conn.Status == Status_Connecting || conn.Status == Status_Connected {
@@ -403,6 +439,9 @@ func (conn *SSHConn) Connect(ctx context.Context) error {
 			}
 		}
 	})
+	if err == nil {
+		conn.startForwards(conn.GetClient())
+	}
 	conn.FireConnChangeEvent()
 	return err
 }
@@ -423,17 +462,21 @@ func (conn *SSHConn) connectInternal(ctx context.Context) error {
 	conn.WithLock(func() {
 		conn.Client = client
 	})
-	err = conn.OpenDomainSocketListener()
-	if err != nil {
-		return err
-	}
-	installErr := conn.CheckAndInstallWsh(ctx, clientDisplayName, nil)
-	if installErr != nil {
-		return fmt.Errorf("conncontroller %s wsh install error: %v", conn.GetName(), installErr)
-	}
-	csErr := conn.StartConnServer()
-	if csErr != nil {
-		return fmt.Errorf("conncontroller %s start wsh connserver error: %v", conn.GetName(), csErr)
+	if wconfig.GetConnConfig(conn.GetName()).IsWshEnabled() {
+		err = conn.OpenDomainSocketListener()
+		if err != nil {
+			return err
+		}
+		installErr := conn.CheckAndInstallWsh(ctx, clientDisplayName, nil)
+		if installErr != nil {
+			return fmt.Errorf("conncontroller %s wsh install error: %v", conn.GetName(), installErr)
+		}
+		csErr := conn.StartConnServer()
+		if csErr != nil {
+			return fmt.Errorf("conncontroller %s start wsh connserver error: %v", conn.GetName(), csErr)
+		}
+	} else {
+		log.Printf("conncontroller %s: wsh is disabled in connections.json, not installing wsh or starting connserver\n", conn.GetName())
 	}
 	conn.HasWaiter.Store(true)
 	go conn.waitForDisconnect()
@@ -448,18 +491,74 @@ func (conn *SSHConn) waitForDisconnect() {
 		return
 	}
 	err := client.Wait()
+	var shouldReconnect bool
 	conn.WithLock(func() {
+		// the connection dropped (not closed by Close(), which sets the status first).  unresponsive connections
+		// were already closed by HandleUnresponsiveRoute.
+		shouldReconnect = (conn.Status == Status_Connected && conn.Client == client) || conn.Status == Status_Unresponsive
 		// disconnects happen for a variety of reasons (like network, etc. and are typically transient)
 		// so we just set the status to "disconnected" here (not error)
 		// don't overwrite any existing error (or error status)
 		if err != nil && conn.Error == "" {
 			conn.Error = err.Error()
 		}
-		if conn.Status != Status_Error {
+		if conn.Status != Status_Error && conn.Status != Status_Unresponsive {
 			conn.Status = Status_Disconnected
 		}
 		conn.close_nolock()
 	})
+	if shouldReconnect {
+		conn.startReconnect()
+	}
+}
+
+// called by the router when a connserver route stops answering keepalive pings (the route is already unregistered).
+// the ssh link is most likely dead, so it is closed (a reconnect starts from scratch).
+func HandleUnresponsiveRoute(routeId string) {
+	var conn *SSHConn
+	globalLock.Lock()
+	for _, c := range clientControllerMap {
+		if wshutil.MakeConnectionRouteId(c.GetName()) == routeId {
+			conn = c
+			break
+		}
+	}
+	globalLock.Unlock()
+	if conn == nil {
+		return
+	}
+	var changed bool
+	conn.WithLock(func() {
+		if conn.Status != Status_Connected {
+			return
+		}
+		conn.Status = Status_Unresponsive
+		conn.Error = "connection is unresponsive (no keepalive responses)"
+		conn.close_nolock()
+		changed = true
+	})
+	if changed {
+		conn.FireConnChangeEvent()
+	}
+}
+
+// router keepalive settings (see wshutil/wshkeepalive.go)
+func GetRouteKeepAliveOpts() wshutil.KeepAliveOpts {
+	opts := wshutil.KeepAliveOpts{
+		IntervalMs:    wshutil.DefaultKeepAliveIntervalMs,
+		MaxMissed:     wshutil.DefaultKeepAliveMaxMissed,
+		RoutePrefixes: wshutil.DefaultKeepAliveRoutePrefixes,
+	}
+	if watcher := wconfig.GetWatcher(); watcher != nil {
+		settings := watcher.GetFullConfig().Settings
+		if settings.ConnKeepAliveIntervalMs != 0 {
+			opts.IntervalMs = int(settings.ConnKeepAliveIntervalMs)
+		}
+		if settings.ConnKeepAliveMaxMissed > 0 {
+			opts.MaxMissed = int(settings.ConnKeepAliveMaxMissed)
+		}
+	}
+	return opts
 }
 
 func getConnInternal(opts *remote.SSHOpts) *SSHConn {
@@ -473,6 +572,26 @@ func getConnInternal(opts *remote.SSHOpts) *SSHConn {
 	return rtn
 }
 
+// rpc caps for the connserver (and the blocks) on a connection, changes take effect on the next connect
+func GetConnRpcCaps(connName string) []string {
+	caps := wshrpc.DefaultRemoteCaps
+	if watcher := wconfig.GetWatcher(); watcher != nil {
+		fullConfig := watcher.GetFullConfig()
+		if connCaps := fullConfig.ResolveConnConfig(connName).ConnRpcCaps; connCaps != nil {
+			caps = connCaps
+		} else if connCaps, ok := fullConfig.Settings.ConnRpcCapsByConn[connName]; ok {
+			caps = connCaps
+		} else if fullConfig.Settings.ConnRpcCaps != nil {
+			caps = fullConfig.Settings.ConnRpcCaps
+		}
+	}
+	if caps == nil {
+		// nil caps would mean full access
+		return []string{}
+	}
+	return caps
+}
+
 func GetConn(ctx context.Context, opts *remote.SSHOpts, shouldConnect bool) *SSHConn {
 	conn := getConnInternal(opts)
 	if conn.Client == nil && shouldConnect {
@@ -486,6 +605,13 @@ func EnsureConnection(ctx context.Context, connName string) error {
 	if connName == "" {
 		return nil
 	}
+	if wshutil.IsNestedConnName(connName) {
+		// nested connections are opened from their parent's shell (wsh sshnested), we can only check the route
+		if !wshutil.DefaultRouter.HasRoute(wshutil.MakeConnectionRouteId(connName)) {
+			return fmt.Errorf("nested connection %q is not connected", connName)
+		}
+		return nil
+	}
 	connOpts, err := remote.ParseOpts(connName)
 	if err != nil {
 		return fmt.Errorf("error parsing connection name: %w", err)
@@ -502,7 +628,11 @@ func EnsureConnection(ctx context.Context, connName string) error {
 		return conn.WaitForConnect(ctx)
 	case Status_Init, Status_Disconnected:
 		return conn.Connect(ctx)
-	case Status_Error:
+	case Status_Error, Status_Unresponsive:
+		if connStatus.Reconnecting {
+			// don't wait for the next automatic attempt
+			return conn.Connect(ctx)
+		}
 		return fmt.Errorf("connection error: %s", connStatus.Error)
 	default:
 		return fmt.Errorf("unknown connection status %q", connStatus.Status)
@@ -0,0 +1,318 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conncontroller
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/pkg/remote"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/crypto/ssh"
+)
+
+// port forwards live on the SSHConn.  they are started when the connection connects and stopped (but kept)
+// when it closes, so they come back on reconnect.  forwards from ssh_config are reloaded on every connect.
+
+const forwardTargetDialTimeout = 10 * time.Second
+
+type connForward struct {
+	Lock        *sync.Mutex
+	StartLock   *sync.Mutex // serializes start() (listening can take a round trip, it is not done under Lock)
+	ForwardId   string
+	Spec        wshrpc.ConnForwardSpec
+	FromConfig  bool
+	Status      string
+	Error       string
+	Listener    net.Listener
+	ActiveConns map[net.Conn]net.Conn // forwarded conn => target conn (nil while it is being dialed)
+}
+
+func makeConnForward(spec wshrpc.ConnForwardSpec, fromConfig bool) *connForward {
+	return &connForward{
+		Lock:        &sync.Mutex{},
+		StartLock:   &sync.Mutex{},
+		ForwardId:   uuid.New().String()[:8],
+		Spec:        spec,
+		FromConfig:  fromConfig,
+		Status:      wshrpc.ConnForwardStatus_Inactive,
+		ActiveConns: make(map[net.Conn]net.Conn),
+	}
+}
+
+func (fwd *connForward) toConnForward() wshrpc.ConnForward {
+	fwd.Lock.Lock()
+	defer fwd.Lock.Unlock()
+	rtn := wshrpc.ConnForward{
+		ForwardId:   fwd.ForwardId,
+		Spec:        fwd.Spec,
+		FromConfig:  fwd.FromConfig,
+		Status:      fwd.Status,
+		Error:       fwd.Error,
+		ActiveConns: len(fwd.ActiveConns),
+	}
+	if fwd.Listener != nil {
+		rtn.BoundAddr = fwd.Listener.Addr().String()
+	}
+	return rtn
+}
+
+func (fwd *connForward) start(client *ssh.Client) error {
+	fwd.StartLock.Lock()
+	defer fwd.StartLock.Unlock()
+	fwd.Lock.Lock()
+	running := fwd.Listener != nil
+	fwd.Lock.Unlock()
+	if running {
+		return nil
+	}
+	var listener net.Listener
+	var err error
+	if fwd.Spec.Type == wshrpc.ConnForwardType_Remote {
+		listener, err = client.Listen("tcp", fwd.Spec.ListenAddr)
+	} else {
+		listener, err = net.Listen("tcp", fwd.Spec.ListenAddr)
+	}
+	fwd.Lock.Lock()
+	defer fwd.Lock.Unlock()
+	if err != nil {
+		fwd.Status = wshrpc.ConnForwardStatus_Error
+		fwd.Error = err.Error()
+		return fmt.Errorf("cannot listen on %s: %w", fwd.Spec.ListenAddr, err)
+	}
+	fwd.Listener = listener
+	fwd.Status = wshrpc.ConnForwardStatus_Active
+	fwd.Error = ""
+	go fwd.acceptLoop(client, listener)
+	return nil
+}
+
+// closes the listener and every forwarded connection
+func (fwd *connForward) stop() {
+	fwd.Lock.Lock()
+	defer fwd.Lock.Unlock()
+	if fwd.Listener != nil {
+		fwd.Listener.Close()
+		fwd.Listener = nil
+	}
+	for srcConn, targetConn := range fwd.ActiveConns {
+		srcConn.Close()
+		if targetConn != nil {
+			targetConn.Close()
+		}
+	}
+	clear(fwd.ActiveConns)
+	fwd.Status = wshrpc.ConnForwardStatus_Inactive
+	fwd.Error = ""
+}
+
+func (fwd *connForward) acceptLoop(client *ssh.Client, listener net.Listener) {
+	for {
+		newConn, err := listener.Accept()
+		if err != nil {
+			fwd.Lock.Lock()
+			if fwd.Listener == listener {
+				// not closed by stop()
+				fwd.Listener = nil
+				fwd.Status = wshrpc.ConnForwardStatus_Error
+				fwd.Error = err.Error()
+			}
+			fwd.Lock.Unlock()
+			return
+		}
+		go fwd.handleConn(client, listener, newConn)
+	}
+}
+
+// returns false if the forward was stopped (the conn is not tracked)
+func (fwd *connForward) trackConn(srcConn net.Conn, targetConn net.Conn, listener net.Listener) bool {
+	fwd.Lock.Lock()
+	defer fwd.Lock.Unlock()
+	if fwd.Listener != listener {
+		return false
+	}
+	fwd.ActiveConns[srcConn] = targetConn
+	return true
+}
+
+func (fwd *connForward) untrackConn(srcConn net.Conn) {
+	fwd.Lock.Lock()
+	defer fwd.Lock.Unlock()
+	delete(fwd.ActiveConns, srcConn)
+}
+
+func (fwd *connForward) dialTarget(client *ssh.Client, srcConn net.Conn) (net.Conn, error) {
+	switch fwd.Spec.Type {
+	case wshrpc.ConnForwardType_Local:
+		return client.Dial("tcp", fwd.Spec.TargetAddr)
+	case wshrpc.ConnForwardType_Remote:
+		return net.DialTimeout("tcp", fwd.Spec.TargetAddr, forwardTargetDialTimeout)
+	case wshrpc.ConnForwardType_Dynamic:
+		return handleSocks5Conn(srcConn, func(addr string) (net.Conn, error) {
+			return client.Dial("tcp", addr)
+		})
+	default:
+		return nil, fmt.Errorf("invalid forward type %q", fwd.Spec.Type)
+	}
+}
+
+func (fwd *connForward) handleConn(client *ssh.Client, listener net.Listener, srcConn net.Conn) {
+	if !fwd.trackConn(srcConn, nil, listener) {
+		srcConn.Close()
+		return
+	}
+	defer fwd.untrackConn(srcConn)
+	targetConn, err := fwd.dialTarget(client, srcConn)
+	if err != nil {
+		log.Printf("[forward:%s] %s: %v\n", fwd.ForwardId, fwd.Spec.Type, err)
+		srcConn.Close()
+		return
+	}
+	if !fwd.trackConn(srcConn, targetConn, listener) {
+		srcConn.Close()
+		targetConn.Close()
+		return
+	}
+	pipeConns(srcConn, targetConn)
+}
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// copies in both directions (passing half-closes through) until both sides are done
+func pipeConns(c1 net.Conn, c2 net.Conn) {
+	var wg sync.WaitGroup
+	copyFn := func(dst net.Conn, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		if cw, ok := dst.(closeWriter); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+	wg.Add(2)
+	go copyFn(c1, c2)
+	go copyFn(c2, c1)
+	wg.Wait()
+	c1.Close()
+	c2.Close()
+}
+
+// reloads the ssh_config forwards and starts every forward on the new client (failures are recorded on the forward)
+func (conn *SSHConn) startForwards(client *ssh.Client) {
+	configSpecs := remote.GetConfigForwards(conn.Opts)
+	var forwards []*connForward
+	conn.WithLock(func() {
+		var newForwards []*connForward
+		for _, spec := range configSpecs {
+			newForwards = append(newForwards, makeConnForward(spec, true))
+		}
+		for _, fwd := range conn.Forwards {
+			if !fwd.FromConfig {
+				newForwards = append(newForwards, fwd)
+			}
+		}
+		conn.Forwards = newForwards
+		forwards = append(forwards, newForwards...)
+	})
+	for _, fwd := range forwards {
+		err := fwd.start(client)
+		if err != nil {
+			log.Printf("conn %s: error starting %s forward %s: %v\n", conn.GetName(), fwd.Spec.Type, fwd.Spec.ListenAddr, err)
+		}
+	}
+	// the connection can close while the forwards are starting
+	conn.WithLock(func() {
+		if conn.Client != client {
+			for _, fwd := range forwards {
+				fwd.stop()
+			}
+		}
+	})
+}
+
+func (conn *SSHConn) stopForwards_nolock() {
+	for _, fwd := range conn.Forwards {
+		fwd.stop()
+	}
+}
+
+func (conn *SSHConn) GetForwards() []wshrpc.ConnForward {
+	conn.Lock.Lock()
+	defer conn.Lock.Unlock()
+	return conn.getForwards_nolock()
+}
+
+func (conn *SSHConn) getForwards_nolock() []wshrpc.ConnForward {
+	var rtn []wshrpc.ConnForward
+	for _, fwd := range conn.Forwards {
+		rtn = append(rtn, fwd.toConnForward())
+	}
+	return rtn
+}
+
+// forwards added to a connection that is not connected are started when it connects
+func (conn *SSHConn) AddForward(spec wshrpc.ConnForwardSpec) (*wshrpc.ConnForward, error) {
+	spec, err := remote.NormalizeForwardSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	fwd := makeConnForward(spec, false)
+	var client *ssh.Client
+	conn.WithLock(func() {
+		for _, existing := range conn.Forwards {
+			if existing.Spec.Type == spec.Type && existing.Spec.ListenAddr == spec.ListenAddr {
+				err = fmt.Errorf("there is already a %s forward on %s (%s)", spec.Type, spec.ListenAddr, existing.ForwardId)
+				return
+			}
+		}
+		if conn.Status == Status_Connected {
+			client = conn.Client
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		err = fwd.start(client)
+		if err != nil {
+			return nil, err
+		}
+	}
+	conn.WithLock(func() {
+		conn.Forwards = append(conn.Forwards, fwd)
+		if client != nil && conn.Client != client {
+			fwd.stop()
+		}
+	})
+	conn.FireConnChangeEvent()
+	rtn := fwd.toConnForward()
+	return &rtn, nil
+}
+
+func (conn *SSHConn) RemoveForward(forwardId string) error {
+	var removed *connForward
+	conn.WithLock(func() {
+		for idx, fwd := range conn.Forwards {
+			if fwd.ForwardId == forwardId {
+				removed = fwd
+				conn.Forwards = append(conn.Forwards[:idx:idx], conn.Forwards[idx+1:]...)
+				return
+			}
+		}
+	})
+	if removed == nil {
+		return fmt.Errorf("forward %q not found on %s", forwardId, conn.GetName())
+	}
+	removed.stop()
+	conn.FireConnChangeEvent()
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conncontroller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+)
+
+// when a connected connection drops (network error, ServerAliveInterval timeout, unresponsive connserver)
+// it is reconnected with exponential backoff.  every attempt sends a connchange event (see the Reconnect*
+// fields of wshrpc.ConnStatus).  Close() or an explicit Connect() cancels a pending reconnect.
+// conn:autoreconnect is on by default, set it to false in settings.json (or for one connection in
+// connections.json) to turn it off, e.g. for hosts that prompt for a password on every connect.
+
+const (
+	ReconnectBaseDelay          = 1 * time.Second
+	ReconnectMaxDelay           = 60 * time.Second
+	DefaultReconnectMaxAttempts = 10
+)
+
+var reconnectHandlerLock = &sync.Mutex{}
+var reconnectHandler func(connName string)
+
+// the handler runs (in its own goroutine) after a successful automatic reconnect
+func SetReconnectHandler(handler func(connName string)) {
+	reconnectHandlerLock.Lock()
+	defer reconnectHandlerLock.Unlock()
+	reconnectHandler = handler
+}
+
+func runReconnectHandler(connName string) {
+	reconnectHandlerLock.Lock()
+	handler := reconnectHandler
+	reconnectHandlerLock.Unlock()
+	if handler != nil {
+		go handler(connName)
+	}
+}
+
+// connections.json wins over the settings.json defaults
+func getAutoReconnectOpts(connName string) (bool, int) {
+	watcher := wconfig.GetWatcher()
+	if watcher == nil {
+		return false, 0
+	}
+	fullConfig := watcher.GetFullConfig()
+	connConfig := fullConfig.ResolveConnConfig(connName)
+	enabled := fullConfig.Settings.ConnAutoReconnect
+	if connConfig.ConnAutoReconnect != nil {
+		enabled = *connConfig.ConnAutoReconnect
+	}
+	maxAttempts := DefaultReconnectMaxAttempts
+	if connConfig.ConnReconnectMaxAttempts > 0 {
+		maxAttempts = connConfig.ConnReconnectMaxAttempts
+	} else if fullConfig.Settings.ConnReconnectMaxAttempts > 0 {
+		maxAttempts = int(fullConfig.Settings.ConnReconnectMaxAttempts)
+	}
+	return enabled, maxAttempts
+}
+
+// 1s, 2s, 4s, ... up to ReconnectMaxDelay (attempts start at 1)
+func reconnectDelay(attempt int) time.Duration {
+	delay := ReconnectBaseDelay
+	for i := 1; i < attempt && delay < ReconnectMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, ReconnectMaxDelay)
+}
+
+func (conn *SSHConn) cancelReconnect_nolock() {
+	if conn.ReconnectCancelFn == nil {
+		return
+	}
+	conn.ReconnectCancelFn()
+	conn.ReconnectCancelFn = nil
+	conn.ReconnectAttempt = 0
+	conn.ReconnectMaxAttempts = 0
+	conn.NextReconnectTime = 0
+}
+
+func (conn *SSHConn) startReconnect() {
+	enabled, maxAttempts := getAutoReconnectOpts(conn.GetName())
+	if !enabled {
+		return
+	}
+	ctx, cancelFn := context.WithCancel(context.Background())
+	conn.WithLock(func() {
+		// a connection can drop right after a reconnect succeeds, before the old loop finishes
+		conn.cancelReconnect_nolock()
+		conn.ReconnectCancelFn = cancelFn
+		conn.ReconnectMaxAttempts = maxAttempts
+	})
+	log.Printf("conn %s: connection lost, reconnecting (max %d attempts)\n", conn.GetName(), maxAttempts)
+	go conn.runReconnectLoop(ctx, maxAttempts)
+}
+
+// clears the reconnect state, returns false if the reconnect was canceled (the state belongs to someone else)
+func (conn *SSHConn) finishReconnect(ctx context.Context, reconnectErr error) bool {
+	var owned bool
+	conn.WithLock(func() {
+		if ctx.Err() != nil {
+			return
+		}
+		owned = true
+		conn.cancelReconnect_nolock()
+		if reconnectErr != nil {
+			conn.Error = reconnectErr.Error()
+		}
+	})
+	if owned {
+		conn.FireConnChangeEvent()
+	}
+	return owned
+}
+
+func (conn *SSHConn) runReconnectLoop(ctx context.Context, maxAttempts int) {
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		delay := reconnectDelay(attempt)
+		var canceled bool
+		conn.WithLock(func() {
+			if ctx.Err() != nil {
+				canceled = true
+				return
+			}
+			conn.ReconnectAttempt = attempt
+			conn.NextReconnectTime = time.Now().Add(delay).UnixMilli()
+		})
+		if canceled {
+			return
+		}
+		conn.FireConnChangeEvent()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		conn.WithLock(func() {
+			if ctx.Err() == nil {
+				conn.NextReconnectTime = 0
+			}
+		})
+		log.Printf("conn %s: reconnect attempt %d/%d\n", conn.GetName(), attempt, maxAttempts)
+		attemptCtx, cancelFn := context.WithTimeout(ctx, DefaultConnectionTimeout)
+		lastErr = conn.connect(attemptCtx)
+		cancelFn()
+		if lastErr == nil {
+			if conn.finishReconnect(ctx, nil) {
+				log.Printf("conn %s: reconnected\n", conn.GetName())
+				runReconnectHandler(conn.GetName())
+			}
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("conn %s: reconnect attempt %d failed: %v\n", conn.GetName(), attempt, lastErr)
+	}
+	conn.finishReconnect(ctx, fmt.Errorf("reconnect failed after %d attempts: %w", maxAttempts, lastErr))
+}
@@ -0,0 +1,21 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conncontroller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectDelay(t *testing.T) {
+	expected := []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, 60 * time.Second, 60 * time.Second}
+	for idx, delay := range expected {
+		if rtn := reconnectDelay(idx + 1); rtn != delay {
+			t.Errorf("attempt %d: got %v, expected %v", idx+1, rtn, delay)
+		}
+	}
+	if rtn := reconnectDelay(1000); rtn != ReconnectMaxDelay {
+		t.Errorf("attempt 1000: got %v", rtn)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conncontroller
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// a minimal socks5 server (rfc 1928) for dynamic forwards: no authentication, CONNECT only
+
+const socks5Version = 5
+const socks5HandshakeTimeout = 30 * time.Second
+
+const (
+	socks5AuthNone         = 0x00
+	socks5AuthNoAcceptable = 0xff
+)
+
+const socks5CmdConnect = 0x01
+
+const (
+	socks5AddrIPv4   = 0x01
+	socks5AddrDomain = 0x03
+	socks5AddrIPv6   = 0x04
+)
+
+const (
+	socks5RepSuccess             = 0x00
+	socks5RepGeneralFailure      = 0x01
+	socks5RepHostUnreachable     = 0x04
+	socks5RepCmdNotSupported     = 0x07
+	socks5RepAddrTypeUnsupported = 0x08
+)
+
+func writeSocks5Reply(conn net.Conn, rep byte) error {
+	// the bound address is not meaningful for a forward, it is always 0.0.0.0:0
+	_, err := conn.Write([]byte{socks5Version, rep, 0, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+func readSocks5Request(conn net.Conn) (string, byte, error) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(conn, header)
+	if err != nil {
+		return "", 0, err
+	}
+	if header[0] != socks5Version {
+		return "", 0, fmt.Errorf("unsupported socks version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	_, err = io.ReadFull(conn, methods)
+	if err != nil {
+		return "", 0, err
+	}
+	var hasNoAuth bool
+	for _, method := range methods {
+		if method == socks5AuthNone {
+			hasNoAuth = true
+		}
+	}
+	if !hasNoAuth {
+		conn.Write([]byte{socks5Version, socks5AuthNoAcceptable})
+		return "", 0, errors.New("socks client does not support unauthenticated connections")
+	}
+	_, err = conn.Write([]byte{socks5Version, socks5AuthNone})
+	if err != nil {
+		return "", 0, err
+	}
+	request := make([]byte, 4)
+	_, err = io.ReadFull(conn, request)
+	if err != nil {
+		return "", 0, err
+	}
+	if request[0] != socks5Version {
+		return "", socks5RepGeneralFailure, fmt.Errorf("unsupported socks version %d", request[0])
+	}
+	if request[1] != socks5CmdConnect {
+		return "", socks5RepCmdNotSupported, fmt.Errorf("unsupported socks command %d", request[1])
+	}
+	var host string
+	switch request[3] {
+	case socks5AddrIPv4, socks5AddrIPv6:
+		addrLen := net.IPv4len
+		if request[3] == socks5AddrIPv6 {
+			addrLen = net.IPv6len
+		}
+		addr := make([]byte, addrLen)
+		_, err = io.ReadFull(conn, addr)
+		if err != nil {
+			return "", 0, err
+		}
+		host = net.IP(addr).String()
+	case socks5AddrDomain:
+		domainLen := make([]byte, 1)
+		_, err = io.ReadFull(conn, domainLen)
+		if err != nil {
+			return "", 0, err
+		}
+		domain := make([]byte, domainLen[0])
+		_, err = io.ReadFull(conn, domain)
+		if err != nil {
+			return "", 0, err
+		}
+		host = string(domain)
+	default:
+		return "", socks5RepAddrTypeUnsupported, fmt.Errorf("unsupported socks address type %d", request[3])
+	}
+	portBytes := make([]byte, 2)
+	_, err = io.ReadFull(conn, portBytes)
+	if err != nil {
+		return "", 0, err
+	}
+	port := binary.BigEndian.Uint16(portBytes)
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), 0, nil
+}
+
+// runs the socks handshake on conn and dials the requested address with dialFn
+func handleSocks5Conn(conn net.Conn, dialFn func(addr string) (net.Conn, error)) (net.Conn, error) {
+	conn.SetDeadline(time.Now().Add(socks5HandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+	addr, failRep, err := readSocks5Request(conn)
+	if err != nil {
+		if failRep != 0 {
+			writeSocks5Reply(conn, failRep)
+		}
+		return nil, err
+	}
+	targetConn, err := dialFn(addr)
+	if err != nil {
+		writeSocks5Reply(conn, socks5RepHostUnreachable)
+		return nil, fmt.Errorf("socks connect to %s: %w", addr, err)
+	}
+	err = writeSocks5Reply(conn, socks5RepSuccess)
+	if err != nil {
+		targetConn.Close()
+		return nil, err
+	}
+	return targetConn, nil
+}
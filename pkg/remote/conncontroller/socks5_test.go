@@ -0,0 +1,93 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conncontroller
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func runSocks5Handshake(t *testing.T, request []byte, dialErr error) (string, []byte, error) {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+	var dialedAddr string
+	type handleRtn struct {
+		conn net.Conn
+		err  error
+	}
+	rtnCh := make(chan handleRtn, 1)
+	go func() {
+		targetConn, err := handleSocks5Conn(serverConn, func(addr string) (net.Conn, error) {
+			dialedAddr = addr
+			if dialErr != nil {
+				return nil, dialErr
+			}
+			c1, c2 := net.Pipe()
+			c2.Close()
+			return c1, nil
+		})
+		// closing ends the client's read of the replies
+		serverConn.Close()
+		rtnCh <- handleRtn{targetConn, err}
+	}()
+	go clientConn.Write(request)
+	reply, _ := io.ReadAll(clientConn)
+	rtn := <-rtnCh
+	if rtn.conn != nil {
+		rtn.conn.Close()
+	}
+	return dialedAddr, reply, rtn.err
+}
+
+func TestSocks5Connect(t *testing.T) {
+	// greeting (no auth), then CONNECT example.com:443
+	request := []byte{5, 1, 0, 5, 1, 0, 3, 11}
+	request = append(request, []byte("example.com")...)
+	request = append(request, 0x01, 0xbb)
+	dialedAddr, reply, err := runSocks5Handshake(t, request, nil)
+	if err != nil {
+		t.Fatalf("handshake error: %v", err)
+	}
+	if dialedAddr != "example.com:443" {
+		t.Errorf("dialed %q", dialedAddr)
+	}
+	expected := []byte{5, 0, 5, socks5RepSuccess, 0, socks5AddrIPv4, 0, 0, 0, 0, 0, 0}
+	if !bytes.Equal(reply, expected) {
+		t.Errorf("bad reply %v", reply)
+	}
+}
+
+func TestSocks5Failures(t *testing.T) {
+	// CONNECT 10.0.0.1:22, the dial fails
+	request := []byte{5, 1, 0, 5, 1, 0, 1, 10, 0, 0, 1, 0, 22}
+	dialedAddr, reply, err := runSocks5Handshake(t, request, errors.New("connection refused"))
+	if err == nil {
+		t.Errorf("expected a dial error")
+	}
+	if dialedAddr != "10.0.0.1:22" {
+		t.Errorf("dialed %q", dialedAddr)
+	}
+	if len(reply) != 12 || reply[3] != socks5RepHostUnreachable {
+		t.Errorf("bad reply for a failed dial %v", reply)
+	}
+
+	// BIND is not supported
+	request = []byte{5, 1, 0, 5, 2, 0, 1, 10, 0, 0, 1, 0, 22}
+	_, reply, err = runSocks5Handshake(t, request, nil)
+	if err == nil || len(reply) != 12 || reply[3] != socks5RepCmdNotSupported {
+		t.Errorf("BIND: bad reply %v (%v)", reply, err)
+	}
+
+	// only username/password auth offered
+	request = []byte{5, 1, 2}
+	_, reply, err = runSocks5Handshake(t, request, nil)
+	if err == nil || !bytes.Equal(reply, []byte{5, socks5AuthNoAcceptable}) {
+		t.Errorf("auth: bad reply %v (%v)", reply, err)
+	}
+}
@@ -20,7 +20,27 @@ import (
 
 var userHostRe = regexp.MustCompile(`^([a-zA-Z0-9][a-zA-Z0-9._@\\-]*@)?([a-z0-9][a-z0-9.-]*)(?::([0-9]+))?$`)
 
+// parses [-J jumphost[,jumphost...]] [user@]host[:port]
 func ParseOpts(input string) (*SSHOpts, error) {
+	var proxyJump string
+	if strings.HasPrefix(input, "-J") {
+		fields := strings.Fields(strings.TrimPrefix(input, "-J"))
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid format of -J jumphost user@host argument")
+		}
+		// "-J none" turns off a ProxyJump from ssh config
+		proxyJump = "none"
+		if strings.ToLower(fields[0]) != "none" {
+			jumpHosts := parseProxyJump(fields[0])
+			for _, jumpStr := range jumpHosts {
+				if !userHostRe.MatchString(jumpStr) {
+					return nil, fmt.Errorf("invalid format of jump host %q", jumpStr)
+				}
+			}
+			proxyJump = strings.Join(jumpHosts, ",")
+		}
+		input = fields[1]
+	}
 	m := userHostRe.FindStringSubmatch(input)
 	if m == nil {
 		return nil, fmt.Errorf("invalid format of user@host argument")
@@ -36,7 +56,7 @@ func ParseOpts(input string) (*SSHOpts, error) {
 		}
 	}
 
-	return &SSHOpts{SSHHost: remoteHost, SSHUser: remoteUser, SSHPort: remotePort}, nil
+	return &SSHOpts{SSHHost: remoteHost, SSHUser: remoteUser, SSHPort: remotePort, ProxyJump: proxyJump}, nil
 }
 
 func DetectShell(client *ssh.Client) (string, error) {
@@ -0,0 +1,51 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseOptsProxyJump(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    SSHOpts
+		wantStr string
+	}{
+		{"user@host:2222", SSHOpts{SSHHost: "host", SSHUser: "user", SSHPort: 2222}, "user@host:2222"},
+		{"-J bastion host", SSHOpts{SSHHost: "host", ProxyJump: "bastion"}, "-J bastion host"},
+		{"-J admin@b1:2200,b2 user@host", SSHOpts{SSHHost: "host", SSHUser: "user", ProxyJump: "admin@b1:2200,b2"}, ""},
+		{"-Jb1,b2 host", SSHOpts{SSHHost: "host", ProxyJump: "b1,b2"}, "-J b1,b2 host"},
+		{"-J none host", SSHOpts{SSHHost: "host", ProxyJump: "none"}, "-J none host"},
+	}
+	for _, test := range tests {
+		opts, err := ParseOpts(test.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.input, err)
+			continue
+		}
+		if *opts != test.want {
+			t.Errorf("%q: got %#v, want %#v", test.input, *opts, test.want)
+		}
+		if test.wantStr != "" && opts.String() != test.wantStr {
+			t.Errorf("%q: String() = %q, want %q", test.input, opts.String(), test.wantStr)
+		}
+		reparsed, err := ParseOpts(opts.String())
+		if err != nil || *reparsed != *opts {
+			t.Errorf("%q: String() does not round trip (%q)", test.input, opts.String())
+		}
+	}
+	for _, input := range []string{"-J host", "-J bad/host host", "-J b1 host extra"} {
+		if _, err := ParseOpts(input); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+	if jumps := parseProxyJump(" b1 , user@b2:22 "); !slices.Equal(jumps, []string{"b1", "user@b2:22"}) {
+		t.Errorf("bad proxyjump parse: %v", jumps)
+	}
+	if jumps := parseProxyJump("None"); jumps != nil {
+		t.Errorf("none should disable proxyjump: %v", jumps)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/skeema/knownhosts"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// openssh user certificates: the certs from CertificateFile and the "<identityfile>-cert.pub" next to each
+// identity file are paired with the private key (from a file or the agent) they certify.  certificate
+// signers are offered before the plain key.
+
+const certFileSuffix = "-cert.pub"
+
+func readUserCertificate(certFile string) (*ssh.Certificate, error) {
+	certBytes, err := os.ReadFile(wavebase.ExpandHomeDir(certFile))
+	if err != nil {
+		return nil, err
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(certBytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse certificate %s: %w", certFile, err)
+	}
+	cert, ok := pubKey.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a certificate", certFile)
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("%s is not a user certificate", certFile)
+	}
+	return cert, nil
+}
+
+func isCertExpired(cert *ssh.Certificate, now time.Time) bool {
+	unixNow := uint64(now.Unix())
+	return unixNow < cert.ValidAfter || (cert.ValidBefore != ssh.CertTimeInfinity && unixNow >= cert.ValidBefore)
+}
+
+// certs from CertificateFile (errors are logged) and the -cert.pub files paired with IdentityFile (skipped if
+// missing).  expired certs are skipped, servers would refuse them.
+func findUserCertificates(sshKeywords *SshKeywords) []*ssh.Certificate {
+	var rtn []*ssh.Certificate
+	seen := make(map[string]bool)
+	addCert := func(certFile string, logMissing bool) {
+		cert, err := readUserCertificate(certFile)
+		if err != nil {
+			if logMissing || !os.IsNotExist(err) {
+				log.Printf("skipping ssh certificate: %v\n", err)
+			}
+			return
+		}
+		if isCertExpired(cert, time.Now()) {
+			log.Printf("skipping ssh certificate %s: expired or not yet valid\n", certFile)
+			return
+		}
+		certKey := string(cert.Marshal())
+		if seen[certKey] {
+			return
+		}
+		seen[certKey] = true
+		rtn = append(rtn, cert)
+	}
+	for _, certFile := range sshKeywords.CertificateFile {
+		addCert(certFile, true)
+	}
+	for _, identityFile := range sshKeywords.IdentityFile {
+		addCert(identityFile+certFileSuffix, false)
+	}
+	return rtn
+}
+
+func certMatchesKey(cert *ssh.Certificate, pubKey ssh.PublicKey) bool {
+	return bytes.Equal(cert.Key.Marshal(), pubKey.Marshal())
+}
+
+// the certificate signers for signer's key, followed by signer itself
+func withCertSigners(certs []*ssh.Certificate, signer ssh.Signer) []ssh.Signer {
+	var rtn []ssh.Signer
+	if _, isCert := signer.PublicKey().(*ssh.Certificate); !isCert {
+		for _, cert := range certs {
+			if !certMatchesKey(cert, signer.PublicKey()) {
+				continue
+			}
+			certSigner, err := ssh.NewCertSigner(cert, signer)
+			if err != nil {
+				log.Printf("cannot use ssh certificate (key id %q): %v\n", cert.KeyId, err)
+				continue
+			}
+			rtn = append(rtn, certSigner)
+		}
+	}
+	return append(rtn, signer)
+}
+
+// agents can hold certificates (ssh-add adds the -cert.pub next to a key), they are offered first
+func sortAgentSigners(signers []ssh.Signer) []ssh.Signer {
+	sorted := append([]ssh.Signer(nil), signers...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		_, iCert := sorted[i].PublicKey().(*ssh.Certificate)
+		_, jCert := sorted[j].PublicKey().(*ssh.Certificate)
+		return iCert && !jCert
+	})
+	return sorted
+}
+
+// AddKeysToAgent adds the key along with its certificates (like openssh)
+func addKeyToAgent(agentClient agent.ExtendedAgent, privateKey any, pubKey ssh.PublicKey, certs []*ssh.Certificate) {
+	agentClient.Add(agent.AddedKey{PrivateKey: privateKey})
+	for _, cert := range certs {
+		if certMatchesKey(cert, pubKey) {
+			agentClient.Add(agent.AddedKey{PrivateKey: privateKey, Certificate: cert})
+		}
+	}
+}
+
+// the @cert-authority keys in known_hosts that apply to the host
+func getHostCertAuthorities(keyDb *knownhosts.HostKeyDB, hostWithPort string) []ssh.PublicKey {
+	if keyDb == nil {
+		return nil
+	}
+	var rtn []ssh.PublicKey
+	for _, hostKey := range keyDb.HostKeys(hostWithPort) {
+		if hostKey.Cert {
+			rtn = append(rtn, hostKey.PublicKey)
+		}
+	}
+	return rtn
+}
+
+func containsKey(keys []ssh.PublicKey, key ssh.PublicKey) bool {
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/skeema/knownhosts"
+	"golang.org/x/crypto/ssh"
+)
+
+func makeTestSigner(t *testing.T) ssh.Signer {
+	_, privKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(privKey)
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+	return signer
+}
+
+func makeTestCert(t *testing.T, key ssh.PublicKey, caSigner ssh.Signer, certType uint32, principal string, validBefore time.Time) *ssh.Certificate {
+	cert := &ssh.Certificate{
+		Key:             key,
+		CertType:        certType,
+		KeyId:           "test",
+		ValidPrincipals: []string{principal},
+		ValidAfter:      uint64(time.Now().Add(-time.Hour).Unix()),
+		ValidBefore:     uint64(validBefore.Unix()),
+	}
+	err := cert.SignCert(rand.Reader, caSigner)
+	if err != nil {
+		t.Fatalf("error signing cert: %v", err)
+	}
+	return cert
+}
+
+func writeTestCert(t *testing.T, filename string, cert *ssh.Certificate) {
+	err := os.WriteFile(filename, ssh.MarshalAuthorizedKey(cert), 0600)
+	if err != nil {
+		t.Fatalf("error writing cert: %v", err)
+	}
+}
+
+func TestUserCertificates(t *testing.T) {
+	caSigner := makeTestSigner(t)
+	keySigner := makeTestSigner(t)
+	otherSigner := makeTestSigner(t)
+	validUntil := time.Now().Add(time.Hour)
+	tmpDir := t.TempDir()
+
+	identityFile := filepath.Join(tmpDir, "id_ed25519")
+	writeTestCert(t, identityFile+certFileSuffix, makeTestCert(t, keySigner.PublicKey(), caSigner, ssh.UserCert, "test", validUntil))
+	otherCertFile := filepath.Join(tmpDir, "other-cert.pub")
+	writeTestCert(t, otherCertFile, makeTestCert(t, otherSigner.PublicKey(), caSigner, ssh.UserCert, "test", validUntil))
+	expiredCertFile := filepath.Join(tmpDir, "expired-cert.pub")
+	writeTestCert(t, expiredCertFile, makeTestCert(t, keySigner.PublicKey(), caSigner, ssh.UserCert, "test", time.Now().Add(-time.Minute)))
+	hostCertFile := filepath.Join(tmpDir, "host-cert.pub")
+	writeTestCert(t, hostCertFile, makeTestCert(t, keySigner.PublicKey(), caSigner, ssh.HostCert, "test", validUntil))
+
+	sshKeywords := &SshKeywords{
+		IdentityFile:    []string{identityFile, filepath.Join(tmpDir, "id_rsa")},
+		CertificateFile: []string{otherCertFile, expiredCertFile, hostCertFile, filepath.Join(tmpDir, "missing-cert.pub")},
+	}
+	certs := findUserCertificates(sshKeywords)
+	if len(certs) != 2 {
+		t.Fatalf("expected 2 certificates (paired identity cert and other), got %d", len(certs))
+	}
+
+	signers := withCertSigners(certs, keySigner)
+	if len(signers) != 2 {
+		t.Fatalf("expected a cert signer and the key signer, got %d signers", len(signers))
+	}
+	cert, ok := signers[0].PublicKey().(*ssh.Certificate)
+	if !ok || !certMatchesKey(cert, keySigner.PublicKey()) {
+		t.Errorf("first signer should be the certificate for the key")
+	}
+	if signers[1] != keySigner {
+		t.Errorf("last signer should be the plain key")
+	}
+
+	// a signer that is already a certificate (from the agent) is not paired again, and goes first
+	sorted := sortAgentSigners([]ssh.Signer{keySigner, signers[0]})
+	if sorted[0] != signers[0] {
+		t.Errorf("agent certificate signers should be offered first")
+	}
+	if len(withCertSigners(certs, signers[0])) != 1 {
+		t.Errorf("certificate signers should not be paired with certificates")
+	}
+}
+
+func TestHostCertAuthorities(t *testing.T) {
+	caSigner := makeTestSigner(t)
+	hostSigner := makeTestSigner(t)
+	knownHostsFile := filepath.Join(t.TempDir(), "known_hosts")
+	knownHostsData := "@cert-authority *.example.com " + string(ssh.MarshalAuthorizedKey(caSigner.PublicKey())) +
+		knownhosts.Line([]string{"plain.example.com"}, hostSigner.PublicKey()) + "\n"
+	err := os.WriteFile(knownHostsFile, []byte(knownHostsData), 0600)
+	if err != nil {
+		t.Fatalf("error writing known_hosts: %v", err)
+	}
+	keyDb, err := knownhosts.NewDB(knownHostsFile)
+	if err != nil {
+		t.Fatalf("error reading known_hosts: %v", err)
+	}
+	hostCAs := getHostCertAuthorities(keyDb, "db.example.com:22")
+	if len(hostCAs) != 1 || !containsKey(hostCAs, caSigner.PublicKey()) {
+		t.Errorf("expected the CA for db.example.com, got %d keys", len(hostCAs))
+	}
+	if containsKey(getHostCertAuthorities(keyDb, "plain.example.com:22"), hostSigner.PublicKey()) {
+		t.Errorf("plain host keys are not authorities")
+	}
+	if len(getHostCertAuthorities(keyDb, "other.org:22")) != 0 {
+		t.Errorf("expected no authorities for other.org")
+	}
+
+	// a host certificate signed by the CA passes the known_hosts check
+	hostCert := makeTestCert(t, hostSigner.PublicKey(), caSigner, ssh.HostCert, "db.example.com", time.Now().Add(time.Hour))
+	err = keyDb.HostKeyCallback()("db.example.com:22", &testAddr{}, hostCert)
+	if err != nil {
+		t.Errorf("host certificate was rejected: %v", err)
+	}
+}
+
+type testAddr struct{}
+
+func (testAddr) Network() string { return "tcp" }
+func (testAddr) String() string  { return "10.0.0.1:22" }
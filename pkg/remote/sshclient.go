@@ -35,6 +35,9 @@ type UserInputCancelError struct {
 	Err error
 }
 
+// limits ProxyJump chains (including jump hosts that have their own ProxyJump) so config loops fail
+const MaxProxyJumpHops = 10
+
 type HostKeyAlgorithms = func(hostWithPort string) (algos []string)
 
 func (uice UserInputCancelError) Error() string {
@@ -85,9 +88,9 @@ func createPublicKeyCallback(connCtx context.Context, sshKeywords *SshKeywords,
 	}
 	// require pointer to modify list in closure
 	identityFilesPtr := &identityFiles
+	certs := findUserCertificates(sshKeywords)
 
-	var authSockSigners []ssh.Signer
-	authSockSigners = append(authSockSigners, authSockSignersExt...)
+	authSockSigners := sortAgentSigners(authSockSignersExt)
 	authSockSignersPtr := &authSockSigners
 
 	return func() ([]ssh.Signer, error) {
@@ -95,7 +98,7 @@ func createPublicKeyCallback(connCtx context.Context, sshKeywords *SshKeywords,
 		if len(*authSockSignersPtr) != 0 {
 			authSockSigner := (*authSockSignersPtr)[0]
 			*authSockSignersPtr = (*authSockSignersPtr)[1:]
-			return []ssh.Signer{authSockSigner}, nil
+			return withCertSigners(certs, authSockSigner), nil
 		}
 
 		if len(*identityFilesPtr) == 0 {
@@ -115,11 +118,9 @@ func createPublicKeyCallback(connCtx context.Context, sshKeywords *SshKeywords,
 			signer, err := ssh.NewSignerFromKey(unencryptedPrivateKey)
 			if err == nil {
 				if sshKeywords.AddKeysToAgent && agentClient != nil {
-					agentClient.Add(agent.AddedKey{
-						PrivateKey: unencryptedPrivateKey,
-					})
+					addKeyToAgent(agentClient, unencryptedPrivateKey, signer.PublicKey(), certs)
 				}
-				return []ssh.Signer{signer}, err
+				return withCertSigners(certs, signer), err
 			}
 		}
 		if _, ok := err.(*ssh.PassphraseMissingError); !ok {
@@ -157,11 +158,9 @@ func createPublicKeyCallback(connCtx context.Context, sshKeywords *SshKeywords,
 			return createDummySigner()
 		}
 		if sshKeywords.AddKeysToAgent && agentClient != nil {
-			agentClient.Add(agent.AddedKey{
-				PrivateKey: unencryptedPrivateKey,
-			})
+			addKeyToAgent(agentClient, unencryptedPrivateKey, signer.PublicKey(), certs)
 		}
-		return []ssh.Signer{signer}, err
+		return withCertSigners(certs, signer), err
 	}
 }
 
@@ -367,6 +366,7 @@ func createHostKeyCallback(opts *SSHOpts) (ssh.HostKeyCallback, HostKeyAlgorithm
 	// and we try again
 	var basicCallback ssh.HostKeyCallback
 	var hostKeyAlgorithms HostKeyAlgorithms
+	var knownHostsDb *knownhosts.HostKeyDB
 	for basicCallback == nil && len(knownHostsFiles) > 0 {
 		keyDb, err := knownhosts.NewDB(knownHostsFiles...)
 		if serr, ok := err.(*os.PathError); ok {
@@ -388,6 +388,7 @@ func createHostKeyCallback(opts *SSHOpts) (ssh.HostKeyCallback, HostKeyAlgorithm
 		} else {
 			basicCallback = keyDb.HostKeyCallback()
 			hostKeyAlgorithms = keyDb.HostKeyAlgorithms
+			knownHostsDb = keyDb
 		}
 	}
 
@@ -402,7 +403,21 @@ func createHostKeyCallback(opts *SSHOpts) (ssh.HostKeyCallback, HostKeyAlgorithm
 		}
 	}
 
-	waveHostKeyCallback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	var waveHostKeyCallback ssh.HostKeyCallback
+	waveHostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		hostCAs := getHostCertAuthorities(knownHostsDb, hostname)
+		if cert, ok := key.(*ssh.Certificate); ok {
+			if !containsKey(hostCAs, cert.SignatureKey) {
+				// like openssh, a host certificate from an unknown authority falls back to the plain host key
+				log.Printf("host certificate for %s is not signed by a @cert-authority in known_hosts, checking the host key\n", hostname)
+				return waveHostKeyCallback(hostname, remote, cert.Key)
+			}
+			err := basicCallback(hostname, remote, key)
+			if err != nil {
+				return fmt.Errorf("invalid host certificate for %s: %w", hostname, err)
+			}
+			return nil
+		}
 		err := basicCallback(hostname, remote, key)
 		if err == nil {
 			// success
@@ -415,6 +430,14 @@ func createHostKeyCallback(opts *SSHOpts) (ssh.HostKeyCallback, HostKeyAlgorithm
 			return err
 		}
 		serr, _ := err.(*xknownhosts.KeyError)
+		// @cert-authority keys are not host keys, a host that only has those is unknown (not changed)
+		var wantHostKeys []xknownhosts.KnownKey
+		for _, knownKey := range serr.Want {
+			if !containsKey(hostCAs, knownKey.Key) {
+				wantHostKeys = append(wantHostKeys, knownKey)
+			}
+		}
+		serr = &xknownhosts.KeyError{Want: wantHostKeys}
 		if len(serr.Want) == 0 {
 			// the key was not found
 
@@ -495,6 +518,35 @@ func createHostKeyCallback(opts *SSHOpts) (ssh.HostKeyCallback, HostKeyAlgorithm
 	return waveHostKeyCallback, hostKeyAlgorithms, nil
 }
 
+// the connection to the next hop, closing it also closes the jump host's client (and the hops before it)
+type proxyJumpConn struct {
+	net.Conn
+	JumpClient *ssh.Client
+}
+
+func (c *proxyJumpConn) Close() error {
+	err := c.Conn.Close()
+	c.JumpClient.Close()
+	return err
+}
+
+func dialThroughJumpHost(ctx context.Context, jumpClient *ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	// opening the channel does not take a context, closing the jump client unblocks it
+	stopFn := context.AfterFunc(ctx, func() {
+		jumpClient.Close()
+	})
+	defer stopFn()
+	conn, err := jumpClient.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(&proxyJumpConn{Conn: conn, JumpClient: jumpClient}, addr, config)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
 func DialContext(ctx context.Context, network string, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
 	d := net.Dialer{Timeout: config.Timeout}
 	conn, err := d.DialContext(ctx, network, addr)
@@ -509,6 +561,19 @@ func DialContext(ctx context.Context, network string, addr string, config *ssh.C
 }
 
 func ConnectToClient(connCtx context.Context, opts *SSHOpts) (*ssh.Client, error) {
+	return connectToClientInternal(connCtx, opts, nil, 0)
+}
+
+// connects through jumpClient when it is set (the next hop of a ProxyJump chain).  like openssh, ProxyJump
+// is only used for direct connections (the first jump host can have its own ProxyJump, later hops can't).
+// every hop gets its own ssh config, auth (and user input prompts) and host key verification.
+// jumpClient is closed if the connection fails.
+func connectToClientInternal(connCtx context.Context, opts *SSHOpts, jumpClient *ssh.Client, jumpNum int) (rtnClient *ssh.Client, rtnErr error) {
+	defer func() {
+		if rtnErr != nil && jumpClient != nil {
+			jumpClient.Close()
+		}
+	}()
 	sshConfigKeywords, err := findSshConfigKeywords(opts.SSHHost)
 	if err != nil {
 		return nil, err
@@ -518,6 +583,23 @@ func ConnectToClient(connCtx context.Context, opts *SSHOpts) (*ssh.Client, error
 	if err != nil {
 		return nil, err
 	}
+
+	if jumpClient == nil {
+		for _, jumpStr := range sshKeywords.ProxyJump {
+			jumpNum++
+			if jumpNum > MaxProxyJumpHops {
+				return nil, fmt.Errorf("too many ProxyJump hops connecting to %s (max %d), check ssh config for loops", opts.SSHHost, MaxProxyJumpHops)
+			}
+			jumpOpts, err := ParseOpts(jumpStr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ProxyJump host %q: %w", jumpStr, err)
+			}
+			jumpClient, err = connectToClientInternal(connCtx, jumpOpts, jumpClient, jumpNum)
+			if err != nil {
+				return nil, fmt.Errorf("ProxyJump %s: %w", jumpOpts.String(), err)
+			}
+		}
+	}
 	remoteName := sshKeywords.User + "@" + xknownhosts.Normalize(sshKeywords.HostName+":"+sshKeywords.Port)
 
 	var authSockSigners []ssh.Signer
@@ -573,7 +655,25 @@ func ConnectToClient(connCtx context.Context, opts *SSHOpts) (*ssh.Client, error
 		HostKeyCallback:   hostKeyCallback,
 		HostKeyAlgorithms: hostKeyAlgorithms(networkAddr),
 	}
-	return DialContext(connCtx, "tcp", networkAddr, clientConfig)
+	var client *ssh.Client
+	if jumpClient != nil {
+		client, err = dialThroughJumpHost(connCtx, jumpClient, networkAddr, clientConfig)
+	} else if sshKeywords.ProxyCommand != "" {
+		proxyCommand, expandErr := expandProxyCommand(sshKeywords.ProxyCommand, opts, sshKeywords)
+		if expandErr != nil {
+			return nil, expandErr
+		}
+		client, err = dialProxyCommand(connCtx, proxyCommand, networkAddr, clientConfig)
+	} else {
+		client, err = DialContext(connCtx, "tcp", networkAddr, clientConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sshKeywords.ServerAliveInterval > 0 {
+		go runServerAliveLoop(client, remoteName, time.Duration(sshKeywords.ServerAliveInterval)*time.Second, sshKeywords.ServerAliveCountMax)
+	}
+	return client, nil
 }
 
 type SshKeywords struct {
@@ -581,6 +681,7 @@ type SshKeywords struct {
 	HostName                     string
 	Port                         string
 	IdentityFile                 []string
+	CertificateFile              []string
 	BatchMode                    bool
 	PubkeyAuthentication         bool
 	PasswordAuthentication       bool
@@ -588,6 +689,10 @@ type SshKeywords struct {
 	PreferredAuthentications     []string
 	AddKeysToAgent               bool
 	IdentityAgent                string
+	ProxyJump                    []string
+	ProxyCommand                 string
+	ServerAliveInterval          int // seconds, 0 disables
+	ServerAliveCountMax          int
 }
 
 func combineSshKeywords(opts *SSHOpts, configKeywords *SshKeywords) (*SshKeywords, error) {
@@ -622,6 +727,7 @@ func combineSshKeywords(opts *SSHOpts, configKeywords *SshKeywords) (*SshKeyword
 	}
 
 	sshKeywords.IdentityFile = configKeywords.IdentityFile
+	sshKeywords.CertificateFile = configKeywords.CertificateFile
 
 	// these are not officially supported in the waveterm frontend but can be configured
 	// in ssh config files
@@ -633,6 +739,16 @@ func combineSshKeywords(opts *SSHOpts, configKeywords *SshKeywords) (*SshKeyword
 	sshKeywords.AddKeysToAgent = configKeywords.AddKeysToAgent
 	sshKeywords.IdentityAgent = configKeywords.IdentityAgent
 
+	// a -J connection option replaces the ProxyJump from ssh config (same as openssh)
+	if opts.ProxyJump != "" {
+		sshKeywords.ProxyJump = parseProxyJump(opts.ProxyJump)
+	} else {
+		sshKeywords.ProxyJump = configKeywords.ProxyJump
+	}
+	sshKeywords.ProxyCommand = configKeywords.ProxyCommand
+	sshKeywords.ServerAliveInterval = configKeywords.ServerAliveInterval
+	sshKeywords.ServerAliveCountMax = configKeywords.ServerAliveCountMax
+
 	return sshKeywords, nil
 }
 
@@ -668,6 +784,12 @@ func findSshConfigKeywords(hostPattern string) (*SshKeywords, error) {
 	}
 	sshKeywords.IdentityFile = identityFileRaw
 
+	certificateFileRaw := ssh_config.GetAll(hostPattern, "CertificateFile")
+	for i := 0; i < len(certificateFileRaw); i++ {
+		certificateFileRaw[i] = trimquotes.TryTrimQuotes(certificateFileRaw[i])
+	}
+	sshKeywords.CertificateFile = certificateFileRaw
+
 	batchModeRaw, err := ssh_config.GetStrict(hostPattern, "BatchMode")
 	if err != nil {
 		return nil, err
@@ -723,19 +845,72 @@ func findSshConfigKeywords(hostPattern string) (*SshKeywords, error) {
 		sshKeywords.IdentityAgent = wavebase.ExpandHomeDir(trimquotes.TryTrimQuotes(identityAgentRaw))
 	}
 
+	proxyJumpRaw, err := ssh_config.GetStrict(hostPattern, "ProxyJump")
+	if err != nil {
+		return nil, err
+	}
+	sshKeywords.ProxyJump = parseProxyJump(trimquotes.TryTrimQuotes(proxyJumpRaw))
+
+	// the command is run by the shell, so quotes are left alone
+	proxyCommandRaw, err := ssh_config.GetStrict(hostPattern, "ProxyCommand")
+	if err != nil {
+		return nil, err
+	}
+	proxyCommandRaw = strings.TrimSpace(proxyCommandRaw)
+	if strings.ToLower(proxyCommandRaw) != "none" {
+		sshKeywords.ProxyCommand = proxyCommandRaw
+	}
+
+	serverAliveIntervalRaw, err := ssh_config.GetStrict(hostPattern, "ServerAliveInterval")
+	if err != nil {
+		return nil, err
+	}
+	sshKeywords.ServerAliveInterval, err = strconv.Atoi(trimquotes.TryTrimQuotes(serverAliveIntervalRaw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ServerAliveInterval %q", serverAliveIntervalRaw)
+	}
+	serverAliveCountMaxRaw, err := ssh_config.GetStrict(hostPattern, "ServerAliveCountMax")
+	if err != nil {
+		return nil, err
+	}
+	sshKeywords.ServerAliveCountMax, err = strconv.Atoi(trimquotes.TryTrimQuotes(serverAliveCountMaxRaw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ServerAliveCountMax %q", serverAliveCountMaxRaw)
+	}
+
 	return sshKeywords, nil
 }
 
+// ProxyJump is a comma separated list of [user@]host[:port], "none" disables it
+func parseProxyJump(proxyJumpStr string) []string {
+	proxyJumpStr = strings.TrimSpace(proxyJumpStr)
+	if proxyJumpStr == "" || strings.ToLower(proxyJumpStr) == "none" {
+		return nil
+	}
+	var rtn []string
+	for _, jumpStr := range strings.Split(proxyJumpStr, ",") {
+		jumpStr = strings.TrimSpace(jumpStr)
+		if jumpStr != "" {
+			rtn = append(rtn, jumpStr)
+		}
+	}
+	return rtn
+}
+
 type SSHOpts struct {
-	SSHHost string `json:"sshhost"`
-	SSHUser string `json:"sshuser"`
-	SSHPort int    `json:"sshport,omitempty"`
+	SSHHost   string `json:"sshhost"`
+	SSHUser   string `json:"sshuser"`
+	SSHPort   int    `json:"sshport,omitempty"`
+	ProxyJump string `json:"proxyjump,omitempty"` // comma separated jump hosts (the -J connection option)
 }
 
 func (opts SSHOpts) String() string {
 	stringRepr := ""
+	if opts.ProxyJump != "" {
+		stringRepr = "-J " + opts.ProxyJump + " "
+	}
 	if opts.SSHUser != "" {
-		stringRepr = opts.SSHUser + "@"
+		stringRepr = stringRepr + opts.SSHUser + "@"
 	}
 	stringRepr = stringRepr + opts.SSHHost
 	if opts.SSHPort != 0 {
@@ -0,0 +1,185 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/kevinburke/ssh_config"
+	"github.com/wavetermdev/waveterm/pkg/trimquotes"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// port forward specs, from ssh_config (LocalForward, RemoteForward, DynamicForward) or in the
+// -L/-R/-D style of the ssh command line.  unix socket forwards are not supported.
+
+var configForwardKeywords = map[string]string{
+	"LocalForward":   wshrpc.ConnForwardType_Local,
+	"RemoteForward":  wshrpc.ConnForwardType_Remote,
+	"DynamicForward": wshrpc.ConnForwardType_Dynamic,
+}
+
+// splits on the colons that are not inside of [] (ipv6 addresses)
+func splitForwardArg(arg string) []string {
+	var parts []string
+	var inBrackets bool
+	start := 0
+	for idx, ch := range arg {
+		switch ch {
+		case '[':
+			inBrackets = true
+		case ']':
+			inBrackets = false
+		case ':':
+			if !inBrackets {
+				parts = append(parts, arg[start:idx])
+				start = idx + 1
+			}
+		}
+	}
+	return append(parts, arg[start:])
+}
+
+func isValidPort(portStr string, allowZero bool) bool {
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return false
+	}
+	return port <= 65535 && (port > 0 || (allowZero && port == 0))
+}
+
+// like openssh, forwards listen on localhost unless there is a bind address ("*" listens on every interface)
+func makeForwardListenAddr(bindAddr string, port string) (string, error) {
+	if !isValidPort(port, true) {
+		return "", fmt.Errorf("invalid listen port %q", port)
+	}
+	bindAddr = strings.Trim(bindAddr, "[]")
+	if bindAddr == "" || bindAddr == "localhost" {
+		bindAddr = "localhost"
+	} else if bindAddr == "*" {
+		bindAddr = "0.0.0.0"
+	}
+	return net.JoinHostPort(bindAddr, port), nil
+}
+
+func makeForwardTargetAddr(host string, port string) (string, error) {
+	host = strings.Trim(host, "[]")
+	if host == "" {
+		return "", fmt.Errorf("no target host")
+	}
+	if !isValidPort(port, false) {
+		return "", fmt.Errorf("invalid target port %q", port)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func isValidForwardType(forwardType string) bool {
+	return forwardType == wshrpc.ConnForwardType_Local || forwardType == wshrpc.ConnForwardType_Remote || forwardType == wshrpc.ConnForwardType_Dynamic
+}
+
+// parses -L/-R "[bind_address:]port:host:hostport" and -D "[bind_address:]port"
+func ParseForwardArg(forwardType string, arg string) (*wshrpc.ConnForwardSpec, error) {
+	if !isValidForwardType(forwardType) {
+		return nil, fmt.Errorf("invalid forward type %q", forwardType)
+	}
+	parts := splitForwardArg(arg)
+	spec := &wshrpc.ConnForwardSpec{Type: forwardType}
+	var err error
+	if forwardType == wshrpc.ConnForwardType_Dynamic {
+		switch len(parts) {
+		case 1:
+			spec.ListenAddr, err = makeForwardListenAddr("", parts[0])
+		case 2:
+			spec.ListenAddr, err = makeForwardListenAddr(parts[0], parts[1])
+		default:
+			return nil, fmt.Errorf("invalid dynamic forward %q (should be [bind_address:]port)", arg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return spec, nil
+	}
+	switch len(parts) {
+	case 3:
+		spec.ListenAddr, err = makeForwardListenAddr("", parts[0])
+	case 4:
+		spec.ListenAddr, err = makeForwardListenAddr(parts[0], parts[1])
+		parts = parts[1:]
+	default:
+		return nil, fmt.Errorf("invalid %s forward %q (should be [bind_address:]port:host:hostport)", forwardType, arg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	spec.TargetAddr, err = makeForwardTargetAddr(parts[1], parts[2])
+	if err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// parses the value of a LocalForward, RemoteForward ("[bind_address:]port host:hostport") or DynamicForward line
+func parseConfigForward(forwardType string, value string) (*wshrpc.ConnForwardSpec, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 1 && forwardType == wshrpc.ConnForwardType_Dynamic {
+		return ParseForwardArg(forwardType, fields[0])
+	}
+	if len(fields) != 2 || forwardType == wshrpc.ConnForwardType_Dynamic {
+		return nil, fmt.Errorf("invalid %s forward %q", forwardType, value)
+	}
+	return ParseForwardArg(forwardType, fields[0]+":"+fields[1])
+}
+
+// checks specs that come from rpc clients
+// validates a spec (from an rpc client) and normalizes its listen address the same way as ParseForwardArg,
+// an empty host listens on localhost (":1080" must not bind every interface)
+func NormalizeForwardSpec(spec wshrpc.ConnForwardSpec) (wshrpc.ConnForwardSpec, error) {
+	if !isValidForwardType(spec.Type) {
+		return spec, fmt.Errorf("invalid forward type %q", spec.Type)
+	}
+	listenHost, listenPort, err := net.SplitHostPort(spec.ListenAddr)
+	if err != nil {
+		return spec, fmt.Errorf("invalid listen address %q", spec.ListenAddr)
+	}
+	spec.ListenAddr, err = makeForwardListenAddr(listenHost, listenPort)
+	if err != nil {
+		return spec, err
+	}
+	if spec.Type == wshrpc.ConnForwardType_Dynamic {
+		if spec.TargetAddr != "" {
+			return spec, fmt.Errorf("dynamic forwards do not have a target address")
+		}
+		return spec, nil
+	}
+	targetHost, targetPort, err := net.SplitHostPort(spec.TargetAddr)
+	if err != nil || targetHost == "" || !isValidPort(targetPort, false) {
+		return spec, fmt.Errorf("invalid target address %q", spec.TargetAddr)
+	}
+	return spec, nil
+}
+
+// forwards from ssh_config for the connection's host (bad lines are logged and skipped)
+func GetConfigForwards(opts *SSHOpts) []wshrpc.ConnForwardSpec {
+	ssh_config.ReloadConfigs()
+	var rtn []wshrpc.ConnForwardSpec
+	for _, keyword := range []string{"LocalForward", "RemoteForward", "DynamicForward"} {
+		for _, value := range ssh_config.GetAll(opts.SSHHost, keyword) {
+			value = trimquotes.TryTrimQuotes(strings.TrimSpace(value))
+			if value == "" {
+				continue
+			}
+			spec, err := parseConfigForward(configForwardKeywords[keyword], value)
+			if err != nil {
+				log.Printf("ssh config for %s: skipping %s: %v\n", opts.SSHHost, keyword, err)
+				continue
+			}
+			rtn = append(rtn, *spec)
+		}
+	}
+	return rtn
+}
@@ -0,0 +1,95 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestParseForwardArg(t *testing.T) {
+	tests := []struct {
+		fwdType string
+		arg     string
+		listen  string
+		target  string
+	}{
+		{wshrpc.ConnForwardType_Local, "8080:localhost:80", "localhost:8080", "localhost:80"},
+		{wshrpc.ConnForwardType_Local, "*:8080:db.internal:5432", "0.0.0.0:8080", "db.internal:5432"},
+		{wshrpc.ConnForwardType_Remote, "[::1]:9000:[fe80::1]:22", "[::1]:9000", "[fe80::1]:22"},
+		{wshrpc.ConnForwardType_Dynamic, "1080", "localhost:1080", ""},
+		{wshrpc.ConnForwardType_Dynamic, "127.0.0.1:0", "127.0.0.1:0", ""},
+	}
+	for _, test := range tests {
+		spec, err := ParseForwardArg(test.fwdType, test.arg)
+		if err != nil {
+			t.Errorf("%s %q: error %v", test.fwdType, test.arg, err)
+			continue
+		}
+		if spec.Type != test.fwdType || spec.ListenAddr != test.listen || spec.TargetAddr != test.target {
+			t.Errorf("%s %q: got %+v", test.fwdType, test.arg, *spec)
+		}
+		if normSpec, err := NormalizeForwardSpec(*spec); err != nil || normSpec != *spec {
+			t.Errorf("%s %q: parsed spec does not validate: %+v %v", test.fwdType, test.arg, normSpec, err)
+		}
+	}
+	badArgs := []struct {
+		fwdType string
+		arg     string
+	}{
+		{wshrpc.ConnForwardType_Local, "8080"},
+		{wshrpc.ConnForwardType_Local, "8080:host:0"},
+		{wshrpc.ConnForwardType_Local, "70000:host:80"},
+		{wshrpc.ConnForwardType_Remote, "9000::22"},
+		{wshrpc.ConnForwardType_Dynamic, "1080:host:80"},
+		{"tunnel", "1080"},
+	}
+	for _, test := range badArgs {
+		if _, err := ParseForwardArg(test.fwdType, test.arg); err == nil {
+			t.Errorf("%s %q: expected an error", test.fwdType, test.arg)
+		}
+	}
+}
+
+func TestNormalizeForwardSpec(t *testing.T) {
+	tests := []struct {
+		spec   wshrpc.ConnForwardSpec
+		listen string // "" for an invalid spec
+	}{
+		{wshrpc.ConnForwardSpec{Type: wshrpc.ConnForwardType_Dynamic, ListenAddr: ":1080"}, "localhost:1080"},
+		{wshrpc.ConnForwardSpec{Type: wshrpc.ConnForwardType_Local, ListenAddr: "[]:8080", TargetAddr: "db:5432"}, "localhost:8080"},
+		{wshrpc.ConnForwardSpec{Type: wshrpc.ConnForwardType_Local, ListenAddr: "*:8080", TargetAddr: "db:5432"}, "0.0.0.0:8080"},
+		{wshrpc.ConnForwardSpec{Type: wshrpc.ConnForwardType_Remote, ListenAddr: "10.0.0.5:9000", TargetAddr: "localhost:22"}, "10.0.0.5:9000"},
+		{wshrpc.ConnForwardSpec{Type: wshrpc.ConnForwardType_Dynamic, ListenAddr: "1080"}, ""},
+		{wshrpc.ConnForwardSpec{Type: wshrpc.ConnForwardType_Local, ListenAddr: ":8080", TargetAddr: ":80"}, ""},
+		{wshrpc.ConnForwardSpec{Type: wshrpc.ConnForwardType_Dynamic, ListenAddr: ":1080", TargetAddr: "host:80"}, ""},
+	}
+	for _, test := range tests {
+		spec, err := NormalizeForwardSpec(test.spec)
+		if test.listen == "" {
+			if err == nil {
+				t.Errorf("%+v: expected an error", test.spec)
+			}
+			continue
+		}
+		if err != nil || spec.ListenAddr != test.listen {
+			t.Errorf("%+v: expected listen address %q, got %+v %v", test.spec, test.listen, spec, err)
+		}
+	}
+}
+
+func TestParseConfigForward(t *testing.T) {
+	spec, err := parseConfigForward(wshrpc.ConnForwardType_Local, "8080 localhost:80")
+	if err != nil || spec.ListenAddr != "localhost:8080" || spec.TargetAddr != "localhost:80" {
+		t.Errorf("LocalForward: got %v %v", spec, err)
+	}
+	spec, err = parseConfigForward(wshrpc.ConnForwardType_Dynamic, "localhost:1080")
+	if err != nil || spec.ListenAddr != "localhost:1080" {
+		t.Errorf("DynamicForward: got %v %v", spec, err)
+	}
+	if _, err := parseConfigForward(wshrpc.ConnForwardType_Remote, "9000"); err == nil {
+		t.Errorf("RemoteForward without a target: expected an error")
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ServerAliveInterval / ServerAliveCountMax (like openssh): a keepalive request is sent every interval and the
+// client is closed when countMax requests are outstanding.  closing the client makes client.Wait() return,
+// which is how the connection notices that the server is gone.
+
+const serverAliveRequestType = "keepalive@openssh.com"
+
+func runServerAliveLoop(client *ssh.Client, remoteName string, interval time.Duration, countMax int) {
+	if countMax <= 0 {
+		countMax = 1
+	}
+	closedCh := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(closedCh)
+	}()
+	var outstanding atomic.Int32
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closedCh:
+			return
+		case <-ticker.C:
+		}
+		if int(outstanding.Load()) >= countMax {
+			log.Printf("ssh %s: no response to %d keepalives, closing connection\n", remoteName, countMax)
+			client.Close()
+			return
+		}
+		outstanding.Add(1)
+		go func() {
+			// any reply (servers answer unknown requests with a failure) means the server is alive
+			_, _, err := client.SendRequest(serverAliveRequestType, true, nil)
+			if err == nil {
+				outstanding.Store(0)
+			}
+		}()
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func dialTestSshServer(t *testing.T, answerRequests bool) *ssh.Client {
+	serverAddr, hostKey := startTestSshServer(t, answerRequests)
+	clientConfig := &ssh.ClientConfig{
+		User:            "test",
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+	}
+	client, err := DialContext(context.Background(), "tcp", serverAddr, clientConfig)
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func waitForClientClose(client *ssh.Client, timeout time.Duration) bool {
+	waitDone := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(waitDone)
+	}()
+	select {
+	case <-waitDone:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func TestServerAliveLoop(t *testing.T) {
+	// an answering server keeps the connection open
+	client := dialTestSshServer(t, true)
+	go runServerAliveLoop(client, "answering", 20*time.Millisecond, 2)
+	if waitForClientClose(client, 300*time.Millisecond) {
+		t.Fatalf("connection to an answering server was closed")
+	}
+
+	// a server that stops answering is disconnected after countMax intervals
+	client = dialTestSshServer(t, false)
+	go runServerAliveLoop(client, "silent", 20*time.Millisecond, 2)
+	if !waitForClientClose(client, 2*time.Second) {
+		t.Fatalf("connection to a silent server was not closed")
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ProxyCommand runs a local command and uses its stdin/stdout as the connection to the ssh server.
+// like openssh, it is not used when connecting through ProxyJump hosts.
+
+type proxyCommandAddr struct {
+	Addr string
+}
+
+func (addr proxyCommandAddr) Network() string {
+	return "proxycommand"
+}
+
+func (addr proxyCommandAddr) String() string {
+	return addr.Addr
+}
+
+// a net.Conn over the stdin/stdout of a ProxyCommand process (deadlines are not supported)
+type proxyCommandConn struct {
+	Cmd       *exec.Cmd
+	Stdin     io.WriteCloser
+	Stdout    io.ReadCloser
+	Addr      proxyCommandAddr
+	CloseOnce *sync.Once
+}
+
+func (c *proxyCommandConn) Read(b []byte) (int, error) {
+	return c.Stdout.Read(b)
+}
+
+func (c *proxyCommandConn) Write(b []byte) (int, error) {
+	return c.Stdin.Write(b)
+}
+
+func (c *proxyCommandConn) Close() error {
+	c.CloseOnce.Do(func() {
+		c.Stdin.Close()
+		// the proxy command normally exits when its stdin closes, make sure it does
+		waitDone := make(chan struct{})
+		go func() {
+			c.Cmd.Wait()
+			close(waitDone)
+		}()
+		select {
+		case <-waitDone:
+		case <-time.After(2 * time.Second):
+			c.Cmd.Process.Kill()
+			<-waitDone
+		}
+	})
+	return nil
+}
+
+func (c *proxyCommandConn) LocalAddr() net.Addr {
+	return proxyCommandAddr{Addr: "localhost"}
+}
+
+func (c *proxyCommandConn) RemoteAddr() net.Addr {
+	return c.Addr
+}
+
+func (c *proxyCommandConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *proxyCommandConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *proxyCommandConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// expands the %h (hostname), %p (port), %r (user), %n (host as given) and %% tokens
+func expandProxyCommand(proxyCommand string, opts *SSHOpts, sshKeywords *SshKeywords) (string, error) {
+	var buf strings.Builder
+	for idx := 0; idx < len(proxyCommand); idx++ {
+		ch := proxyCommand[idx]
+		if ch != '%' {
+			buf.WriteByte(ch)
+			continue
+		}
+		if idx+1 >= len(proxyCommand) {
+			return "", fmt.Errorf("invalid ProxyCommand %q: trailing %%", proxyCommand)
+		}
+		idx++
+		switch proxyCommand[idx] {
+		case 'h':
+			buf.WriteString(sshKeywords.HostName)
+		case 'p':
+			buf.WriteString(sshKeywords.Port)
+		case 'r':
+			buf.WriteString(sshKeywords.User)
+		case 'n':
+			buf.WriteString(opts.SSHHost)
+		case '%':
+			buf.WriteByte('%')
+		default:
+			return "", fmt.Errorf("invalid ProxyCommand %q: unknown token %%%c", proxyCommand, proxyCommand[idx])
+		}
+	}
+	return buf.String(), nil
+}
+
+func makeProxyCommandCmd(proxyCommand string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", proxyCommand)
+	}
+	return exec.Command("/bin/sh", "-c", "exec "+proxyCommand)
+}
+
+func dialProxyCommand(ctx context.Context, proxyCommand string, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	cmd := makeProxyCommandCmd(proxyCommand)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("running ProxyCommand for %s: %s\n", addr, proxyCommand)
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("cannot start ProxyCommand %q: %w", proxyCommand, err)
+	}
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.Printf("[proxycommand:%s] %s\n", addr, scanner.Text())
+		}
+	}()
+	conn := &proxyCommandConn{
+		Cmd:       cmd,
+		Stdin:     stdin,
+		Stdout:    stdout,
+		Addr:      proxyCommandAddr{Addr: addr},
+		CloseOnce: &sync.Once{},
+	}
+	// the handshake does not take a context, closing the conn unblocks it
+	stopFn := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stopFn()
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ProxyCommand %q: %w", proxyCommand, err)
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
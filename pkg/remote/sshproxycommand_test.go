@@ -0,0 +1,162 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const proxyHelperEnvVar = "WAVETERM_TEST_PROXYCOMMAND"
+
+// a netcat-like stub, run as a ProxyCommand (the test binary runs itself with the helper env var set)
+func TestProxyCommandHelper(t *testing.T) {
+	if os.Getenv(proxyHelperEnvVar) == "" {
+		return
+	}
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) != 3 {
+		fmt.Fprintf(os.Stderr, "usage: -- host port\n")
+		os.Exit(2)
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(args[1], args[2]))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dial error: %v\n", err)
+		os.Exit(1)
+	}
+	go func() {
+		io.Copy(conn, os.Stdin)
+		conn.Close()
+	}()
+	io.Copy(os.Stdout, conn)
+	os.Exit(0)
+}
+
+// the server replies to "ping" requests (it stops servicing requests when answerRequests is false)
+func startTestSshServer(t *testing.T, answerRequests bool) (string, ssh.PublicKey) {
+	_, hostPrivKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPrivKey)
+	if err != nil {
+		t.Fatalf("error creating host key signer: %v", err)
+	}
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(hostSigner)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %v", err)
+	}
+	closedCh := make(chan struct{})
+	t.Cleanup(func() {
+		listener.Close()
+		close(closedCh)
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+				if err != nil {
+					return
+				}
+				go func() {
+					for newChan := range chans {
+						newChan.Reject(ssh.Prohibited, "no channels")
+					}
+				}()
+				for req := range reqs {
+					if !answerRequests {
+						// never replies (and the requests after this one queue up)
+						<-closedCh
+						return
+					}
+					req.Reply(req.Type == "ping", nil)
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), hostSigner.PublicKey()
+}
+
+func TestExpandProxyCommand(t *testing.T) {
+	opts := &SSHOpts{SSHHost: "myalias"}
+	keywords := &SshKeywords{HostName: "10.0.0.5", Port: "2222", User: "mike"}
+	rtn, err := expandProxyCommand("ssh -W %h:%p %r@bastion # %n 100%%", opts, keywords)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if rtn != "ssh -W 10.0.0.5:2222 mike@bastion # myalias 100%" {
+		t.Errorf("bad expansion: %q", rtn)
+	}
+	for _, badCmd := range []string{"nc %h %x", "nc %h %"} {
+		if _, err := expandProxyCommand(badCmd, opts, keywords); err == nil {
+			t.Errorf("%q: expected an error", badCmd)
+		}
+	}
+}
+
+func TestDialProxyCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("ProxyCommand test uses /bin/sh")
+	}
+	serverAddr, hostKey := startTestSshServer(t, true)
+	host, port, _ := net.SplitHostPort(serverAddr)
+	opts := &SSHOpts{SSHHost: "testhost"}
+	keywords := &SshKeywords{HostName: host, Port: port, User: "test"}
+	proxyCommand, err := expandProxyCommand(fmt.Sprintf("env %s=1 '%s' -test.run=TestProxyCommandHelper -- %%h %%p", proxyHelperEnvVar, os.Args[0]), opts, keywords)
+	if err != nil {
+		t.Fatalf("error expanding ProxyCommand: %v", err)
+	}
+	clientConfig := &ssh.ClientConfig{
+		User:            "test",
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelFn()
+	client, err := dialProxyCommand(ctx, proxyCommand, serverAddr, clientConfig)
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	if client.RemoteAddr().String() != serverAddr {
+		t.Errorf("bad remote addr %q", client.RemoteAddr())
+	}
+	ok, _, err := client.SendRequest("ping", true, nil)
+	if err != nil || !ok {
+		t.Fatalf("ping failed: %v %v", ok, err)
+	}
+	closeDone := make(chan struct{})
+	go func() {
+		client.Close()
+		close(closeDone)
+	}()
+	select {
+	case <-closeDone:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("closing the client did not stop the ProxyCommand")
+	}
+
+	// a ProxyCommand that fails is reported as a dial error
+	_, err = dialProxyCommand(ctx, "exit 1", serverAddr, clientConfig)
+	if err == nil {
+		t.Fatalf("expected an error from a failing ProxyCommand")
+	}
+}
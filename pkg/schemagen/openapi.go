@@ -0,0 +1,163 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package schemagen
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// the openapi document describes the local rpc gateway (see web/webgateway.go).  every call and
+// responsestream command is a POST to GatewayRpcPath/<command>, streamingrequest commands need the websocket.
+// the paths are passed in so this package does not depend on pkg/web.
+
+const OpenApiVersion = "3.1.0"
+
+type OpenApiOpts struct {
+	Version string
+	RpcPath string
+	WsPath  string
+}
+
+func gatewayResponseSchema(dataSchema map[string]any) map[string]any {
+	successProps := map[string]any{
+		"success": map[string]any{"const": true},
+	}
+	if dataSchema != nil {
+		successProps["data"] = dataSchema
+	}
+	return map[string]any{
+		"oneOf": []any{
+			map[string]any{
+				"type":       "object",
+				"properties": successProps,
+				"required":   []string{"success"},
+			},
+			map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"error": map[string]any{"type": "string"}},
+				"required":   []string{"error"},
+			},
+		},
+	}
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+func makeCommandOperation(cmdSchema *CommandSchema, decl *wshrpc.WshRpcMethodDecl) map[string]any {
+	respSchema := cmdSchema.Response
+	desc := fmt.Sprintf("wsh rpc command %q (wshserver.%s)", decl.Command, decl.MethodName)
+	if decl.CommandType == wshrpc.RpcType_ResponseStream {
+		desc += ", the streamed responses are returned as an array"
+		respSchema = map[string]any{"type": "array", "items": map[string]any{}}
+		if cmdSchema.Response != nil {
+			respSchema["items"] = cmdSchema.Response
+		}
+	}
+	op := map[string]any{
+		"operationId": decl.MethodName,
+		"summary":     decl.Command,
+		"description": desc,
+		"tags":        []string{decl.CommandType},
+		"parameters": []any{
+			map[string]any{
+				"name":        "route",
+				"in":          "query",
+				"description": "route to send the command to (defaults to wavesrv)",
+				"schema":      map[string]any{"type": "string"},
+			},
+			map[string]any{
+				"name":        "timeout",
+				"in":          "query",
+				"description": "timeout in milliseconds",
+				"schema":      map[string]any{"type": "integer"},
+			},
+		},
+		"responses": map[string]any{
+			"200": map[string]any{
+				"description": "the command's response (errors from the command are returned as {\"error\": ...})",
+				"content":     jsonContent(gatewayResponseSchema(respSchema)),
+			},
+		},
+	}
+	if cmdSchema.Data != nil {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content":  jsonContent(cmdSchema.Data),
+		}
+	}
+	return op
+}
+
+func GenerateWshRpcOpenApi(opts OpenApiOpts) (map[string]any, error) {
+	g := MakeSchemaGen(OpenApiRefPrefix)
+	rpcMessageSchema, err := g.TypeSchema(reflect.TypeOf(wshutil.RpcMessage{}))
+	if err != nil {
+		return nil, err
+	}
+	paths := make(map[string]any)
+	paths[opts.RpcPath] = map[string]any{
+		"post": map[string]any{
+			"operationId": "RpcMessage",
+			"summary":     "send an rpc message",
+			"description": "sends a call or responsestream command as an rpc message, the reqid and source are set by the gateway",
+			"requestBody": map[string]any{
+				"required": true,
+				"content":  jsonContent(rpcMessageSchema),
+			},
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": "the command's response",
+					"content":     jsonContent(gatewayResponseSchema(map[string]any{})),
+				},
+			},
+		},
+	}
+	var streamingCommands []string
+	declMap := wshrpc.GenerateWshCommandDeclMap()
+	for _, command := range utilfn.GetOrderedMapKeys(declMap) {
+		decl := declMap[command]
+		cmdSchema, err := g.CommandSchema(decl)
+		if err != nil {
+			return nil, fmt.Errorf("command %q: %w", command, err)
+		}
+		if decl.CommandType != wshrpc.RpcType_Call && decl.CommandType != wshrpc.RpcType_ResponseStream {
+			streamingCommands = append(streamingCommands, command)
+			continue
+		}
+		paths[opts.RpcPath+"/"+command] = map[string]any{"post": makeCommandOperation(cmdSchema, decl)}
+	}
+	desc := fmt.Sprintf("the local rpc gateway (off by default, see the gateway:enabled setting).  the server's urls are written to "+
+		"gateway.json in the wave home dir.  the websocket (%s) sends and receives rpc messages, it is needed for events and "+
+		"for streaming requests (%v).", opts.WsPath, streamingCommands)
+	return map[string]any{
+		"openapi": OpenApiVersion,
+		"info": map[string]any{
+			"title":       "Wave Terminal RPC Gateway",
+			"version":     opts.Version,
+			"description": desc,
+		},
+		"servers": []any{
+			map[string]any{"url": "http://127.0.0.1:{port}", "variables": map[string]any{"port": map[string]any{"default": "0"}}},
+		},
+		"security": []any{map[string]any{"apiToken": []string{}}},
+		"paths":    paths,
+		"components": map[string]any{
+			"securitySchemes": map[string]any{
+				"apiToken": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "an api token (created with wsh apitoken create)",
+				},
+			},
+			"schemas": g.Defs,
+		},
+	}, nil
+}
@@ -0,0 +1,245 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// generates json schema (draft 2020-12) for the wsh rpc types and an openapi document for the gateway
+package schemagen
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const JsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+const DefsRefPrefix = "#/$defs/"
+const OpenApiRefPrefix = "#/components/schemas/"
+
+var jsonMarshalerRType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// types with custom json marshaling
+var overrideSchemas = map[reflect.Type]map[string]any{
+	reflect.TypeOf(waveobj.ORef{}): {
+		"type":        "string",
+		"description": "object reference (otype:oid)",
+	},
+	reflect.TypeOf(wconfig.MetaSettingsType{}): {
+		"type": "object",
+	},
+}
+
+type SchemaGen struct {
+	RefPrefix string
+	Defs      map[string]any
+	defTypes  map[string]reflect.Type
+}
+
+func MakeSchemaGen(refPrefix string) *SchemaGen {
+	return &SchemaGen{
+		RefPrefix: refPrefix,
+		Defs:      make(map[string]any),
+		defTypes:  make(map[string]reflect.Type),
+	}
+}
+
+func nullable(schema map[string]any) map[string]any {
+	return map[string]any{"anyOf": []any{schema, map[string]any{"type": "null"}}}
+}
+
+func isNilableKind(kind reflect.Kind) bool {
+	return kind == reflect.Ptr || kind == reflect.Slice || kind == reflect.Map || kind == reflect.Interface
+}
+
+// returns the schema for a value of type rtype (structs are added to Defs and referenced)
+func (g *SchemaGen) TypeSchema(rtype reflect.Type) (map[string]any, error) {
+	if override, ok := overrideSchemas[rtype]; ok {
+		return override, nil
+	}
+	if rtype.Kind() != reflect.Ptr && rtype.Kind() != reflect.Interface && rtype.Implements(jsonMarshalerRType) {
+		return nil, fmt.Errorf("type %s has custom json marshaling, add it to overrideSchemas", rtype)
+	}
+	switch rtype.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}, nil
+	case reflect.Slice, reflect.Array:
+		if rtype.Kind() == reflect.Slice && rtype.Elem().Kind() == reflect.Uint8 {
+			// []byte is base64 encoded in json
+			return map[string]any{"type": "string", "contentEncoding": "base64"}, nil
+		}
+		elemSchema, err := g.TypeSchema(rtype.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "array", "items": elemSchema}, nil
+	case reflect.Map:
+		if rtype.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type in %s", rtype)
+		}
+		elemSchema, err := g.TypeSchema(rtype.Elem())
+		if err != nil {
+			return nil, err
+		}
+		rtn := map[string]any{"type": "object"}
+		if len(elemSchema) > 0 {
+			rtn["additionalProperties"] = elemSchema
+		}
+		return rtn, nil
+	case reflect.Ptr:
+		return g.TypeSchema(rtype.Elem())
+	case reflect.Interface:
+		return map[string]any{}, nil
+	case reflect.Struct:
+		err := g.defineStruct(rtype)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"$ref": g.RefPrefix + rtype.Name()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", rtype)
+	}
+}
+
+func (g *SchemaGen) defineStruct(rtype reflect.Type) error {
+	name := rtype.Name()
+	if name == "" || strings.Contains(name, "[") {
+		return fmt.Errorf("anonymous and generic structs are not supported (%s)", rtype)
+	}
+	if existing, ok := g.defTypes[name]; ok {
+		if existing != rtype {
+			return fmt.Errorf("duplicate type name %q (%s and %s)", name, existing, rtype)
+		}
+		return nil
+	}
+	g.defTypes[name] = rtype
+	properties := make(map[string]any)
+	var required []string
+	err := g.addStructFields(rtype, properties, &required)
+	if err != nil {
+		return err
+	}
+	def := map[string]any{
+		"type":        "object",
+		"description": rtype.String(),
+		"properties":  properties,
+	}
+	if len(required) > 0 {
+		def["required"] = required
+	}
+	g.Defs[name] = def
+	return nil
+}
+
+func (g *SchemaGen) addStructFields(rtype reflect.Type, properties map[string]any, required *[]string) error {
+	for idx := 0; idx < rtype.NumField(); idx++ {
+		field := rtype.Field(idx)
+		jsonTag := utilfn.GetJsonTag(field)
+		if jsonTag == "-" {
+			continue
+		}
+		if field.Anonymous && jsonTag == "" && field.Type.Kind() == reflect.Struct {
+			// embedded struct fields are flattened by encoding/json
+			err := g.addStructFields(field.Type, properties, required)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		fieldName := jsonTag
+		if fieldName == "" {
+			fieldName = field.Name
+		}
+		fieldSchema, err := g.TypeSchema(field.Type)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", rtype.Name(), field.Name, err)
+		}
+		omitEmpty := strings.Contains(field.Tag.Get("json"), ",omitempty")
+		if !omitEmpty {
+			*required = append(*required, fieldName)
+			if isNilableKind(field.Type.Kind()) && len(fieldSchema) > 0 {
+				fieldSchema = nullable(fieldSchema)
+			}
+		}
+		properties[fieldName] = fieldSchema
+	}
+	return nil
+}
+
+type CommandSchema struct {
+	Command       string         `json:"command"`
+	RpcType       string         `json:"rpctype"`
+	Data          map[string]any `json:"data,omitempty"`          // command data (absent if the command takes none)
+	RequestStream map[string]any `json:"requeststream,omitempty"` // streamingrequest commands, one value per continuation
+	Response      map[string]any `json:"response,omitempty"`      // for responsestream commands, one value per response
+}
+
+func (g *SchemaGen) CommandSchema(decl *wshrpc.WshRpcMethodDecl) (*CommandSchema, error) {
+	rtn := &CommandSchema{Command: decl.Command, RpcType: decl.CommandType}
+	var err error
+	if decl.CommandDataType != nil {
+		rtn.Data, err = g.TypeSchema(decl.CommandDataType)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if decl.RequestStreamDataType != nil {
+		rtn.RequestStream, err = g.TypeSchema(decl.RequestStreamDataType)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if decl.DefaultResponseDataType != nil {
+		rtn.Response, err = g.TypeSchema(decl.DefaultResponseDataType)
+		if err != nil {
+			return nil, err
+		}
+		if isNilableKind(decl.DefaultResponseDataType.Kind()) && len(rtn.Response) > 0 {
+			rtn.Response = nullable(rtn.Response)
+		}
+	}
+	return rtn, nil
+}
+
+// the json schema document, every type is in $defs and the commands are in "commands"
+// (reference a command's data with "wshrpc.schema.json#/commands/<command>/data")
+func GenerateWshRpcJsonSchema() (map[string]any, error) {
+	g := MakeSchemaGen(DefsRefPrefix)
+	rpcMessageSchema, err := g.TypeSchema(reflect.TypeOf(wshutil.RpcMessage{}))
+	if err != nil {
+		return nil, err
+	}
+	declMap := wshrpc.GenerateWshCommandDeclMap()
+	commands := make(map[string]any)
+	for _, command := range utilfn.GetOrderedMapKeys(declMap) {
+		cmdSchema, err := g.CommandSchema(declMap[command])
+		if err != nil {
+			return nil, fmt.Errorf("command %q: %w", command, err)
+		}
+		commands[command] = cmdSchema
+	}
+	return map[string]any{
+		"$schema":     JsonSchemaDialect,
+		"$id":         "https://waveterm.dev/schema/wshrpc.schema.json",
+		"title":       "wsh rpc",
+		"description": "rpc messages (the document validates a single message) and the data types of every wsh rpc command (see \"commands\")",
+		"$ref":        rpcMessageSchema["$ref"],
+		"$defs":       g.Defs,
+		"commands":    commands,
+	}, nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package schemagen
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+type testEmbedded struct {
+	Inner string `json:"inner"`
+}
+
+type testSchemaType struct {
+	testEmbedded
+	Name   string            `json:"name"`
+	Tags   []string          `json:"tags"`
+	Opt    *testEmbedded     `json:"opt,omitempty"`
+	Data   []byte            `json:"data,omitempty"`
+	Env    map[string]string `json:"env,omitempty"`
+	ORef   waveobj.ORef      `json:"oref"`
+	Hidden string            `json:"-"`
+}
+
+// collects every "$ref" in the document
+func collectRefs(val any, refs map[string]bool) {
+	switch v := val.(type) {
+	case map[string]any:
+		for key, subVal := range v {
+			if key == "$ref" {
+				refs[subVal.(string)] = true
+				continue
+			}
+			collectRefs(subVal, refs)
+		}
+	case []any:
+		for _, subVal := range v {
+			collectRefs(subVal, refs)
+		}
+	}
+}
+
+func TestTypeSchema(t *testing.T) {
+	g := MakeSchemaGen(DefsRefPrefix)
+	schema, err := g.TypeSchema(reflect.TypeOf(&testSchemaType{}))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if schema["$ref"] != "#/$defs/testSchemaType" {
+		t.Fatalf("bad ref: %v", schema)
+	}
+	def := g.Defs["testSchemaType"].(map[string]any)
+	props := def["properties"].(map[string]any)
+	for _, name := range []string{"inner", "name", "tags", "opt", "data", "env", "oref"} {
+		if props[name] == nil {
+			t.Errorf("missing property %q", name)
+		}
+	}
+	if props["Hidden"] != nil || props["-"] != nil {
+		t.Errorf("json:\"-\" field was included")
+	}
+	required := def["required"].([]string)
+	if !slices.Equal(required, []string{"inner", "name", "tags", "oref"}) {
+		t.Errorf("bad required fields: %v", required)
+	}
+	if _, ok := props["tags"].(map[string]any)["anyOf"]; !ok {
+		t.Errorf("non-omitempty slice should be nullable: %v", props["tags"])
+	}
+	if props["data"].(map[string]any)["contentEncoding"] != "base64" {
+		t.Errorf("[]byte should be a base64 string: %v", props["data"])
+	}
+	if props["oref"].(map[string]any)["type"] != "string" {
+		t.Errorf("oref should be a string: %v", props["oref"])
+	}
+}
+
+func TestGenerateWshRpcSchemas(t *testing.T) {
+	declMap := wshrpc.GenerateWshCommandDeclMap()
+	jsonSchema, err := GenerateWshRpcJsonSchema()
+	if err != nil {
+		t.Fatalf("error generating json schema: %v", err)
+	}
+	openApi, err := GenerateWshRpcOpenApi(OpenApiOpts{Version: "0.0.0", RpcPath: "/rpc", WsPath: "/ws"})
+	if err != nil {
+		t.Fatalf("error generating openapi document: %v", err)
+	}
+	// round trip through json so the documents can be walked as plain values
+	docs := map[string]any{}
+	for name, doc := range map[string]map[string]any{"jsonschema": jsonSchema, "openapi": openApi} {
+		barr, err := json.Marshal(doc)
+		if err != nil {
+			t.Fatalf("error marshaling %s: %v", name, err)
+		}
+		var val map[string]any
+		json.Unmarshal(barr, &val)
+		docs[name] = val
+	}
+	schemaDoc := docs["jsonschema"].(map[string]any)
+	if len(schemaDoc["commands"].(map[string]any)) != len(declMap) {
+		t.Errorf("json schema is missing commands")
+	}
+	checks := []struct {
+		docName string
+		prefix  string
+		defs    map[string]any
+	}{
+		{"jsonschema", DefsRefPrefix, schemaDoc["$defs"].(map[string]any)},
+		{"openapi", OpenApiRefPrefix, docs["openapi"].(map[string]any)["components"].(map[string]any)["schemas"].(map[string]any)},
+	}
+	for _, check := range checks {
+		refs := make(map[string]bool)
+		collectRefs(docs[check.docName], refs)
+		for ref := range refs {
+			name, found := strings.CutPrefix(ref, check.prefix)
+			if !found || check.defs[name] == nil {
+				t.Errorf("%s: unresolved ref %q", check.docName, ref)
+			}
+		}
+	}
+	paths := docs["openapi"].(map[string]any)["paths"].(map[string]any)
+	for command, decl := range declMap {
+		_, hasPath := paths["/rpc/"+command]
+		if hasPath != (decl.CommandType != wshrpc.RpcType_StreamingRequest) {
+			t.Errorf("command %q (%s): path present = %v", command, decl.CommandType, hasPath)
+		}
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
+	"os"
 	"time"
 
 	"github.com/wavetermdev/waveterm/pkg/filestore"
@@ -20,6 +20,7 @@ import (
 
 const MaxFileSize = 10 * 1024 * 1024 // 10M
 const DefaultTimeout = 2 * time.Second
+const FileOpTimeoutMs = 10 * 60 * 1000 // recursive copies and deletes
 
 type FileService struct{}
 
@@ -41,8 +42,14 @@ func (fs *FileService) SaveFile(connection string, path string, data64 string) e
 	}
 	connRoute := wshutil.MakeConnectionRouteId(connection)
 	client := wshserver.GetMainRpcClient()
-	writeData := wshrpc.CommandRemoteWriteFileData{Path: path, Data64: data64}
-	return wshclient.RemoteWriteFileCommand(client, writeData, &wshrpc.RpcOpts{Route: connRoute})
+	dataBytes, err := base64.StdEncoding.DecodeString(data64)
+	if err != nil {
+		return fmt.Errorf("cannot decode base64 data: %w", err)
+	}
+	writeData := wshrpc.CommandRemoteWriteFileStreamData{Path: path, Size: int64(len(dataBytes))}
+	reqCh := wshclient.ReaderToFileChunkCh(context.Background(), bytes.NewReader(dataBytes), nil)
+	_, err = wshclient.RemoteWriteFileStreamCommand(client, writeData, reqCh, &wshrpc.RpcOpts{Route: connRoute, Timeout: wshutil.StreamTimeoutMs(int64(len(dataBytes)))})
+	return err
 }
 
 func (fs *FileService) StatFile_Meta() tsgenmeta.MethodMeta {
@@ -104,14 +111,7 @@ func (fs *FileService) ReadFile(connection string, path string) (*FullFile, erro
 			}
 			fileInfoArr = append(fileInfoArr, resp.FileInfo...)
 		} else {
-			if resp.Data64 == "" {
-				continue
-			}
-			decoder := base64.NewDecoder(base64.StdEncoding, bytes.NewReader([]byte(resp.Data64)))
-			_, err := io.Copy(&fileBuf, decoder)
-			if err != nil {
-				return nil, fmt.Errorf("stream file, failed to decode base64 data %q: %w", resp.Data64, err)
-			}
+			fileBuf.Write(resp.Data)
 		}
 	}
 	if isDir {
@@ -121,7 +121,6 @@ func (fs *FileService) ReadFile(connection string, path string) (*FullFile, erro
 		}
 		fullFile.Data64 = base64.StdEncoding.EncodeToString(fiBytes)
 	} else {
-		// we can avoid this re-encoding if we ensure the remote side always encodes chunks of 3 bytes so we don't get padding chars
 		fullFile.Data64 = base64.StdEncoding.EncodeToString(fileBuf.Bytes())
 	}
 	return fullFile, nil
@@ -139,18 +138,104 @@ func (fs *FileService) GetWaveFile(id string, path string) (any, error) {
 
 func (fs *FileService) DeleteFile_Meta() tsgenmeta.MethodMeta {
 	return tsgenmeta.MethodMeta{
-		Desc:     "delete file",
-		ArgNames: []string{"connection", "path"},
+		Desc:     "delete file (recursive is required for non-empty directories)",
+		ArgNames: []string{"connection", "path", "recursive"},
+	}
+}
+
+func (fs *FileService) DeleteFile(connection string, path string, recursive bool) error {
+	if connection == "" {
+		connection = wshrpc.LocalConnName
+	}
+	connRoute := wshutil.MakeConnectionRouteId(connection)
+	client := wshserver.GetMainRpcClient()
+	deleteData := wshrpc.CommandRemoteFileDeleteData{Path: path, Recursive: recursive}
+	return wshclient.RemoteFileDeleteCommand(client, deleteData, &wshrpc.RpcOpts{Route: connRoute, Timeout: FileOpTimeoutMs})
+}
+
+func (fs *FileService) ListDir_Meta() tsgenmeta.MethodMeta {
+	return tsgenmeta.MethodMeta{
+		Desc:     "list a directory (sorted and paged)",
+		ArgNames: []string{"connection", "data"},
+	}
+}
+
+func (fs *FileService) ListDir(connection string, data wshrpc.CommandRemoteListDirData) (*wshrpc.CommandRemoteListDirRtnData, error) {
+	if connection == "" {
+		connection = wshrpc.LocalConnName
+	}
+	connRoute := wshutil.MakeConnectionRouteId(connection)
+	client := wshserver.GetMainRpcClient()
+	return wshclient.RemoteListDirCommand(client, data, &wshrpc.RpcOpts{Route: connRoute})
+}
+
+func (fs *FileService) Mkdir_Meta() tsgenmeta.MethodMeta {
+	return tsgenmeta.MethodMeta{
+		Desc:     "create a directory",
+		ArgNames: []string{"connection", "path", "parents"},
+	}
+}
+
+func (fs *FileService) Mkdir(connection string, path string, parents bool) (*wshrpc.FileInfo, error) {
+	if connection == "" {
+		connection = wshrpc.LocalConnName
+	}
+	connRoute := wshutil.MakeConnectionRouteId(connection)
+	client := wshserver.GetMainRpcClient()
+	mkdirData := wshrpc.CommandRemoteMkdirData{Path: path, Parents: parents}
+	return wshclient.RemoteMkdirCommand(client, mkdirData, &wshrpc.RpcOpts{Route: connRoute})
+}
+
+func (fs *FileService) RenameFile_Meta() tsgenmeta.MethodMeta {
+	return tsgenmeta.MethodMeta{
+		Desc:     "rename (move) a file or directory",
+		ArgNames: []string{"connection", "srcpath", "destpath", "overwrite"},
+	}
+}
+
+func (fs *FileService) RenameFile(connection string, srcPath string, destPath string, overwrite bool) (*wshrpc.FileInfo, error) {
+	if connection == "" {
+		connection = wshrpc.LocalConnName
+	}
+	connRoute := wshutil.MakeConnectionRouteId(connection)
+	client := wshserver.GetMainRpcClient()
+	renameData := wshrpc.CommandRemoteFileRenameData{SrcPath: srcPath, DestPath: destPath, Overwrite: overwrite}
+	// moves between filesystems are copies
+	return wshclient.RemoteFileRenameCommand(client, renameData, &wshrpc.RpcOpts{Route: connRoute, Timeout: FileOpTimeoutMs})
+}
+
+func (fs *FileService) CopyFile_Meta() tsgenmeta.MethodMeta {
+	return tsgenmeta.MethodMeta{
+		Desc:     "copy a file or directory (on the same connection)",
+		ArgNames: []string{"connection", "srcpath", "destpath", "overwrite", "recursive"},
+	}
+}
+
+func (fs *FileService) CopyFile(connection string, srcPath string, destPath string, overwrite bool, recursive bool) (*wshrpc.FileInfo, error) {
+	if connection == "" {
+		connection = wshrpc.LocalConnName
+	}
+	connRoute := wshutil.MakeConnectionRouteId(connection)
+	client := wshserver.GetMainRpcClient()
+	copyData := wshrpc.CommandRemoteFileCopyData{SrcPath: srcPath, DestPath: destPath, Overwrite: overwrite, Recursive: recursive}
+	return wshclient.RemoteFileCopyCommand(client, copyData, &wshrpc.RpcOpts{Route: connRoute, Timeout: FileOpTimeoutMs})
+}
+
+func (fs *FileService) ChmodFile_Meta() tsgenmeta.MethodMeta {
+	return tsgenmeta.MethodMeta{
+		Desc:     "change file permissions",
+		ArgNames: []string{"connection", "path", "mode"},
 	}
 }
 
-func (fs *FileService) DeleteFile(connection string, path string) error {
+func (fs *FileService) ChmodFile(connection string, path string, mode os.FileMode) (*wshrpc.FileInfo, error) {
 	if connection == "" {
 		connection = wshrpc.LocalConnName
 	}
 	connRoute := wshutil.MakeConnectionRouteId(connection)
 	client := wshserver.GetMainRpcClient()
-	return wshclient.RemoteFileDeleteCommand(client, path, &wshrpc.RpcOpts{Route: connRoute})
+	chmodData := wshrpc.CommandRemoteFileChmodData{Path: path, Mode: mode}
+	return wshclient.RemoteFileChmodCommand(client, chmodData, &wshrpc.RpcOpts{Route: connRoute})
 }
 
 func (fs *FileService) GetFullConfig() wconfig.FullConfigType {
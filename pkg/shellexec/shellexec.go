@@ -11,7 +11,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
@@ -23,6 +25,7 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/util/shellutil"
 	"github.com/wavetermdev/waveterm/pkg/wavebase"
 	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
 	"github.com/wavetermdev/waveterm/pkg/wshutil"
 )
 
@@ -140,33 +143,70 @@ func (pp *PipePty) WriteString(s string) (n int, err error) {
 
 func StartRemoteShellProc(termSize waveobj.TermSize, cmdStr string, cmdOpts CommandOptsType, conn *conncontroller.SSHConn) (*ShellProc, error) {
 	client := conn.GetClient()
-	shellPath, err := remote.DetectShell(client)
+	connConfig := wconfig.GetConnConfig(conn.GetName())
+	wshEnabled := connConfig.IsWshEnabled()
+	// the command line is parsed by the login shell, which can differ from shell:path
+	loginShellPath, err := remote.DetectShell(client)
 	if err != nil {
 		return nil, err
 	}
+	shellPath := connConfig.ShellPath
+	if shellPath == "" {
+		shellPath = loginShellPath
+		log.Printf("detected shell: %s", shellPath)
+	} else {
+		log.Printf("using shell from connections.json: %s (login shell: %s)", shellPath, loginShellPath)
+	}
 	var shellOpts []string
 	var cmdCombined string
-	log.Printf("detected shell: %s", shellPath)
+	isPowershell := remote.IsPowershell(shellPath)
+	loginIsPowershell := remote.IsPowershell(loginShellPath)
 
-	err = remote.InstallClientRcFiles(client)
-	if err != nil {
-		log.Printf("error installing rc files: %v", err)
-		return nil, err
+	// the block's cmd:env and cmd:cwd win over connections.json
+	if cmdOpts.Env == nil {
+		cmdOpts.Env = make(map[string]string)
+	}
+	for envKey, envVal := range connConfig.ShellEnv {
+		if _, ok := cmdOpts.Env[envKey]; !ok {
+			cmdOpts.Env[envKey] = envVal
+		}
+	}
+	if cmdOpts.Cwd == "" {
+		cmdOpts.Cwd = connConfig.ShellCwd
+	}
+	if !wshEnabled {
+		delete(cmdOpts.Env, wshutil.WaveJwtTokenVarName)
+	}
+
+	if wshEnabled {
+		err = remote.InstallClientRcFiles(client)
+		if err != nil {
+			log.Printf("error installing rc files: %v", err)
+			return nil, err
+		}
 	}
 
 	homeDir := remote.GetHomeDir(client)
 
 	if cmdStr == "" {
+		if connConfig.ShellInitScript != "" {
+			if wshEnabled {
+				// run by the shell integration rc files
+				cmdOpts.Env[shellutil.WaveInitScriptVarName] = connConfig.ShellInitScript
+			} else {
+				log.Printf("ignoring shell:initscript for %s, it needs wsh (the shell integration runs it)", conn.GetName())
+			}
+		}
 		/* transform command in order to inject environment vars */
-		if isBashShell(shellPath) {
+		if isBashShell(shellPath) && wshEnabled {
 			log.Printf("recognized as bash shell")
 			// add --rcfile
 			// cant set -l or -i with --rcfile
 			shellOpts = append(shellOpts, "--rcfile", fmt.Sprintf(`"%s"/.waveterm/%s/.bashrc`, homeDir, shellutil.BashIntegrationDir))
-		} else if remote.IsPowershell(shellPath) {
-			// powershell is weird about quoted path executables and requires an ampersand first
-			shellPath = "& " + shellPath
-			shellOpts = append(shellOpts, "-ExecutionPolicy", "Bypass", "-NoExit", "-File", homeDir+fmt.Sprintf("/.waveterm/%s/wavepwsh.ps1", shellutil.PwshIntegrationDir))
+		} else if isPowershell {
+			if wshEnabled {
+				shellOpts = append(shellOpts, "-ExecutionPolicy", "Bypass", "-NoExit", "-File", homeDir+fmt.Sprintf("/.waveterm/%s/wavepwsh.ps1", shellutil.PwshIntegrationDir))
+			}
 		} else {
 			if cmdOpts.Login {
 				shellOpts = append(shellOpts, "-l")
@@ -177,6 +217,10 @@ func StartRemoteShellProc(termSize waveobj.TermSize, cmdStr string, cmdOpts Comm
 			// zdotdir setting moved to after session is created
 		}
 		cmdCombined = fmt.Sprintf("%s %s", shellPath, strings.Join(shellOpts, " "))
+		if loginIsPowershell {
+			// powershell is weird about quoted path executables and requires an ampersand first
+			cmdCombined = "& " + cmdCombined
+		}
 		log.Printf("combined command is: %s", cmdCombined)
 	} else {
 		shellPath = cmdStr
@@ -226,19 +270,15 @@ func StartRemoteShellProc(termSize waveobj.TermSize, cmdStr string, cmdOpts Comm
 		session.Setenv(envKey, envVal)
 	}
 
-	if isZshShell(shellPath) {
-		cmdCombined = fmt.Sprintf(`ZDOTDIR="%s/.waveterm/%s" %s`, homeDir, shellutil.ZshIntegrationDir, cmdCombined)
+	if isZshShell(shellPath) && wshEnabled {
+		zdotDir := fmt.Sprintf("%s/.waveterm/%s", homeDir, shellutil.ZshIntegrationDir)
+		cmdCombined = makeRemoteEnvPrefix(map[string]string{"ZDOTDIR": zdotDir}, loginIsPowershell) + cmdCombined
 	}
 
-	jwtToken, ok := cmdOpts.Env[wshutil.WaveJwtTokenVarName]
-	if !ok {
-		return nil, fmt.Errorf("no jwt token provided to connection")
-	}
-
-	if remote.IsPowershell(shellPath) {
-		cmdCombined = fmt.Sprintf(`$env:%s="%s"; %s`, wshutil.WaveJwtTokenVarName, jwtToken, cmdCombined)
-	} else {
-		cmdCombined = fmt.Sprintf(`%s=%s %s`, wshutil.WaveJwtTokenVarName, jwtToken, cmdCombined)
+	// servers often refuse Setenv (AcceptEnv), so the env (including the jwt token) is also set on the command line
+	cmdCombined = makeRemoteEnvPrefix(cmdOpts.Env, loginIsPowershell) + cmdCombined
+	if cmdOpts.Cwd != "" {
+		cmdCombined = makeRemoteCdPrefix(cmdOpts.Cwd, loginIsPowershell) + cmdCombined
 	}
 
 	session.RequestPty("xterm-256color", termSize.Rows, termSize.Cols, nil)
@@ -252,6 +292,54 @@ func StartRemoteShellProc(termSize waveobj.TermSize, cmdStr string, cmdOpts Comm
 	return &ShellProc{Cmd: sessionWrap, ConnName: conn.GetName(), CloseOnce: &sync.Once{}, DoneCh: make(chan any)}, nil
 }
 
+var validEnvVarNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func posixSingleQuote(val string) string {
+	return "'" + strings.ReplaceAll(val, "'", `'"'"'`) + "'"
+}
+
+func pwshSingleQuote(val string) string {
+	return "'" + strings.ReplaceAll(val, "'", "''") + "'"
+}
+
+func makeRemoteEnvPrefix(env map[string]string, isPowershell bool) string {
+	var envKeys []string
+	for envKey := range env {
+		if !validEnvVarNameRe.MatchString(envKey) {
+			log.Printf("skipping invalid env var name %q", envKey)
+			continue
+		}
+		envKeys = append(envKeys, envKey)
+	}
+	sort.Strings(envKeys)
+	var buf strings.Builder
+	for _, envKey := range envKeys {
+		if isPowershell {
+			buf.WriteString(fmt.Sprintf("$env:%s=%s; ", envKey, pwshSingleQuote(env[envKey])))
+		} else {
+			buf.WriteString(fmt.Sprintf("%s=%s ", envKey, posixSingleQuote(env[envKey])))
+		}
+	}
+	return buf.String()
+}
+
+// the shell still starts if the directory does not exist
+func makeRemoteCdPrefix(cwd string, isPowershell bool) string {
+	if isPowershell {
+		return fmt.Sprintf("Set-Location -Path %s -ErrorAction SilentlyContinue; ", pwshSingleQuote(cwd))
+	}
+	// leave ~ unquoted so the remote shell expands it
+	var quotedCwd string
+	if cwd == "~" {
+		quotedCwd = "~"
+	} else if strings.HasPrefix(cwd, "~/") {
+		quotedCwd = "~/" + posixSingleQuote(cwd[2:])
+	} else {
+		quotedCwd = posixSingleQuote(cwd)
+	}
+	return fmt.Sprintf("cd %s 2>/dev/null; ", quotedCwd)
+}
+
 func isZshShell(shellPath string) bool {
 	// get the base path, and then check contains
 	shellBase := filepath.Base(shellPath)
@@ -21,6 +21,7 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/wconfig"
 	"github.com/wavetermdev/waveterm/pkg/web/webcmd"
 	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wpsevents"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshutil"
 )
@@ -126,6 +127,10 @@ func TypeToTSType(t reflect.Type, tsTypesMap map[reflect.Type]string) (string, [
 	case reflect.Bool:
 		return "boolean", nil
 	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// []byte is base64 encoded in json
+			return "string", nil
+		}
 		elemType, subTypes := TypeToTSType(t.Elem(), tsTypesMap)
 		if elemType == "" {
 			return "", nil
@@ -259,6 +264,29 @@ func generateTSTypeUnionInternal(unionMeta tsgenmeta.TypeUnionMeta) string {
 	return buf.String()
 }
 
+// generates TypedWaveEvent, a union of WaveEvent types (discriminated by event name) from the wpsevents registry
+func GenerateEventTypeUnion(tsTypesMap map[reflect.Type]string) {
+	var buf bytes.Buffer
+	buf.WriteString("// wpsevents.TypedWaveEvent\n")
+	buf.WriteString("type TypedWaveEvent = Omit<WaveEvent, \"event\" | \"data\"> & (\n")
+	for idx, info := range wpsevents.EventTypes {
+		sep := "|"
+		if idx == 0 {
+			sep = " "
+		}
+		dataStr := "data?: undefined"
+		if info.DataType != nil {
+			tsType, _ := TypeToTSType(info.DataType, tsTypesMap)
+			dataStr = fmt.Sprintf("data: %s", tsType)
+			GenerateTSType(info.DataType, tsTypesMap)
+		}
+		buf.WriteString(fmt.Sprintf("    %s { event: %q; %s }\n", sep, info.Event, dataStr))
+	}
+	buf.WriteString(");\n")
+	tsTypesMap[reflect.TypeOf((*wpsevents.TypedWaveEvent)(nil)).Elem()] = buf.String()
+	GenerateTSType(reflect.TypeOf(wps.WaveEvent{}), tsTypesMap)
+}
+
 func GenerateTSType(rtype reflect.Type, tsTypesMap map[reflect.Type]string) {
 	if rtype == nil {
 		return
@@ -414,6 +442,9 @@ func GenerateWshClientApiMethod(methodDecl *wshrpc.WshRpcMethodDecl, tsTypesMap
 		return generateWshClientApiMethod_ResponseStream(methodDecl, tsTypesMap)
 	} else if methodDecl.CommandType == wshrpc.RpcType_Call {
 		return generateWshClientApiMethod_Call(methodDecl, tsTypesMap)
+	} else if methodDecl.CommandType == wshrpc.RpcType_StreamingRequest {
+		// the frontend doesn't send streaming requests
+		return ""
 	} else {
 		panic(fmt.Sprintf("cannot generate wshserver commandtype %q", methodDecl.CommandType))
 	}
@@ -473,6 +504,8 @@ func GenerateWaveObjTypes(tsTypesMap map[reflect.Type]string) {
 	for _, extraType := range ExtraTypes {
 		GenerateTSType(reflect.TypeOf(extraType), tsTypesMap)
 	}
+	// after ExtraTypes so event data types can reference them (e.g. WaveObjUpdate.obj => WaveObj)
+	GenerateEventTypeUnion(tsTypesMap)
 	for _, rtype := range waveobj.AllWaveObjTypes() {
 		GenerateTSType(rtype, tsTypesMap)
 	}
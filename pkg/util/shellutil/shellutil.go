@@ -33,6 +33,9 @@ var userShellRegexp = regexp.MustCompile(`^UserShell: (.*)$`)
 const DefaultShellPath = "/bin/bash"
 
 const WaveAppPathVarName = "WAVETERM_APP_PATH"
+
+// shell:initscript from connections.json, run (and unset) by the rc files below
+const WaveInitScriptVarName = "WAVETERM_INITSCRIPT"
 const AppPathBinDir = "bin"
 
 const (
@@ -54,6 +57,22 @@ export PATH={{.WSHBINDIR}}:$PATH
 if [[ -n ${_comps+x} ]]; then
   source <(wsh completion zsh)
 fi
+
+if [[ -n "$WAVETERM_INITSCRIPT" ]]; then
+  eval "$WAVETERM_INITSCRIPT"
+  unset WAVETERM_INITSCRIPT
+fi
+
+# WAVETERM_JWT expires, refresh it (at most once an hour) from the prompt
+_waveterm_jwt_ts=$SECONDS
+_waveterm_refresh_jwt() {
+  if [[ -n "$WAVETERM_JWT" ]] && (( SECONDS - _waveterm_jwt_ts >= 3600 )); then
+    local newjwt
+    newjwt=$(wsh token refresh 2>/dev/null) && [[ -n "$newjwt" ]] && export WAVETERM_JWT="$newjwt"
+    _waveterm_jwt_ts=$SECONDS
+  fi
+}
+precmd_functions+=(_waveterm_refresh_jwt)
 `
 
 	ZshStartup_Zlogin = `
@@ -85,12 +104,47 @@ if type _init_completion &>/dev/null; then
   source <(wsh completion bash)
 fi
 
+if [ -n "$WAVETERM_INITSCRIPT" ]; then
+    eval "$WAVETERM_INITSCRIPT"
+    unset WAVETERM_INITSCRIPT
+fi
+
+# WAVETERM_JWT expires, refresh it (at most once an hour) from the prompt
+_waveterm_jwt_ts=$SECONDS
+_waveterm_refresh_jwt() {
+    if [ -n "$WAVETERM_JWT" ] && [ $((SECONDS - _waveterm_jwt_ts)) -ge 3600 ]; then
+        local newjwt
+        newjwt=$(wsh token refresh 2>/dev/null) && [ -n "$newjwt" ] && export WAVETERM_JWT="$newjwt"
+        _waveterm_jwt_ts=$SECONDS
+    fi
+}
+PROMPT_COMMAND="_waveterm_refresh_jwt${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+
 `
 	PwshStartup_wavepwsh = `
 # no need to source regular profiles since we cannot
 # overwrite those with powershell. Instead we will source
 # this file with -NoExit
 $env:PATH = "{{.WSHBINDIR}}" + "{{.PATHSEP}}" + $env:PATH
+
+if ($env:WAVETERM_INITSCRIPT) {
+    Invoke-Expression $env:WAVETERM_INITSCRIPT
+    Remove-Item Env:WAVETERM_INITSCRIPT
+}
+
+# WAVETERM_JWT expires, refresh it (at most once an hour) from the prompt
+$global:_WaveJwtTs = Get-Date
+$global:_WaveOrigPrompt = $function:prompt
+function global:prompt {
+    if ($env:WAVETERM_JWT -and ((Get-Date) - $global:_WaveJwtTs).TotalSeconds -ge 3600) {
+        $newJwt = wsh token refresh 2>$null
+        if ($LASTEXITCODE -eq 0 -and $newJwt) {
+            $env:WAVETERM_JWT = "$newJwt".Trim()
+        }
+        $global:_WaveJwtTs = Get-Date
+    }
+    & $global:_WaveOrigPrompt
+}
 `
 )
 
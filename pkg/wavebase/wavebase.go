@@ -32,7 +32,6 @@ const WaveDevVarName = "WAVETERM_DEV"
 const WaveLockFile = "wave.lock"
 const DomainSocketBaseName = "wave.sock"
 const WaveDBDir = "db"
-const JwtSecret = "waveterm" // TODO generate and store this
 const ConfigDir = "config"
 
 var baseLock = &sync.Mutex{}
@@ -33,16 +33,17 @@ type MetaTSType struct {
 	FrameBorderColor         string `json:"frame:bordercolor,omitempty"`
 	FrameBorderColor_Focused string `json:"frame:bordercolor:focused,omitempty"`
 
-	Cmd               string            `json:"cmd,omitempty"`
-	CmdClear          bool              `json:"cmd:*,omitempty"`
-	CmdInteractive    bool              `json:"cmd:interactive,omitempty"`
-	CmdLogin          bool              `json:"cmd:login,omitempty"`
-	CmdRunOnStart     bool              `json:"cmd:runonstart,omitempty"`
-	CmdClearOnStart   bool              `json:"cmd:clearonstart,omitempty"`
-	CmdClearOnRestart bool              `json:"cmd:clearonrestart,omitempty"`
-	CmdEnv            map[string]string `json:"cmd:env,omitempty"`
-	CmdCwd            string            `json:"cmd:cwd,omitempty"`
-	CmdNoWsh          bool              `json:"cmd:nowsh,omitempty"`
+	Cmd                   string            `json:"cmd,omitempty"`
+	CmdClear              bool              `json:"cmd:*,omitempty"`
+	CmdInteractive        bool              `json:"cmd:interactive,omitempty"`
+	CmdLogin              bool              `json:"cmd:login,omitempty"`
+	CmdRunOnStart         bool              `json:"cmd:runonstart,omitempty"`
+	CmdClearOnStart       bool              `json:"cmd:clearonstart,omitempty"`
+	CmdClearOnRestart     bool              `json:"cmd:clearonrestart,omitempty"`
+	CmdRestartOnReconnect bool              `json:"cmd:restartonreconnect,omitempty"` // cmd blocks on a connection are restarted when it reconnects
+	CmdEnv                map[string]string `json:"cmd:env,omitempty"`
+	CmdCwd                string            `json:"cmd:cwd,omitempty"`
+	CmdNoWsh              bool              `json:"cmd:nowsh,omitempty"`
 
 	GraphClear     bool     `json:"graph:*,omitempty"`
 	GraphNumPoints int      `json:"graph:numpoints,omitempty"`
@@ -0,0 +1,122 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wconfig
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// connections.json is keyed by connection name (as it appears in the connection list, e.g. "user@host:2222")
+// or by a glob pattern ("*" and "?", e.g. "*@prod-*").  every matching entry applies, patterns first (shorter
+// patterns are less specific and go first), then the exact name.  later entries override earlier ones field by
+// field, and shell:env maps are merged.
+type ConnConfigType struct {
+	DisplayName     string            `json:"display:name,omitempty"`
+	DisplayColor    string            `json:"display:color,omitempty"`
+	ShellPath       string            `json:"shell:path,omitempty"`       // used instead of the detected shell
+	ShellEnv        map[string]string `json:"shell:env,omitempty"`        // set in shells and cmd blocks (block cmd:env wins)
+	ShellCwd        string            `json:"shell:cwd,omitempty"`        // initial directory (block cmd:cwd wins)
+	ShellInitScript string            `json:"shell:initscript,omitempty"` // runs in interactive shells after the rc files (needs wsh)
+	WshEnabled      *bool             `json:"wsh:enabled,omitempty"`      // false skips installing wsh (no connserver, no shell integration)
+
+	// these override the conn:* defaults in settings.json
+	ConnRpcCaps              []string `json:"conn:rpccaps,omitempty"`       // rpc caps for the connection ([] for none)
+	ConnAutoReconnect        *bool    `json:"conn:autoreconnect,omitempty"` // reconnect (with backoff) when the connection drops
+	ConnReconnectMaxAttempts int      `json:"conn:reconnectmaxattempts,omitempty"`
+}
+
+func (cc ConnConfigType) IsWshEnabled() bool {
+	return cc.WshEnabled == nil || *cc.WshEnabled
+}
+
+func isConnPattern(key string) bool {
+	return strings.ContainsAny(key, "*?[")
+}
+
+func connKeyMatches(key string, connName string) bool {
+	if !isConnPattern(key) {
+		return key == connName
+	}
+	// path.Match's "*" stops at "/", but nested connection names ("user@jump/user@host") should match
+	// patterns across the separator ("*@prod-*" matches "user@jump/root@prod-db")
+	matched, err := path.Match(strings.ReplaceAll(key, "/", "\x00"), strings.ReplaceAll(connName, "/", "\x00"))
+	return err == nil && matched
+}
+
+func mergeConnConfig(base ConnConfigType, overlay ConnConfigType) ConnConfigType {
+	if overlay.DisplayName != "" {
+		base.DisplayName = overlay.DisplayName
+	}
+	if overlay.DisplayColor != "" {
+		base.DisplayColor = overlay.DisplayColor
+	}
+	if overlay.ShellPath != "" {
+		base.ShellPath = overlay.ShellPath
+	}
+	if len(overlay.ShellEnv) > 0 {
+		env := make(map[string]string)
+		for k, v := range base.ShellEnv {
+			env[k] = v
+		}
+		for k, v := range overlay.ShellEnv {
+			env[k] = v
+		}
+		base.ShellEnv = env
+	}
+	if overlay.ShellCwd != "" {
+		base.ShellCwd = overlay.ShellCwd
+	}
+	if overlay.ShellInitScript != "" {
+		base.ShellInitScript = overlay.ShellInitScript
+	}
+	if overlay.WshEnabled != nil {
+		base.WshEnabled = overlay.WshEnabled
+	}
+	if overlay.ConnRpcCaps != nil {
+		base.ConnRpcCaps = overlay.ConnRpcCaps
+	}
+	if overlay.ConnAutoReconnect != nil {
+		base.ConnAutoReconnect = overlay.ConnAutoReconnect
+	}
+	if overlay.ConnReconnectMaxAttempts > 0 {
+		base.ConnReconnectMaxAttempts = overlay.ConnReconnectMaxAttempts
+	}
+	return base
+}
+
+func (fc *FullConfigType) ResolveConnConfig(connName string) ConnConfigType {
+	var matchingKeys []string
+	for key := range fc.Connections {
+		if connKeyMatches(key, connName) {
+			matchingKeys = append(matchingKeys, key)
+		}
+	}
+	sort.Slice(matchingKeys, func(i, j int) bool {
+		iPattern, jPattern := isConnPattern(matchingKeys[i]), isConnPattern(matchingKeys[j])
+		if iPattern != jPattern {
+			return iPattern
+		}
+		if len(matchingKeys[i]) != len(matchingKeys[j]) {
+			return len(matchingKeys[i]) < len(matchingKeys[j])
+		}
+		return matchingKeys[i] < matchingKeys[j]
+	})
+	var rtn ConnConfigType
+	for _, key := range matchingKeys {
+		rtn = mergeConnConfig(rtn, fc.Connections[key])
+	}
+	return rtn
+}
+
+// resolves from the current config (connections.json is re-read by the file watcher, so this is always current)
+func GetConnConfig(connName string) ConnConfigType {
+	watcher := GetWatcher()
+	if watcher == nil {
+		return ConnConfigType{}
+	}
+	fullConfig := watcher.GetFullConfig()
+	return fullConfig.ResolveConnConfig(connName)
+}
@@ -0,0 +1,70 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wconfig
+
+import (
+	"testing"
+)
+
+func TestResolveConnConfig(t *testing.T) {
+	wshDisabled := false
+	autoReconnect := true
+	fullConfig := &FullConfigType{
+		Connections: map[string]ConnConfigType{
+			"*": {
+				ShellEnv: map[string]string{"EDITOR": "vi", "LANG": "C"},
+				ShellCwd: "~",
+			},
+			"*@prod-*": {
+				DisplayColor:      "red",
+				ShellEnv:          map[string]string{"EDITOR": "nano"},
+				WshEnabled:        &wshDisabled,
+				ConnRpcCaps:       []string{"read"},
+				ConnAutoReconnect: &autoReconnect,
+			},
+			"root@prod-db": {
+				DisplayName:              "prod db",
+				ShellCwd:                 "/var/lib/db",
+				ConnRpcCaps:              []string{},
+				ConnReconnectMaxAttempts: 3,
+			},
+		},
+	}
+
+	cc := fullConfig.ResolveConnConfig("root@prod-db")
+	if cc.DisplayName != "prod db" || cc.DisplayColor != "red" {
+		t.Errorf("display fields not merged: %q %q", cc.DisplayName, cc.DisplayColor)
+	}
+	if cc.ShellCwd != "/var/lib/db" {
+		t.Errorf("exact name should override patterns, got cwd %q", cc.ShellCwd)
+	}
+	if cc.ShellEnv["EDITOR"] != "nano" || cc.ShellEnv["LANG"] != "C" {
+		t.Errorf("env not merged (more specific patterns win): %v", cc.ShellEnv)
+	}
+	if cc.IsWshEnabled() {
+		t.Errorf("wsh should be disabled for root@prod-db")
+	}
+	if cc.ConnRpcCaps == nil || len(cc.ConnRpcCaps) != 0 {
+		t.Errorf("empty conn:rpccaps should override the pattern's caps, got %v", cc.ConnRpcCaps)
+	}
+	if cc.ConnAutoReconnect == nil || !*cc.ConnAutoReconnect || cc.ConnReconnectMaxAttempts != 3 {
+		t.Errorf("reconnect settings not merged: %v %d", cc.ConnAutoReconnect, cc.ConnReconnectMaxAttempts)
+	}
+
+	cc = fullConfig.ResolveConnConfig("user@dev:2222")
+	if cc.DisplayName != "" || cc.ShellCwd != "~" || !cc.IsWshEnabled() || cc.ConnRpcCaps != nil || cc.ConnAutoReconnect != nil {
+		t.Errorf("only \"*\" should apply to user@dev:2222, got %+v", cc)
+	}
+
+	// patterns match across the separator in nested connection names, exact names don't match a nested host
+	cc = fullConfig.ResolveConnConfig("user@jump/root@prod-db")
+	if cc.DisplayColor != "red" || cc.ShellCwd != "~" || cc.DisplayName != "" || cc.IsWshEnabled() {
+		t.Errorf("\"*\" and \"*@prod-*\" should apply to a nested connection, got %+v", cc)
+	}
+
+	// resolving must not modify the config entries
+	if len(fullConfig.Connections["*"].ShellEnv) != 2 {
+		t.Errorf("resolving modified the \"*\" env: %v", fullConfig.Connections["*"].ShellEnv)
+	}
+}
@@ -49,5 +49,16 @@ const (
 
 	ConfigKey_TelemetryClear                 = "telemetry:*"
 	ConfigKey_TelemetryEnabled               = "telemetry:enabled"
+
+	ConfigKey_ConnClear                      = "conn:*"
+	ConfigKey_ConnRpcCaps                    = "conn:rpccaps"
+	ConfigKey_ConnRpcCapsByConn              = "conn:rpccapsbyconn"
+	ConfigKey_ConnKeepAliveIntervalMs        = "conn:keepaliveintervalms"
+	ConfigKey_ConnKeepAliveMaxMissed         = "conn:keepalivemaxmissed"
+	ConfigKey_ConnAutoReconnect              = "conn:autoreconnect"
+	ConfigKey_ConnReconnectMaxAttempts       = "conn:reconnectmaxattempts"
+
+	ConfigKey_GatewayClear                   = "gateway:*"
+	ConfigKey_GatewayEnabled                 = "gateway:enabled"
 )
 
@@ -83,6 +83,19 @@ type SettingsType struct {
 
 	TelemetryClear   bool `json:"telemetry:*,omitempty"`
 	TelemetryEnabled bool `json:"telemetry:enabled,omitempty"`
+
+	// rpccaps, autoreconnect and reconnectmaxattempts are defaults, connections.json can override them per connection.
+	// the keepalive settings stay global, one router loop pings every connserver route.
+	ConnClear                bool                `json:"conn:*,omitempty"`
+	ConnRpcCaps              []string            `json:"conn:rpccaps,omitempty"`             // rpc caps for remote connections (see wshrpc.Cap_*)
+	ConnRpcCapsByConn        map[string][]string `json:"conn:rpccapsbyconn,omitempty"`       // per-connection overrides of conn:rpccaps (conn:rpccaps in connections.json wins)
+	ConnKeepAliveIntervalMs  float64             `json:"conn:keepaliveintervalms,omitempty"` // router keepalive pings to connservers (negative disables)
+	ConnKeepAliveMaxMissed   float64             `json:"conn:keepalivemaxmissed,omitempty"`  // missed pings before a connection is unresponsive
+	ConnAutoReconnect        bool                `json:"conn:autoreconnect,omitempty"`       // reconnect (with backoff) when a connection drops (on by default)
+	ConnReconnectMaxAttempts float64             `json:"conn:reconnectmaxattempts,omitempty"`
+
+	GatewayClear   bool `json:"gateway:*,omitempty"`
+	GatewayEnabled bool `json:"gateway:enabled,omitempty"` // local rpc gateway for external tools (api tokens)
 }
 
 type ConfigError struct {
@@ -97,6 +110,8 @@ type FullConfigType struct {
 	Widgets        map[string]WidgetConfigType    `json:"widgets"`
 	Presets        map[string]waveobj.MetaMapType `json:"presets"`
 	TermThemes     map[string]TermThemeType       `json:"termthemes"`
+	Webhooks       map[string]WebhookConfigType   `json:"webhooks"`
+	Connections    map[string]ConnConfigType      `json:"connections"`
 	ConfigErrors   []ConfigError                  `json:"configerrors" configfile:"-"`
 }
 
@@ -359,6 +374,16 @@ type WidgetConfigType struct {
 	BlockDef     waveobj.BlockDef `json:"blockdef"`
 }
 
+// events matching event+scope (and filter) are POSTed as json to url (must be a local http endpoint)
+type WebhookConfigType struct {
+	Event    string            `json:"event"`
+	Scope    string            `json:"scope,omitempty"` // scope pattern (supports "*" and "**"), empty matches all scopes
+	Url      string            `json:"url"`
+	Filter   string            `json:"filter,omitempty"` // optional data filter (same syntax as wps subscriptions)
+	Headers  map[string]string `json:"headers,omitempty"`
+	Disabled bool              `json:"disabled,omitempty"`
+}
+
 type MimeTypeConfigType struct {
 	Icon  string `json:"icon"`
 	Color string `json:"color"`
@@ -15,6 +15,7 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/telemetry"
 	"github.com/wavetermdev/waveterm/pkg/waveobj"
 	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
 	"github.com/wavetermdev/waveterm/pkg/wstore"
 )
 
@@ -31,6 +32,7 @@ func DeleteBlock(ctx context.Context, tabId string, blockId string) error {
 	if err != nil {
 		return fmt.Errorf("error deleting block: %w", err)
 	}
+	wshutil.RevokeBlockTokens(blockId)
 	go blockcontroller.StopBlockController(blockId)
 	sendBlockCloseEvent(tabId, blockId)
 	return nil
@@ -198,3 +200,33 @@ func CreateBlock(ctx context.Context, tabId string, blockDef *waveobj.BlockDef,
 	}()
 	return blockData, nil
 }
+
+// returns the connections an object uses ("" for local), for a tab it is the connections of all its blocks
+// used by the router to check Cap_BlockSelf for connservers
+func ResolveObjConns(oref waveobj.ORef) ([]string, error) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancelFn()
+	switch oref.OType {
+	case waveobj.OType_Block:
+		block, err := wstore.DBMustGet[*waveobj.Block](ctx, oref.OID)
+		if err != nil {
+			return nil, err
+		}
+		return []string{block.Meta.GetString(waveobj.MetaKey_Connection, "")}, nil
+	case waveobj.OType_Tab:
+		tab, err := wstore.DBMustGet[*waveobj.Tab](ctx, oref.OID)
+		if err != nil {
+			return nil, err
+		}
+		var rtn []string
+		for _, blockId := range tab.BlockIds {
+			block, err := wstore.DBGet[*waveobj.Block](ctx, blockId)
+			if err != nil || block == nil {
+				continue
+			}
+			rtn = append(rtn, block.Meta.GetString(waveobj.MetaKey_Connection, ""))
+		}
+		return rtn, nil
+	}
+	return nil, fmt.Errorf("cannot resolve connections for %s", oref)
+}
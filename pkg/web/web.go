@@ -4,7 +4,6 @@
 package web
 
 import (
-	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -278,11 +277,10 @@ func handleRemoteStreamFile(w http.ResponseWriter, r *http.Request, conn string,
 			w.Header().Set(ContentLengthHeaderKey, fmt.Sprintf("%d", fileInfo.Size))
 			continue
 		}
-		if respUnion.Response.Data64 == "" {
+		if len(respUnion.Response.Data) == 0 {
 			continue
 		}
-		decoder := base64.NewDecoder(base64.StdEncoding, bytes.NewReader([]byte(respUnion.Response.Data64)))
-		_, err := io.Copy(w, decoder)
+		_, err := w.Write(respUnion.Response.Data)
 		if err != nil {
 			log.Printf("error streaming file %q: %v\n", fileName, err)
 			// not sure what to do here, the headers have already been sent.
@@ -438,15 +436,21 @@ func RunWebServer(listener net.Listener) {
 	gr.HandleFunc("/wave/file", WebFnWrap(WebFnOpts{AllowCaching: false}, handleWaveFile))
 	gr.HandleFunc("/wave/service", WebFnWrap(WebFnOpts{JsonErrors: true}, handleService))
 	gr.HandleFunc("/wave/log-active-state", WebFnWrap(WebFnOpts{JsonErrors: true}, handleLogActiveState))
+	gr.HandleFunc(GatewayRpcPath, gatewayFnWrap(handleGatewayRpc))
+	gr.HandleFunc(GatewayRpcPath+"/{command}", gatewayFnWrap(handleGatewayCommand))
 	handler := http.TimeoutHandler(gr, HttpTimeoutDuration, "Timeout")
 	if wavebase.IsDevMode() {
 		handler = handlers.CORS(handlers.AllowedOrigins([]string{"*"}))(handler)
 	}
+	// the gateway websocket is long lived, it can't go through the TimeoutHandler (see webgateway.go)
+	topRouter := mux.NewRouter()
+	topRouter.HandleFunc(GatewayWsPath, gatewayFnWrap(handleGatewayWs))
+	topRouter.PathPrefix("/").Handler(handler)
 	server := &http.Server{
 		ReadTimeout:    HttpReadTimeout,
 		WriteTimeout:   HttpWriteTimeout,
 		MaxHeaderBytes: HttpMaxHeaderBytes,
-		Handler:        handler,
+		Handler:        topRouter,
 	}
 	err := server.Serve(listener)
 	if err != nil {
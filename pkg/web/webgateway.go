@@ -0,0 +1,351 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+// the gateway lets tools outside of wave (editors, launchers, test harnesses) send rpc commands to wavesrv.
+// it is off by default (gateway:enabled), and every request needs an api token ("Authorization: Bearer <token>",
+// tokens are created with the apitokencreate rpc).  the token's caps are enforced by the router like any other
+// authenticated route (see wshutil/wshauth.go).
+//
+//   POST /wave/gateway/rpc -- body is an rpc message ({"command":..., "data":..., "route":..., "timeout":...}),
+//                             returns {"success":true,"data":...} (an array for streaming responses) or {"error":...}
+//   POST /wave/gateway/rpc/<command>?route=...&timeout=... -- body is the command data, same response
+//                             (this is the form described by the generated openapi document, see pkg/schemagen)
+//   GET  /wave/gateway/ws  -- websocket, text messages are rpc messages in both directions (use eventsub to get events)
+//
+// the port changes every time wave starts, the urls are written to gateway.json in the wave home dir.
+// requests from browsers (with an Origin header) are rejected.
+
+const GatewayRpcPath = "/wave/gateway/rpc"
+const GatewayWsPath = "/wave/gateway/ws"
+const GatewayDiscoveryFileName = "gateway.json"
+
+const gatewayMaxBodySize = 1024 * 1024
+const gatewayWsReadLimit = 1024 * 1024
+
+// vars so tests can change them
+var gatewayRevalidateTime = 10 * time.Second
+var isGatewayEnabled = isGatewayEnabledInConfig
+
+type GatewayDiscovery struct {
+	Url   string `json:"url"`
+	WsUrl string `json:"wsurl"`
+	Pid   int    `json:"pid"`
+}
+
+func WriteGatewayDiscoveryFile(addr net.Addr) error {
+	discovery := GatewayDiscovery{
+		Url:   fmt.Sprintf("http://%s%s", addr, GatewayRpcPath),
+		WsUrl: fmt.Sprintf("ws://%s%s", addr, GatewayWsPath),
+		Pid:   os.Getpid(),
+	}
+	barr, err := json.MarshalIndent(discovery, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(wavebase.GetWaveHomeDir(), GatewayDiscoveryFileName), barr, 0600)
+}
+
+func isGatewayEnabledInConfig() bool {
+	watcher := wconfig.GetWatcher()
+	if watcher == nil {
+		return false
+	}
+	return watcher.GetFullConfig().Settings.GatewayEnabled
+}
+
+// returns the http status for the error
+func validateGatewayRequest(r *http.Request) (*wstore.ApiToken, int, error) {
+	if !isGatewayEnabled() {
+		return nil, http.StatusForbidden, fmt.Errorf("the gateway is disabled (see the gateway:enabled setting)")
+	}
+	if r.Header.Get("Origin") != "" {
+		return nil, http.StatusForbidden, fmt.Errorf("gateway requests from browsers are not allowed")
+	}
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return nil, http.StatusUnauthorized, fmt.Errorf("no api token (use an \"Authorization: Bearer <token>\" header)")
+	}
+	apiToken, err := validateApiToken(r.Context(), token)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+	return apiToken, http.StatusOK, nil
+}
+
+func validateApiToken(ctx context.Context, token string) (*wstore.ApiToken, error) {
+	ctx, cancelFn := context.WithTimeout(ctx, 2*time.Second)
+	defer cancelFn()
+	apiToken, err := wstore.ValidateApiToken(ctx, token)
+	if err == wstore.ErrNotFound {
+		return nil, fmt.Errorf("invalid api token")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error validating api token: %w", err)
+	}
+	return apiToken, nil
+}
+
+// registers a proxy route for a gateway client, the caller must call the returned cleanup fn
+func registerGatewayRoute(apiToken *wstore.ApiToken) (string, *wshutil.WshRpcProxy, func()) {
+	routeId := wshutil.MakeGatewayRouteId(uuid.New().String())
+	proxy := wshutil.MakeRpcProxy()
+	proxy.SetRpcContext(&wshrpc.RpcContext{ClientType: wshrpc.ClientType_Gateway, Caps: apiToken.Caps})
+	wshutil.DefaultRouter.RegisterRoute(routeId, proxy)
+	log.Printf("[gateway] route %q registered for api token %q (%s)\n", routeId, apiToken.Name, apiToken.TokenId)
+	return routeId, proxy, func() {
+		wshutil.DefaultRouter.UnregisterRoute(routeId)
+		close(proxy.FromRemoteCh)
+	}
+}
+
+func writeGatewayHttpError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set(ContentTypeHeaderKey, ContentTypeJson)
+	w.WriteHeader(status)
+	barr, _ := json.Marshal(map[string]any{"error": err.Error()})
+	w.Write(barr)
+}
+
+func gatewayFnWrap(fn WebFnType) WebFnType {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recErr := recover()
+			if recErr == nil {
+				return
+			}
+			log.Printf("panic in gateway handler: %v\n", recErr)
+			debug.PrintStack()
+			writeGatewayHttpError(w, http.StatusInternalServerError, fmt.Errorf("panic: %v", recErr))
+		}()
+		w.Header().Set(CacheControlHeaderKey, CacheControlHeaderNoCache)
+		fn(w, r)
+	}
+}
+
+func handleGatewayRpc(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeGatewayHttpError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+		return
+	}
+	apiToken, status, err := validateGatewayRequest(r)
+	if err != nil {
+		writeGatewayHttpError(w, status, err)
+		return
+	}
+	bodyData, err := io.ReadAll(http.MaxBytesReader(w, r.Body, gatewayMaxBodySize))
+	if err != nil {
+		writeGatewayHttpError(w, http.StatusBadRequest, fmt.Errorf("error reading request body: %w", err))
+		return
+	}
+	var msg wshutil.RpcMessage
+	err = json.Unmarshal(bodyData, &msg)
+	if err != nil {
+		writeGatewayHttpError(w, http.StatusBadRequest, fmt.Errorf("invalid rpc message: %w", err))
+		return
+	}
+	runGatewayCommand(w, r, apiToken, msg)
+}
+
+// POST GatewayRpcPath/<command>, the body is the command data (can be empty for commands without data)
+func handleGatewayCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeGatewayHttpError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+		return
+	}
+	apiToken, status, err := validateGatewayRequest(r)
+	if err != nil {
+		writeGatewayHttpError(w, status, err)
+		return
+	}
+	bodyData, err := io.ReadAll(http.MaxBytesReader(w, r.Body, gatewayMaxBodySize))
+	if err != nil {
+		writeGatewayHttpError(w, http.StatusBadRequest, fmt.Errorf("error reading request body: %w", err))
+		return
+	}
+	msg := wshutil.RpcMessage{
+		Command: mux.Vars(r)["command"],
+		Route:   r.URL.Query().Get("route"),
+	}
+	if timeoutStr := r.URL.Query().Get("timeout"); timeoutStr != "" {
+		msg.Timeout, err = strconv.Atoi(timeoutStr)
+		if err != nil {
+			writeGatewayHttpError(w, http.StatusBadRequest, fmt.Errorf("invalid timeout %q", timeoutStr))
+			return
+		}
+	}
+	if len(bytes.TrimSpace(bodyData)) > 0 {
+		err = json.Unmarshal(bodyData, &msg.Data)
+		if err != nil {
+			writeGatewayHttpError(w, http.StatusBadRequest, fmt.Errorf("invalid command data: %w", err))
+			return
+		}
+	}
+	runGatewayCommand(w, r, apiToken, msg)
+}
+
+func runGatewayCommand(w http.ResponseWriter, r *http.Request, apiToken *wstore.ApiToken, msg wshutil.RpcMessage) {
+	methodDecl := wshutil.WshCommandDeclMap[msg.Command]
+	if methodDecl == nil {
+		writeGatewayHttpError(w, http.StatusBadRequest, fmt.Errorf("unknown command %q", msg.Command))
+		return
+	}
+	if methodDecl.CommandType != wshrpc.RpcType_Call && methodDecl.CommandType != wshrpc.RpcType_ResponseStream {
+		writeGatewayHttpError(w, http.StatusBadRequest, fmt.Errorf("command %q needs the websocket (%s)", msg.Command, GatewayWsPath))
+		return
+	}
+	rtn, err := runGatewayRpc(r.Context(), apiToken, msg, methodDecl.CommandType == wshrpc.RpcType_ResponseStream)
+	if err != nil {
+		WriteJsonError(w, err)
+		return
+	}
+	WriteJsonSuccess(w, rtn)
+}
+
+// sends one command and waits for its response(s), streaming responses are returned as an array
+func runGatewayRpc(ctx context.Context, apiToken *wstore.ApiToken, msg wshutil.RpcMessage, isStream bool) (any, error) {
+	routeId, proxy, cleanupFn := registerGatewayRoute(apiToken)
+	defer cleanupFn()
+	msg = wshutil.RpcMessage{
+		Command: msg.Command,
+		ReqId:   uuid.New().String(),
+		Timeout: msg.Timeout,
+		Route:   msg.Route,
+		Source:  routeId,
+		Data:    msg.Data,
+	}
+	if msg.Timeout <= 0 {
+		msg.Timeout = wshutil.DefaultTimeoutMs
+	}
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancelFn := context.WithTimeout(ctx, time.Duration(msg.Timeout)*time.Millisecond)
+	defer cancelFn()
+	proxy.FromRemoteCh <- msgBytes
+	var streamData []any
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timeout waiting for response")
+		case respBytes := <-proxy.ToRemoteCh:
+			respBytes, err = wshutil.BinFrameToJson(respBytes)
+			if err != nil {
+				continue
+			}
+			var resp wshutil.RpcMessage
+			err = json.Unmarshal(respBytes, &resp)
+			if err != nil || resp.ResId != msg.ReqId {
+				// events or other messages, nothing else can be sent to this route
+				continue
+			}
+			if resp.Error != "" {
+				return nil, errors.New(resp.Error)
+			}
+			if !isStream {
+				return resp.Data, nil
+			}
+			if resp.Data != nil {
+				streamData = append(streamData, resp.Data)
+			}
+			if !resp.Cont {
+				return streamData, nil
+			}
+		}
+	}
+}
+
+func handleGatewayWs(w http.ResponseWriter, r *http.Request) {
+	apiToken, status, err := validateGatewayRequest(r)
+	if err != nil {
+		writeGatewayHttpError(w, status, err)
+		return
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	conn, err := WebSocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("[gateway] websocket upgrade failed: %v\n", err)
+		return
+	}
+	routeId, proxy, cleanupFn := registerGatewayRoute(apiToken)
+	doneCh := make(chan struct{})
+	defer func() {
+		// the reader must be done before the proxy's input is closed
+		conn.Close()
+		<-doneCh
+		cleanupFn()
+	}()
+	go func() {
+		defer close(doneCh)
+		conn.SetReadLimit(gatewayWsReadLimit)
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if messageType != websocket.TextMessage {
+				continue
+			}
+			proxy.FromRemoteCh <- message
+		}
+	}()
+	// the token is checked again periodically, deleting it closes open sessions
+	revalidateTicker := time.NewTicker(gatewayRevalidateTime)
+	defer revalidateTicker.Stop()
+	for {
+		select {
+		case msgBytes := <-proxy.ToRemoteCh:
+			msgBytes, err = wshutil.BinFrameToJson(msgBytes)
+			if err != nil {
+				log.Printf("[gateway] error converting binary frame to json: %v\n", err)
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWaitTimeout))
+			err = conn.WriteMessage(websocket.TextMessage, msgBytes)
+			if err != nil {
+				log.Printf("[gateway] route %q write error: %v\n", routeId, err)
+				return
+			}
+		case <-revalidateTicker.C:
+			if !isGatewayEnabled() {
+				log.Printf("[gateway] closing route %q, the gateway was disabled\n", routeId)
+				return
+			}
+			_, err = validateApiToken(context.Background(), token)
+			if err != nil {
+				log.Printf("[gateway] closing route %q: %v\n", routeId, err)
+				return
+			}
+		case <-doneCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+// answers every request sent to the default route with the command name
+func runTestGatewayServer(t *testing.T) {
+	proxy := wshutil.MakeRpcProxy()
+	wshutil.DefaultRouter.RegisterRoute(wshutil.DefaultRoute, proxy)
+	t.Cleanup(func() { wshutil.DefaultRouter.UnregisterRoute(wshutil.DefaultRoute) })
+	go func() {
+		for msgBytes := range proxy.ToRemoteCh {
+			var msg wshutil.RpcMessage
+			if json.Unmarshal(msgBytes, &msg) != nil || msg.ReqId == "" {
+				continue
+			}
+			respBytes, _ := json.Marshal(wshutil.RpcMessage{ResId: msg.ReqId, Route: msg.Source, Data: "ok:" + msg.Command})
+			proxy.FromRemoteCh <- respBytes
+		}
+	}()
+}
+
+func makeTestGateway(t *testing.T) *httptest.Server {
+	err := wstore.InitWStoreForTesting()
+	if err != nil {
+		t.Fatalf("error initializing wstore: %v", err)
+	}
+	gatewayEnabled := true
+	isGatewayEnabled = func() bool { return gatewayEnabled }
+	t.Cleanup(func() { isGatewayEnabled = isGatewayEnabledInConfig })
+	runTestGatewayServer(t)
+	gr := mux.NewRouter()
+	gr.HandleFunc(GatewayRpcPath, gatewayFnWrap(handleGatewayRpc))
+	gr.HandleFunc(GatewayRpcPath+"/{command}", gatewayFnWrap(handleGatewayCommand))
+	gr.HandleFunc(GatewayWsPath, gatewayFnWrap(handleGatewayWs))
+	server := httptest.NewServer(gr)
+	t.Cleanup(server.Close)
+	return server
+}
+
+type gatewayResp struct {
+	Success bool   `json:"success"`
+	Data    any    `json:"data"`
+	Error   string `json:"error"`
+}
+
+func TestGatewayRpc(t *testing.T) {
+	server := makeTestGateway(t)
+	ctx := context.Background()
+	_, readToken, err := wstore.CreateApiToken(ctx, "read", wshrpc.DefaultApiTokenCaps)
+	if err != nil {
+		t.Fatalf("error creating token: %v", err)
+	}
+	_, configToken, err := wstore.CreateApiToken(ctx, "config", []string{wshrpc.Cap_Config})
+	if err != nil {
+		t.Fatalf("error creating token: %v", err)
+	}
+	deletedInfo, deletedToken, err := wstore.CreateApiToken(ctx, "deleted", wshrpc.DefaultApiTokenCaps)
+	if err != nil {
+		t.Fatalf("error creating token: %v", err)
+	}
+	err = wstore.DeleteApiToken(ctx, deletedInfo.TokenId)
+	if err != nil {
+		t.Fatalf("error deleting token: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		disabled bool
+		path     string
+		token    string
+		origin   string
+		body     string
+		status   int
+		errMatch string // expected error (substring), "" for success
+		data     any
+	}{
+		{name: "ok", path: GatewayRpcPath, token: readToken, body: `{"command":"connlist"}`, status: 200, data: "ok:connlist"},
+		{name: "command-path", path: GatewayRpcPath + "/" + wshrpc.Command_ConnList, token: readToken, status: 200, data: "ok:connlist"},
+		{name: "disabled", disabled: true, path: GatewayRpcPath, token: readToken, body: `{"command":"connlist"}`, status: 403, errMatch: "disabled"},
+		{name: "origin", path: GatewayRpcPath, token: readToken, origin: "http://example.com", body: `{"command":"connlist"}`, status: 403, errMatch: "browsers"},
+		{name: "no-token", path: GatewayRpcPath, body: `{"command":"connlist"}`, status: 401, errMatch: "no api token"},
+		{name: "unknown-token", path: GatewayRpcPath, token: wstore.ApiTokenPrefix + "0000", body: `{"command":"connlist"}`, status: 401, errMatch: "invalid api token"},
+		{name: "deleted-token", path: GatewayRpcPath, token: deletedToken, body: `{"command":"connlist"}`, status: 401, errMatch: "invalid api token"},
+		{name: "caps-denied", path: GatewayRpcPath, token: readToken, body: `{"command":"setconfig","data":{}}`, status: 200, errMatch: "permission denied"},
+		{name: "caps-allowed", path: GatewayRpcPath + "/" + wshrpc.Command_SetConfig, token: configToken, body: `{}`, status: 200, data: "ok:setconfig"},
+		{name: "caps-other", path: GatewayRpcPath, token: configToken, body: `{"command":"connlist"}`, status: 200, errMatch: "permission denied"},
+		{name: "unknown-command", path: GatewayRpcPath, token: readToken, body: `{"command":"nosuchcommand"}`, status: 400, errMatch: "unknown command"},
+	}
+	for _, test := range tests {
+		enabled := !test.disabled
+		isGatewayEnabled = func() bool { return enabled }
+		req, _ := http.NewRequest(http.MethodPost, server.URL+test.path, bytes.NewBufferString(test.body))
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		httpResp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request error: %v", test.name, err)
+		}
+		var resp gatewayResp
+		json.NewDecoder(httpResp.Body).Decode(&resp)
+		httpResp.Body.Close()
+		if httpResp.StatusCode != test.status {
+			t.Errorf("%s: expected status %d, got %d (%+v)", test.name, test.status, httpResp.StatusCode, resp)
+			continue
+		}
+		if test.errMatch == "" {
+			if !resp.Success || resp.Data != test.data {
+				t.Errorf("%s: expected success with %v, got %+v", test.name, test.data, resp)
+			}
+		} else if !strings.Contains(resp.Error, test.errMatch) {
+			t.Errorf("%s: expected error %q, got %+v", test.name, test.errMatch, resp)
+		}
+	}
+}
+
+func TestGatewayWebsocket(t *testing.T) {
+	server := makeTestGateway(t)
+	gatewayRevalidateTime = 50 * time.Millisecond
+	t.Cleanup(func() { gatewayRevalidateTime = 10 * time.Second })
+	ctx := context.Background()
+	tokenInfo, token, err := wstore.CreateApiToken(ctx, "ws", wshrpc.DefaultApiTokenCaps)
+	if err != nil {
+		t.Fatalf("error creating token: %v", err)
+	}
+	wsUrl := "ws" + strings.TrimPrefix(server.URL, "http") + GatewayWsPath
+
+	// browsers can't open the websocket
+	header := http.Header{"Authorization": []string{"Bearer " + token}, "Origin": []string{"http://example.com"}}
+	_, _, err = websocket.DefaultDialer.Dial(wsUrl, header)
+	if err == nil {
+		t.Fatalf("expected websocket with an Origin header to be rejected")
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsUrl, http.Header{"Authorization": []string{"Bearer " + token}})
+	if err != nil {
+		t.Fatalf("error opening websocket: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	conn.WriteJSON(wshutil.RpcMessage{Command: wshrpc.Command_ConnList, ReqId: "req1"})
+	var resp wshutil.RpcMessage
+	err = conn.ReadJSON(&resp)
+	if err != nil || resp.ResId != "req1" || resp.Data != "ok:connlist" {
+		t.Fatalf("unexpected response: %+v (%v)", resp, err)
+	}
+	conn.WriteJSON(wshutil.RpcMessage{Command: wshrpc.Command_SetConfig, ReqId: "req2", Data: map[string]any{}})
+	err = conn.ReadJSON(&resp)
+	if err != nil || resp.ResId != "req2" || !strings.Contains(resp.Error, "permission denied") {
+		t.Fatalf("expected permission denied: %+v (%v)", resp, err)
+	}
+
+	// deleting the token closes the open session
+	err = wstore.DeleteApiToken(ctx, tokenInfo.TokenId)
+	if err != nil {
+		t.Fatalf("error deleting token: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	if err == nil {
+		t.Fatalf("expected the websocket to be closed after the token was deleted")
+	}
+	if netErr, ok := err.(interface{ Timeout() bool }); ok && netErr.Timeout() {
+		t.Fatalf("websocket was not closed after the token was deleted")
+	}
+}
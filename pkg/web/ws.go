@@ -283,6 +283,15 @@ func HandleWsInternal(w http.ResponseWriter, r *http.Request) error {
 		// no waitgroup add here
 		// move values from rpcOutputCh to outputCh
 		for msgBytes := range wproxy.ToRemoteCh {
+			// the frontend only speaks json, rpc binary frames (see wshutil/wshrpcframe.go) are converted
+			if wshutil.IsBinFrame(msgBytes) {
+				jsonBytes, err := wshutil.BinFrameToJson(msgBytes)
+				if err != nil {
+					log.Printf("error converting binary frame to json: %v\n", err)
+					continue
+				}
+				msgBytes = jsonBytes
+			}
 			rpcWSMsg := map[string]any{
 				"eventtype": "rpc", // TODO don't hard code this (but def is in eventbus)
 				"data":      json.RawMessage(msgBytes),
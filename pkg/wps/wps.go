@@ -6,6 +6,8 @@ package wps
 
 import (
 	"log"
+	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
 
@@ -17,16 +19,33 @@ import (
 // strong typing and event types can be defined elsewhere
 
 const MaxPersist = 4096
+const ReplayStorePageSize = 500
 const ReMakeArrThreshold = 10 * 1024
 
 type Client interface {
 	SendEvent(routeId string, event WaveEvent)
 }
 
+// optional, clients that implement it get subscription replays through SendReplayEvents instead of SendEvent.
+// it may block (the replay runs in its own goroutine) but must not drop events, so long replays are not lost.
+type ReplayClient interface {
+	SendReplayEvents(routeId string, events []WaveEvent)
+}
+
+// optional durable storage for persisted events (see SetEventStore)
+// the store decides which events to keep (and for how long)
+type EventStore interface {
+	GetMaxSeq() int64           // highest seq in the store (used to seed the broker's seq counter)
+	StoreEvent(event WaveEvent) // called from Publish, must not block
+	// returns up to maxItems events (oldest first) with seq < beforeSeq
+	ReadEventHistory(eventType string, scope string, beforeSeq int64, maxItems int) []*WaveEvent
+}
+
 type BrokerSubscription struct {
-	AllSubs   []string            // routeids subscribed to "all" events
-	ScopeSubs map[string][]string // routeids subscribed to specific scopes
-	StarSubs  map[string][]string // routeids subscribed to star scope (scopes with "*" or "**" in them)
+	AllSubs   []string                // routeids subscribed to "all" events
+	ScopeSubs map[string][]string     // routeids subscribed to specific scopes
+	StarSubs  map[string][]string     // routeids subscribed to star scope (scopes with "*" or "**" in them)
+	Filters   map[string]*EventFilter // routeid => data filter (only for subscriptions with a filter)
 }
 
 type persistKey struct {
@@ -34,6 +53,16 @@ type persistKey struct {
 	Scope string
 }
 
+// replays are per subscription (a route has at most one subscription per event)
+type replayKey struct {
+	RouteId string
+	Event   string
+}
+
+type replayState struct {
+	Queued []WaveEvent // live events published while replaying
+}
+
 type persistEventWrap struct {
 	ArrTotalAdds int
 	Events       []*WaveEvent
@@ -42,14 +71,22 @@ type persistEventWrap struct {
 type BrokerType struct {
 	Lock       *sync.Mutex
 	Client     Client
+	Store      EventStore
 	SubMap     map[string]*BrokerSubscription
 	PersistMap map[persistKey]*persistEventWrap
+	EventSeq   int64
+	ReplayMap  map[replayKey]*replayState // subscriptions that are replaying events (live events are queued here until the replay is done)
 }
 
-var Broker = &BrokerType{
-	Lock:       &sync.Mutex{},
-	SubMap:     make(map[string]*BrokerSubscription),
-	PersistMap: make(map[persistKey]*persistEventWrap),
+var Broker = MakeBroker()
+
+func MakeBroker() *BrokerType {
+	return &BrokerType{
+		Lock:       &sync.Mutex{},
+		SubMap:     make(map[string]*BrokerSubscription),
+		PersistMap: make(map[persistKey]*persistEventWrap),
+		ReplayMap:  make(map[replayKey]*replayState),
+	}
 }
 
 func scopeHasStarMatch(scope string) bool {
@@ -74,14 +111,200 @@ func (b *BrokerType) GetClient() Client {
 	return b.Client
 }
 
+func (b *BrokerType) SetEventStore(store EventStore) {
+	maxSeq := store.GetMaxSeq()
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	b.Store = store
+	if maxSeq > b.EventSeq {
+		b.EventSeq = maxSeq
+	}
+}
+
 // if already subscribed, this will *resubscribe* with the new subscription (remove the old one, and replace with this one)
-func (b *BrokerType) Subscribe(subRouteId string, sub SubscriptionRequest) {
+// if sub.Since is set, persisted events after that seq are replayed (in order) before any live events are sent for the
+// subscription.  the replay runs in the background (Subscribe returns once the subscription is in place).
+// returns an error (and does not subscribe) if sub.Filter is invalid
+func (b *BrokerType) Subscribe(subRouteId string, sub SubscriptionRequest) error {
 	log.Printf("[wps] sub %s %s\n", subRouteId, sub.Event)
 	if sub.Event == "" {
-		return
+		return nil
+	}
+	filter, err := ParseEventFilter(sub.Filter)
+	if err != nil {
+		return err
 	}
+	rs, replayEvents, storeScopes, store := b.subscribeAndGetReplay(subRouteId, sub, filter)
+	if rs == nil {
+		return nil
+	}
+	go b.runReplay(subRouteId, sub, filter, rs, replayEvents, storeScopes, store)
+	return nil
+}
+
+// returns a nil replayState if there is no replay, otherwise the subscription is put into replay mode
+// storeScopes are the scopes whose in-memory history does not reach back to sub.Since (scope => seq of the oldest in-memory event)
+func (b *BrokerType) subscribeAndGetReplay(subRouteId string, sub SubscriptionRequest, filter *EventFilter) (*replayState, []WaveEvent, map[string]int64, EventStore) {
 	b.Lock.Lock()
 	defer b.Lock.Unlock()
+	b.subscribe_nolock(subRouteId, sub, filter)
+	if sub.Since <= 0 {
+		return nil, nil, nil, nil
+	}
+	replayEvents, storeScopes := b.getReplayEvents_nolock(sub, filter)
+	rs := &replayState{}
+	b.ReplayMap[replayKey{RouteId: subRouteId, Event: sub.Event}] = rs
+	return rs, replayEvents, storeScopes, b.Store
+}
+
+// reads stored events with sub.Since < seq < storeScopes[scope] into seqMap (paging back from the oldest in-memory event)
+func readStoreReplayEvents(store EventStore, sub SubscriptionRequest, filter *EventFilter, storeScopes map[string]int64, seqMap map[int64]*WaveEvent) {
+	for scope, beforeSeq := range storeScopes {
+		for beforeSeq > sub.Since+1 {
+			events := store.ReadEventHistory(sub.Event, scope, beforeSeq, ReplayStorePageSize)
+			for _, event := range events {
+				if event.Seq <= sub.Since || seqMap[event.Seq] != nil {
+					continue
+				}
+				if filter != nil && !filter.Match(NormalizeEventData(event.Data)) {
+					continue
+				}
+				seqMap[event.Seq] = event
+			}
+			if len(events) < ReplayStorePageSize {
+				break
+			}
+			beforeSeq = events[0].Seq
+		}
+	}
+}
+
+func makeSeqMap(events []WaveEvent) map[int64]*WaveEvent {
+	seqMap := make(map[int64]*WaveEvent)
+	for idx := range events {
+		seqMap[events[idx].Seq] = &events[idx]
+	}
+	return seqMap
+}
+
+func sortedSeqMapEvents(seqMap map[int64]*WaveEvent) []WaveEvent {
+	rtn := make([]WaveEvent, 0, len(seqMap))
+	for _, event := range seqMap {
+		rtn = append(rtn, *event)
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		return rtn[i].Seq < rtn[j].Seq
+	})
+	return rtn
+}
+
+// reads the store (if needed) and sends the replay events, then drains any live events that were queued while replaying
+// stops early if the subscription is replaced or removed
+func (b *BrokerType) runReplay(routeId string, sub SubscriptionRequest, filter *EventFilter, rs *replayState, replayEvents []WaveEvent, storeScopes map[string]int64, store EventStore) {
+	key := replayKey{RouteId: routeId, Event: sub.Event}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[wps] panic in replay for %s %s: %v\n", routeId, sub.Event, r)
+			debug.PrintStack()
+			b.Lock.Lock()
+			if b.ReplayMap[key] == rs {
+				delete(b.ReplayMap, key)
+			}
+			b.Lock.Unlock()
+		}
+	}()
+	if store != nil && len(storeScopes) > 0 {
+		// live events are queued in rs while we read the store (no lock held for the db reads)
+		seqMap := makeSeqMap(replayEvents)
+		readStoreReplayEvents(store, sub, filter, storeScopes, seqMap)
+		replayEvents = sortedSeqMapEvents(seqMap)
+	}
+	client := b.GetClient()
+	for {
+		if !b.isReplayCurrent(key, rs) {
+			return
+		}
+		if client != nil && len(replayEvents) > 0 {
+			sendReplayEvents(client, routeId, replayEvents)
+		}
+		b.Lock.Lock()
+		if b.ReplayMap[key] != rs {
+			b.Lock.Unlock()
+			return
+		}
+		if len(rs.Queued) == 0 {
+			delete(b.ReplayMap, key)
+			b.Lock.Unlock()
+			return
+		}
+		replayEvents = rs.Queued
+		rs.Queued = nil
+		b.Lock.Unlock()
+	}
+}
+
+func (b *BrokerType) isReplayCurrent(key replayKey, rs *replayState) bool {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	return b.ReplayMap[key] == rs
+}
+
+func sendReplayEvents(client Client, routeId string, events []WaveEvent) {
+	if replayClient, ok := client.(ReplayClient); ok {
+		replayClient.SendReplayEvents(routeId, events)
+		return
+	}
+	for _, event := range events {
+		client.SendEvent(routeId, event)
+	}
+}
+
+// returns in-memory persisted events matching sub with seq > sub.Since (ordered by seq)
+// if there is a store, also returns the scopes that need to be read from it (star scopes only match scopes that are in memory)
+func (b *BrokerType) getReplayEvents_nolock(sub SubscriptionRequest, filter *EventFilter) ([]WaveEvent, map[string]int64) {
+	var scopes []string
+	if sub.AllScopes {
+		scopes = []string{""}
+	} else {
+		for _, scope := range sub.Scopes {
+			if !scopeHasStarMatch(scope) {
+				scopes = append(scopes, scope)
+				continue
+			}
+			for key := range b.PersistMap {
+				if key.Event == sub.Event && key.Scope != "" && utilfn.StarMatchString(scope, key.Scope, ":") {
+					scopes = append(scopes, key.Scope)
+				}
+			}
+		}
+	}
+	seqMap := make(map[int64]*WaveEvent)
+	storeScopes := make(map[string]int64)
+	for _, scope := range scopes {
+		pe := b.PersistMap[persistKey{Event: sub.Event, Scope: scope}]
+		if pe == nil || len(pe.Events) == 0 {
+			if b.Store != nil {
+				storeScopes[scope] = b.EventSeq + 1
+			}
+			continue
+		}
+		if b.Store != nil && pe.Events[0].Seq > sub.Since+1 {
+			storeScopes[scope] = pe.Events[0].Seq
+		}
+		for _, event := range pe.Events {
+			if event.Seq <= sub.Since || seqMap[event.Seq] != nil {
+				continue
+			}
+			if filter != nil && !filter.Match(NormalizeEventData(event.Data)) {
+				continue
+			}
+			seqMap[event.Seq] = event
+		}
+	}
+	return sortedSeqMapEvents(seqMap), storeScopes
+}
+
+func (b *BrokerType) subscribe_nolock(subRouteId string, sub SubscriptionRequest, filter *EventFilter) {
 	b.unsubscribe_nolock(subRouteId, sub.Event)
 	bs := b.SubMap[sub.Event]
 	if bs == nil {
@@ -89,9 +312,13 @@ func (b *BrokerType) Subscribe(subRouteId string, sub SubscriptionRequest) {
 			AllSubs:   []string{},
 			ScopeSubs: make(map[string][]string),
 			StarSubs:  make(map[string][]string),
+			Filters:   make(map[string]*EventFilter),
 		}
 		b.SubMap[sub.Event] = bs
 	}
+	if filter != nil {
+		bs.Filters[subRouteId] = filter
+	}
 	if sub.AllScopes {
 		bs.AllSubs = utilfn.AddElemToSliceUniq(bs.AllSubs, subRouteId)
 		return
@@ -145,11 +372,13 @@ func (b *BrokerType) Unsubscribe(subRouteId string, eventName string) {
 }
 
 func (b *BrokerType) unsubscribe_nolock(subRouteId string, eventName string) {
+	delete(b.ReplayMap, replayKey{RouteId: subRouteId, Event: eventName})
 	bs := b.SubMap[eventName]
 	if bs == nil {
 		return
 	}
 	bs.AllSubs = utilfn.RemoveElemFromSlice(bs.AllSubs, subRouteId)
+	delete(bs.Filters, subRouteId)
 	for scope := range bs.ScopeSubs {
 		removeStrFromScopeMap(bs.ScopeSubs, scope, subRouteId)
 	}
@@ -164,8 +393,14 @@ func (b *BrokerType) unsubscribe_nolock(subRouteId string, eventName string) {
 func (b *BrokerType) UnsubscribeAll(subRouteId string) {
 	b.Lock.Lock()
 	defer b.Lock.Unlock()
+	for key := range b.ReplayMap {
+		if key.RouteId == subRouteId {
+			delete(b.ReplayMap, key)
+		}
+	}
 	for eventType, bs := range b.SubMap {
 		bs.AllSubs = utilfn.RemoveElemFromSlice(bs.AllSubs, subRouteId)
+		delete(bs.Filters, subRouteId)
 		removeStrFromScopeMapAll(bs.StarSubs, subRouteId)
 		removeStrFromScopeMapAll(bs.ScopeSubs, subRouteId)
 		if bs.IsEmpty() {
@@ -175,16 +410,30 @@ func (b *BrokerType) UnsubscribeAll(subRouteId string) {
 }
 
 // does not take wildcards, use "" for all
+// merges in events from the durable store (if set) when there are not enough in-memory events
 func (b *BrokerType) ReadEventHistory(eventType string, scope string, maxItems int) []*WaveEvent {
 	if maxItems <= 0 {
 		return nil
 	}
+	memEvents, beforeSeq, store := b.readMemEventHistory(eventType, scope, maxItems)
+	if store == nil || len(memEvents) >= maxItems {
+		return memEvents
+	}
+	storeEvents := store.ReadEventHistory(eventType, scope, beforeSeq, maxItems-len(memEvents))
+	if len(storeEvents) == 0 {
+		return memEvents
+	}
+	return append(storeEvents, memEvents...)
+}
+
+// returns (events, seq of the oldest in-memory event, store)
+func (b *BrokerType) readMemEventHistory(eventType string, scope string, maxItems int) ([]*WaveEvent, int64, EventStore) {
 	b.Lock.Lock()
 	defer b.Lock.Unlock()
 	key := persistKey{Event: eventType, Scope: scope}
 	pe := b.PersistMap[key]
 	if pe == nil || len(pe.Events) == 0 {
-		return nil
+		return nil, b.EventSeq + 1, b.Store
 	}
 	if maxItems > len(pe.Events) {
 		maxItems = len(pe.Events)
@@ -192,13 +441,10 @@ func (b *BrokerType) ReadEventHistory(eventType string, scope string, maxItems i
 	// return new arr
 	rtn := make([]*WaveEvent, maxItems)
 	copy(rtn, pe.Events[len(pe.Events)-maxItems:])
-	return rtn
+	return rtn, pe.Events[0].Seq, b.Store
 }
 
-func (b *BrokerType) persistEvent(event WaveEvent) {
-	if event.Persist <= 0 {
-		return
-	}
+func (b *BrokerType) persistEvent_nolock(event WaveEvent) {
 	numPersist := event.Persist
 	if numPersist > MaxPersist {
 		numPersist = MaxPersist
@@ -208,19 +454,20 @@ func (b *BrokerType) persistEvent(event WaveEvent) {
 		scopeMap[scope] = true
 	}
 	scopeMap[""] = true
-	b.Lock.Lock()
-	defer b.Lock.Unlock()
 	for scope := range scopeMap {
 		key := persistKey{Event: event.Event, Scope: scope}
 		pe := b.PersistMap[key]
 		if pe == nil {
 			pe = &persistEventWrap{
 				ArrTotalAdds: 0,
-				Events:       make([]*WaveEvent, 0, event.Persist),
+				Events:       make([]*WaveEvent, 0, numPersist),
 			}
 			b.PersistMap[key] = pe
 		}
 		pe.Events = append(pe.Events, &event)
+		if len(pe.Events) > numPersist {
+			pe.Events = pe.Events[len(pe.Events)-numPersist:]
+		}
 		pe.ArrTotalAdds++
 		if pe.ArrTotalAdds > ReMakeArrThreshold {
 			pe.Events = append([]*WaveEvent{}, pe.Events...)
@@ -229,21 +476,43 @@ func (b *BrokerType) persistEvent(event WaveEvent) {
 	}
 }
 
+// assigning the seq, persisting, and matching routes happen atomically (under the broker lock)
+// this is what guarantees that a subscription replay has no gaps or duplicates
 func (b *BrokerType) Publish(event WaveEvent) {
 	// log.Printf("BrokerType.Publish: %v\n", event)
-	if event.Persist > 0 {
-		b.persistEvent(event)
-	}
 	client := b.GetClient()
+	routeIds, store := b.publish_lock(&event)
+	if event.Persist > 0 && store != nil {
+		store.StoreEvent(event)
+	}
 	if client == nil {
 		return
 	}
-	routeIds := b.getMatchingRouteIds(event)
 	for _, routeId := range routeIds {
 		client.SendEvent(routeId, event)
 	}
 }
 
+// returns the routeids to send the event to (subscriptions that are replaying get the event queued instead)
+func (b *BrokerType) publish_lock(event *WaveEvent) ([]string, EventStore) {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	b.EventSeq++
+	event.Seq = b.EventSeq
+	if event.Persist > 0 {
+		b.persistEvent_nolock(*event)
+	}
+	var rtn []string
+	for _, routeId := range b.getMatchingRouteIds_nolock(*event) {
+		if rs := b.ReplayMap[replayKey{RouteId: routeId, Event: event.Event}]; rs != nil {
+			rs.Queued = append(rs.Queued, *event)
+			continue
+		}
+		rtn = append(rtn, routeId)
+	}
+	return rtn, b.Store
+}
+
 func (b *BrokerType) SendUpdateEvents(updates waveobj.UpdatesRtnType) {
 	for _, update := range updates {
 		b.Publish(WaveEvent{
@@ -254,9 +523,7 @@ func (b *BrokerType) SendUpdateEvents(updates waveobj.UpdatesRtnType) {
 	}
 }
 
-func (b *BrokerType) getMatchingRouteIds(event WaveEvent) []string {
-	b.Lock.Lock()
-	defer b.Lock.Unlock()
+func (b *BrokerType) getMatchingRouteIds_nolock(event WaveEvent) []string {
 	bs := b.SubMap[event.Event]
 	if bs == nil {
 		return nil
@@ -278,7 +545,18 @@ func (b *BrokerType) getMatchingRouteIds(event WaveEvent) []string {
 		}
 	}
 	var rtn []string
+	var normData any
+	dataNormalized := false
 	for routeId := range routeIds {
+		if filter := bs.Filters[routeId]; filter != nil {
+			if !dataNormalized {
+				normData = NormalizeEventData(event.Data)
+				dataNormalized = true
+			}
+			if !filter.Match(normData) {
+				continue
+			}
+		}
 		rtn = append(rtn, routeId)
 	}
 	// log.Printf("getMatchingRouteIds %v %v\n", event, rtn)
@@ -0,0 +1,194 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wps
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type testClient struct {
+	Lock   sync.Mutex
+	Events map[string][]WaveEvent
+}
+
+func (c *testClient) SendEvent(routeId string, event WaveEvent) {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	c.Events[routeId] = append(c.Events[routeId], event)
+}
+
+func (c *testClient) getSeqs(routeId string) []int64 {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	var rtn []int64
+	for _, event := range c.Events[routeId] {
+		rtn = append(rtn, event.Seq)
+	}
+	return rtn
+}
+
+// keeps every event (under each scope and "") in memory
+type testStore struct {
+	Lock     sync.Mutex
+	Events   map[persistKey][]*WaveEvent
+	NumReads int
+}
+
+func (s *testStore) GetMaxSeq() int64 {
+	return 0
+}
+
+func (s *testStore) StoreEvent(event WaveEvent) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	for _, scope := range append([]string{""}, event.Scopes...) {
+		key := persistKey{Event: event.Event, Scope: scope}
+		s.Events[key] = append(s.Events[key], &event)
+	}
+}
+
+func (s *testStore) ReadEventHistory(eventType string, scope string, beforeSeq int64, maxItems int) []*WaveEvent {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	s.NumReads++
+	var rtn []*WaveEvent
+	for _, event := range s.Events[persistKey{Event: eventType, Scope: scope}] {
+		if event.Seq < beforeSeq {
+			rtn = append(rtn, event)
+		}
+	}
+	if len(rtn) > maxItems {
+		rtn = rtn[len(rtn)-maxItems:]
+	}
+	return rtn
+}
+
+func makeTestBroker() (*BrokerType, *testClient, *testStore) {
+	b := MakeBroker()
+	client := &testClient{Events: make(map[string][]WaveEvent)}
+	store := &testStore{Events: make(map[persistKey][]*WaveEvent)}
+	b.SetClient(client)
+	b.SetEventStore(store)
+	return b, client, store
+}
+
+// replays run in the background
+func waitForReplays(t *testing.T, b *BrokerType) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		b.Lock.Lock()
+		numReplays := len(b.ReplayMap)
+		b.Lock.Unlock()
+		if numReplays == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for replays")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func seqRange(start int64, end int64) []int64 {
+	var rtn []int64
+	for seq := start; seq <= end; seq++ {
+		rtn = append(rtn, seq)
+	}
+	return rtn
+}
+
+func checkSeqs(t *testing.T, name string, got []int64, expected []int64) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Errorf("%s: expected seqs %v, got %v", name, expected, got)
+		return
+	}
+	for idx := range got {
+		if got[idx] != expected[idx] {
+			t.Errorf("%s: expected seqs %v, got %v", name, expected, got)
+			return
+		}
+	}
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	b, client, store := makeTestBroker()
+	// only the last 3 events are kept in memory, the store has all of them
+	for idx := 0; idx < 1200; idx++ {
+		data := map[string]any{"odd": idx%2 == 0}
+		b.Publish(WaveEvent{Event: "test", Scopes: []string{"block:1"}, Persist: 3, Data: data})
+	}
+
+	err := b.Subscribe("mem", SubscriptionRequest{Event: "test", AllScopes: true, Since: 1198})
+	if err != nil {
+		t.Fatalf("subscribe error: %v", err)
+	}
+	waitForReplays(t, b)
+	checkSeqs(t, "in-memory replay", client.getSeqs("mem"), seqRange(1199, 1200))
+	if store.NumReads != 0 {
+		t.Errorf("store should not be read when memory covers the cursor (%d reads)", store.NumReads)
+	}
+
+	// cursor older than the memory window (the store is read in pages)
+	err = b.Subscribe("store", SubscriptionRequest{Event: "test", Scopes: []string{"block:1"}, Since: 10})
+	if err != nil {
+		t.Fatalf("subscribe error: %v", err)
+	}
+	waitForReplays(t, b)
+	checkSeqs(t, "store replay", client.getSeqs("store"), seqRange(11, 1200))
+	if store.NumReads < 3 {
+		t.Errorf("expected the store to be paged (%d reads)", store.NumReads)
+	}
+
+	err = b.Subscribe("filter", SubscriptionRequest{Event: "test", AllScopes: true, Since: 1190, Filter: "odd == true"})
+	if err != nil {
+		t.Fatalf("subscribe error: %v", err)
+	}
+	waitForReplays(t, b)
+	checkSeqs(t, "filtered replay", client.getSeqs("filter"), []int64{1191, 1193, 1195, 1197, 1199})
+
+	// live events are sent after the replay
+	b.Publish(WaveEvent{Event: "test", Scopes: []string{"block:1"}, Persist: 3})
+	seqs := client.getSeqs("store")
+	if len(seqs) != 1191 || seqs[len(seqs)-1] != 1201 {
+		t.Errorf("expected live event 1201 after the replay, got %d events", len(seqs))
+	}
+}
+
+func TestConcurrentReplays(t *testing.T) {
+	b, client, _ := makeTestBroker()
+	for idx := 0; idx < 100; idx++ {
+		b.Publish(WaveEvent{Event: "a", Persist: 100})
+		b.Publish(WaveEvent{Event: "b", Persist: 100})
+	}
+	// two replays on the same route don't share their queued live events
+	err := b.Subscribe("route", SubscriptionRequest{Event: "a", AllScopes: true, Since: 1})
+	if err != nil {
+		t.Fatalf("subscribe error: %v", err)
+	}
+	err = b.Subscribe("route", SubscriptionRequest{Event: "b", AllScopes: true, Since: 2})
+	if err != nil {
+		t.Fatalf("subscribe error: %v", err)
+	}
+	b.Publish(WaveEvent{Event: "a"})
+	b.Publish(WaveEvent{Event: "b"})
+	waitForReplays(t, b)
+	client.Lock.Lock()
+	counts := make(map[string]int)
+	lastSeqs := make(map[string]int64)
+	for _, event := range client.Events["route"] {
+		if event.Seq <= lastSeqs[event.Event] {
+			t.Errorf("%s events out of order (%d after %d)", event.Event, event.Seq, lastSeqs[event.Event])
+		}
+		lastSeqs[event.Event] = event.Seq
+		counts[event.Event]++
+	}
+	client.Lock.Unlock()
+	if counts["a"] != 100 || counts["b"] != 100 {
+		t.Errorf("expected 100 events of each type (99 replayed + 1 live), got %v", counts)
+	}
+}
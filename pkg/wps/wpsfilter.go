@@ -0,0 +1,198 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wps
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/ijson"
+)
+
+// data-level filters for subscriptions
+// a filter is a list of conditions joined by "&&" (outside of quoted strings), each condition is "path op value"
+//   path uses ijson simple path syntax (e.g. "shellprocstatus", "data.items[0].name")
+//   op is one of ==, !=, <, <=, >, >=
+//   value is a json literal ("done", 5, true, null), bare words are treated as strings
+// example: `filename == term && fileop != "truncate"`
+
+const (
+	FilterOp_Eq  = "=="
+	FilterOp_Ne  = "!="
+	FilterOp_Lt  = "<"
+	FilterOp_Lte = "<="
+	FilterOp_Gt  = ">"
+	FilterOp_Gte = ">="
+)
+
+var filterCondRe = regexp.MustCompile(`^\s*([^\s=!<>]+)\s*(==|!=|<=|>=|<|>)\s*(.*?)\s*$`)
+
+type EventFilter struct {
+	FilterStr string
+	Conds     []FilterCond
+}
+
+type FilterCond struct {
+	Path  ijson.Path
+	Op    string
+	Value any
+}
+
+func ParseEventFilter(filterStr string) (*EventFilter, error) {
+	if strings.TrimSpace(filterStr) == "" {
+		return nil, nil
+	}
+	condStrs, err := splitFilterConds(filterStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", filterStr, err)
+	}
+	rtn := &EventFilter{FilterStr: filterStr}
+	for _, condStr := range condStrs {
+		cond, err := parseFilterCond(condStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %w", filterStr, err)
+		}
+		rtn.Conds = append(rtn.Conds, cond)
+	}
+	return rtn, nil
+}
+
+// splits on "&&" outside of double-quoted (json) strings
+func splitFilterConds(filterStr string) ([]string, error) {
+	var rtn []string
+	inQuote := false
+	start := 0
+	for i := 0; i < len(filterStr); i++ {
+		switch {
+		case inQuote && filterStr[i] == '\\':
+			i++
+		case filterStr[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && strings.HasPrefix(filterStr[i:], "&&"):
+			rtn = append(rtn, filterStr[start:i])
+			i++
+			start = i + 1
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated string")
+	}
+	return append(rtn, filterStr[start:]), nil
+}
+
+func parseFilterCond(condStr string) (FilterCond, error) {
+	m := filterCondRe.FindStringSubmatch(condStr)
+	if m == nil {
+		return FilterCond{}, fmt.Errorf("cannot parse condition %q", strings.TrimSpace(condStr))
+	}
+	path, err := ijson.ParseSimplePath(m[1])
+	if err != nil {
+		return FilterCond{}, fmt.Errorf("invalid path %q: %w", m[1], err)
+	}
+	if m[3] == "" {
+		return FilterCond{}, fmt.Errorf("missing value in condition %q", strings.TrimSpace(condStr))
+	}
+	var value any
+	err = json.Unmarshal([]byte(m[3]), &value)
+	if err != nil {
+		// bare word
+		value = m[3]
+	}
+	op := m[2]
+	if op != FilterOp_Eq && op != FilterOp_Ne {
+		switch value.(type) {
+		case float64, string:
+		default:
+			return FilterCond{}, fmt.Errorf("operator %s requires a number or string value", op)
+		}
+	}
+	return FilterCond{Path: path, Op: op, Value: value}, nil
+}
+
+// normalizes event data into ijson values (map[string]any, []any, float64, etc.)
+// structs are converted using their json tags.  maps and slices are converted too, they can
+// hold ints (or structs) that would never match the float64 literals in a filter
+func NormalizeEventData(data any) any {
+	switch data.(type) {
+	case nil, string, float64, bool:
+		return data
+	}
+	barr, err := json.Marshal(data)
+	if err != nil {
+		return nil
+	}
+	var rtn any
+	err = json.Unmarshal(barr, &rtn)
+	if err != nil {
+		return nil
+	}
+	return rtn
+}
+
+// data should be normalized (see NormalizeEventData)
+func (f *EventFilter) Match(data any) bool {
+	if f == nil {
+		return true
+	}
+	for _, cond := range f.Conds {
+		if !cond.match(data) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c FilterCond) match(data any) bool {
+	val, err := ijson.GetPath(data, c.Path)
+	if err != nil {
+		return false
+	}
+	switch c.Op {
+	case FilterOp_Eq:
+		return ijson.DeepEqual(val, c.Value)
+	case FilterOp_Ne:
+		return !ijson.DeepEqual(val, c.Value)
+	}
+	cmp, ok := compareValues(val, c.Value)
+	if !ok {
+		return false
+	}
+	switch c.Op {
+	case FilterOp_Lt:
+		return cmp < 0
+	case FilterOp_Lte:
+		return cmp <= 0
+	case FilterOp_Gt:
+		return cmp > 0
+	case FilterOp_Gte:
+		return cmp >= 0
+	}
+	return false
+}
+
+// returns (cmp, ok), ok is false if the values are not comparable (must both be numbers or both be strings)
+func compareValues(v1 any, v2 any) (int, bool) {
+	switch v1 := v1.(type) {
+	case float64:
+		v2, ok := v2.(float64)
+		if !ok {
+			return 0, false
+		}
+		if v1 < v2 {
+			return -1, true
+		} else if v1 > v2 {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		v2, ok := v2.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(v1, v2), true
+	}
+	return 0, false
+}
@@ -0,0 +1,75 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wps
+
+import "testing"
+
+func TestParseEventFilter(t *testing.T) {
+	filter, err := ParseEventFilter("")
+	if err != nil || filter != nil {
+		t.Errorf("empty filter should return nil, got %v %v", filter, err)
+	}
+	filter, err = ParseEventFilter(`filename == term && fileop != "truncate"`)
+	if err != nil {
+		t.Fatalf("error parsing filter: %v", err)
+	}
+	if len(filter.Conds) != 2 {
+		t.Fatalf("expected 2 conditions, got %d", len(filter.Conds))
+	}
+	if filter.Conds[0].Value != "term" || filter.Conds[1].Value != "truncate" {
+		t.Errorf("bad values: %v %v", filter.Conds[0].Value, filter.Conds[1].Value)
+	}
+	// "&&" inside a quoted value doesn't split the condition
+	filter, err = ParseEventFilter(`data.cmd == "a && b \" && c" && fileop == append`)
+	if err != nil {
+		t.Fatalf("error parsing filter: %v", err)
+	}
+	if len(filter.Conds) != 2 || filter.Conds[0].Value != `a && b " && c` || filter.Conds[1].Value != "append" {
+		t.Errorf("bad quoted conditions: %+v", filter.Conds)
+	}
+	badFilters := []string{"filename", "== term", "x ==", "a[x] == 5", "x < true", `x == "a && b`}
+	for _, badFilter := range badFilters {
+		_, err = ParseEventFilter(badFilter)
+		if err == nil {
+			t.Errorf("filter %q should fail to parse", badFilter)
+		}
+	}
+}
+
+func TestEventFilterMatch(t *testing.T) {
+	data := NormalizeEventData(&WSFileEventData{ZoneId: "z1", FileName: "term", FileOp: FileOp_Append})
+	testCases := []struct {
+		Filter string
+		Match  bool
+	}{
+		{"filename == term", true},
+		{`filename == "term"`, true},
+		{"filename == html", false},
+		{"filename != html", true},
+		{"fileop == append && zoneid == z1", true},
+		{"fileop == append && zoneid == z2", false},
+		{"missing == null", true},
+		{"missing > 5", false},
+		{"filename > s", true},
+	}
+	for _, tc := range testCases {
+		filter, err := ParseEventFilter(tc.Filter)
+		if err != nil {
+			t.Fatalf("error parsing filter %q: %v", tc.Filter, err)
+		}
+		if filter.Match(data) != tc.Match {
+			t.Errorf("filter %q, expected match=%v", tc.Filter, tc.Match)
+		}
+	}
+	numData := NormalizeEventData(map[string]any{"values": map[string]any{"cpu": 50.5}, "arr": []any{1.0, 2.0}})
+	numFilter, _ := ParseEventFilter("values.cpu >= 50 && arr[1] == 2")
+	if !numFilter.Match(numData) {
+		t.Errorf("numeric filter should match")
+	}
+	intData := NormalizeEventData(map[string]any{"values": map[string]any{"cpu": 50, "mem": int64(1024)}, "arr": []any{1, int32(2)}})
+	intFilter, _ := ParseEventFilter("values.cpu == 50 && values.mem >= 1024 && arr[1] == 2")
+	if !intFilter.Match(intData) {
+		t.Errorf("filter should match ints nested in maps and slices")
+	}
+}
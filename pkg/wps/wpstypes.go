@@ -18,6 +18,7 @@ type WaveEvent struct {
 	Scopes  []string `json:"scopes,omitempty"`
 	Sender  string   `json:"sender,omitempty"`
 	Persist int      `json:"persist,omitempty"`
+	Seq     int64    `json:"seq,omitempty"` // set by the broker on publish (monotonically increasing)
 	Data    any      `json:"data,omitempty"`
 }
 
@@ -29,6 +30,8 @@ type SubscriptionRequest struct {
 	Event     string   `json:"event"`
 	Scopes    []string `json:"scopes,omitempty"`
 	AllScopes bool     `json:"allscopes,omitempty"`
+	Since     int64    `json:"since,omitempty"`  // if set, replays persisted events with seq > since before sending live events
+	Filter    string   `json:"filter,omitempty"` // optional data filter, see wpsfilter.go (e.g. "shellprocstatus == done")
 }
 
 const (
@@ -0,0 +1,89 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// registry of the known wps events and the go types of their data
+// used to validate events published by untrusted routes, and to generate the TypedWaveEvent TS union (see tsgen)
+// events that are not in the registry are allowed to have any data
+package wpsevents
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/wavetermdev/waveterm/pkg/blockcontroller"
+	"github.com/wavetermdev/waveterm/pkg/userinput"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+type EventTypeInfo struct {
+	Event    string
+	DataType reflect.Type // nil means the event has no data
+	System   bool         // only wavesrv and the frontend can publish it
+}
+
+// marker type, tsgen generates this as a union of WaveEvent types discriminated by the event name
+type TypedWaveEvent interface{}
+
+var EventTypes = []EventTypeInfo{
+	{Event: wps.Event_BlockClose, DataType: reflect.TypeOf(""), System: true}, // blockid
+	{Event: wps.Event_ConnChange, DataType: reflect.TypeOf(wshrpc.ConnStatus{}), System: true},
+	{Event: wps.Event_SysInfo, DataType: reflect.TypeOf(wshrpc.TimeSeriesData{})}, // connservers publish their own sysinfo
+	{Event: wps.Event_ControllerStatus, DataType: reflect.TypeOf(blockcontroller.BlockControllerRuntimeStatus{}), System: true},
+	{Event: wps.Event_WaveObjUpdate, DataType: reflect.TypeOf(waveobj.WaveObjUpdate{}), System: true},
+	{Event: wps.Event_BlockFile, DataType: reflect.TypeOf(wps.WSFileEventData{}), System: true},
+	{Event: wps.Event_Config, DataType: reflect.TypeOf(wconfig.WatcherUpdate{}), System: true},
+	{Event: wps.Event_UserInput, DataType: reflect.TypeOf(userinput.UserInputRequest{}), System: true},
+}
+
+var eventTypeMap = makeEventTypeMap()
+
+func makeEventTypeMap() map[string]EventTypeInfo {
+	rtn := make(map[string]EventTypeInfo)
+	for _, info := range EventTypes {
+		rtn[info.Event] = info
+	}
+	return rtn
+}
+
+func GetEventTypeInfo(eventName string) (EventTypeInfo, bool) {
+	info, ok := eventTypeMap[eventName]
+	return info, ok
+}
+
+func IsSystemEvent(eventName string) bool {
+	info, ok := GetEventTypeInfo(eventName)
+	return ok && info.System
+}
+
+// checks that the event's data matches the registered type (unknown fields are not allowed)
+func ValidateEventData(event wps.WaveEvent) error {
+	info, ok := GetEventTypeInfo(event.Event)
+	if !ok {
+		return nil
+	}
+	if info.DataType == nil {
+		if event.Data != nil {
+			return fmt.Errorf("event %q does not take data", event.Event)
+		}
+		return nil
+	}
+	if event.Data == nil {
+		return fmt.Errorf("event %q requires data (%s)", event.Event, info.DataType)
+	}
+	barr, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("event %q has invalid data: %w", event.Event, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(barr))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(reflect.New(info.DataType).Interface())
+	if err != nil {
+		return fmt.Errorf("event %q has invalid data (expected %s): %w", event.Event, info.DataType, err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wpsevents
+
+import (
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wps"
+)
+
+func TestValidateEventData(t *testing.T) {
+	validEvents := []wps.WaveEvent{
+		{Event: wps.Event_SysInfo, Data: map[string]any{"ts": 1000, "values": map[string]any{"cpu": 5.5}}},
+		{Event: wps.Event_BlockClose, Data: "6f9ab2b5-1d4a-4b2b-9b0c-0f3b8b6e8e8e"},
+		{Event: wps.Event_ControllerStatus, Data: &struct {
+			BlockId         string `json:"blockid"`
+			ShellProcStatus string `json:"shellprocstatus"`
+		}{BlockId: "b1", ShellProcStatus: "running"}},
+		{Event: "deploy-done", Data: []any{1, "x"}},
+		{Event: "deploy-done"},
+	}
+	for _, event := range validEvents {
+		err := ValidateEventData(event)
+		if err != nil {
+			t.Errorf("expected %s event to be valid: %v", event.Event, err)
+		}
+	}
+	invalidEvents := []wps.WaveEvent{
+		{Event: wps.Event_SysInfo},
+		{Event: wps.Event_SysInfo, Data: "cpu"},
+		{Event: wps.Event_SysInfo, Data: map[string]any{"ts": "now"}},
+		{Event: wps.Event_SysInfo, Data: map[string]any{"ts": 1000, "extra": true}},
+		{Event: wps.Event_BlockClose, Data: 5},
+	}
+	for _, event := range invalidEvents {
+		err := ValidateEventData(event)
+		if err == nil {
+			t.Errorf("expected %s event with data %v to be invalid", event.Event, event.Data)
+		}
+	}
+}
+
+func TestIsSystemEvent(t *testing.T) {
+	for _, event := range []string{wps.Event_BlockClose, wps.Event_WaveObjUpdate, wps.Event_ControllerStatus, wps.Event_BlockFile, wps.Event_ConnChange, wps.Event_Config, wps.Event_UserInput} {
+		if !IsSystemEvent(event) {
+			t.Errorf("expected %s to be a system event", event)
+		}
+	}
+	for _, event := range []string{wps.Event_SysInfo, "deploy-done"} {
+		if IsSystemEvent(event) {
+			t.Errorf("expected %s not to be a system event", event)
+		}
+	}
+}
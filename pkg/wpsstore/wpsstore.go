@@ -0,0 +1,333 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// durable (sqlite) storage for persisted wps events
+// implements wps.EventStore, only events with a retention setting are stored
+package wpsstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+const WriteChSize = 1000
+const MaxWriteBatch = 200
+const DBTimeout = 2 * time.Second
+
+// set with the eventretentionset rpc (wsh event retention)
+type EventRetention = wshrpc.EventRetention
+
+type retentionKey struct {
+	Event string
+	Scope string
+}
+
+type storeItem struct {
+	Seq     int64
+	Ts      int64
+	Event   wps.WaveEvent
+	FlushCh chan struct{} // if set, this is a flush marker (not an event)
+}
+
+type EventStoreType struct {
+	Lock         *sync.Mutex
+	RetentionMap map[retentionKey]EventRetention
+	WriteCh      chan storeItem
+	WriterOnce   *sync.Once
+}
+
+var EventStore = &EventStoreType{
+	Lock:         &sync.Mutex{},
+	RetentionMap: make(map[retentionKey]EventRetention),
+	WriteCh:      make(chan storeItem, WriteChSize),
+	WriterOnce:   &sync.Once{},
+}
+
+// must be called after wstore is initialized (calling it again reloads the retention settings,
+// there is only ever one writer)
+func InitEventStore() error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), DBTimeout)
+	defer cancelFn()
+	retentions, err := dbGetRetentions(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading event retention: %w", err)
+	}
+	retentionMap := make(map[retentionKey]EventRetention)
+	for _, r := range retentions {
+		retentionMap[retentionKey{Event: r.Event, Scope: r.Scope}] = *r
+	}
+	EventStore.Lock.Lock()
+	EventStore.RetentionMap = retentionMap
+	EventStore.Lock.Unlock()
+	EventStore.WriterOnce.Do(func() {
+		go EventStore.runWriter()
+	})
+	log.Printf("wps event store initialized (%d retention settings)\n", len(retentions))
+	return nil
+}
+
+// maxItems <= 0 removes the retention setting (and the events stored under it)
+func SetEventRetention(ctx context.Context, r EventRetention) error {
+	if r.Event == "" {
+		return fmt.Errorf("event is required")
+	}
+	if r.MaxAgeMs < 0 {
+		return fmt.Errorf("maxagems must be non-negative")
+	}
+	err := dbSetRetention(ctx, r)
+	if err != nil {
+		return err
+	}
+	EventStore.Lock.Lock()
+	defer EventStore.Lock.Unlock()
+	key := retentionKey{Event: r.Event, Scope: r.Scope}
+	if r.MaxItems <= 0 {
+		delete(EventStore.RetentionMap, key)
+	} else {
+		EventStore.RetentionMap[key] = r
+	}
+	return nil
+}
+
+func GetEventRetentions() []EventRetention {
+	EventStore.Lock.Lock()
+	defer EventStore.Lock.Unlock()
+	rtn := make([]EventRetention, 0, len(EventStore.RetentionMap))
+	for _, r := range EventStore.RetentionMap {
+		rtn = append(rtn, r)
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		if rtn[i].Event != rtn[j].Event {
+			return rtn[i].Event < rtn[j].Event
+		}
+		return rtn[i].Scope < rtn[j].Scope
+	})
+	return rtn
+}
+
+// specific scope settings override the event default ("")
+func (s *EventStoreType) getRetention(eventType string, scope string) (EventRetention, bool) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if r, ok := s.RetentionMap[retentionKey{Event: eventType, Scope: scope}]; ok {
+		return r, true
+	}
+	r, ok := s.RetentionMap[retentionKey{Event: eventType, Scope: ""}]
+	return r, ok
+}
+
+func (s *EventStoreType) hasEventRetention(eventType string) bool {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	for key := range s.RetentionMap {
+		if key.Event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *EventStoreType) GetMaxSeq() int64 {
+	ctx, cancelFn := context.WithTimeout(context.Background(), DBTimeout)
+	defer cancelFn()
+	maxSeq, err := dbGetMaxSeq(ctx)
+	if err != nil {
+		log.Printf("[wpsstore] error getting max seq: %v\n", err)
+		return 0
+	}
+	return maxSeq
+}
+
+func (s *EventStoreType) StoreEvent(event wps.WaveEvent) {
+	if !s.hasEventRetention(event.Event) {
+		return
+	}
+	select {
+	case s.WriteCh <- storeItem{Seq: event.Seq, Ts: time.Now().UnixMilli(), Event: event}:
+	default:
+		log.Printf("[wpsstore] write queue full, dropping event %s\n", event.Event)
+	}
+}
+
+func (s *EventStoreType) ReadEventHistory(eventType string, scope string, beforeSeq int64, maxItems int) []*wps.WaveEvent {
+	if maxItems <= 0 {
+		return nil
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), DBTimeout)
+	defer cancelFn()
+	events, err := dbReadEvents(ctx, eventType, scope, beforeSeq, maxItems)
+	if err != nil {
+		log.Printf("[wpsstore] error reading event history %s/%s: %v\n", eventType, scope, err)
+		return nil
+	}
+	return events
+}
+
+// waits for all queued events to be written (or for ctx to be done)
+func (s *EventStoreType) Flush(ctx context.Context) error {
+	flushCh := make(chan struct{})
+	select {
+	case s.WriteCh <- storeItem{FlushCh: flushCh}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *EventStoreType) runWriter() {
+	for {
+		item := <-s.WriteCh
+		batch := []storeItem{item}
+	DrainLoop:
+		for len(batch) < MaxWriteBatch {
+			select {
+			case item := <-s.WriteCh:
+				batch = append(batch, item)
+			default:
+				break DrainLoop
+			}
+		}
+		s.writeBatch(batch)
+	}
+}
+
+// a panic only loses this batch, the writer keeps running (and flushes are always released)
+func (s *EventStoreType) writeBatch(batch []storeItem) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[wpsstore] panic writing events: %v\n", r)
+			debug.PrintStack()
+		}
+		for _, item := range batch {
+			if item.FlushCh != nil {
+				close(item.FlushCh)
+			}
+		}
+	}()
+	var rows []*eventRow
+	pruneMap := make(map[retentionKey]EventRetention)
+	for _, item := range batch {
+		if item.FlushCh != nil {
+			continue
+		}
+		dataBytes, err := json.Marshal(item.Event)
+		if err != nil {
+			log.Printf("[wpsstore] error marshaling event %s: %v\n", item.Event.Event, err)
+			continue
+		}
+		// same as the broker's in-memory history, events are stored under each scope (and "")
+		scopeMap := map[string]bool{"": true}
+		for _, scope := range item.Event.Scopes {
+			scopeMap[scope] = true
+		}
+		for scope := range scopeMap {
+			r, ok := s.getRetention(item.Event.Event, scope)
+			if !ok || r.MaxItems <= 0 {
+				continue
+			}
+			key := retentionKey{Event: item.Event.Event, Scope: scope}
+			rows = append(rows, &eventRow{Event: item.Event.Event, Scope: scope, Seq: item.Seq, Ts: item.Ts, Data: dataBytes})
+			pruneMap[key] = r
+		}
+	}
+	if len(rows) > 0 {
+		ctx, cancelFn := context.WithTimeout(context.Background(), DBTimeout)
+		err := dbInsertEvents(ctx, rows, pruneMap)
+		cancelFn()
+		if err != nil {
+			log.Printf("[wpsstore] error writing %d events: %v\n", len(rows), err)
+		}
+	}
+}
+
+type eventRow struct {
+	Event string
+	Scope string
+	Seq   int64
+	Ts    int64
+	Data  []byte
+}
+
+func dbGetRetentions(ctx context.Context) ([]*EventRetention, error) {
+	return wstore.WithTxRtn(ctx, func(tx *wstore.TxWrap) ([]*EventRetention, error) {
+		var rtn []*EventRetention
+		query := `SELECT event, scope, maxitems, maxagems FROM db_event_retention`
+		tx.Select(&rtn, query)
+		return rtn, nil
+	})
+}
+
+func dbSetRetention(ctx context.Context, r EventRetention) error {
+	return wstore.WithTx(ctx, func(tx *wstore.TxWrap) error {
+		if r.MaxItems <= 0 {
+			query := `DELETE FROM db_event_retention WHERE event = ? AND scope = ?`
+			tx.Exec(query, r.Event, r.Scope)
+			query = `DELETE FROM db_event_history WHERE event = ? AND scope = ?`
+			tx.Exec(query, r.Event, r.Scope)
+			return nil
+		}
+		query := `REPLACE INTO db_event_retention (event, scope, maxitems, maxagems) VALUES (?, ?, ?, ?)`
+		tx.Exec(query, r.Event, r.Scope, r.MaxItems, r.MaxAgeMs)
+		return nil
+	})
+}
+
+func dbGetMaxSeq(ctx context.Context) (int64, error) {
+	return wstore.WithTxRtn(ctx, func(tx *wstore.TxWrap) (int64, error) {
+		query := `SELECT COALESCE(MAX(seq), 0) FROM db_event_history`
+		return tx.GetInt64(query), nil
+	})
+}
+
+func dbInsertEvents(ctx context.Context, rows []*eventRow, pruneMap map[retentionKey]EventRetention) error {
+	return wstore.WithTx(ctx, func(tx *wstore.TxWrap) error {
+		query := `REPLACE INTO db_event_history (event, scope, seq, ts, data) VALUES (?, ?, ?, ?, ?)`
+		for _, row := range rows {
+			tx.Exec(query, row.Event, row.Scope, row.Seq, row.Ts, row.Data)
+		}
+		for key, r := range pruneMap {
+			query = `DELETE FROM db_event_history
+			         WHERE event = ? AND scope = ? AND seq <= (SELECT seq FROM db_event_history WHERE event = ? AND scope = ? ORDER BY seq DESC LIMIT 1 OFFSET ?)`
+			tx.Exec(query, key.Event, key.Scope, key.Event, key.Scope, r.MaxItems)
+			if r.MaxAgeMs > 0 {
+				query = `DELETE FROM db_event_history WHERE event = ? AND scope = ? AND ts < ?`
+				tx.Exec(query, key.Event, key.Scope, time.Now().UnixMilli()-r.MaxAgeMs)
+			}
+		}
+		return nil
+	})
+}
+
+// returns events oldest first
+func dbReadEvents(ctx context.Context, eventType string, scope string, beforeSeq int64, maxItems int) ([]*wps.WaveEvent, error) {
+	return wstore.WithTxRtn(ctx, func(tx *wstore.TxWrap) ([]*wps.WaveEvent, error) {
+		var dataArr [][]byte
+		query := `SELECT data FROM db_event_history WHERE event = ? AND scope = ? AND seq < ? ORDER BY seq DESC LIMIT ?`
+		tx.Select(&dataArr, query, eventType, scope, beforeSeq, maxItems)
+		rtn := make([]*wps.WaveEvent, 0, len(dataArr))
+		for idx := len(dataArr) - 1; idx >= 0; idx-- {
+			var event wps.WaveEvent
+			err := json.Unmarshal(dataArr[idx], &event)
+			if err != nil {
+				return nil, fmt.Errorf("error unmarshaling stored event: %w", err)
+			}
+			rtn = append(rtn, &event)
+		}
+		return rtn, nil
+	})
+}
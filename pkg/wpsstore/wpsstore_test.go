@@ -0,0 +1,155 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wpsstore
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
+)
+
+func initStore(t *testing.T) {
+	err := wstore.InitWStoreForTesting()
+	if err != nil {
+		t.Fatalf("error initializing wstore: %v", err)
+	}
+	err = InitEventStore()
+	if err != nil {
+		t.Fatalf("error initializing event store: %v", err)
+	}
+}
+
+func flushStore(t *testing.T) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFn()
+	err := EventStore.Flush(ctx)
+	if err != nil {
+		t.Fatalf("error flushing event store: %v", err)
+	}
+}
+
+func historySeqs(events []*wps.WaveEvent) []int64 {
+	var rtn []int64
+	for _, event := range events {
+		rtn = append(rtn, event.Seq)
+	}
+	return rtn
+}
+
+func seqsEqual(a []int64, b ...int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEventStore(t *testing.T) {
+	initStore(t)
+	ctx := context.Background()
+
+	// the migration adds a default retention for sysinfo
+	err := SetEventRetention(ctx, EventRetention{Event: "test:items", MaxItems: 5})
+	if err != nil {
+		t.Fatalf("error setting retention: %v", err)
+	}
+	err = SetEventRetention(ctx, EventRetention{Event: "test:items", Scope: "block:1", MaxItems: 2})
+	if err != nil {
+		t.Fatalf("error setting scope retention: %v", err)
+	}
+	if err := SetEventRetention(ctx, EventRetention{MaxItems: 5}); err == nil {
+		t.Errorf("expected an error setting retention without an event")
+	}
+	retentions := GetEventRetentions()
+	if len(retentions) != 3 || retentions[0].Event != "sysinfo" || retentions[1].Scope != "" || retentions[2].Scope != "block:1" {
+		t.Errorf("unexpected (or unsorted) retentions: %+v", retentions)
+	}
+
+	// events without a retention setting are not stored
+	EventStore.StoreEvent(wps.WaveEvent{Event: "test:none", Seq: 1})
+	for seq := int64(1); seq <= 8; seq++ {
+		EventStore.StoreEvent(wps.WaveEvent{Event: "test:items", Scopes: []string{"block:1"}, Seq: seq, Data: seq})
+	}
+	flushStore(t)
+
+	if events := EventStore.ReadEventHistory("test:none", "", math.MaxInt64, 10); len(events) != 0 {
+		t.Errorf("event without retention was stored: %v", historySeqs(events))
+	}
+	if seqs := historySeqs(EventStore.ReadEventHistory("test:items", "", math.MaxInt64, 10)); !seqsEqual(seqs, 4, 5, 6, 7, 8) {
+		t.Errorf("expected the last 5 events oldest first, got %v", seqs)
+	}
+	if seqs := historySeqs(EventStore.ReadEventHistory("test:items", "block:1", math.MaxInt64, 10)); !seqsEqual(seqs, 7, 8) {
+		t.Errorf("scope retention should override the default, got %v", seqs)
+	}
+
+	// paging back with beforeSeq
+	if seqs := historySeqs(EventStore.ReadEventHistory("test:items", "", 7, 2)); !seqsEqual(seqs, 5, 6) {
+		t.Errorf("expected seqs 5,6 before 7, got %v", seqs)
+	}
+	if seqs := historySeqs(EventStore.ReadEventHistory("test:items", "", 5, 2)); !seqsEqual(seqs, 4) {
+		t.Errorf("expected seq 4 before 5, got %v", seqs)
+	}
+	if events := EventStore.ReadEventHistory("test:items", "", math.MaxInt64, 0); len(events) != 0 {
+		t.Errorf("maxitems 0 should return nothing")
+	}
+	if maxSeq := EventStore.GetMaxSeq(); maxSeq != 8 {
+		t.Errorf("expected max seq 8, got %d", maxSeq)
+	}
+
+	// age pruning
+	err = SetEventRetention(ctx, EventRetention{Event: "test:age", MaxItems: 10, MaxAgeMs: 60 * 1000})
+	if err != nil {
+		t.Fatalf("error setting age retention: %v", err)
+	}
+	now := time.Now().UnixMilli()
+	EventStore.WriteCh <- storeItem{Seq: 20, Ts: now - 2*60*1000, Event: wps.WaveEvent{Event: "test:age", Seq: 20}}
+	EventStore.WriteCh <- storeItem{Seq: 21, Ts: now, Event: wps.WaveEvent{Event: "test:age", Seq: 21}}
+	flushStore(t)
+	if seqs := historySeqs(EventStore.ReadEventHistory("test:age", "", math.MaxInt64, 10)); !seqsEqual(seqs, 21) {
+		t.Errorf("expected the old event to be pruned, got %v", seqs)
+	}
+
+	// removing the retention removes the stored events
+	err = SetEventRetention(ctx, EventRetention{Event: "test:items", MaxItems: 0})
+	if err != nil {
+		t.Fatalf("error removing retention: %v", err)
+	}
+	if events := EventStore.ReadEventHistory("test:items", "", math.MaxInt64, 10); len(events) != 0 {
+		t.Errorf("events still stored after removing the retention: %v", historySeqs(events))
+	}
+	if seqs := historySeqs(EventStore.ReadEventHistory("test:items", "block:1", math.MaxInt64, 10)); !seqsEqual(seqs, 7, 8) {
+		t.Errorf("scope retention should be kept, got %v", seqs)
+	}
+}
+
+type panicData struct{}
+
+func (panicData) MarshalJSON() ([]byte, error) {
+	panic("marshal panic")
+}
+
+func TestEventStoreWriterPanic(t *testing.T) {
+	initStore(t)
+	err := SetEventRetention(context.Background(), EventRetention{Event: "test:panic", MaxItems: 5})
+	if err != nil {
+		t.Fatalf("error setting retention: %v", err)
+	}
+	EventStore.StoreEvent(wps.WaveEvent{Event: "test:panic", Seq: 1, Data: panicData{}})
+	flushStore(t)
+
+	// the writer survives the panic
+	EventStore.StoreEvent(wps.WaveEvent{Event: "test:panic", Seq: 2, Data: "ok"})
+	flushStore(t)
+	if seqs := historySeqs(EventStore.ReadEventHistory("test:panic", "", math.MaxInt64, 10)); !seqsEqual(seqs, 2) {
+		t.Errorf("expected the event after the panic to be stored, got %v", seqs)
+	}
+}
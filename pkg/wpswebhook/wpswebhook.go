@@ -0,0 +1,384 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// bridges wps events to local http endpoints (configured in webhooks.json)
+// the bridge registers its own route with the router and subscribes to the configured events,
+// matching events are POSTed as json (retried with backoff), failed deliveries go to a small dead-letter log
+package wpswebhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const WebhookRouteId = "webhooks"
+const DeliveryQueueSize = 100
+const MaxDeliveryAttempts = 5
+const DefaultInitialBackoff = 1 * time.Second
+const MaxBackoff = 30 * time.Second
+const DeliveryTimeout = 5 * time.Second
+const MaxDeadLetters = 100
+const DeadLetterFileName = "webhook-deadletters.json"
+
+type DeadLetter struct {
+	Webhook  string        `json:"webhook"`
+	Url      string        `json:"url"`
+	Ts       int64         `json:"ts"`
+	Attempts int           `json:"attempts"`
+	Error    string        `json:"error"`
+	Event    wps.WaveEvent `json:"event"`
+}
+
+type webhook struct {
+	Name       string
+	Config     wconfig.WebhookConfigType
+	Filter     *wps.EventFilter
+	DeliveryCh chan wps.WaveEvent
+	DoneCh     chan struct{}
+}
+
+type bridgeType struct {
+	Lock        *sync.Mutex
+	Webhooks    map[string]*webhook
+	SubEvents   map[string]bool
+	DeadLetters []DeadLetter
+	SaveCh      chan struct{} // signals the dead-letter writer (file io is never done under Lock)
+}
+
+var bridge = &bridgeType{
+	Lock:      &sync.Mutex{},
+	Webhooks:  make(map[string]*webhook),
+	SubEvents: make(map[string]bool),
+	SaveCh:    make(chan struct{}, 1),
+}
+
+// redirects are not followed (they could point to a non-local endpoint), a 3xx is a failed delivery
+var httpClient = &http.Client{
+	Timeout: DeliveryTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+var initialBackoff = DefaultInitialBackoff // just for testing (shortens the retry backoff)
+
+// the bridge's route, receives events from the router (never sends anything)
+type bridgeRpcClient struct{}
+
+func (bridgeRpcClient) SendRpcMessage(msg []byte) {
+	var rpcMsg wshutil.RpcMessage
+	err := json.Unmarshal(msg, &rpcMsg)
+	if err != nil || rpcMsg.Command != wshrpc.Command_EventRecv || rpcMsg.Data == nil {
+		return
+	}
+	var event wps.WaveEvent
+	err = utilfn.ReUnmarshal(&event, rpcMsg.Data)
+	if err != nil {
+		return
+	}
+	bridge.handleEvent(event)
+}
+
+func (bridgeRpcClient) RecvRpcMessage() ([]byte, bool) {
+	select {}
+}
+
+// must be called after the router is set up and the config watcher is started
+func StartWebhookBridge() {
+	bridge.loadDeadLetters()
+	go bridge.runDeadLetterWriter()
+	wshutil.DefaultRouter.RegisterRoute(WebhookRouteId, bridgeRpcClient{})
+	// config updates are how we pick up changes to webhooks.json
+	wps.Broker.Subscribe(WebhookRouteId, wps.SubscriptionRequest{Event: wps.Event_Config, AllScopes: true})
+	bridge.reload()
+}
+
+func (b *bridgeType) getDeadLetters() []DeadLetter {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	rtn := make([]DeadLetter, len(b.DeadLetters))
+	copy(rtn, b.DeadLetters)
+	return rtn
+}
+
+func validateWebhookConfig(config wconfig.WebhookConfigType) (*wps.EventFilter, error) {
+	if config.Event == "" {
+		return nil, fmt.Errorf("event is required")
+	}
+	u, err := url.Parse(config.Url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %w", config.Url, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid url %q: scheme must be http or https", config.Url)
+	}
+	if !isLocalHost(u.Hostname()) {
+		return nil, fmt.Errorf("invalid url %q: webhooks can only be sent to local endpoints", config.Url)
+	}
+	return wps.ParseEventFilter(config.Filter)
+}
+
+func isLocalHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (b *bridgeType) reload() {
+	watcher := wconfig.GetWatcher()
+	if watcher == nil {
+		return
+	}
+	configs := watcher.GetFullConfig().Webhooks
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	newEvents := make(map[string]bool)
+	for name, config := range configs {
+		if config.Disabled {
+			continue
+		}
+		filter, err := validateWebhookConfig(config)
+		if err != nil {
+			log.Printf("[webhook] skipping webhook %q: %v\n", name, err)
+			continue
+		}
+		newEvents[config.Event] = true
+		if oldWh := b.Webhooks[name]; oldWh != nil {
+			if reflect.DeepEqual(oldWh.Config, config) {
+				continue
+			}
+			close(oldWh.DoneCh)
+		}
+		wh := &webhook{
+			Name:       name,
+			Config:     config,
+			Filter:     filter,
+			DeliveryCh: make(chan wps.WaveEvent, DeliveryQueueSize),
+			DoneCh:     make(chan struct{}),
+		}
+		b.Webhooks[name] = wh
+		go wh.run()
+	}
+	for name, wh := range b.Webhooks {
+		// removed, disabled, or invalid
+		if !reflect.DeepEqual(configs[name], wh.Config) {
+			close(wh.DoneCh)
+			delete(b.Webhooks, name)
+		}
+	}
+	for event := range b.SubEvents {
+		if !newEvents[event] && event != wps.Event_Config {
+			wps.Broker.Unsubscribe(WebhookRouteId, event)
+		}
+	}
+	for event := range newEvents {
+		if !b.SubEvents[event] && event != wps.Event_Config {
+			err := wps.Broker.Subscribe(WebhookRouteId, wps.SubscriptionRequest{Event: event, AllScopes: true})
+			if err != nil {
+				log.Printf("[webhook] error subscribing to %q: %v\n", event, err)
+			}
+		}
+	}
+	b.SubEvents = newEvents
+	if len(b.Webhooks) > 0 {
+		log.Printf("[webhook] %d webhook(s) active\n", len(b.Webhooks))
+	}
+}
+
+func (b *bridgeType) handleEvent(event wps.WaveEvent) {
+	if event.Event == wps.Event_Config {
+		b.reload()
+	}
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	var normData any
+	dataNormalized := false
+	for _, wh := range b.Webhooks {
+		if wh.Config.Event != event.Event || !scopeMatches(wh.Config.Scope, event.Scopes) {
+			continue
+		}
+		if wh.Filter != nil {
+			if !dataNormalized {
+				normData = wps.NormalizeEventData(event.Data)
+				dataNormalized = true
+			}
+			if !wh.Filter.Match(normData) {
+				continue
+			}
+		}
+		select {
+		case wh.DeliveryCh <- event:
+		default:
+			b.addDeadLetter_nolock(wh, event, 0, fmt.Errorf("delivery queue full"))
+		}
+	}
+}
+
+func scopeMatches(pattern string, scopes []string) bool {
+	if pattern == "" {
+		return true
+	}
+	for _, scope := range scopes {
+		if utilfn.StarMatchString(pattern, scope, ":") {
+			return true
+		}
+	}
+	return false
+}
+
+func (wh *webhook) run() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[webhook] panic in webhook %q: %v\n", wh.Name, r)
+			debug.PrintStack()
+		}
+	}()
+	for {
+		select {
+		case <-wh.DoneCh:
+			return
+		case event := <-wh.DeliveryCh:
+			wh.deliver(event)
+		}
+	}
+}
+
+func (wh *webhook) deliver(event wps.WaveEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[webhook] error marshaling event %s: %v\n", event.Event, err)
+		return
+	}
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		err = wh.post(body, event.Event)
+		if err == nil {
+			return
+		}
+		if attempt >= MaxDeliveryAttempts {
+			bridge.addDeadLetter(wh, event, attempt, err)
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-wh.DoneCh:
+			return
+		}
+		backoff = min(backoff*2, MaxBackoff)
+	}
+}
+
+func (wh *webhook) post(body []byte, eventName string) error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), DeliveryTimeout)
+	defer cancelFn()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.Config.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Wave-Event", eventName)
+	for key, val := range wh.Config.Headers {
+		req.Header.Set(key, val)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("bad status: %s", resp.Status)
+	}
+	return nil
+}
+
+func (b *bridgeType) addDeadLetter(wh *webhook, event wps.WaveEvent, attempts int, err error) {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	b.addDeadLetter_nolock(wh, event, attempts, err)
+}
+
+func (b *bridgeType) addDeadLetter_nolock(wh *webhook, event wps.WaveEvent, attempts int, err error) {
+	log.Printf("[webhook] failed to deliver %s to webhook %q: %v\n", event.Event, wh.Name, err)
+	b.DeadLetters = append(b.DeadLetters, DeadLetter{
+		Webhook:  wh.Name,
+		Url:      wh.Config.Url,
+		Ts:       time.Now().UnixMilli(),
+		Attempts: attempts,
+		Error:    err.Error(),
+		Event:    event,
+	})
+	if len(b.DeadLetters) > MaxDeadLetters {
+		b.DeadLetters = b.DeadLetters[len(b.DeadLetters)-MaxDeadLetters:]
+	}
+	select {
+	case b.SaveCh <- struct{}{}:
+	default:
+	}
+}
+
+// dead letters added while a save is running are picked up by the next save
+func (b *bridgeType) runDeadLetterWriter() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[webhook] panic in dead-letter writer: %v\n", r)
+			debug.PrintStack()
+		}
+	}()
+	for range b.SaveCh {
+		b.saveDeadLetters()
+	}
+}
+
+func (b *bridgeType) saveDeadLetters() {
+	deadLetters := b.getDeadLetters()
+	barr, err := json.MarshalIndent(deadLetters, "", "  ")
+	if err != nil {
+		return
+	}
+	err = os.WriteFile(getDeadLetterFileName(), barr, 0600)
+	if err != nil {
+		log.Printf("[webhook] error writing dead-letter log: %v\n", err)
+	}
+}
+
+func (b *bridgeType) loadDeadLetters() {
+	barr, err := os.ReadFile(getDeadLetterFileName())
+	if err != nil {
+		return
+	}
+	var deadLetters []DeadLetter
+	err = json.Unmarshal(barr, &deadLetters)
+	if err != nil {
+		log.Printf("[webhook] error reading dead-letter log: %v\n", err)
+		return
+	}
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	b.DeadLetters = deadLetters
+}
+
+func getDeadLetterFileName() string {
+	return filepath.Join(wavebase.GetWaveHomeDir(), DeadLetterFileName)
+}
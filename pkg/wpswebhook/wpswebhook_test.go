@@ -0,0 +1,169 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wpswebhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+)
+
+func setupWebhookTest(t *testing.T) {
+	t.Setenv(wavebase.WaveHomeVarName, t.TempDir())
+	initialBackoff = 10 * time.Millisecond
+	bridge.Lock.Lock()
+	bridge.DeadLetters = nil
+	bridge.Lock.Unlock()
+	select {
+	case <-bridge.SaveCh:
+	default:
+	}
+	t.Cleanup(func() {
+		initialBackoff = DefaultInitialBackoff
+		bridge.Lock.Lock()
+		bridge.DeadLetters = nil
+		bridge.Webhooks = make(map[string]*webhook)
+		bridge.Lock.Unlock()
+	})
+}
+
+func makeTestWebhook(t *testing.T, name string, url string) *webhook {
+	wh := &webhook{
+		Name:       name,
+		Config:     wconfig.WebhookConfigType{Event: "test:event", Url: url, Headers: map[string]string{"X-Test": "1"}},
+		DeliveryCh: make(chan wps.WaveEvent, 1),
+		DoneCh:     make(chan struct{}),
+	}
+	t.Cleanup(func() { close(wh.DoneCh) })
+	return wh
+}
+
+func TestWebhookRetry(t *testing.T) {
+	setupWebhookTest(t)
+	var numReqs atomic.Int32
+	var reqTimes []time.Time
+	var lock sync.Mutex
+	var gotEvent wps.WaveEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		reqTimes = append(reqTimes, time.Now())
+		lock.Unlock()
+		if r.Header.Get("X-Wave-Event") != "test:event" || r.Header.Get("X-Test") != "1" {
+			t.Errorf("missing headers: %v", r.Header)
+		}
+		if numReqs.Add(1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &gotEvent)
+	}))
+	defer server.Close()
+
+	wh := makeTestWebhook(t, "retry", server.URL)
+	wh.deliver(wps.WaveEvent{Event: "test:event", Seq: 5, Data: "hello"})
+	if numReqs.Load() != 3 {
+		t.Errorf("expected 2 retries before success, got %d requests", numReqs.Load())
+	}
+	if gotEvent.Seq != 5 || gotEvent.Data != "hello" {
+		t.Errorf("unexpected delivered event: %+v", gotEvent)
+	}
+	// backoff doubles after each attempt
+	if len(reqTimes) == 3 && reqTimes[2].Sub(reqTimes[1]) < 2*initialBackoff {
+		t.Errorf("expected the second retry to wait at least %v, waited %v", 2*initialBackoff, reqTimes[2].Sub(reqTimes[1]))
+	}
+	if deadLetters := bridge.getDeadLetters(); len(deadLetters) != 0 {
+		t.Errorf("successful delivery added dead letters: %+v", deadLetters)
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	setupWebhookTest(t)
+	var numReqs atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		numReqs.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	wh := makeTestWebhook(t, "failing", server.URL)
+	wh.deliver(wps.WaveEvent{Event: "test:event", Seq: 7})
+	if numReqs.Load() != MaxDeliveryAttempts {
+		t.Errorf("expected %d attempts, got %d", MaxDeliveryAttempts, numReqs.Load())
+	}
+	deadLetters := bridge.getDeadLetters()
+	if len(deadLetters) != 1 || deadLetters[0].Webhook != "failing" || deadLetters[0].Attempts != MaxDeliveryAttempts || deadLetters[0].Event.Seq != 7 {
+		t.Fatalf("unexpected dead letters: %+v", deadLetters)
+	}
+	select {
+	case <-bridge.SaveCh:
+	default:
+		t.Errorf("adding a dead letter should signal the writer")
+	}
+
+	// the writer saves outside the lock, the log is reloaded on startup
+	bridge.saveDeadLetters()
+	if _, err := os.Stat(getDeadLetterFileName()); err != nil {
+		t.Fatalf("dead-letter log not written: %v", err)
+	}
+	bridge.Lock.Lock()
+	bridge.DeadLetters = nil
+	bridge.Lock.Unlock()
+	bridge.loadDeadLetters()
+	if deadLetters := bridge.getDeadLetters(); len(deadLetters) != 1 || deadLetters[0].Event.Seq != 7 {
+		t.Errorf("dead letters not reloaded: %+v", deadLetters)
+	}
+}
+
+func TestWebhookNoRedirects(t *testing.T) {
+	setupWebhookTest(t)
+	var targetReqs atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		targetReqs.Add(1)
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	wh := makeTestWebhook(t, "redirect", server.URL)
+	err := wh.post([]byte(`{}`), "test:event")
+	if err == nil || !strings.Contains(err.Error(), "307") {
+		t.Errorf("expected a redirect to fail the delivery, got %v", err)
+	}
+	if targetReqs.Load() != 0 {
+		t.Errorf("redirect was followed")
+	}
+}
+
+func TestWebhookQueueFull(t *testing.T) {
+	setupWebhookTest(t)
+	// not running, so the delivery queue (size 1) fills up
+	wh := makeTestWebhook(t, "full", "http://127.0.0.1:1/")
+	bridge.Lock.Lock()
+	bridge.Webhooks = map[string]*webhook{"full": wh}
+	bridge.Lock.Unlock()
+	bridge.handleEvent(wps.WaveEvent{Event: "test:event", Seq: 1})
+	bridge.handleEvent(wps.WaveEvent{Event: "other:event", Seq: 2})
+	bridge.handleEvent(wps.WaveEvent{Event: "test:event", Seq: 3})
+	deadLetters := bridge.getDeadLetters()
+	if len(deadLetters) != 1 || deadLetters[0].Event.Seq != 3 || deadLetters[0].Attempts != 0 {
+		t.Errorf("expected the event that did not fit to be dead-lettered: %+v", deadLetters)
+	}
+	if event := <-wh.DeliveryCh; event.Seq != 1 {
+		t.Errorf("expected event 1 to be queued, got %d", event.Seq)
+	}
+}
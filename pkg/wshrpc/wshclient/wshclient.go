@@ -13,12 +13,36 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/wps"
 )
 
+// command "apitokencreate", wshserver.ApiTokenCreateCommand
+func ApiTokenCreateCommand(w *wshutil.WshRpc, data wshrpc.CommandApiTokenCreateData, opts *wshrpc.RpcOpts) (*wshrpc.CommandApiTokenCreateRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandApiTokenCreateRtnData](w, "apitokencreate", data, opts)
+	return resp, err
+}
+
+// command "apitokendelete", wshserver.ApiTokenDeleteCommand
+func ApiTokenDeleteCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "apitokendelete", data, opts)
+	return err
+}
+
+// command "apitokenlist", wshserver.ApiTokenListCommand
+func ApiTokenListCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]wshrpc.ApiTokenInfo, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.ApiTokenInfo](w, "apitokenlist", nil, opts)
+	return resp, err
+}
+
 // command "authenticate", wshserver.AuthenticateCommand
 func AuthenticateCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) (wshrpc.CommandAuthenticateRtnData, error) {
 	resp, err := sendRpcRequestCallHelper[wshrpc.CommandAuthenticateRtnData](w, "authenticate", data, opts)
 	return resp, err
 }
 
+// command "authrefresh", wshserver.AuthRefreshCommand
+func AuthRefreshCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) (string, error) {
+	resp, err := sendRpcRequestCallHelper[string](w, "authrefresh", data, opts)
+	return resp, err
+}
+
 // command "blockinfo", wshserver.BlockInfoCommand
 func BlockInfoCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) (*wshrpc.BlockInfoData, error) {
 	resp, err := sendRpcRequestCallHelper[*wshrpc.BlockInfoData](w, "blockinfo", data, opts)
@@ -31,6 +55,11 @@ func ConnConnectCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) er
 	return err
 }
 
+// command "conncopyfile", wshserver.ConnCopyFileCommand
+func ConnCopyFileCommand(w *wshutil.WshRpc, data wshrpc.CommandConnCopyFileData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.ConnCopyFileProgress] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.ConnCopyFileProgress](w, "conncopyfile", data, opts)
+}
+
 // command "conndisconnect", wshserver.ConnDisconnectCommand
 func ConnDisconnectCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "conndisconnect", data, opts)
@@ -43,12 +72,36 @@ func ConnEnsureCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) err
 	return err
 }
 
+// command "connforwardadd", wshserver.ConnForwardAddCommand
+func ConnForwardAddCommand(w *wshutil.WshRpc, data wshrpc.CommandConnForwardAddData, opts *wshrpc.RpcOpts) (*wshrpc.ConnForward, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.ConnForward](w, "connforwardadd", data, opts)
+	return resp, err
+}
+
+// command "connforwardlist", wshserver.ConnForwardListCommand
+func ConnForwardListCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) ([]wshrpc.ConnForward, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.ConnForward](w, "connforwardlist", data, opts)
+	return resp, err
+}
+
+// command "connforwardremove", wshserver.ConnForwardRemoveCommand
+func ConnForwardRemoveCommand(w *wshutil.WshRpc, data wshrpc.CommandConnForwardRemoveData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "connforwardremove", data, opts)
+	return err
+}
+
 // command "connlist", wshserver.ConnListCommand
 func ConnListCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]string, error) {
 	resp, err := sendRpcRequestCallHelper[[]string](w, "connlist", nil, opts)
 	return resp, err
 }
 
+// command "connnestedtokens", wshserver.ConnNestedTokensCommand
+func ConnNestedTokensCommand(w *wshutil.WshRpc, data wshrpc.CommandConnNestedTokensData, opts *wshrpc.RpcOpts) (wshrpc.CommandConnNestedTokensRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[wshrpc.CommandConnNestedTokensRtnData](w, "connnestedtokens", data, opts)
+	return resp, err
+}
+
 // command "connreinstallwsh", wshserver.ConnReinstallWshCommand
 func ConnReinstallWshCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "connreinstallwsh", data, opts)
@@ -97,6 +150,12 @@ func EventPublishCommand(w *wshutil.WshRpc, data wps.WaveEvent, opts *wshrpc.Rpc
 	return err
 }
 
+// command "eventqueuestats", wshserver.EventQueueStatsCommand
+func EventQueueStatsCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]wshrpc.EventQueueStats, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.EventQueueStats](w, "eventqueuestats", nil, opts)
+	return resp, err
+}
+
 // command "eventreadhistory", wshserver.EventReadHistoryCommand
 func EventReadHistoryCommand(w *wshutil.WshRpc, data wshrpc.CommandEventReadHistoryData, opts *wshrpc.RpcOpts) ([]*wps.WaveEvent, error) {
 	resp, err := sendRpcRequestCallHelper[[]*wps.WaveEvent](w, "eventreadhistory", data, opts)
@@ -109,6 +168,18 @@ func EventRecvCommand(w *wshutil.WshRpc, data wps.WaveEvent, opts *wshrpc.RpcOpt
 	return err
 }
 
+// command "eventretentionlist", wshserver.EventRetentionListCommand
+func EventRetentionListCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) ([]wshrpc.EventRetention, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.EventRetention](w, "eventretentionlist", nil, opts)
+	return resp, err
+}
+
+// command "eventretentionset", wshserver.EventRetentionSetCommand
+func EventRetentionSetCommand(w *wshutil.WshRpc, data wshrpc.EventRetention, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "eventretentionset", data, opts)
+	return err
+}
+
 // command "eventsub", wshserver.EventSubCommand
 func EventSubCommand(w *wshutil.WshRpc, data wps.SubscriptionRequest, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "eventsub", data, opts)
@@ -139,12 +210,30 @@ func FileAppendIJsonCommand(w *wshutil.WshRpc, data wshrpc.CommandAppendIJsonDat
 	return err
 }
 
+// command "filelistversions", wshserver.FileListVersionsCommand
+func FileListVersionsCommand(w *wshutil.WshRpc, data wshrpc.CommandFileData, opts *wshrpc.RpcOpts) ([]*wshrpc.FileVersionInfo, error) {
+	resp, err := sendRpcRequestCallHelper[[]*wshrpc.FileVersionInfo](w, "filelistversions", data, opts)
+	return resp, err
+}
+
 // command "fileread", wshserver.FileReadCommand
-func FileReadCommand(w *wshutil.WshRpc, data wshrpc.CommandFileData, opts *wshrpc.RpcOpts) (string, error) {
-	resp, err := sendRpcRequestCallHelper[string](w, "fileread", data, opts)
+func FileReadCommand(w *wshutil.WshRpc, data wshrpc.CommandFileData, opts *wshrpc.RpcOpts) ([]byte, error) {
+	resp, err := sendRpcRequestCallHelper[[]byte](w, "fileread", data, opts)
+	return resp, err
+}
+
+// command "filereadversion", wshserver.FileReadVersionCommand
+func FileReadVersionCommand(w *wshutil.WshRpc, data wshrpc.CommandFileVersionData, opts *wshrpc.RpcOpts) (string, error) {
+	resp, err := sendRpcRequestCallHelper[string](w, "filereadversion", data, opts)
 	return resp, err
 }
 
+// command "filerestoreversion", wshserver.FileRestoreVersionCommand
+func FileRestoreVersionCommand(w *wshutil.WshRpc, data wshrpc.CommandFileVersionData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "filerestoreversion", data, opts)
+	return err
+}
+
 // command "filewrite", wshserver.FileWriteCommand
 func FileWriteCommand(w *wshutil.WshRpc, data wshrpc.CommandFileData, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "filewrite", data, opts)
@@ -163,8 +252,20 @@ func MessageCommand(w *wshutil.WshRpc, data wshrpc.CommandMessageData, opts *wsh
 	return err
 }
 
+// command "remotefilechmod", wshserver.RemoteFileChmodCommand
+func RemoteFileChmodCommand(w *wshutil.WshRpc, data wshrpc.CommandRemoteFileChmodData, opts *wshrpc.RpcOpts) (*wshrpc.FileInfo, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.FileInfo](w, "remotefilechmod", data, opts)
+	return resp, err
+}
+
+// command "remotefilecopy", wshserver.RemoteFileCopyCommand
+func RemoteFileCopyCommand(w *wshutil.WshRpc, data wshrpc.CommandRemoteFileCopyData, opts *wshrpc.RpcOpts) (*wshrpc.FileInfo, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.FileInfo](w, "remotefilecopy", data, opts)
+	return resp, err
+}
+
 // command "remotefiledelete", wshserver.RemoteFileDeleteCommand
-func RemoteFileDeleteCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
+func RemoteFileDeleteCommand(w *wshutil.WshRpc, data wshrpc.CommandRemoteFileDeleteData, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "remotefiledelete", data, opts)
 	return err
 }
@@ -181,6 +282,24 @@ func RemoteFileJoinCommand(w *wshutil.WshRpc, data []string, opts *wshrpc.RpcOpt
 	return resp, err
 }
 
+// command "remotefilerename", wshserver.RemoteFileRenameCommand
+func RemoteFileRenameCommand(w *wshutil.WshRpc, data wshrpc.CommandRemoteFileRenameData, opts *wshrpc.RpcOpts) (*wshrpc.FileInfo, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.FileInfo](w, "remotefilerename", data, opts)
+	return resp, err
+}
+
+// command "remotelistdir", wshserver.RemoteListDirCommand
+func RemoteListDirCommand(w *wshutil.WshRpc, data wshrpc.CommandRemoteListDirData, opts *wshrpc.RpcOpts) (*wshrpc.CommandRemoteListDirRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandRemoteListDirRtnData](w, "remotelistdir", data, opts)
+	return resp, err
+}
+
+// command "remotemkdir", wshserver.RemoteMkdirCommand
+func RemoteMkdirCommand(w *wshutil.WshRpc, data wshrpc.CommandRemoteMkdirData, opts *wshrpc.RpcOpts) (*wshrpc.FileInfo, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.FileInfo](w, "remotemkdir", data, opts)
+	return resp, err
+}
+
 // command "remotestreamcpudata", wshserver.RemoteStreamCpuDataCommand
 func RemoteStreamCpuDataCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.TimeSeriesData] {
 	return sendRpcRequestResponseStreamHelper[wshrpc.TimeSeriesData](w, "remotestreamcpudata", nil, opts)
@@ -197,6 +316,12 @@ func RemoteWriteFileCommand(w *wshutil.WshRpc, data wshrpc.CommandRemoteWriteFil
 	return err
 }
 
+// command "remotewritefilestream", wshserver.RemoteWriteFileStreamCommand
+func RemoteWriteFileStreamCommand(w *wshutil.WshRpc, data wshrpc.CommandRemoteWriteFileStreamData, reqCh <-chan wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData], opts *wshrpc.RpcOpts) (*wshrpc.FileInfo, error) {
+	resp, err := sendRpcStreamingRequestHelper[*wshrpc.FileInfo](w, "remotewritefilestream", data, reqCh, opts)
+	return resp, err
+}
+
 // command "resolveids", wshserver.ResolveIdsCommand
 func ResolveIdsCommand(w *wshutil.WshRpc, data wshrpc.CommandResolveIdsData, opts *wshrpc.RpcOpts) (wshrpc.CommandResolveIdsRtnData, error) {
 	resp, err := sendRpcRequestCallHelper[wshrpc.CommandResolveIdsRtnData](w, "resolveids", data, opts)
@@ -209,12 +334,30 @@ func RouteAnnounceCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) error {
 	return err
 }
 
+// command "routeping", wshserver.RoutePingCommand
+func RoutePingCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "routeping", nil, opts)
+	return err
+}
+
 // command "routeunannounce", wshserver.RouteUnannounceCommand
 func RouteUnannounceCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "routeunannounce", nil, opts)
 	return err
 }
 
+// command "rpcstats", wshserver.RpcStatsCommand
+func RpcStatsCommand(w *wshutil.WshRpc, data wshrpc.CommandRpcStatsData, opts *wshrpc.RpcOpts) ([]wshrpc.RpcCommandStats, error) {
+	resp, err := sendRpcRequestCallHelper[[]wshrpc.RpcCommandStats](w, "rpcstats", data, opts)
+	return resp, err
+}
+
+// command "rpctrace", wshserver.RpcTraceCommand
+func RpcTraceCommand(w *wshutil.WshRpc, data wshrpc.CommandRpcTraceData, opts *wshrpc.RpcOpts) (string, error) {
+	resp, err := sendRpcRequestCallHelper[string](w, "rpctrace", data, opts)
+	return resp, err
+}
+
 // command "setconfig", wshserver.SetConfigCommand
 func SetConfigCommand(w *wshutil.WshRpc, data wconfig.MetaSettingsType, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "setconfig", data, opts)
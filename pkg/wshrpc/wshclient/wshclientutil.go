@@ -4,9 +4,10 @@
 package wshclient
 
 import (
+	"context"
 	"errors"
+	"io"
 
-	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshutil"
 )
@@ -26,17 +27,64 @@ func sendRpcRequestCallHelper[T any](w *wshutil.WshRpc, command string, data int
 		}
 		return respData, nil
 	}
-	resp, err := w.SendRpcRequest(command, data, opts)
+	err := w.SendRpcRequestDecode(command, data, opts, &respData)
 	if err != nil {
 		return respData, err
 	}
-	err = utilfn.ReUnmarshal(&respData, resp)
+	return respData, nil
+}
+
+func sendRpcStreamingRequestHelper[T any, R any](w *wshutil.WshRpc, command string, data interface{}, reqCh <-chan wshrpc.RespOrErrorUnion[R], opts *wshrpc.RpcOpts) (T, error) {
+	var respData T
+	if w == nil {
+		go func() {
+			for range reqCh {
+			}
+		}()
+		return respData, errors.New("nil wshrpc passed to wshclient")
+	}
+	err := wshutil.SendStreamingRequestDecode(w, command, data, reqCh, opts, &respData)
 	if err != nil {
 		return respData, err
 	}
 	return respData, nil
 }
 
+const FileChunkSize = 64 * 1024
+
+// reads r in chunks for a streaming file write (RemoteWriteFileStreamCommand).  progressFn (optional) is called with
+// the total bytes read so far.  canceling ctx (or a read error) cancels the write.
+func ReaderToFileChunkCh(ctx context.Context, r io.Reader, progressFn func(int64)) <-chan wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData] {
+	reqCh := make(chan wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData], 4)
+	go func() {
+		defer close(reqCh)
+		var total int64
+		for {
+			if ctx.Err() != nil {
+				reqCh <- wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData]{Error: ctx.Err()}
+				return
+			}
+			buf := make([]byte, FileChunkSize)
+			n, err := io.ReadFull(r, buf)
+			if n > 0 {
+				reqCh <- wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData]{Response: wshrpc.CommandFileChunkData{Data: buf[:n]}}
+				total += int64(n)
+				if progressFn != nil {
+					progressFn(total)
+				}
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return
+			}
+			if err != nil {
+				reqCh <- wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData]{Error: err}
+				return
+			}
+		}
+	}()
+	return reqCh
+}
+
 func rtnErr[T any](ch chan wshrpc.RespOrErrorUnion[T], err error) {
 	go func() {
 		ch <- wshrpc.RespOrErrorUnion[T]{Error: err}
@@ -68,13 +116,8 @@ func sendRpcRequestResponseStreamHelper[T any](w *wshutil.WshRpc, command string
 			if reqHandler.ResponseDone() {
 				break
 			}
-			resp, err := reqHandler.NextResponse()
-			if err != nil {
-				respChan <- wshrpc.RespOrErrorUnion[T]{Error: err}
-				break
-			}
 			var respData T
-			err = utilfn.ReUnmarshal(&respData, resp)
+			err := reqHandler.DecodeNextResponse(&respData)
 			if err != nil {
 				respChan <- wshrpc.RespOrErrorUnion[T]{Error: err}
 				break
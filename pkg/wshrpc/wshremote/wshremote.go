@@ -4,8 +4,8 @@
 package wshremote
 
 import (
+	"bytes"
 	"context"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -173,7 +173,8 @@ func (impl *ServerImpl) remoteStreamFileInternal(ctx context.Context, data wshrp
 	if finfo.NotFound {
 		return nil
 	}
-	if finfo.Size > MaxFileSize {
+	// large files can be read in byte ranges (this is how files are copied between connections)
+	if finfo.Size > MaxFileSize && (byteRange.All || byteRange.End-byteRange.Start > MaxFileSize) {
 		return fmt.Errorf("file %q is too large to read, use /wave/stream-file", path)
 	}
 	if finfo.IsDir {
@@ -185,18 +186,22 @@ func (impl *ServerImpl) remoteStreamFileInternal(ctx context.Context, data wshrp
 
 func (impl *ServerImpl) RemoteStreamFileCommand(ctx context.Context, data wshrpc.CommandRemoteStreamFileData) chan wshrpc.RespOrErrorUnion[wshrpc.CommandRemoteStreamFileRtnData] {
 	ch := make(chan wshrpc.RespOrErrorUnion[wshrpc.CommandRemoteStreamFileRtnData], 16)
-	defer close(ch)
-	err := impl.remoteStreamFileInternal(ctx, data, func(fileInfo []*wshrpc.FileInfo, data []byte) {
-		resp := wshrpc.CommandRemoteStreamFileRtnData{}
-		resp.FileInfo = fileInfo
-		if len(data) > 0 {
-			resp.Data64 = base64.StdEncoding.EncodeToString(data)
+	// the stream is read after we return, so it must be produced in the background (it can be larger than ch)
+	go func() {
+		defer close(ch)
+		err := impl.remoteStreamFileInternal(ctx, data, func(fileInfo []*wshrpc.FileInfo, data []byte) {
+			resp := wshrpc.CommandRemoteStreamFileRtnData{}
+			resp.FileInfo = fileInfo
+			if len(data) > 0 {
+				// the read buffer is reused
+				resp.Data = bytes.Clone(data)
+			}
+			ch <- wshrpc.RespOrErrorUnion[wshrpc.CommandRemoteStreamFileRtnData]{Response: resp}
+		})
+		if err != nil {
+			ch <- respErr(err)
 		}
-		ch <- wshrpc.RespOrErrorUnion[wshrpc.CommandRemoteStreamFileRtnData]{Response: resp}
-	})
-	if err != nil {
-		ch <- respErr(err)
-	}
+	}()
 	return ch
 }
 
@@ -310,24 +315,102 @@ func (*ServerImpl) RemoteWriteFileCommand(ctx context.Context, data wshrpc.Comma
 	if createMode == 0 {
 		createMode = 0644
 	}
-	dataSize := base64.StdEncoding.DecodedLen(len(data.Data64))
-	dataBytes := make([]byte, dataSize)
-	n, err := base64.StdEncoding.Decode(dataBytes, []byte(data.Data64))
-	if err != nil {
-		return fmt.Errorf("cannot decode base64 data: %w", err)
-	}
-	err = os.WriteFile(path, dataBytes[:n], createMode)
+	err := os.WriteFile(path, data.Data, createMode)
 	if err != nil {
 		return fmt.Errorf("cannot write file %q: %w", path, err)
 	}
 	return nil
 }
 
-func (*ServerImpl) RemoteFileDeleteCommand(ctx context.Context, path string) error {
-	cleanedPath := filepath.Clean(wavebase.ExpandHomeDir(path))
-	err := os.Remove(cleanedPath)
+// opens <path>.wavepart for a resumable write (truncated to offset, which must not be past its end)
+func openPartialFile(path string, offset int64) (*os.File, error) {
+	partialName := path + wshrpc.PartialFileSuffix
+	partialFile, err := os.OpenFile(partialName, os.O_CREATE|os.O_WRONLY, 0600)
 	if err != nil {
-		return fmt.Errorf("cannot delete file %q: %w", path, err)
+		return nil, fmt.Errorf("cannot open partial file for %q: %w", path, err)
 	}
-	return nil
+	finfo, err := partialFile.Stat()
+	if err == nil && finfo.Size() < offset {
+		err = fmt.Errorf("partial file has %d bytes, cannot resume at %d", finfo.Size(), offset)
+	}
+	if err == nil {
+		err = partialFile.Truncate(offset)
+	}
+	if err == nil {
+		_, err = partialFile.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		partialFile.Close()
+		return nil, fmt.Errorf("cannot resume %q: %w", path, err)
+	}
+	return partialFile, nil
+}
+
+// writes to a temp file next to path, which replaces path (atomically) once the whole stream is written.
+// canceled or failed writes leave path untouched.  with Partial the temp file is <path>.wavepart, which is
+// kept when the write fails so it can be resumed (at Offset).
+func (impl *ServerImpl) RemoteWriteFileStreamCommand(ctx context.Context, data wshrpc.CommandRemoteWriteFileStreamData, reqCh <-chan wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData]) (*wshrpc.FileInfo, error) {
+	path := wavebase.ExpandHomeDir(data.Path)
+	createMode := data.CreateMode
+	if createMode == 0 {
+		createMode = 0644
+	}
+	if finfo, err := os.Stat(path); err == nil {
+		if finfo.IsDir() {
+			return nil, fmt.Errorf("cannot write file %q: is a directory", path)
+		}
+		// keep the mode of the file we're replacing (like os.WriteFile)
+		createMode = finfo.Mode().Perm()
+	}
+	if data.Offset != 0 && (!data.Partial || data.Offset < 0) {
+		return nil, fmt.Errorf("cannot write file %q: offset requires a partial write", path)
+	}
+	var tmpFile *os.File
+	var err error
+	if data.Partial {
+		tmpFile, err = openPartialFile(path, data.Offset)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		tmpFile, err = os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".wavetmp-*")
+		if err != nil {
+			return nil, fmt.Errorf("cannot create temp file for %q: %w", path, err)
+		}
+	}
+	tmpName := tmpFile.Name()
+	success := false
+	defer func() {
+		if !success {
+			tmpFile.Close()
+			if !data.Partial {
+				os.Remove(tmpName)
+			}
+		}
+	}()
+	written := data.Offset
+	for req := range reqCh {
+		if req.Error != nil {
+			return nil, fmt.Errorf("writing %q: %w", path, req.Error)
+		}
+		n, err := tmpFile.Write(req.Response.Data)
+		written += int64(n)
+		if err != nil {
+			return nil, fmt.Errorf("cannot write file %q: %w", path, err)
+		}
+	}
+	if data.Size > 0 && written != data.Size {
+		return nil, fmt.Errorf("cannot write file %q: got %d bytes, expected %d", path, written, data.Size)
+	}
+	if err := tmpFile.Chmod(createMode); err != nil {
+		return nil, fmt.Errorf("cannot set mode for %q: %w", path, err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return nil, fmt.Errorf("cannot write file %q: %w", path, err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return nil, fmt.Errorf("cannot write file %q: %w", path, err)
+	}
+	success = true
+	return impl.fileInfoInternal(path, false)
 }
@@ -0,0 +1,385 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// file management commands for the directory view (list, mkdir, rename, copy, delete, chmod)
+
+const DefaultListDirLimit = 200
+const MaxListDirLimit = 2000
+const DefaultMkdirMode = 0755
+
+func cleanPath(path string) string {
+	return filepath.Clean(wavebase.ExpandHomeDir(path))
+}
+
+func compareFileInfo(a *wshrpc.FileInfo, b *wshrpc.FileInfo, sortBy string) int {
+	switch sortBy {
+	case wshrpc.ListDirSort_Size:
+		if a.Size != b.Size {
+			if a.Size < b.Size {
+				return -1
+			}
+			return 1
+		}
+	case wshrpc.ListDirSort_ModTime:
+		if a.ModTime != b.ModTime {
+			if a.ModTime < b.ModTime {
+				return -1
+			}
+			return 1
+		}
+	case wshrpc.ListDirSort_MimeType:
+		if c := strings.Compare(a.MimeType, b.MimeType); c != 0 {
+			return c
+		}
+	}
+	// names are the tiebreaker for every sort
+	if c := strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Name, b.Name)
+}
+
+func sortFileInfos(entries []*wshrpc.FileInfo, sortBy string, sortDesc bool, dirsFirst bool) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if dirsFirst && entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		c := compareFileInfo(entries[i], entries[j], sortBy)
+		if sortDesc {
+			c = -c
+		}
+		return c < 0
+	})
+}
+
+func validateListDirSort(sortBy string) error {
+	switch sortBy {
+	case "", wshrpc.ListDirSort_Name, wshrpc.ListDirSort_Size, wshrpc.ListDirSort_ModTime, wshrpc.ListDirSort_MimeType:
+		return nil
+	}
+	return fmt.Errorf("invalid sort %q (use name, size, modtime, or mimetype)", sortBy)
+}
+
+// unlike RemoteStreamFile (which returns the first MaxDirSize entries in directory order), the whole
+// directory is sorted before it is paged
+func (impl *ServerImpl) RemoteListDirCommand(ctx context.Context, data wshrpc.CommandRemoteListDirData) (*wshrpc.CommandRemoteListDirRtnData, error) {
+	if err := validateListDirSort(data.SortBy); err != nil {
+		return nil, err
+	}
+	if data.Offset < 0 || data.Limit < 0 {
+		return nil, fmt.Errorf("invalid offset/limit %d/%d", data.Offset, data.Limit)
+	}
+	limit := data.Limit
+	if limit == 0 {
+		limit = DefaultListDirLimit
+	}
+	limit = min(limit, MaxListDirLimit)
+	path := cleanPath(data.Path)
+	dirInfo, err := impl.fileInfoInternal(path, true)
+	if err != nil {
+		return nil, err
+	}
+	rtn := &wshrpc.CommandRemoteListDirRtnData{Dir: dirInfo}
+	if dirInfo.NotFound {
+		return rtn, nil
+	}
+	if !dirInfo.IsDir {
+		return nil, fmt.Errorf("cannot list %q: not a directory", data.Path)
+	}
+	dirEntries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open dir %q: %w", data.Path, err)
+	}
+	entries := make([]*wshrpc.FileInfo, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if data.NoHidden && strings.HasPrefix(dirEntry.Name(), ".") {
+			continue
+		}
+		finfo, err := dirEntry.Info()
+		if err != nil {
+			// removed while we were listing
+			continue
+		}
+		entries = append(entries, statToFileInfo(filepath.Join(path, finfo.Name()), finfo, false))
+	}
+	sortFileInfos(entries, data.SortBy, data.SortDesc, data.DirsFirst)
+	rtn.Total = len(entries)
+	if data.Offset >= len(entries) {
+		rtn.Entries = []*wshrpc.FileInfo{}
+		return rtn, nil
+	}
+	end := min(data.Offset+limit, len(entries))
+	rtn.Entries = entries[data.Offset:end]
+	rtn.HasMore = end < len(entries)
+	return rtn, nil
+}
+
+func (impl *ServerImpl) RemoteMkdirCommand(ctx context.Context, data wshrpc.CommandRemoteMkdirData) (*wshrpc.FileInfo, error) {
+	path := cleanPath(data.Path)
+	mode := data.Mode.Perm()
+	if mode == 0 {
+		mode = DefaultMkdirMode
+	}
+	var err error
+	if data.Parents {
+		err = os.MkdirAll(path, mode)
+	} else {
+		err = os.Mkdir(path, mode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot create directory %q: %w", data.Path, err)
+	}
+	return impl.fileInfoInternal(path, true)
+}
+
+// checks an existing destination, returns true if dest exists
+func checkDestPath(srcInfo fs.FileInfo, dest string, overwrite bool) (bool, error) {
+	destInfo, err := os.Lstat(dest)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot stat %q: %w", dest, err)
+	}
+	if !overwrite {
+		return true, fmt.Errorf("%q already exists (set overwrite to replace it)", dest)
+	}
+	if srcInfo.IsDir() != destInfo.IsDir() {
+		if destInfo.IsDir() {
+			return true, fmt.Errorf("cannot overwrite directory %q with a file", dest)
+		}
+		return true, fmt.Errorf("cannot overwrite file %q with a directory", dest)
+	}
+	return true, nil
+}
+
+func isSubPath(parent string, path string) bool {
+	relPath, err := filepath.Rel(parent, path)
+	if err != nil {
+		return false
+	}
+	return relPath == "." || (relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator)))
+}
+
+func (impl *ServerImpl) RemoteFileRenameCommand(ctx context.Context, data wshrpc.CommandRemoteFileRenameData) (*wshrpc.FileInfo, error) {
+	src := cleanPath(data.SrcPath)
+	dest := cleanPath(data.DestPath)
+	if src == dest {
+		return nil, fmt.Errorf("cannot rename %q: source and destination are the same", data.SrcPath)
+	}
+	srcInfo, err := os.Lstat(src)
+	if err != nil {
+		return nil, fmt.Errorf("cannot rename %q: %w", data.SrcPath, err)
+	}
+	if srcInfo.IsDir() && isSubPath(src, dest) {
+		return nil, fmt.Errorf("cannot move %q into itself", data.SrcPath)
+	}
+	destExists, err := checkDestPath(srcInfo, dest, data.Overwrite)
+	if err != nil {
+		return nil, err
+	}
+	if destExists && srcInfo.IsDir() {
+		// os.Rename replaces empty directories on unix only, be consistent
+		return nil, fmt.Errorf("cannot move directory %q: %q already exists", data.SrcPath, data.DestPath)
+	}
+	err = os.Rename(src, dest)
+	if errors.Is(err, syscall.EXDEV) {
+		// different filesystems, copy and remove
+		err = copyTree(ctx, src, dest)
+		if err == nil {
+			err = os.RemoveAll(src)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot rename %q to %q: %w", data.SrcPath, data.DestPath, err)
+	}
+	return impl.fileInfoInternal(dest, false)
+}
+
+// copies a regular file to a temp file next to dest, which replaces dest once it is complete
+func copyRegularFile(ctx context.Context, src string, dest string, mode fs.FileMode) error {
+	srcFd, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFd.Close()
+	tmpFile, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".wavetmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmpFile.Name()
+	success := false
+	defer func() {
+		if !success {
+			tmpFile.Close()
+			os.Remove(tmpName)
+		}
+	}()
+	buf := make([]byte, FileChunkSize*4)
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		n, readErr := srcFd.Read(buf)
+		if n > 0 {
+			if _, err := tmpFile.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+	if err := tmpFile.Chmod(mode); err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, dest); err != nil {
+		return err
+	}
+	success = true
+	return nil
+}
+
+// copies src to dest (merging into existing directories and replacing existing files).
+// symlinks are copied as links, other special files are skipped.
+func copyTree(ctx context.Context, srcRoot string, destRoot string) error {
+	return filepath.WalkDir(srcRoot, func(src string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		relPath, err := filepath.Rel(srcRoot, src)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(destRoot, relPath)
+		srcInfo, err := dirEntry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case srcInfo.IsDir():
+			err := os.Mkdir(dest, srcInfo.Mode().Perm())
+			if errors.Is(err, fs.ErrExist) {
+				if destInfo, statErr := os.Lstat(dest); statErr == nil && destInfo.IsDir() {
+					return nil
+				}
+			}
+			return err
+		case srcInfo.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(src)
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(dest); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			return os.Symlink(target, dest)
+		case srcInfo.Mode().IsRegular():
+			return copyRegularFile(ctx, src, dest, srcInfo.Mode().Perm())
+		default:
+			return nil
+		}
+	})
+}
+
+func (impl *ServerImpl) RemoteFileCopyCommand(ctx context.Context, data wshrpc.CommandRemoteFileCopyData) (*wshrpc.FileInfo, error) {
+	src := cleanPath(data.SrcPath)
+	dest := cleanPath(data.DestPath)
+	if src == dest {
+		return nil, fmt.Errorf("cannot copy %q: source and destination are the same", data.SrcPath)
+	}
+	srcInfo, err := os.Lstat(src)
+	if err != nil {
+		return nil, fmt.Errorf("cannot copy %q: %w", data.SrcPath, err)
+	}
+	if srcInfo.IsDir() {
+		if !data.Recursive {
+			return nil, fmt.Errorf("cannot copy %q: is a directory (set recursive to copy it)", data.SrcPath)
+		}
+		if isSubPath(src, dest) {
+			return nil, fmt.Errorf("cannot copy %q into itself", data.SrcPath)
+		}
+	}
+	if _, err := checkDestPath(srcInfo, dest, data.Overwrite); err != nil {
+		return nil, err
+	}
+	err = copyTree(ctx, src, dest)
+	if err != nil {
+		return nil, fmt.Errorf("cannot copy %q to %q: %w", data.SrcPath, data.DestPath, err)
+	}
+	return impl.fileInfoInternal(dest, false)
+}
+
+func (impl *ServerImpl) RemoteFileChmodCommand(ctx context.Context, data wshrpc.CommandRemoteFileChmodData) (*wshrpc.FileInfo, error) {
+	path := cleanPath(data.Path)
+	mode := data.Mode & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+	err := os.Chmod(path, mode)
+	if err != nil {
+		return nil, fmt.Errorf("cannot chmod %q: %w", data.Path, err)
+	}
+	return impl.fileInfoInternal(path, true)
+}
+
+// recursive deletes of a filesystem root or the home directory are refused
+func isProtectedPath(cleanedPath string) bool {
+	if cleanedPath == filepath.VolumeName(cleanedPath)+string(filepath.Separator) || cleanedPath == "." {
+		return true
+	}
+	homeDir := wavebase.GetHomeDir()
+	return homeDir != "" && cleanedPath == filepath.Clean(homeDir)
+}
+
+func (*ServerImpl) RemoteFileDeleteCommand(ctx context.Context, data wshrpc.CommandRemoteFileDeleteData) error {
+	cleanedPath := cleanPath(data.Path)
+	if !data.Recursive {
+		err := os.Remove(cleanedPath)
+		if err != nil {
+			if finfo, statErr := os.Lstat(cleanedPath); statErr == nil && finfo.IsDir() {
+				return fmt.Errorf("cannot delete directory %q: %w (set recursive to delete it and its contents)", data.Path, err)
+			}
+			return fmt.Errorf("cannot delete file %q: %w", data.Path, err)
+		}
+		return nil
+	}
+	if isProtectedPath(cleanedPath) {
+		return fmt.Errorf("refusing to recursively delete %q", data.Path)
+	}
+	if _, err := os.Lstat(cleanedPath); err != nil {
+		return fmt.Errorf("cannot delete %q: %w", data.Path, err)
+	}
+	err := os.RemoveAll(cleanedPath)
+	if err != nil {
+		return fmt.Errorf("cannot delete %q: %w", data.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func writeTestFile(t *testing.T, path string, content string) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatalf("error creating dir: %v", err)
+	}
+	err = os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+}
+
+func listNames(rtn *wshrpc.CommandRemoteListDirRtnData) []string {
+	var names []string
+	for _, entry := range rtn.Entries {
+		names = append(names, entry.Name)
+	}
+	return names
+}
+
+func TestRemoteListDir(t *testing.T) {
+	ctx := context.Background()
+	impl := &ServerImpl{}
+	tmpDir := t.TempDir()
+	writeTestFile(t, filepath.Join(tmpDir, "b.txt"), "bb")
+	writeTestFile(t, filepath.Join(tmpDir, "A.txt"), "aaaa")
+	writeTestFile(t, filepath.Join(tmpDir, "c.txt"), "c")
+	writeTestFile(t, filepath.Join(tmpDir, ".hidden"), "")
+	writeTestFile(t, filepath.Join(tmpDir, "zdir", "inner.txt"), "")
+	os.Chtimes(filepath.Join(tmpDir, "c.txt"), time.Now(), time.Now().Add(-time.Hour))
+
+	rtn, err := impl.RemoteListDirCommand(ctx, wshrpc.CommandRemoteListDirData{Path: tmpDir, DirsFirst: true, NoHidden: true})
+	if err != nil {
+		t.Fatalf("error listing dir: %v", err)
+	}
+	if got := listNames(rtn); len(got) != 4 || got[0] != "zdir" || got[1] != "A.txt" || got[2] != "b.txt" || got[3] != "c.txt" {
+		t.Errorf("unexpected order (dirs first, case-insensitive names): %v", got)
+	}
+	if rtn.Total != 4 || rtn.HasMore || !rtn.Dir.IsDir {
+		t.Errorf("unexpected total/hasmore/dir: %d %v %v", rtn.Total, rtn.HasMore, rtn.Dir.IsDir)
+	}
+
+	rtn, err = impl.RemoteListDirCommand(ctx, wshrpc.CommandRemoteListDirData{Path: tmpDir, SortBy: wshrpc.ListDirSort_Size, SortDesc: true, Offset: 1, Limit: 2})
+	if err != nil {
+		t.Fatalf("error listing dir: %v", err)
+	}
+	// sizes: A=4, b=2, c=1, .hidden=0, zdir=-1
+	if got := listNames(rtn); len(got) != 2 || got[0] != "b.txt" || got[1] != "c.txt" {
+		t.Errorf("unexpected page sorted by size: %v", got)
+	}
+	if rtn.Total != 5 || !rtn.HasMore {
+		t.Errorf("expected 5 entries with more pages, got %d %v", rtn.Total, rtn.HasMore)
+	}
+
+	rtn, err = impl.RemoteListDirCommand(ctx, wshrpc.CommandRemoteListDirData{Path: tmpDir, SortBy: wshrpc.ListDirSort_ModTime, NoHidden: true, Limit: 1})
+	if err != nil {
+		t.Fatalf("error listing dir: %v", err)
+	}
+	if got := listNames(rtn); len(got) != 1 || got[0] != "c.txt" {
+		t.Errorf("expected the oldest file first, got %v", got)
+	}
+
+	if _, err := impl.RemoteListDirCommand(ctx, wshrpc.CommandRemoteListDirData{Path: tmpDir, SortBy: "color"}); err == nil {
+		t.Errorf("expected an error for an invalid sort")
+	}
+	if _, err := impl.RemoteListDirCommand(ctx, wshrpc.CommandRemoteListDirData{Path: filepath.Join(tmpDir, "b.txt")}); err == nil {
+		t.Errorf("expected an error listing a file")
+	}
+}
+
+func TestRemoteFileOps(t *testing.T) {
+	ctx := context.Background()
+	impl := &ServerImpl{}
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	writeTestFile(t, filepath.Join(srcDir, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(srcDir, "sub", "b.txt"), "b")
+	err := os.Symlink("a.txt", filepath.Join(srcDir, "link"))
+	if err != nil {
+		t.Fatalf("error creating symlink: %v", err)
+	}
+
+	// mkdir
+	newDir := filepath.Join(tmpDir, "x", "y")
+	if _, err := impl.RemoteMkdirCommand(ctx, wshrpc.CommandRemoteMkdirData{Path: newDir}); err == nil {
+		t.Errorf("mkdir without parents should fail when the parent is missing")
+	}
+	finfo, err := impl.RemoteMkdirCommand(ctx, wshrpc.CommandRemoteMkdirData{Path: newDir, Parents: true})
+	if err != nil || !finfo.IsDir {
+		t.Fatalf("mkdir with parents failed: %v", err)
+	}
+
+	// copy
+	destDir := filepath.Join(tmpDir, "dest")
+	if _, err := impl.RemoteFileCopyCommand(ctx, wshrpc.CommandRemoteFileCopyData{SrcPath: srcDir, DestPath: destDir}); err == nil {
+		t.Errorf("copying a directory should require recursive")
+	}
+	if _, err := impl.RemoteFileCopyCommand(ctx, wshrpc.CommandRemoteFileCopyData{SrcPath: srcDir, DestPath: filepath.Join(srcDir, "sub", "copy"), Recursive: true}); err == nil {
+		t.Errorf("copying a directory into itself should fail")
+	}
+	_, err = impl.RemoteFileCopyCommand(ctx, wshrpc.CommandRemoteFileCopyData{SrcPath: srcDir, DestPath: destDir, Recursive: true})
+	if err != nil {
+		t.Fatalf("recursive copy failed: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(destDir, "sub", "b.txt")); err != nil || string(data) != "b" {
+		t.Errorf("nested file not copied: %q %v", data, err)
+	}
+	if target, err := os.Readlink(filepath.Join(destDir, "link")); err != nil || target != "a.txt" {
+		t.Errorf("symlink not copied as a link: %q %v", target, err)
+	}
+	if _, err := impl.RemoteFileCopyCommand(ctx, wshrpc.CommandRemoteFileCopyData{SrcPath: filepath.Join(srcDir, "a.txt"), DestPath: filepath.Join(destDir, "sub", "b.txt")}); err == nil {
+		t.Errorf("copy should not overwrite without overwrite")
+	}
+
+	// rename
+	renamed := filepath.Join(tmpDir, "renamed.txt")
+	finfo, err = impl.RemoteFileRenameCommand(ctx, wshrpc.CommandRemoteFileRenameData{SrcPath: filepath.Join(destDir, "a.txt"), DestPath: renamed})
+	if err != nil || finfo.Name != "renamed.txt" {
+		t.Fatalf("rename failed: %v", err)
+	}
+	if _, err := impl.RemoteFileRenameCommand(ctx, wshrpc.CommandRemoteFileRenameData{SrcPath: renamed, DestPath: filepath.Join(destDir, "sub", "b.txt")}); err == nil {
+		t.Errorf("rename should not overwrite without overwrite")
+	}
+	if _, err := impl.RemoteFileRenameCommand(ctx, wshrpc.CommandRemoteFileRenameData{SrcPath: renamed, DestPath: filepath.Join(destDir, "sub", "b.txt"), Overwrite: true}); err != nil {
+		t.Errorf("rename with overwrite failed: %v", err)
+	}
+
+	// chmod
+	finfo, err = impl.RemoteFileChmodCommand(ctx, wshrpc.CommandRemoteFileChmodData{Path: filepath.Join(destDir, "sub", "b.txt"), Mode: 0600})
+	if err != nil || finfo.Mode.Perm() != 0600 {
+		t.Errorf("chmod failed: %v", err)
+	}
+
+	// delete
+	if err := impl.RemoteFileDeleteCommand(ctx, wshrpc.CommandRemoteFileDeleteData{Path: destDir}); err == nil {
+		t.Errorf("deleting a non-empty directory should require recursive")
+	}
+	if err := impl.RemoteFileDeleteCommand(ctx, wshrpc.CommandRemoteFileDeleteData{Path: destDir, Recursive: true}); err != nil {
+		t.Errorf("recursive delete failed: %v", err)
+	}
+	if _, err := os.Stat(destDir); !os.IsNotExist(err) {
+		t.Errorf("directory still exists after recursive delete")
+	}
+	if err := impl.RemoteFileDeleteCommand(ctx, wshrpc.CommandRemoteFileDeleteData{Path: "/", Recursive: true}); err == nil {
+		t.Errorf("recursive delete of / should be refused")
+	}
+	if err := impl.RemoteFileDeleteCommand(ctx, wshrpc.CommandRemoteFileDeleteData{Path: "~", Recursive: true}); err == nil {
+		t.Errorf("recursive delete of the home directory should be refused")
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshrpc
+
+// rpc capabilities are encoded in the jwt token (RpcContext.Caps) and enforced by the router (see wshutil/wshauth.go)
+// a token without caps (legacy) has full access
+
+const (
+	Cap_All       = "*"
+	Cap_Read      = "read"       // read-only commands (metadata, files, event history, connection status)
+	Cap_Events    = "events"     // publish and subscribe to events
+	Cap_Block     = "block"      // create, modify, and delete any block (and its files)
+	Cap_BlockSelf = "block:self" // like Cap_Block, but only for the caller's own block/tab (connservers: blocks on their connection)
+	Cap_Config    = "config"     // change settings
+	Cap_Conn      = "conn"       // connect, disconnect, and reinstall connections
+	Cap_Remote    = "remote"     // remote file and sysinfo commands on any connection (Cap_BlockSelf allows the caller's own connection)
+)
+
+// default caps for remote connections (and blocks running on them), can be changed with the conn:rpccaps settings
+var DefaultRemoteCaps = []string{Cap_Read, Cap_Events, Cap_BlockSelf}
+
+// default caps for gateway api tokens
+var DefaultApiTokenCaps = []string{Cap_Read, Cap_Events}
+
+var allCaps = map[string]bool{
+	Cap_All:       true,
+	Cap_Read:      true,
+	Cap_Events:    true,
+	Cap_Block:     true,
+	Cap_BlockSelf: true,
+	Cap_Config:    true,
+	Cap_Conn:      true,
+	Cap_Remote:    true,
+}
+
+func IsValidCap(cap string) bool {
+	return allCaps[cap]
+}
+
+// every command should be listed here (commands that are not in this map require Cap_All)
+// callers limited to their own blocks (Cap_BlockSelf without Cap_Block) can only use the block read commands
+// (files, meta, block info) and block-scoped events (history, subscribe, publish) on their own blocks, see wshutil/wshauth.go
+var CommandCaps = map[string]string{
+	Command_Authenticate:    "",
+	Command_RouteAnnounce:   "",
+	Command_RouteUnannounce: "",
+	Command_RoutePing:       "",
+	Command_EventRecv:       "",
+
+	// the refreshed token has the same claims as the caller's token
+	Command_AuthRefresh: "",
+
+	Command_Message:            Cap_Read,
+	Command_GetMeta:            Cap_Read,
+	Command_ResolveIds:         Cap_Read,
+	Command_BlockInfo:          Cap_Read,
+	Command_FileRead:           Cap_Read,
+	Command_FileListVersions:   Cap_Read,
+	Command_FileReadVersion:    Cap_Read,
+	Command_EventReadHistory:   Cap_Read,
+	Command_EventRetentionList: Cap_Read,
+	Command_ConnStatus:         Cap_Read,
+	Command_ConnList:           Cap_Read,
+	Command_StreamCpuData:      Cap_Read,
+	Command_Test:               Cap_Read,
+	Command_StreamTest:         Cap_Read,
+
+	Command_EventPublish:  Cap_Events,
+	Command_EventSub:      Cap_Events,
+	Command_EventUnsub:    Cap_Events,
+	Command_EventUnsubAll: Cap_Events,
+
+	Command_SetMeta:            Cap_Block,
+	Command_SetView:            Cap_Block,
+	Command_ControllerInput:    Cap_Block,
+	Command_ControllerStop:     Cap_Block,
+	Command_ControllerRestart:  Cap_Block,
+	Command_ControllerResync:   Cap_Block,
+	Command_FileAppend:         Cap_Block,
+	Command_FileAppendIJson:    Cap_Block,
+	Command_FileWrite:          Cap_Block,
+	Command_FileRestoreVersion: Cap_Block,
+	Command_CreateBlock:        Cap_Block,
+	Command_DeleteBlock:        Cap_Block,
+
+	Command_SetConfig:         Cap_Config,
+	Command_EventRetentionSet: Cap_Config,
+
+	Command_ConnEnsure:       Cap_Conn,
+	Command_ConnReinstallWsh: Cap_Conn,
+	Command_ConnConnect:      Cap_Conn,
+	Command_ConnDisconnect:   Cap_Conn,
+
+	Command_ConnForwardAdd:    Cap_Conn,
+	Command_ConnForwardRemove: Cap_Conn,
+	Command_ConnForwardList:   Cap_Read,
+
+	// reads and writes files on both connections
+	Command_ConnCopyFile: Cap_Remote,
+
+	// the nested tokens never have more caps than the caller
+	Command_ConnNestedTokens: "",
+
+	Command_RemoteStreamFile:    Cap_Remote,
+	Command_RemoteFileInfo:      Cap_Remote,
+	Command_RemoteWriteFile:     Cap_Remote,
+	Command_RemoteFileDelete:    Cap_Remote,
+	Command_RemoteFileJoiin:     Cap_Remote,
+	Command_RemoteStreamCpuData: Cap_Remote,
+
+	Command_RemoteWriteFileStream: Cap_Remote,
+
+	Command_RemoteListDir:    Cap_Remote,
+	Command_RemoteMkdir:      Cap_Remote,
+	Command_RemoteFileRename: Cap_Remote,
+	Command_RemoteFileCopy:   Cap_Remote,
+	Command_RemoteFileChmod:  Cap_Remote,
+
+	// admin/debug commands (and ui-only commands)
+	Command_ApiTokenCreate:  Cap_All,
+	Command_ApiTokenList:    Cap_All,
+	Command_ApiTokenDelete:  Cap_All,
+	Command_EventQueueStats: Cap_All,
+	Command_RpcStats:        Cap_All,
+	Command_RpcTrace:        Cap_All,
+	Command_StreamWaveAi:    Cap_All,
+	Command_WebSelector:     Cap_All,
+}
+
+// returns the cap required for the command ("" means always allowed)
+func GetCommandCap(command string) string {
+	cap, ok := CommandCaps[command]
+	if !ok {
+		return Cap_All
+	}
+	return cap
+}
+
+// nil caps (legacy tokens) have full access
+func HasCap(caps []string, cap string) bool {
+	if caps == nil || cap == "" {
+		return true
+	}
+	for _, c := range caps {
+		if c == Cap_All || c == cap {
+			return true
+		}
+		if c == Cap_Block && cap == Cap_BlockSelf {
+			return true
+		}
+	}
+	return false
+}
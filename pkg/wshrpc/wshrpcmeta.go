@@ -16,6 +16,7 @@ type WshRpcMethodDecl struct {
 	CommandType             string
 	MethodName              string
 	CommandDataType         reflect.Type
+	RequestStreamDataType   reflect.Type // data type of the request stream (streaming requests)
 	DefaultResponseDataType reflect.Type
 }
 
@@ -23,6 +24,10 @@ var contextRType = reflect.TypeOf((*context.Context)(nil)).Elem()
 var wshRpcInterfaceRType = reflect.TypeOf((*WshRpcInterface)(nil)).Elem()
 
 func getWshCommandType(method reflect.Method) string {
+	// streaming requests take the request stream after the command data (ctx, data, reqCh)
+	if method.Type.NumIn() == 3 && method.Type.In(2).Kind() == reflect.Chan {
+		return RpcType_StreamingRequest
+	}
 	if method.Type.NumOut() == 1 {
 		outType := method.Type.Out(0)
 		if outType.Kind() == reflect.Chan {
@@ -32,6 +37,23 @@ func getWshCommandType(method reflect.Method) string {
 	return RpcType_Call
 }
 
+// the request stream is a <-chan RespOrErrorUnion[T], returns T
+func getWshMethodRequestStreamType(method reflect.Method) reflect.Type {
+	reqChType := method.Type.In(2)
+	if reqChType.ChanDir() != reflect.RecvDir {
+		panic(fmt.Sprintf("method %q has invalid request stream type %s (should be <-chan)", method.Name, reqChType))
+	}
+	elemType := reqChType.Elem()
+	if !strings.HasPrefix(elemType.Name(), "RespOrErrorUnion") {
+		panic(fmt.Sprintf("method %q has invalid request stream element type %s (should be RespOrErrorUnion)", method.Name, elemType))
+	}
+	respField, found := elemType.FieldByName("Response")
+	if !found {
+		panic(fmt.Sprintf("method %q has invalid request stream element type %s (missing Response field)", method.Name, elemType))
+	}
+	return respField.Type
+}
+
 func getWshMethodResponseType(commandType string, method reflect.Method) reflect.Type {
 	switch commandType {
 	case RpcType_ResponseStream:
@@ -51,7 +73,7 @@ func getWshMethodResponseType(commandType string, method reflect.Method) reflect
 			panic(fmt.Sprintf("method %q has invalid return element type %s for response stream (missing Response field)", method.Name, elemType))
 		}
 		return respField.Type
-	case RpcType_Call:
+	case RpcType_Call, RpcType_StreamingRequest:
 		if method.Type.NumOut() > 1 {
 			return method.Type.Out(0)
 		}
@@ -80,6 +102,9 @@ func generateWshCommandDecl(method reflect.Method) *WshRpcMethodDecl {
 		cdataType = method.Type.In(1)
 	}
 	decl.CommandDataType = cdataType
+	if decl.CommandType == RpcType_StreamingRequest {
+		decl.RequestStreamDataType = getWshMethodRequestStreamType(method)
+	}
 	decl.DefaultResponseDataType = getWshMethodResponseType(decl.CommandType, method)
 	return decl
 }
@@ -26,48 +26,83 @@ const (
 )
 
 const (
-	Command_Authenticate      = "authenticate"    // special
-	Command_RouteAnnounce     = "routeannounce"   // special (for routing)
-	Command_RouteUnannounce   = "routeunannounce" // special (for routing)
-	Command_Message           = "message"
-	Command_GetMeta           = "getmeta"
-	Command_SetMeta           = "setmeta"
-	Command_SetView           = "setview"
-	Command_ControllerInput   = "controllerinput"
-	Command_ControllerRestart = "controllerrestart"
-	Command_ControllerStop    = "controllerstop"
-	Command_ControllerResync  = "controllerresync"
-	Command_FileAppend        = "fileappend"
-	Command_FileAppendIJson   = "fileappendijson"
-	Command_ResolveIds        = "resolveids"
-	Command_BlockInfo         = "blockinfo"
-	Command_CreateBlock       = "createblock"
-	Command_DeleteBlock       = "deleteblock"
-	Command_FileWrite         = "filewrite"
-	Command_FileRead          = "fileread"
-	Command_EventPublish      = "eventpublish"
-	Command_EventRecv         = "eventrecv"
-	Command_EventSub          = "eventsub"
-	Command_EventUnsub        = "eventunsub"
-	Command_EventUnsubAll     = "eventunsuball"
-	Command_EventReadHistory  = "eventreadhistory"
-	Command_StreamTest        = "streamtest"
-	Command_StreamWaveAi      = "streamwaveai"
-	Command_StreamCpuData     = "streamcpudata"
-	Command_Test              = "test"
-	Command_RemoteStreamFile  = "remotestreamfile"
-	Command_RemoteFileInfo    = "remotefileinfo"
-	Command_RemoteWriteFile   = "remotewritefile"
-	Command_RemoteFileDelete  = "remotefiledelete"
-	Command_RemoteFileJoiin   = "remotefilejoin"
-
+	Command_Authenticate       = "authenticate"    // special
+	Command_RouteAnnounce      = "routeannounce"   // special (for routing)
+	Command_RouteUnannounce    = "routeunannounce" // special (for routing)
+	Command_RoutePing          = "routeping"       // special (router keepalive, see wshutil/wshkeepalive.go)
+	Command_Message            = "message"
+	Command_GetMeta            = "getmeta"
+	Command_SetMeta            = "setmeta"
+	Command_SetView            = "setview"
+	Command_ControllerInput    = "controllerinput"
+	Command_ControllerRestart  = "controllerrestart"
+	Command_ControllerStop     = "controllerstop"
+	Command_ControllerResync   = "controllerresync"
+	Command_FileAppend         = "fileappend"
+	Command_FileAppendIJson    = "fileappendijson"
+	Command_ResolveIds         = "resolveids"
+	Command_BlockInfo          = "blockinfo"
+	Command_CreateBlock        = "createblock"
+	Command_DeleteBlock        = "deleteblock"
+	Command_FileWrite          = "filewrite"
+	Command_FileRead           = "fileread"
+	Command_FileListVersions   = "filelistversions"
+	Command_FileReadVersion    = "filereadversion"
+	Command_FileRestoreVersion = "filerestoreversion"
+	Command_EventPublish       = "eventpublish"
+	Command_EventRecv          = "eventrecv"
+	Command_EventSub           = "eventsub"
+	Command_EventUnsub         = "eventunsub"
+	Command_EventUnsubAll      = "eventunsuball"
+	Command_EventReadHistory   = "eventreadhistory"
+	Command_EventRetentionSet  = "eventretentionset"
+	Command_EventRetentionList = "eventretentionlist"
+	Command_StreamTest         = "streamtest"
+	Command_StreamWaveAi       = "streamwaveai"
+	Command_StreamCpuData      = "streamcpudata"
+	Command_Test               = "test"
+	Command_RemoteStreamFile   = "remotestreamfile"
+	Command_RemoteFileInfo     = "remotefileinfo"
+	Command_RemoteWriteFile    = "remotewritefile"
+	Command_RemoteFileDelete   = "remotefiledelete"
+	Command_RemoteFileJoiin    = "remotefilejoin"
+	Command_SetConfig          = "setconfig"
+
+	Command_ConnStatus       = "connstatus"
 	Command_ConnEnsure       = "connensure"
 	Command_ConnReinstallWsh = "connreinstallwsh"
 	Command_ConnConnect      = "connconnect"
 	Command_ConnDisconnect   = "conndisconnect"
 	Command_ConnList         = "connlist"
+	Command_ConnNestedTokens = "connnestedtokens"
+
+	Command_ConnForwardAdd    = "connforwardadd"
+	Command_ConnForwardList   = "connforwardlist"
+	Command_ConnForwardRemove = "connforwardremove"
+
+	Command_ConnCopyFile = "conncopyfile"
+
+	Command_RemoteStreamCpuData = "remotestreamcpudata"
+
+	Command_RemoteWriteFileStream = "remotewritefilestream"
+
+	Command_RemoteListDir    = "remotelistdir"
+	Command_RemoteMkdir      = "remotemkdir"
+	Command_RemoteFileRename = "remotefilerename"
+	Command_RemoteFileCopy   = "remotefilecopy"
+	Command_RemoteFileChmod  = "remotefilechmod"
 
 	Command_WebSelector = "webselector"
+
+	Command_EventQueueStats = "eventqueuestats"
+	Command_RpcStats        = "rpcstats"
+	Command_RpcTrace        = "rpctrace"
+
+	Command_ApiTokenCreate = "apitokencreate"
+	Command_ApiTokenList   = "apitokenlist"
+	Command_ApiTokenDelete = "apitokendelete"
+
+	Command_AuthRefresh = "authrefresh"
 )
 
 type RespOrErrorUnion[T any] struct {
@@ -79,6 +114,7 @@ type WshRpcInterface interface {
 	AuthenticateCommand(ctx context.Context, data string) (CommandAuthenticateRtnData, error)
 	RouteAnnounceCommand(ctx context.Context) error   // (special) announces a new route to the main router
 	RouteUnannounceCommand(ctx context.Context) error // (special) unannounces a route to the main router
+	RoutePingCommand(ctx context.Context) error       // (special) keepalive ping from the router, answered by WshRpc itself
 
 	MessageCommand(ctx context.Context, data CommandMessageData) error
 	GetMetaCommand(ctx context.Context, data CommandGetMetaData) (waveobj.MetaMapType, error)
@@ -93,12 +129,17 @@ type WshRpcInterface interface {
 	CreateBlockCommand(ctx context.Context, data CommandCreateBlockData) (waveobj.ORef, error)
 	DeleteBlockCommand(ctx context.Context, data CommandDeleteBlockData) error
 	FileWriteCommand(ctx context.Context, data CommandFileData) error
-	FileReadCommand(ctx context.Context, data CommandFileData) (string, error)
+	FileReadCommand(ctx context.Context, data CommandFileData) ([]byte, error)
+	FileListVersionsCommand(ctx context.Context, data CommandFileData) ([]*FileVersionInfo, error)
+	FileReadVersionCommand(ctx context.Context, data CommandFileVersionData) (string, error)
+	FileRestoreVersionCommand(ctx context.Context, data CommandFileVersionData) error
 	EventPublishCommand(ctx context.Context, data wps.WaveEvent) error
 	EventSubCommand(ctx context.Context, data wps.SubscriptionRequest) error
 	EventUnsubCommand(ctx context.Context, data string) error
 	EventUnsubAllCommand(ctx context.Context) error
 	EventReadHistoryCommand(ctx context.Context, data CommandEventReadHistoryData) ([]*wps.WaveEvent, error)
+	EventRetentionSetCommand(ctx context.Context, data EventRetention) error
+	EventRetentionListCommand(ctx context.Context) ([]EventRetention, error)
 	StreamTestCommand(ctx context.Context) chan RespOrErrorUnion[int]
 	StreamWaveAiCommand(ctx context.Context, request OpenAiStreamRequest) chan RespOrErrorUnion[OpenAIPacketType]
 	StreamCpuDataCommand(ctx context.Context, request CpuDataRequest) chan RespOrErrorUnion[TimeSeriesData]
@@ -113,6 +154,11 @@ type WshRpcInterface interface {
 	ConnConnectCommand(ctx context.Context, connName string) error
 	ConnDisconnectCommand(ctx context.Context, connName string) error
 	ConnListCommand(ctx context.Context) ([]string, error)
+	ConnNestedTokensCommand(ctx context.Context, data CommandConnNestedTokensData) (CommandConnNestedTokensRtnData, error)
+	ConnForwardAddCommand(ctx context.Context, data CommandConnForwardAddData) (*ConnForward, error)
+	ConnForwardListCommand(ctx context.Context, connName string) ([]ConnForward, error)
+	ConnForwardRemoveCommand(ctx context.Context, data CommandConnForwardRemoveData) error
+	ConnCopyFileCommand(ctx context.Context, data CommandConnCopyFileData) chan RespOrErrorUnion[ConnCopyFileProgress]
 
 	// eventrecv is special, it's handled internally by WshRpc with EventListener
 	EventRecvCommand(ctx context.Context, data wps.WaveEvent) error
@@ -120,12 +166,31 @@ type WshRpcInterface interface {
 	// remotes
 	RemoteStreamFileCommand(ctx context.Context, data CommandRemoteStreamFileData) chan RespOrErrorUnion[CommandRemoteStreamFileRtnData]
 	RemoteFileInfoCommand(ctx context.Context, path string) (*FileInfo, error)
-	RemoteFileDeleteCommand(ctx context.Context, path string) error
+	RemoteFileDeleteCommand(ctx context.Context, data CommandRemoteFileDeleteData) error
 	RemoteWriteFileCommand(ctx context.Context, data CommandRemoteWriteFileData) error
+	RemoteWriteFileStreamCommand(ctx context.Context, data CommandRemoteWriteFileStreamData, reqCh <-chan RespOrErrorUnion[CommandFileChunkData]) (*FileInfo, error)
 	RemoteFileJoinCommand(ctx context.Context, paths []string) (*FileInfo, error)
 	RemoteStreamCpuDataCommand(ctx context.Context) chan RespOrErrorUnion[TimeSeriesData]
+	RemoteListDirCommand(ctx context.Context, data CommandRemoteListDirData) (*CommandRemoteListDirRtnData, error)
+	RemoteMkdirCommand(ctx context.Context, data CommandRemoteMkdirData) (*FileInfo, error)
+	RemoteFileRenameCommand(ctx context.Context, data CommandRemoteFileRenameData) (*FileInfo, error)
+	RemoteFileCopyCommand(ctx context.Context, data CommandRemoteFileCopyData) (*FileInfo, error)
+	RemoteFileChmodCommand(ctx context.Context, data CommandRemoteFileChmodData) (*FileInfo, error)
 
 	WebSelectorCommand(ctx context.Context, data CommandWebSelectorData) ([]string, error)
+
+	// debug
+	EventQueueStatsCommand(ctx context.Context) ([]EventQueueStats, error)
+	RpcStatsCommand(ctx context.Context, data CommandRpcStatsData) ([]RpcCommandStats, error)
+	RpcTraceCommand(ctx context.Context, data CommandRpcTraceData) (string, error)
+
+	// api tokens for the local rpc gateway
+	ApiTokenCreateCommand(ctx context.Context, data CommandApiTokenCreateData) (*CommandApiTokenCreateRtnData, error)
+	ApiTokenListCommand(ctx context.Context) ([]ApiTokenInfo, error)
+	ApiTokenDeleteCommand(ctx context.Context, tokenId string) error
+
+	// returns a new WAVETERM_JWT for the caller's (unexpired) token
+	AuthRefreshCommand(ctx context.Context, data string) (string, error)
 }
 
 // for frontend
@@ -144,13 +209,15 @@ type RpcOpts struct {
 const (
 	ClientType_ConnServer      = "connserver"
 	ClientType_BlockController = "blockcontroller"
+	ClientType_Gateway         = "gateway" // external tools using an api token (see web/webgateway.go)
 )
 
 type RpcContext struct {
-	ClientType string `json:"ctype,omitempty"`
-	BlockId    string `json:"blockid,omitempty"`
-	TabId      string `json:"tabid,omitempty"`
-	Conn       string `json:"conn,omitempty"`
+	ClientType string   `json:"ctype,omitempty"`
+	BlockId    string   `json:"blockid,omitempty"`
+	TabId      string   `json:"tabid,omitempty"`
+	Conn       string   `json:"conn,omitempty"`
+	Caps       []string `json:"caps,omitempty"` // see wshrpccaps.go (nil means full access)
 }
 
 func HackRpcContextIntoData(dataPtr any, rpcContext RpcContext) {
@@ -243,6 +310,19 @@ type CommandFileData struct {
 	Data64   string `json:"data64,omitempty"`
 }
 
+type CommandFileVersionData struct {
+	ZoneId   string `json:"zoneid" wshcontext:"BlockId"`
+	FileName string `json:"filename"`
+	Version  int    `json:"version"`
+}
+
+type FileVersionInfo struct {
+	Version   int   `json:"version"`
+	Size      int64 `json:"size"`
+	ModTs     int64 `json:"modts"`
+	CreatedTs int64 `json:"createdts"`
+}
+
 type CommandAppendIJsonData struct {
 	ZoneId   string        `json:"zoneid" wshcontext:"BlockId"`
 	FileName string        `json:"filename"`
@@ -259,6 +339,14 @@ type CommandEventReadHistoryData struct {
 	MaxItems int    `json:"maxitems"`
 }
 
+// durable (sqlite) history settings for an event, MaxItems <= 0 removes the setting and its stored events
+type EventRetention struct {
+	Event    string `json:"event"`
+	Scope    string `json:"scope,omitempty"` // "" is the default for all scopes of the event
+	MaxItems int    `json:"maxitems"`
+	MaxAgeMs int64  `json:"maxagems,omitempty"` // 0 means no age limit
+}
+
 type OpenAiStreamRequest struct {
 	ClientId string                    `json:"clientid,omitempty"`
 	Opts     *OpenAIOptsType           `json:"opts"`
@@ -326,17 +414,107 @@ type CommandRemoteStreamFileData struct {
 	ByteRange string `json:"byterange,omitempty"`
 }
 
+// Data is sent as a binary frame payload when possible (base64 in json)
 type CommandRemoteStreamFileRtnData struct {
 	FileInfo []*FileInfo `json:"fileinfo,omitempty"`
-	Data64   string      `json:"data64,omitempty"`
+	Data     []byte      `json:"data64,omitempty" wshbinary:"true"`
 }
 
 type CommandRemoteWriteFileData struct {
 	Path       string      `json:"path"`
-	Data64     string      `json:"data64"`
+	Data       []byte      `json:"data64,omitempty" wshbinary:"true"`
 	CreateMode os.FileMode `json:"createmode,omitempty"`
 }
 
+// the file is written to a temp file (in the same directory) and renamed when the stream is done
+type CommandRemoteWriteFileStreamData struct {
+	Path       string      `json:"path"`
+	Size       int64       `json:"size,omitempty"` // expected size (checked if set, includes Offset)
+	CreateMode os.FileMode `json:"createmode,omitempty"`
+	Partial    bool        `json:"partial,omitempty"` // write through <path>.wavepart, which is kept if the write fails
+	Offset     int64       `json:"offset,omitempty"`  // with Partial, the stream continues the partial file at Offset
+}
+
+// copies a file between connections ("local" is the wave host).  the last progress update has Done set.
+type CommandConnCopyFileData struct {
+	SrcConn   string `json:"srcconn"`
+	SrcPath   string `json:"srcpath"`
+	DestConn  string `json:"destconn"`
+	DestPath  string `json:"destpath"` // if this is a directory, the file is copied into it
+	Overwrite bool   `json:"overwrite,omitempty"`
+	Resume    bool   `json:"resume,omitempty"` // continue from the partial file left by a failed copy
+}
+
+type ConnCopyFileProgress struct {
+	DestPath    string    `json:"destpath"` // resolved destination path
+	Size        int64     `json:"size"`
+	Copied      int64     `json:"copied"` // includes ResumedFrom
+	ResumedFrom int64     `json:"resumedfrom,omitempty"`
+	Done        bool      `json:"done,omitempty"`
+	FileInfo    *FileInfo `json:"fileinfo,omitempty"` // the destination file (set with Done)
+}
+
+// suffix for the partial file of a resumable write (see CommandRemoteWriteFileStreamData.Partial)
+const PartialFileSuffix = ".wavepart"
+
+type CommandFileChunkData struct {
+	Data []byte `json:"data64,omitempty" wshbinary:"true"`
+}
+
+type CommandRemoteFileDeleteData struct {
+	Path      string `json:"path"`
+	Recursive bool   `json:"recursive,omitempty"` // required to delete a non-empty directory
+}
+
+const (
+	ListDirSort_Name     = "name"
+	ListDirSort_Size     = "size"
+	ListDirSort_ModTime  = "modtime"
+	ListDirSort_MimeType = "mimetype"
+)
+
+type CommandRemoteListDirData struct {
+	Path      string `json:"path"`
+	Offset    int    `json:"offset,omitempty"`
+	Limit     int    `json:"limit,omitempty"`  // 0 means the default page size (see wshremote.DefaultListDirLimit)
+	SortBy    string `json:"sortby,omitempty"` // ListDirSort_* (default name)
+	SortDesc  bool   `json:"sortdesc,omitempty"`
+	DirsFirst bool   `json:"dirsfirst,omitempty"`
+	NoHidden  bool   `json:"nohidden,omitempty"` // skip dotfiles
+}
+
+type CommandRemoteListDirRtnData struct {
+	Dir     *FileInfo   `json:"dir"`
+	Entries []*FileInfo `json:"entries"`
+	Total   int         `json:"total"` // number of entries in the directory (after NoHidden)
+	HasMore bool        `json:"hasmore,omitempty"`
+}
+
+type CommandRemoteMkdirData struct {
+	Path    string      `json:"path"`
+	Parents bool        `json:"parents,omitempty"` // like mkdir -p (creates parents, no error if the directory exists)
+	Mode    os.FileMode `json:"mode,omitempty"`    // default 0755
+}
+
+type CommandRemoteFileRenameData struct {
+	SrcPath   string `json:"srcpath"`
+	DestPath  string `json:"destpath"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+}
+
+// copies on the same host (directories are copied recursively, symlinks are copied as links)
+type CommandRemoteFileCopyData struct {
+	SrcPath   string `json:"srcpath"`
+	DestPath  string `json:"destpath"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+	Recursive bool   `json:"recursive,omitempty"` // required to copy a directory
+}
+
+type CommandRemoteFileChmodData struct {
+	Path string      `json:"path"`
+	Mode os.FileMode `json:"mode"` // permission bits (plus setuid, setgid and sticky)
+}
+
 const (
 	TimeSeries_Cpu = "cpu"
 )
@@ -347,12 +525,73 @@ type TimeSeriesData struct {
 }
 
 type ConnStatus struct {
-	Status        string `json:"status"`
-	Connection    string `json:"connection"`
-	Connected     bool   `json:"connected"`
-	HasConnected  bool   `json:"hasconnected"` // true if it has *ever* connected successfully
-	ActiveConnNum int    `json:"activeconnnum"`
-	Error         string `json:"error,omitempty"`
+	Status        string        `json:"status"`
+	Connection    string        `json:"connection"`
+	Connected     bool          `json:"connected"`
+	HasConnected  bool          `json:"hasconnected"` // true if it has *ever* connected successfully
+	ActiveConnNum int           `json:"activeconnnum"`
+	Error         string        `json:"error,omitempty"`
+	Forwards      []ConnForward `json:"forwards,omitempty"`
+
+	// set while an automatic reconnect is in progress (between attempts the status is disconnected, error or unresponsive)
+	Reconnecting         bool  `json:"reconnecting,omitempty"`
+	ReconnectAttempt     int   `json:"reconnectattempt,omitempty"`
+	ReconnectMaxAttempts int   `json:"reconnectmaxattempts,omitempty"`
+	NextReconnectTs      int64 `json:"nextreconnectts,omitempty"` // when the next attempt starts (0 while an attempt is running)
+
+	// display:name and display:color from connections.json
+	DisplayName  string `json:"displayname,omitempty"`
+	DisplayColor string `json:"displaycolor,omitempty"`
+}
+
+const (
+	ConnForwardType_Local   = "local"   // listens here, connects from the remote host (ssh -L)
+	ConnForwardType_Remote  = "remote"  // listens on the remote host, connects from here (ssh -R)
+	ConnForwardType_Dynamic = "dynamic" // socks5 proxy listening here, connects from the remote host (ssh -D)
+)
+
+const (
+	ConnForwardStatus_Active   = "active"
+	ConnForwardStatus_Inactive = "inactive" // the connection is not connected (forwards are started on connect)
+	ConnForwardStatus_Error    = "error"
+)
+
+type ConnForwardSpec struct {
+	Type       string `json:"type"`
+	ListenAddr string `json:"listenaddr"`           // host:port
+	TargetAddr string `json:"targetaddr,omitempty"` // host:port (not used for dynamic forwards)
+}
+
+type ConnForward struct {
+	ForwardId   string          `json:"forwardid"`
+	Spec        ConnForwardSpec `json:"spec"`
+	FromConfig  bool            `json:"fromconfig,omitempty"` // from ssh_config (reloaded on every connect)
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	BoundAddr   string          `json:"boundaddr,omitempty"` // the address actually listened on (port 0 picks a free port)
+	ActiveConns int             `json:"activeconns"`
+}
+
+type CommandConnForwardAddData struct {
+	ConnName string          `json:"connname"`
+	Spec     ConnForwardSpec `json:"spec"`
+}
+
+type CommandConnForwardRemoveData struct {
+	ConnName  string `json:"connname"`
+	ForwardId string `json:"forwardid"`
+}
+
+// for nested connections (ssh from a wave block to another host), see wshutil/wshsubrouter.go
+type CommandConnNestedTokensData struct {
+	Host     string `json:"host"`
+	SockName string `json:"sockname"` // the domain socket on the nested host (forwarded to the sub-router)
+}
+
+type CommandConnNestedTokensRtnData struct {
+	Conn            string `json:"conn"`
+	ConnServerToken string `json:"connservertoken"`
+	ShellToken      string `json:"shelltoken"`
 }
 
 type WebSelectorOpts struct {
@@ -374,3 +613,59 @@ type BlockInfoData struct {
 	WindowId string              `json:"windowid"`
 	Meta     waveobj.MetaMapType `json:"meta"`
 }
+
+// per-route event delivery stats (from the router)
+type EventQueueStats struct {
+	RouteId    string `json:"routeid"`
+	QueueDepth int    `json:"queuedepth"`
+	MaxDepth   int    `json:"maxdepth"`
+	Sent       int64  `json:"sent"`
+	Dropped    int64  `json:"dropped"`   // dropped because the queue was full
+	Coalesced  int64  `json:"coalesced"` // replaced by a newer event because the queue was full
+	Delayed    int64  `json:"delayed"`   // sent more than 1s after being queued
+}
+
+// upper bounds (inclusive) of the rpc latency histogram buckets, the last bucket in RpcCommandStats.Histogram is for everything above
+var RpcLatencyBucketsMs = []int64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+type RpcCommandStats struct {
+	Command    string  `json:"command"`
+	Count      int64   `json:"count"`
+	Errors     int64   `json:"errors"`
+	NoResponse int64   `json:"noresponse"` // commands sent without a reqid (not included in the latency stats)
+	Pending    int64   `json:"pending"`    // requests still waiting for a response
+	TotalMs    int64   `json:"totalms"`
+	MaxMs      int64   `json:"maxms"`
+	P50Ms      int64   `json:"p50ms"` // estimated from the histogram (bucket upper bound)
+	P95Ms      int64   `json:"p95ms"`
+	ReqBytes   int64   `json:"reqbytes"`
+	RespBytes  int64   `json:"respbytes"`
+	Histogram  []int64 `json:"histogram"` // see RpcLatencyBucketsMs
+}
+
+type CommandRpcStatsData struct {
+	Reset bool `json:"reset,omitempty"` // reset the stats after returning them
+}
+
+type CommandRpcTraceData struct {
+	Enabled  bool   `json:"enabled"`
+	FileName string `json:"filename,omitempty"` // file name in the rpctrace dir (in the wave home dir), defaults to a new file
+}
+
+type ApiTokenInfo struct {
+	TokenId    string   `json:"tokenid"`
+	Name       string   `json:"name"`
+	Caps       []string `json:"caps"`
+	CreatedTs  int64    `json:"createdts"`
+	LastUsedTs int64    `json:"lastusedts,omitempty"`
+}
+
+type CommandApiTokenCreateData struct {
+	Name string   `json:"name"`
+	Caps []string `json:"caps,omitempty"` // defaults to DefaultApiTokenCaps
+}
+
+type CommandApiTokenCreateRtnData struct {
+	TokenInfo ApiTokenInfo `json:"tokeninfo"`
+	Token     string       `json:"token"` // only returned here, it can't be retrieved later
+}
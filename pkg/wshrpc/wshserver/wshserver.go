@@ -27,6 +27,8 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/wcore"
 	"github.com/wavetermdev/waveterm/pkg/wlayout"
 	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wpsevents"
+	"github.com/wavetermdev/waveterm/pkg/wpsstore"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshutil"
 	"github.com/wavetermdev/waveterm/pkg/wstore"
@@ -313,14 +315,60 @@ func (ws *WshServer) FileWriteCommand(ctx context.Context, data wshrpc.CommandFi
 	return nil
 }
 
-func (ws *WshServer) FileReadCommand(ctx context.Context, data wshrpc.CommandFileData) (string, error) {
+func (ws *WshServer) FileReadCommand(ctx context.Context, data wshrpc.CommandFileData) ([]byte, error) {
 	_, dataBuf, err := filestore.WFS.ReadFile(ctx, data.ZoneId, data.FileName)
 	if err != nil {
-		return "", fmt.Errorf("error reading blockfile: %w", err)
+		return nil, fmt.Errorf("error reading blockfile: %w", err)
+	}
+	if dataBuf == nil {
+		// nil would be sent as null
+		dataBuf = []byte{}
+	}
+	return dataBuf, nil
+}
+
+func (ws *WshServer) FileListVersionsCommand(ctx context.Context, data wshrpc.CommandFileData) ([]*wshrpc.FileVersionInfo, error) {
+	versions, err := filestore.WFS.ListFileVersions(ctx, data.ZoneId, data.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("error listing blockfile versions: %w", err)
+	}
+	var rtn []*wshrpc.FileVersionInfo
+	for _, version := range versions {
+		rtn = append(rtn, &wshrpc.FileVersionInfo{
+			Version:   version.Version,
+			Size:      version.Size,
+			ModTs:     version.ModTs,
+			CreatedTs: version.CreatedTs,
+		})
+	}
+	return rtn, nil
+}
+
+func (ws *WshServer) FileReadVersionCommand(ctx context.Context, data wshrpc.CommandFileVersionData) (string, error) {
+	_, dataBuf, err := filestore.WFS.ReadFileVersion(ctx, data.ZoneId, data.FileName, data.Version)
+	if err != nil {
+		return "", fmt.Errorf("error reading blockfile version: %w", err)
 	}
 	return base64.StdEncoding.EncodeToString(dataBuf), nil
 }
 
+func (ws *WshServer) FileRestoreVersionCommand(ctx context.Context, data wshrpc.CommandFileVersionData) error {
+	err := filestore.WFS.RestoreFileVersion(ctx, data.ZoneId, data.FileName, data.Version)
+	if err != nil {
+		return fmt.Errorf("error restoring blockfile version: %w", err)
+	}
+	wps.Broker.Publish(wps.WaveEvent{
+		Event:  wps.Event_BlockFile,
+		Scopes: []string{waveobj.MakeORef(waveobj.OType_Block, data.ZoneId).String()},
+		Data: &wps.WSFileEventData{
+			ZoneId:   data.ZoneId,
+			FileName: data.FileName,
+			FileOp:   wps.FileOp_Invalidate,
+		},
+	})
+	return nil
+}
+
 func (ws *WshServer) FileAppendCommand(ctx context.Context, data wshrpc.CommandFileData) error {
 	dataBuf, err := base64.StdEncoding.DecodeString(data.Data64)
 	if err != nil {
@@ -406,6 +454,15 @@ func (ws *WshServer) EventPublishCommand(ctx context.Context, data wps.WaveEvent
 	if rpcSource == "" {
 		return fmt.Errorf("no rpc source set")
 	}
+	if !isTrustedEventSource(rpcSource) {
+		if wpsevents.IsSystemEvent(data.Event) {
+			return fmt.Errorf("cannot publish system event %q", data.Event)
+		}
+		err := wpsevents.ValidateEventData(data)
+		if err != nil {
+			return err
+		}
+	}
 	if data.Sender == "" {
 		data.Sender = rpcSource
 	}
@@ -413,14 +470,18 @@ func (ws *WshServer) EventPublishCommand(ctx context.Context, data wps.WaveEvent
 	return nil
 }
 
+// events from wavesrv and the frontend are trusted, everything else (wsh, connservers) is validated against the event registry
+func isTrustedEventSource(rpcSource string) bool {
+	return rpcSource == wshutil.DefaultRoute || strings.HasPrefix(rpcSource, wshutil.MakeWindowRouteId(""))
+}
+
 func (ws *WshServer) EventSubCommand(ctx context.Context, data wps.SubscriptionRequest) error {
 	log.Printf("EventSubCommand: %v\n", data)
 	rpcSource := wshutil.GetRpcSourceFromContext(ctx)
 	if rpcSource == "" {
 		return fmt.Errorf("no rpc source set")
 	}
-	wps.Broker.Subscribe(rpcSource, data)
-	return nil
+	return wps.Broker.Subscribe(rpcSource, data)
 }
 
 func (ws *WshServer) EventUnsubCommand(ctx context.Context, data string) error {
@@ -446,6 +507,14 @@ func (ws *WshServer) EventReadHistoryCommand(ctx context.Context, data wshrpc.Co
 	return events, nil
 }
 
+func (ws *WshServer) EventRetentionSetCommand(ctx context.Context, data wshrpc.EventRetention) error {
+	return wpsstore.SetEventRetention(ctx, data)
+}
+
+func (ws *WshServer) EventRetentionListCommand(ctx context.Context) ([]wshrpc.EventRetention, error) {
+	return wpsstore.GetEventRetentions(), nil
+}
+
 func (ws *WshServer) SetConfigCommand(ctx context.Context, data wconfig.MetaSettingsType) error {
 	log.Printf("SETCONFIG: %v\n", data)
 	return wconfig.SetBaseConfigValue(data.MetaMapType)
@@ -496,10 +565,94 @@ func (ws *WshServer) ConnReinstallWshCommand(ctx context.Context, connName strin
 	return conn.CheckAndInstallWsh(ctx, connName, &conncontroller.WshInstallOpts{Force: true, NoUserPrompt: true})
 }
 
+func getForwardConn(ctx context.Context, connName string) (*conncontroller.SSHConn, error) {
+	if wshutil.IsNestedConnName(connName) {
+		return nil, fmt.Errorf("port forwards are not supported on nested connections")
+	}
+	connOpts, err := remote.ParseOpts(connName)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing connection name: %w", err)
+	}
+	conn := conncontroller.GetConn(ctx, connOpts, false)
+	if conn == nil {
+		return nil, fmt.Errorf("connection not found: %s", connName)
+	}
+	return conn, nil
+}
+
+func (ws *WshServer) ConnForwardAddCommand(ctx context.Context, data wshrpc.CommandConnForwardAddData) (*wshrpc.ConnForward, error) {
+	conn, err := getForwardConn(ctx, data.ConnName)
+	if err != nil {
+		return nil, err
+	}
+	return conn.AddForward(data.Spec)
+}
+
+func (ws *WshServer) ConnForwardListCommand(ctx context.Context, connName string) ([]wshrpc.ConnForward, error) {
+	conn, err := getForwardConn(ctx, connName)
+	if err != nil {
+		return nil, err
+	}
+	return conn.GetForwards(), nil
+}
+
+func (ws *WshServer) ConnForwardRemoveCommand(ctx context.Context, data wshrpc.CommandConnForwardRemoveData) error {
+	conn, err := getForwardConn(ctx, data.ConnName)
+	if err != nil {
+		return err
+	}
+	return conn.RemoveForward(data.ForwardId)
+}
+
 func (ws *WshServer) ConnListCommand(ctx context.Context) ([]string, error) {
 	return conncontroller.GetConnectionsList()
 }
 
+func (ws *WshServer) AuthRefreshCommand(ctx context.Context, data string) (string, error) {
+	callerCtx := wshutil.DefaultRouter.GetRouteRpcContext(wshutil.GetRpcSourceFromContext(ctx))
+	if callerCtx == nil {
+		return "", fmt.Errorf("tokens must be refreshed from an authenticated wsh client")
+	}
+	newToken, tokenCtx, err := wshutil.RefreshClientJWTToken(data)
+	if err != nil {
+		return "", fmt.Errorf("error refreshing token: %w", err)
+	}
+	// a caller can only refresh its own token
+	if tokenCtx.BlockId != callerCtx.BlockId || tokenCtx.Conn != callerCtx.Conn || tokenCtx.ClientType != callerCtx.ClientType {
+		return "", fmt.Errorf("token does not belong to the caller")
+	}
+	return newToken, nil
+}
+
+func (ws *WshServer) ConnNestedTokensCommand(ctx context.Context, data wshrpc.CommandConnNestedTokensData) (wshrpc.CommandConnNestedTokensRtnData, error) {
+	var rtn wshrpc.CommandConnNestedTokensRtnData
+	if data.Host == "" || strings.ContainsAny(data.Host, wshutil.NestedConnSeparator+" \t\n") {
+		return rtn, fmt.Errorf("invalid host %q", data.Host)
+	}
+	if data.SockName == "" {
+		return rtn, fmt.Errorf("no socket name")
+	}
+	callerCtx := wshutil.DefaultRouter.GetRouteRpcContext(wshutil.GetRpcSourceFromContext(ctx))
+	if callerCtx == nil {
+		return rtn, fmt.Errorf("nested connections must be opened from an authenticated wsh client")
+	}
+	rtn.Conn = wshutil.MakeNestedConnName(callerCtx.Conn, data.Host)
+	connServerCtx := wshrpc.RpcContext{ClientType: wshrpc.ClientType_ConnServer, Conn: rtn.Conn, Caps: callerCtx.Caps}
+	connServerToken, err := wshutil.MakeClientJWTToken(connServerCtx, data.SockName)
+	if err != nil {
+		return rtn, fmt.Errorf("error making connserver token: %w", err)
+	}
+	// the nested shell runs in the caller's block
+	shellCtx := wshrpc.RpcContext{BlockId: callerCtx.BlockId, TabId: callerCtx.TabId, Conn: rtn.Conn, Caps: callerCtx.Caps}
+	shellToken, err := wshutil.MakeClientJWTToken(shellCtx, data.SockName)
+	if err != nil {
+		return rtn, fmt.Errorf("error making shell token: %w", err)
+	}
+	rtn.ConnServerToken = connServerToken
+	rtn.ShellToken = shellToken
+	return rtn, nil
+}
+
 func (ws *WshServer) BlockInfoCommand(ctx context.Context, blockId string) (*wshrpc.BlockInfoData, error) {
 	blockData, err := wstore.DBMustGet[*waveobj.Block](ctx, blockId)
 	if err != nil {
@@ -520,3 +673,76 @@ func (ws *WshServer) BlockInfoCommand(ctx context.Context, blockId string) (*wsh
 		Meta:     blockData.Meta,
 	}, nil
 }
+
+func (ws *WshServer) EventQueueStatsCommand(ctx context.Context) ([]wshrpc.EventQueueStats, error) {
+	return wshutil.DefaultRouter.GetEventQueueStats(), nil
+}
+
+func (ws *WshServer) RpcStatsCommand(ctx context.Context, data wshrpc.CommandRpcStatsData) ([]wshrpc.RpcCommandStats, error) {
+	return wshutil.DefaultRouter.GetRpcStats(data.Reset), nil
+}
+
+func (ws *WshServer) RpcTraceCommand(ctx context.Context, data wshrpc.CommandRpcTraceData) (string, error) {
+	return wshutil.DefaultRouter.SetRpcTrace(data)
+}
+
+func apiTokenToInfo(apiToken *wstore.ApiToken) wshrpc.ApiTokenInfo {
+	return wshrpc.ApiTokenInfo{
+		TokenId:    apiToken.TokenId,
+		Name:       apiToken.Name,
+		Caps:       apiToken.Caps,
+		CreatedTs:  apiToken.CreatedTs,
+		LastUsedTs: apiToken.LastUsedTs,
+	}
+}
+
+func (ws *WshServer) ApiTokenCreateCommand(ctx context.Context, data wshrpc.CommandApiTokenCreateData) (*wshrpc.CommandApiTokenCreateRtnData, error) {
+	name := strings.TrimSpace(data.Name)
+	if name == "" {
+		return nil, fmt.Errorf("api token name is required")
+	}
+	if len(name) > 200 {
+		return nil, fmt.Errorf("api token name is too long (max 200 chars)")
+	}
+	caps := data.Caps
+	if caps == nil {
+		caps = wshrpc.DefaultApiTokenCaps
+	}
+	for _, cap := range caps {
+		if !wshrpc.IsValidCap(cap) {
+			return nil, fmt.Errorf("invalid cap %q", cap)
+		}
+		if cap == wshrpc.Cap_BlockSelf {
+			// api tokens don't belong to a block
+			return nil, fmt.Errorf("cap %q is not valid for api tokens", cap)
+		}
+	}
+	apiToken, token, err := wstore.CreateApiToken(ctx, name, caps)
+	if err != nil {
+		return nil, fmt.Errorf("error creating api token: %w", err)
+	}
+	return &wshrpc.CommandApiTokenCreateRtnData{TokenInfo: apiTokenToInfo(apiToken), Token: token}, nil
+}
+
+func (ws *WshServer) ApiTokenListCommand(ctx context.Context) ([]wshrpc.ApiTokenInfo, error) {
+	apiTokens, err := wstore.ListApiTokens(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing api tokens: %w", err)
+	}
+	rtn := make([]wshrpc.ApiTokenInfo, 0, len(apiTokens))
+	for _, apiToken := range apiTokens {
+		rtn = append(rtn, apiTokenToInfo(apiToken))
+	}
+	return rtn, nil
+}
+
+func (ws *WshServer) ApiTokenDeleteCommand(ctx context.Context, tokenId string) error {
+	err := wstore.DeleteApiToken(ctx, tokenId)
+	if err == wstore.ErrNotFound {
+		return fmt.Errorf("api token %q not found", tokenId)
+	}
+	if err != nil {
+		return fmt.Errorf("error deleting api token: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshserver
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/remote/conncontroller"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// copies between connections stream the source (RemoteStreamFile, in ConnCopyRangeSize byte ranges) into
+// RemoteWriteFileStream on the destination, through wavesrv.  nothing is buffered to disk here.  the
+// destination is written through its partial file, which is kept when the copy fails so it can be resumed.
+
+const ConnCopyRangeSize = 16 * 1024 * 1024
+const ConnCopyProgressInterval = 250 * time.Millisecond
+
+func (ws *WshServer) ConnCopyFileCommand(ctx context.Context, data wshrpc.CommandConnCopyFileData) chan wshrpc.RespOrErrorUnion[wshrpc.ConnCopyFileProgress] {
+	rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.ConnCopyFileProgress], 16)
+	go func() {
+		defer close(rtn)
+		err := connCopyFile(ctx, data, func(progress wshrpc.ConnCopyFileProgress) {
+			rtn <- wshrpc.RespOrErrorUnion[wshrpc.ConnCopyFileProgress]{Response: progress}
+		})
+		if err != nil {
+			rtn <- wshrpc.RespOrErrorUnion[wshrpc.ConnCopyFileProgress]{Error: err}
+		}
+	}()
+	return rtn
+}
+
+func ensureCopyConn(ctx context.Context, connName string) error {
+	// a registered route means the connserver is up (this covers "local" and nested connections)
+	if wshutil.DefaultRouter.HasRoute(wshutil.MakeConnectionRouteId(connName)) {
+		return nil
+	}
+	return conncontroller.EnsureConnection(ctx, connName)
+}
+
+// a partial file is only used if it was written after the source was last modified
+func getResumeOffset(client *wshutil.WshRpc, destRoute string, destPath string, srcInfo *wshrpc.FileInfo) int64 {
+	partialInfo, err := wshclient.RemoteFileInfoCommand(client, destPath+wshrpc.PartialFileSuffix, &wshrpc.RpcOpts{Route: destRoute})
+	if err != nil || partialInfo.NotFound || partialInfo.IsDir {
+		return 0
+	}
+	if partialInfo.Size > srcInfo.Size || partialInfo.ModTime < srcInfo.ModTime {
+		return 0
+	}
+	return partialInfo.Size
+}
+
+// streams [offset, srcInfo.Size) of the source file to dataFn
+func streamFileRanges(ctx context.Context, client *wshutil.WshRpc, srcRoute string, srcInfo *wshrpc.FileInfo, offset int64, dataFn func([]byte) error) error {
+	for start := offset; start < srcInfo.Size; start += ConnCopyRangeSize {
+		end := min(start+ConnCopyRangeSize, srcInfo.Size)
+		streamData := wshrpc.CommandRemoteStreamFileData{Path: srcInfo.Path, ByteRange: fmt.Sprintf("%d-%d", start, end)}
+		opts := &wshrpc.RpcOpts{Route: srcRoute, Timeout: wshutil.StreamTimeoutMs(end - start)}
+		respCh := wshclient.RemoteStreamFileCommand(client, streamData, opts)
+		var rangeErr error
+		firstPk := true
+		var rangeBytes int64
+		for respUnion := range respCh {
+			if rangeErr != nil {
+				// drain after a cancel
+				continue
+			}
+			if respUnion.Error != nil {
+				rangeErr = respUnion.Error
+				continue
+			}
+			resp := respUnion.Response
+			if firstPk {
+				firstPk = false
+				// first packet has the fileinfo
+				if len(resp.FileInfo) != 1 || resp.FileInfo[0].Size != srcInfo.Size || resp.FileInfo[0].ModTime != srcInfo.ModTime {
+					rangeErr = fmt.Errorf("%s changed during the copy", srcInfo.Path)
+					opts.StreamCancelFn()
+				}
+				continue
+			}
+			rangeBytes += int64(len(resp.Data))
+			if err := dataFn(resp.Data); err != nil {
+				rangeErr = err
+				opts.StreamCancelFn()
+			}
+		}
+		if rangeErr != nil {
+			return rangeErr
+		}
+		if rangeBytes != end-start {
+			return fmt.Errorf("reading %s: got %d bytes at offset %d, expected %d", srcInfo.Path, rangeBytes, start, end-start)
+		}
+	}
+	return nil
+}
+
+func connCopyFile(ctx context.Context, data wshrpc.CommandConnCopyFileData, progressFn func(wshrpc.ConnCopyFileProgress)) error {
+	if data.SrcConn == "" {
+		data.SrcConn = wshrpc.LocalConnName
+	}
+	if data.DestConn == "" {
+		data.DestConn = wshrpc.LocalConnName
+	}
+	if data.SrcPath == "" || data.DestPath == "" {
+		return fmt.Errorf("source and destination paths are required")
+	}
+	for _, connName := range []string{data.SrcConn, data.DestConn} {
+		if err := ensureCopyConn(ctx, connName); err != nil {
+			return err
+		}
+	}
+	client := GetMainRpcClient()
+	srcRoute := wshutil.MakeConnectionRouteId(data.SrcConn)
+	destRoute := wshutil.MakeConnectionRouteId(data.DestConn)
+	srcInfo, err := wshclient.RemoteFileInfoCommand(client, data.SrcPath, &wshrpc.RpcOpts{Route: srcRoute})
+	if err != nil {
+		return fmt.Errorf("cannot stat %s:%s: %w", data.SrcConn, data.SrcPath, err)
+	}
+	if srcInfo.NotFound {
+		return fmt.Errorf("%s:%s not found", data.SrcConn, data.SrcPath)
+	}
+	if srcInfo.IsDir {
+		return fmt.Errorf("%s:%s is a directory", data.SrcConn, data.SrcPath)
+	}
+	destPath := data.DestPath
+	destInfo, err := wshclient.RemoteFileInfoCommand(client, destPath, &wshrpc.RpcOpts{Route: destRoute})
+	if err == nil && destInfo.IsDir {
+		// remote paths are always unix style
+		destPath = path.Join(destPath, srcInfo.Name)
+		destInfo, err = wshclient.RemoteFileInfoCommand(client, destPath, &wshrpc.RpcOpts{Route: destRoute})
+	}
+	if err != nil {
+		return fmt.Errorf("cannot stat %s:%s: %w", data.DestConn, destPath, err)
+	}
+	if destInfo.IsDir {
+		return fmt.Errorf("cannot overwrite directory %s:%s", data.DestConn, destPath)
+	}
+	if !destInfo.NotFound && !data.Overwrite {
+		return fmt.Errorf("%s:%s already exists", data.DestConn, destPath)
+	}
+	progress := wshrpc.ConnCopyFileProgress{DestPath: destPath, Size: srcInfo.Size}
+
+	if data.SrcConn == data.DestConn {
+		// no need to stream through wavesrv
+		copyData := wshrpc.CommandRemoteFileCopyData{SrcPath: srcInfo.Path, DestPath: destPath, Overwrite: true}
+		finfo, err := wshclient.RemoteFileCopyCommand(client, copyData, &wshrpc.RpcOpts{Route: srcRoute, Timeout: wshutil.StreamTimeoutMs(srcInfo.Size)})
+		if err != nil {
+			return err
+		}
+		progress.Copied = srcInfo.Size
+		progress.Done = true
+		progress.FileInfo = finfo
+		progressFn(progress)
+		return nil
+	}
+
+	var offset int64
+	if data.Resume {
+		offset = getResumeOffset(client, destRoute, destPath, srcInfo)
+	}
+	progress.ResumedFrom = offset
+	progress.Copied = offset
+	progressFn(progress)
+
+	copyCtx, cancelFn := context.WithCancel(ctx)
+	reqCh := make(chan wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData], 4)
+	feedDoneCh := make(chan struct{})
+	// the feeder calls progressFn, it must be done before we return
+	defer func() {
+		cancelFn()
+		<-feedDoneCh
+	}()
+	go func() {
+		defer close(feedDoneCh)
+		defer close(reqCh)
+		feedProgress := progress
+		var lastProgressTs time.Time
+		err := streamFileRanges(copyCtx, client, srcRoute, srcInfo, offset, func(chunk []byte) error {
+			select {
+			case reqCh <- wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData]{Response: wshrpc.CommandFileChunkData{Data: chunk}}:
+			case <-copyCtx.Done():
+				return copyCtx.Err()
+			}
+			feedProgress.Copied += int64(len(chunk))
+			if time.Since(lastProgressTs) >= ConnCopyProgressInterval {
+				lastProgressTs = time.Now()
+				progressFn(feedProgress)
+			}
+			return nil
+		})
+		if err != nil {
+			select {
+			case reqCh <- wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData]{Error: err}:
+			case <-copyCtx.Done():
+			}
+		}
+	}()
+	writeData := wshrpc.CommandRemoteWriteFileStreamData{
+		Path:       destPath,
+		Size:       srcInfo.Size,
+		CreateMode: srcInfo.Mode.Perm(),
+		Partial:    true,
+		Offset:     offset,
+	}
+	writeOpts := &wshrpc.RpcOpts{Route: destRoute, Timeout: wshutil.StreamTimeoutMs(srcInfo.Size - offset)}
+	finfo, err := wshclient.RemoteWriteFileStreamCommand(client, writeData, reqCh, writeOpts)
+	if err != nil {
+		return fmt.Errorf("copying to %s:%s: %w (resume to continue the copy)", data.DestConn, destPath, err)
+	}
+	progress.Copied = srcInfo.Size
+	progress.Done = true
+	progress.FileInfo = finfo
+	progressFn(progress)
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshremote"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+func setupCopyTestRoutes(t *testing.T, connNames ...string) {
+	wshutil.DefaultRouter.RegisterRoute(wshutil.DefaultRoute, GetMainRpcClient())
+	for _, connName := range connNames {
+		connRpc := wshutil.MakeWshRpc(nil, nil, wshrpc.RpcContext{Conn: connName}, &wshremote.ServerImpl{})
+		wshutil.DefaultRouter.RegisterRoute(wshutil.MakeConnectionRouteId(connName), connRpc)
+	}
+	t.Cleanup(func() {
+		for _, connName := range connNames {
+			wshutil.DefaultRouter.UnregisterRoute(wshutil.MakeConnectionRouteId(connName))
+		}
+	})
+}
+
+func runConnCopy(t *testing.T, data wshrpc.CommandConnCopyFileData) (*wshrpc.ConnCopyFileProgress, error) {
+	var lastProgress *wshrpc.ConnCopyFileProgress
+	for respUnion := range WshServerImpl.ConnCopyFileCommand(context.Background(), data) {
+		if respUnion.Error != nil {
+			return lastProgress, respUnion.Error
+		}
+		progress := respUnion.Response
+		lastProgress = &progress
+	}
+	return lastProgress, nil
+}
+
+func TestConnCopyFile(t *testing.T) {
+	setupCopyTestRoutes(t, "src-host", "dest-host")
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	content := make([]byte, 300*1024)
+	rand.Read(content)
+	srcFile := filepath.Join(srcDir, "data.bin")
+	err := os.WriteFile(srcFile, content, 0640)
+	if err != nil {
+		t.Fatalf("error writing source: %v", err)
+	}
+
+	// copying to a directory keeps the name
+	copyData := wshrpc.CommandConnCopyFileData{SrcConn: "src-host", SrcPath: srcFile, DestConn: "dest-host", DestPath: destDir}
+	progress, err := runConnCopy(t, copyData)
+	if err != nil {
+		t.Fatalf("copy failed: %v", err)
+	}
+	destFile := filepath.Join(destDir, "data.bin")
+	if progress == nil || !progress.Done || progress.Copied != int64(len(content)) || progress.DestPath != destFile {
+		t.Fatalf("unexpected final progress: %+v", progress)
+	}
+	if destContent, err := os.ReadFile(destFile); err != nil || !bytes.Equal(destContent, content) {
+		t.Fatalf("destination content does not match (%v)", err)
+	}
+	if finfo, err := os.Stat(destFile); err != nil || finfo.Mode().Perm() != 0640 {
+		t.Errorf("destination mode was not copied: %v", err)
+	}
+
+	if _, err := runConnCopy(t, copyData); err == nil {
+		t.Errorf("expected an error copying over an existing file without overwrite")
+	}
+
+	// resume from a partial file
+	resumeFile := filepath.Join(destDir, "resumed.bin")
+	err = os.WriteFile(resumeFile+wshrpc.PartialFileSuffix, content[:100*1024], 0600)
+	if err != nil {
+		t.Fatalf("error writing partial file: %v", err)
+	}
+	copyData = wshrpc.CommandConnCopyFileData{SrcConn: "src-host", SrcPath: srcFile, DestConn: "dest-host", DestPath: resumeFile, Resume: true}
+	progress, err = runConnCopy(t, copyData)
+	if err != nil {
+		t.Fatalf("resumed copy failed: %v", err)
+	}
+	if progress.ResumedFrom != 100*1024 {
+		t.Errorf("expected to resume at %d, resumed at %d", 100*1024, progress.ResumedFrom)
+	}
+	if destContent, err := os.ReadFile(resumeFile); err != nil || !bytes.Equal(destContent, content) {
+		t.Fatalf("resumed content does not match (%v)", err)
+	}
+	if _, err := os.Stat(resumeFile + wshrpc.PartialFileSuffix); !os.IsNotExist(err) {
+		t.Errorf("partial file was not renamed")
+	}
+}
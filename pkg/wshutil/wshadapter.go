@@ -8,7 +8,6 @@ import (
 	"reflect"
 	"strings"
 
-	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 )
 
@@ -52,23 +51,23 @@ func noImplHandler(handler *RpcResponseHandler) bool {
 	return true
 }
 
-func recodeCommandData(command string, data any, rpcCtx *wshrpc.RpcContext) (any, error) {
+func recodeCommandData(msg *RpcMessage, rpcCtx *wshrpc.RpcContext) (any, error) {
 	// only applies to initial command packet
-	if command == "" {
-		return data, nil
+	if msg.Command == "" {
+		return msg.getInlinedData(), nil
 	}
-	methodDecl := WshCommandDeclMap[command]
+	methodDecl := WshCommandDeclMap[msg.Command]
 	if methodDecl == nil {
-		return data, fmt.Errorf("command %q not found", command)
+		return msg.getInlinedData(), fmt.Errorf("command %q not found", msg.Command)
 	}
 	if methodDecl.CommandDataType == nil {
-		return data, nil
+		return msg.getInlinedData(), nil
 	}
 	commandDataPtr := reflect.New(methodDecl.CommandDataType).Interface()
-	if data != nil {
-		err := utilfn.ReUnmarshal(commandDataPtr, data)
+	if msg.Data != nil || msg.BinData != nil {
+		err := msg.decodeData(commandDataPtr)
 		if err != nil {
-			return data, fmt.Errorf("error re-marshalling command data: %w", err)
+			return msg.getInlinedData(), fmt.Errorf("error re-marshalling command data: %w", err)
 		}
 		if rpcCtx != nil {
 			wshrpc.HackRpcContextIntoData(commandDataPtr, *rpcCtx)
@@ -77,6 +76,91 @@ func recodeCommandData(command string, data any, rpcCtx *wshrpc.RpcContext) (any
 	return reflect.ValueOf(commandDataPtr).Elem().Interface(), nil
 }
 
+// decodes the request stream of a streaming request into reqChVal (a chan RespOrErrorUnion[dataType]), closes it when done.
+// cancellation and timeouts are sent as an error.
+func runRequestStream(handler *RpcResponseHandler, reqChVal reflect.Value, dataType reflect.Type) {
+	defer reqChVal.Close()
+	reqStream := handler.reqStream
+	if reqStream == nil {
+		// not sent as a streaming request, the stream is empty
+		return
+	}
+	ctx := handler.Context()
+	elemType := reqChVal.Type().Elem()
+	// returns false if the handler is done (or the request was canceled)
+	sendFn := func(unionVal reflect.Value) bool {
+		chosen, _, _ := reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectSend, Chan: reqChVal, Send: unionVal},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(reqStream.DoneCh)},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(reqStream.CancelCh)},
+		})
+		return chosen == 0
+	}
+	// a canceled stream must never look like a clean end of stream to the handler
+	streamErrFn := func() error {
+		select {
+		case <-reqStream.CancelCh:
+			if reqStream.isOverflow() {
+				return fmt.Errorf("request stream overflowed (more than %d queued messages)", MaxRequestStreamQueue)
+			}
+			return fmt.Errorf("request stream canceled")
+		default:
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("request stream: %w", ctx.Err())
+		}
+		return nil
+	}
+	sendErrFn := func(err error) {
+		unionVal := reflect.New(elemType).Elem()
+		unionVal.FieldByName("Error").Set(reflect.ValueOf(&err).Elem())
+		// the handler may not be reading anymore
+		select {
+		case <-reqStream.DoneCh:
+		default:
+			reflect.Select([]reflect.SelectCase{
+				{Dir: reflect.SelectSend, Chan: reqChVal, Send: unionVal},
+				{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(reqStream.DoneCh)},
+			})
+		}
+	}
+	for {
+		select {
+		case msg := <-reqStream.Ch:
+			if !msg.Cont && msg.Data == nil && msg.BinData == nil {
+				// end of stream marker
+				return
+			}
+			dataPtr := reflect.New(dataType)
+			err := msg.decodeData(dataPtr.Interface())
+			if err != nil {
+				sendErrFn(fmt.Errorf("error decoding request stream data: %w", err))
+				return
+			}
+			unionVal := reflect.New(elemType).Elem()
+			unionVal.FieldByName("Response").Set(dataPtr.Elem())
+			if !sendFn(unionVal) {
+				if err := streamErrFn(); err != nil {
+					sendErrFn(err)
+				}
+				return
+			}
+			if !msg.Cont {
+				return
+			}
+		case <-ctx.Done():
+			sendErrFn(streamErrFn())
+			return
+		case <-reqStream.CancelCh:
+			sendErrFn(streamErrFn())
+			return
+		case <-reqStream.DoneCh:
+			return
+		}
+	}
+}
+
 func serverImplAdapter(impl any) func(*RpcResponseHandler) bool {
 	if impl == nil {
 		return noImplHandler
@@ -107,14 +191,20 @@ func serverImplAdapter(impl any) func(*RpcResponseHandler) bool {
 		callParams = append(callParams, reflect.ValueOf(handler.Context()))
 		if methodDecl.CommandDataType != nil {
 			rpcCtx := handler.GetRpcContext()
-			cmdData, err := recodeCommandData(cmd, handler.GetCommandRawData(), &rpcCtx)
+			cmdData, err := recodeCommandData(handler.commandMsg, &rpcCtx)
 			if err != nil {
 				handler.SendResponseError(err)
 				return true
 			}
 			callParams = append(callParams, reflect.ValueOf(cmdData))
 		}
-		if methodDecl.CommandType == wshrpc.RpcType_Call {
+		if methodDecl.CommandType == wshrpc.RpcType_StreamingRequest {
+			reqChType := reflect.ChanOf(reflect.BothDir, implMethod.Type().In(len(callParams)).Elem())
+			reqChVal := reflect.MakeChan(reqChType, 0)
+			go runRequestStream(handler, reqChVal, methodDecl.RequestStreamDataType)
+			callParams = append(callParams, reqChVal)
+		}
+		if methodDecl.CommandType == wshrpc.RpcType_Call || methodDecl.CommandType == wshrpc.RpcType_StreamingRequest {
 			rtnVals := implMethod.Call(callParams)
 			rtnData, rtnErr := decodeRtnVals(rtnVals)
 			if rtnErr != nil {
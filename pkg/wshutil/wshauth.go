@@ -0,0 +1,333 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// the router checks every new command against the caps of the route it came in on (see wshrpc/wshrpccaps.go).
+// only authenticated proxies (domain socket clients, connservers) have caps, everything else is trusted.
+// for block commands, Cap_BlockSelf allows targets (the fields tagged with wshcontext) that belong to the caller:
+//   block contexts -- their own block and tab
+//   connserver contexts -- blocks on their connection, and tabs with a block on their connection (uses the ConnResolver)
+// the same targets limit block reads and block-scoped events for callers with Cap_BlockSelf (but not Cap_Block),
+// even though those commands only require Cap_Read or Cap_Events
+
+// returns the connections an object uses (a block's connection, or the connections of a tab's blocks)
+// local blocks have a connection of ""
+type ConnResolverFn func(oref waveobj.ORef) ([]string, error)
+
+// commands where the data is a bare blockid
+var blockIdDataCommands = map[string]bool{
+	wshrpc.Command_ControllerStop: true,
+	wshrpc.Command_BlockInfo:      true,
+}
+
+// read commands that expose a block's data (limited to self targets for Cap_BlockSelf callers)
+var blockReadCommands = map[string]bool{
+	wshrpc.Command_GetMeta:          true,
+	wshrpc.Command_BlockInfo:        true,
+	wshrpc.Command_FileRead:         true,
+	wshrpc.Command_FileListVersions: true,
+	wshrpc.Command_FileReadVersion:  true,
+}
+
+// events scoped by the object they are about (block and tab orefs)
+var blockScopedEvents = map[string]bool{
+	wps.Event_BlockFile:        true,
+	wps.Event_BlockClose:       true,
+	wps.Event_ControllerStatus: true,
+	wps.Event_WaveObjUpdate:    true,
+}
+
+func (router *WshRouter) SetConnResolver(fn ConnResolverFn) {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	router.ConnResolver = fn
+}
+
+func (router *WshRouter) getConnResolver() ConnResolverFn {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	return router.ConnResolver
+}
+
+// returns nil for routes that are not authenticated proxies (trusted)
+func (router *WshRouter) getRouteRpcContext(routeId string) *wshrpc.RpcContext {
+	proxy, ok := router.GetRpc(routeId).(*WshRpcProxy)
+	if !ok {
+		return nil
+	}
+	return proxy.GetRpcContext()
+}
+
+// returns the context of an authenticated route (a local proxy, or a route announced through one), nil if trusted
+func (router *WshRouter) GetRouteRpcContext(routeId string) *wshrpc.RpcContext {
+	rpcCtx := router.getRouteRpcContext(routeId)
+	if rpcCtx != nil {
+		return rpcCtx
+	}
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	return router.AnnouncedCtx[routeId]
+}
+
+// true if a local or announced route was authenticated with a token for the block
+func (router *WshRouter) hasBlockRoute(blockId string) bool {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	for _, rpc := range router.RouteMap {
+		if proxy, ok := rpc.(*WshRpcProxy); ok {
+			if rpcCtx := proxy.GetRpcContext(); rpcCtx != nil && rpcCtx.BlockId == blockId {
+				return true
+			}
+		}
+	}
+	for _, rpcCtx := range router.AnnouncedCtx {
+		if rpcCtx != nil && rpcCtx.BlockId == blockId {
+			return true
+		}
+	}
+	return false
+}
+
+func (router *WshRouter) checkPermission(fromRouteId string, msg *RpcMessage) error {
+	if router.GetUpstreamClient() != nil {
+		return router.checkSubRouterPermission(fromRouteId, msg)
+	}
+	rpcCtx := router.getRouteRpcContext(fromRouteId)
+	if rpcCtx == nil {
+		return nil
+	}
+	if msg.Source != fromRouteId {
+		// forwarded by a sub-router, the source must have been announced through it
+		router.Lock.Lock()
+		announcedFrom := router.AnnouncedRoutes[msg.Source]
+		announcedCtx := router.AnnouncedCtx[msg.Source]
+		router.Lock.Unlock()
+		if announcedFrom != fromRouteId || announcedCtx == nil {
+			return fmt.Errorf("permission denied: unknown source route %q", msg.Source)
+		}
+		rpcCtx = announcedCtx
+	}
+	if IsBlockTokenRevoked(rpcCtx.BlockId) {
+		return fmt.Errorf("permission denied: token has been revoked")
+	}
+	if rpcCtx.Caps == nil {
+		return nil
+	}
+	return CheckRpcPermission(rpcCtx, msg, router.getConnResolver())
+}
+
+func CheckRpcPermission(rpcCtx *wshrpc.RpcContext, msg *RpcMessage, resolver ConnResolverFn) error {
+	cap := wshrpc.GetCommandCap(msg.Command)
+	if wshrpc.HasCap(rpcCtx.Caps, cap) {
+		if isBlockSelfOnly(rpcCtx) {
+			return checkBlockSelfRead(rpcCtx, msg, resolver)
+		}
+		return nil
+	}
+	permErr := fmt.Errorf("permission denied: %q requires the %q capability", msg.Command, cap)
+	if cap == wshrpc.Cap_Remote && wshrpc.HasCap(rpcCtx.Caps, wshrpc.Cap_BlockSelf) && rpcCtx.Conn != "" && msg.Route == MakeConnectionRouteId(rpcCtx.Conn) {
+		// remote commands to the caller's own connection
+		return nil
+	}
+	if cap != wshrpc.Cap_Block || !wshrpc.HasCap(rpcCtx.Caps, wshrpc.Cap_BlockSelf) {
+		return permErr
+	}
+	err := checkSelfTargets(rpcCtx, msg, resolver)
+	if err != nil {
+		return err
+	}
+	if rpcCtx.Conn != "" {
+		return checkConnBoundMeta(rpcCtx.Conn, msg)
+	}
+	return nil
+}
+
+func isBlockSelfOnly(rpcCtx *wshrpc.RpcContext) bool {
+	return wshrpc.HasCap(rpcCtx.Caps, wshrpc.Cap_BlockSelf) && !wshrpc.HasCap(rpcCtx.Caps, wshrpc.Cap_Block)
+}
+
+func checkSelfTargets(rpcCtx *wshrpc.RpcContext, msg *RpcMessage, resolver ConnResolverFn) error {
+	targets, err := getCommandTargets(msg.Command, msg.Data)
+	if err != nil {
+		return fmt.Errorf("permission denied: %w", err)
+	}
+	for _, target := range targets {
+		if !isSelfTarget(rpcCtx, target, resolver) {
+			return fmt.Errorf("permission denied: %q is limited to the caller's own blocks (target %s)", msg.Command, target)
+		}
+	}
+	return nil
+}
+
+// block reads and block-scoped events (history, subscribe, publish) for callers limited to their own blocks (the command's cap was already checked)
+func checkBlockSelfRead(rpcCtx *wshrpc.RpcContext, msg *RpcMessage, resolver ConnResolverFn) error {
+	if blockReadCommands[msg.Command] {
+		return checkSelfTargets(rpcCtx, msg, resolver)
+	}
+	switch msg.Command {
+	case wshrpc.Command_EventReadHistory:
+		var data wshrpc.CommandEventReadHistoryData
+		err := utilfn.ReUnmarshal(&data, msg.Data)
+		if err != nil {
+			return fmt.Errorf("permission denied: invalid data: %w", err)
+		}
+		return checkSelfEventScopes(rpcCtx, data.Event, []string{data.Scope}, resolver)
+	case wshrpc.Command_EventSub:
+		var data wps.SubscriptionRequest
+		err := utilfn.ReUnmarshal(&data, msg.Data)
+		if err != nil {
+			return fmt.Errorf("permission denied: invalid data: %w", err)
+		}
+		if data.AllScopes {
+			data.Scopes = []string{""}
+		}
+		return checkSelfEventScopes(rpcCtx, data.Event, data.Scopes, resolver)
+	case wshrpc.Command_EventPublish:
+		var data wps.WaveEvent
+		err := utilfn.ReUnmarshal(&data, msg.Data)
+		if err != nil {
+			return fmt.Errorf("permission denied: invalid data: %w", err)
+		}
+		return checkSelfEventScopes(rpcCtx, data.Event, data.Scopes, resolver)
+	}
+	return nil
+}
+
+// every scope of a block-scoped event must be a self target ("" and star scopes match other blocks)
+func checkSelfEventScopes(rpcCtx *wshrpc.RpcContext, event string, scopes []string, resolver ConnResolverFn) error {
+	if !blockScopedEvents[event] {
+		return nil
+	}
+	if len(scopes) == 0 {
+		return fmt.Errorf("permission denied: %q events are limited to the caller's own blocks (scopes are required)", event)
+	}
+	for _, scope := range scopes {
+		oref, err := waveobj.ParseORef(scope)
+		if err != nil || !isSelfTarget(rpcCtx, oref, resolver) {
+			return fmt.Errorf("permission denied: %q events are limited to the caller's own blocks (scope %q)", event, scope)
+		}
+	}
+	return nil
+}
+
+// blocks with these keys use their connection (shells, commands, files)
+var connBoundMetaKeys = []string{waveobj.MetaKey_Controller, waveobj.MetaKey_Cmd, waveobj.MetaKey_File}
+
+// a remote caller limited to its own blocks cannot create or change blocks that would use another
+// connection (e.g. a local shell, or a preview of a local file)
+func checkConnBoundMeta(conn string, msg *RpcMessage) error {
+	var meta waveobj.MetaMapType
+	switch msg.Command {
+	case wshrpc.Command_CreateBlock:
+		var data wshrpc.CommandCreateBlockData
+		err := utilfn.ReUnmarshal(&data, msg.Data)
+		if err != nil {
+			return fmt.Errorf("permission denied: invalid data: %w", err)
+		}
+		if data.BlockDef == nil {
+			return nil
+		}
+		meta = data.BlockDef.Meta
+		connBound := false
+		for _, key := range connBoundMetaKeys {
+			if _, ok := meta[key]; ok {
+				connBound = true
+			}
+		}
+		if connBound && meta.GetString(waveobj.MetaKey_Connection, "") != conn {
+			return fmt.Errorf("permission denied: new blocks must use connection %q", conn)
+		}
+	case wshrpc.Command_SetMeta:
+		var data wshrpc.CommandSetMetaData
+		err := utilfn.ReUnmarshal(&data, msg.Data)
+		if err != nil {
+			return fmt.Errorf("permission denied: invalid data: %w", err)
+		}
+		if _, ok := data.Meta[waveobj.MetaKey_Connection]; ok && data.Meta.GetString(waveobj.MetaKey_Connection, "") != conn {
+			return fmt.Errorf("permission denied: cannot change the block connection")
+		}
+	}
+	return nil
+}
+
+// returns the objects a command operates on (the fields tagged with wshcontext)
+func getCommandTargets(command string, data any) ([]waveobj.ORef, error) {
+	if blockIdDataCommands[command] {
+		blockId, ok := data.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid data for %q", command)
+		}
+		return []waveobj.ORef{waveobj.MakeORef(waveobj.OType_Block, blockId)}, nil
+	}
+	methodDecl := WshCommandDeclMap[command]
+	if methodDecl == nil || methodDecl.CommandDataType == nil || methodDecl.CommandDataType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("no target for %q", command)
+	}
+	dataPtr := reflect.New(methodDecl.CommandDataType)
+	if data != nil {
+		err := utilfn.ReUnmarshal(dataPtr.Interface(), data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data for %q: %w", command, err)
+		}
+	}
+	dataVal := dataPtr.Elem()
+	var rtn []waveobj.ORef
+	for i := 0; i < dataVal.NumField(); i++ {
+		field := dataVal.Field(i)
+		switch methodDecl.CommandDataType.Field(i).Tag.Get("wshcontext") {
+		case "BlockId":
+			if blockId := field.String(); blockId != "" {
+				rtn = append(rtn, waveobj.MakeORef(waveobj.OType_Block, blockId))
+			}
+		case "TabId":
+			if tabId := field.String(); tabId != "" {
+				rtn = append(rtn, waveobj.MakeORef(waveobj.OType_Tab, tabId))
+			}
+		case "BlockORef":
+			if oref, ok := field.Interface().(waveobj.ORef); ok && oref.OID != "" {
+				rtn = append(rtn, oref)
+			}
+		}
+	}
+	if len(rtn) == 0 {
+		return nil, fmt.Errorf("no target for %q", command)
+	}
+	return rtn, nil
+}
+
+func isSelfTarget(rpcCtx *wshrpc.RpcContext, target waveobj.ORef, resolver ConnResolverFn) bool {
+	if rpcCtx.BlockId != "" {
+		switch target.OType {
+		case waveobj.OType_Block:
+			return target.OID == rpcCtx.BlockId
+		case waveobj.OType_Tab:
+			return rpcCtx.TabId != "" && target.OID == rpcCtx.TabId
+		}
+		return false
+	}
+	if rpcCtx.Conn == "" || resolver == nil {
+		return false
+	}
+	if target.OType != waveobj.OType_Block && target.OType != waveobj.OType_Tab {
+		return false
+	}
+	conns, err := resolver(target)
+	if err != nil {
+		return false
+	}
+	if target.OType == waveobj.OType_Block {
+		return len(conns) == 1 && conns[0] == rpcCtx.Conn
+	}
+	return utilfn.ContainsStr(conns, rpcCtx.Conn)
+}
@@ -0,0 +1,96 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const testBlockId = "6f9ab2b5-1d4a-4b2b-9b0c-0f3b8b6e8e8e"
+const testOtherBlockId = "0a1b2c3d-1d4a-4b2b-9b0c-0f3b8b6e8e8e"
+const testTabId = "11111111-1d4a-4b2b-9b0c-0f3b8b6e8e8e"
+
+func testResolver(oref waveobj.ORef) ([]string, error) {
+	if oref.OID == testBlockId {
+		return []string{"user@host"}, nil
+	}
+	if oref.OID == testTabId {
+		return []string{"", "user@host"}, nil
+	}
+	return []string{""}, nil
+}
+
+func TestCheckRpcPermission(t *testing.T) {
+	blockCtx := &wshrpc.RpcContext{BlockId: testBlockId, TabId: testTabId, Conn: "user@host", Caps: wshrpc.DefaultRemoteCaps}
+	connCtx := &wshrpc.RpcContext{ClientType: wshrpc.ClientType_ConnServer, Conn: "user@host", Caps: wshrpc.DefaultRemoteCaps}
+	fullCtx := &wshrpc.RpcContext{BlockId: testBlockId, Caps: []string{wshrpc.Cap_All}}
+	tests := []struct {
+		name    string
+		rpcCtx  *wshrpc.RpcContext
+		msg     RpcMessage
+		allowed bool
+	}{
+		{"read", blockCtx, RpcMessage{Command: wshrpc.Command_ConnStatus}, true},
+		{"read-self-meta", blockCtx, RpcMessage{Command: wshrpc.Command_GetMeta, Data: map[string]any{"oref": "block:" + testBlockId}}, true},
+		{"read-other-meta", blockCtx, RpcMessage{Command: wshrpc.Command_GetMeta, Data: map[string]any{"oref": "block:" + testOtherBlockId}}, false},
+		{"read-other-meta-full", fullCtx, RpcMessage{Command: wshrpc.Command_GetMeta, Data: map[string]any{"oref": "block:" + testOtherBlockId}}, true},
+		{"read-other-file", blockCtx, RpcMessage{Command: wshrpc.Command_FileRead, Data: map[string]any{"zoneid": testOtherBlockId, "filename": "term"}}, false},
+		{"read-other-version", blockCtx, RpcMessage{Command: wshrpc.Command_FileReadVersion, Data: map[string]any{"zoneid": testOtherBlockId, "filename": "term", "version": 1}}, false},
+		{"read-other-blockinfo", blockCtx, RpcMessage{Command: wshrpc.Command_BlockInfo, Data: testOtherBlockId}, false},
+		{"conn-read-file", connCtx, RpcMessage{Command: wshrpc.Command_FileRead, Data: map[string]any{"zoneid": testBlockId, "filename": "term"}}, true},
+		{"conn-read-local-file", connCtx, RpcMessage{Command: wshrpc.Command_FileRead, Data: map[string]any{"zoneid": testOtherBlockId, "filename": "term"}}, false},
+		{"history-self", blockCtx, RpcMessage{Command: wshrpc.Command_EventReadHistory, Data: map[string]any{"event": "blockfile", "scope": "block:" + testBlockId}}, true},
+		{"history-all", blockCtx, RpcMessage{Command: wshrpc.Command_EventReadHistory, Data: map[string]any{"event": "blockfile", "scope": ""}}, false},
+		{"history-unscoped-event", blockCtx, RpcMessage{Command: wshrpc.Command_EventReadHistory, Data: map[string]any{"event": "sysinfo", "scope": ""}}, true},
+		{"sub-self", blockCtx, RpcMessage{Command: wshrpc.Command_EventSub, Data: map[string]any{"event": "blockfile", "scopes": []string{"block:" + testBlockId}}}, true},
+		{"sub-other", blockCtx, RpcMessage{Command: wshrpc.Command_EventSub, Data: map[string]any{"event": "controllerstatus", "scopes": []string{"block:" + testOtherBlockId}}}, false},
+		{"sub-allscopes", blockCtx, RpcMessage{Command: wshrpc.Command_EventSub, Data: map[string]any{"event": "blockfile", "allscopes": true}}, false},
+		{"sub-star", blockCtx, RpcMessage{Command: wshrpc.Command_EventSub, Data: map[string]any{"event": "blockfile", "scopes": []string{"block:*"}}}, false},
+		{"sub-allscopes-full", fullCtx, RpcMessage{Command: wshrpc.Command_EventSub, Data: map[string]any{"event": "blockfile", "allscopes": true}}, true},
+		{"sub-unscoped-event", blockCtx, RpcMessage{Command: wshrpc.Command_EventSub, Data: map[string]any{"event": "sysinfo", "allscopes": true}}, true},
+		{"publish-self", blockCtx, RpcMessage{Command: wshrpc.Command_EventPublish, Data: map[string]any{"event": "blockclose", "scopes": []string{"block:" + testBlockId}, "data": testBlockId}}, true},
+		{"publish-other", blockCtx, RpcMessage{Command: wshrpc.Command_EventPublish, Data: map[string]any{"event": "blockclose", "scopes": []string{"block:" + testOtherBlockId}, "data": testOtherBlockId}}, false},
+		{"publish-unscoped", blockCtx, RpcMessage{Command: wshrpc.Command_EventPublish, Data: map[string]any{"event": "waveobj:update", "data": map[string]any{}}}, false},
+		{"publish-other-full", fullCtx, RpcMessage{Command: wshrpc.Command_EventPublish, Data: map[string]any{"event": "blockclose", "scopes": []string{"block:" + testOtherBlockId}, "data": testOtherBlockId}}, true},
+		{"publish-custom", blockCtx, RpcMessage{Command: wshrpc.Command_EventPublish, Data: map[string]any{"event": "deploy-done"}}, true},
+		{"config", blockCtx, RpcMessage{Command: wshrpc.Command_SetConfig, Data: map[string]any{}}, false},
+		{"config-full", fullCtx, RpcMessage{Command: wshrpc.Command_SetConfig, Data: map[string]any{}}, true},
+		{"unknown", blockCtx, RpcMessage{Command: wshrpc.Command_WebSelector}, false},
+		{"self-block", blockCtx, RpcMessage{Command: wshrpc.Command_DeleteBlock, Data: map[string]any{"blockid": testBlockId}}, true},
+		{"other-block", blockCtx, RpcMessage{Command: wshrpc.Command_DeleteBlock, Data: map[string]any{"blockid": testOtherBlockId}}, false},
+		{"other-block-str", blockCtx, RpcMessage{Command: wshrpc.Command_ControllerStop, Data: testOtherBlockId}, false},
+		{"conn-block", connCtx, RpcMessage{Command: wshrpc.Command_SetMeta, Data: map[string]any{"oref": "block:" + testBlockId, "meta": map[string]any{"view": "term"}}}, true},
+		{"conn-local-block", connCtx, RpcMessage{Command: wshrpc.Command_SetMeta, Data: map[string]any{"oref": "block:" + testOtherBlockId, "meta": map[string]any{}}}, false},
+		{"conn-change", connCtx, RpcMessage{Command: wshrpc.Command_SetMeta, Data: map[string]any{"oref": "block:" + testBlockId, "meta": map[string]any{"connection": ""}}}, false},
+		{"create-remote", blockCtx, RpcMessage{Command: wshrpc.Command_CreateBlock, Data: map[string]any{"tabid": testTabId, "blockdef": map[string]any{"meta": map[string]any{"view": "preview", "file": "/tmp/x", "connection": "user@host"}}}}, true},
+		{"create-local", blockCtx, RpcMessage{Command: wshrpc.Command_CreateBlock, Data: map[string]any{"tabid": testTabId, "blockdef": map[string]any{"meta": map[string]any{"view": "term", "controller": "shell"}}}}, false},
+		{"remote-own-conn", blockCtx, RpcMessage{Command: wshrpc.Command_RemoteFileInfo, Route: MakeConnectionRouteId("user@host"), Data: "/tmp"}, true},
+		{"remote-local-conn", blockCtx, RpcMessage{Command: wshrpc.Command_RemoteFileInfo, Route: MakeConnectionRouteId(wshrpc.LocalConnName), Data: "/tmp"}, false},
+	}
+	for _, test := range tests {
+		err := CheckRpcPermission(test.rpcCtx, &test.msg, testResolver)
+		if test.allowed && err != nil {
+			t.Errorf("%s: expected allowed, got %v", test.name, err)
+		}
+		if !test.allowed && err == nil {
+			t.Errorf("%s: expected permission denied", test.name)
+		}
+	}
+}
+
+func TestCommandCapsComplete(t *testing.T) {
+	for command := range WshCommandDeclMap {
+		if _, ok := wshrpc.CommandCaps[command]; !ok {
+			t.Errorf("command %q is missing from wshrpc.CommandCaps", command)
+		}
+	}
+	for command, cap := range wshrpc.CommandCaps {
+		if cap != "" && !wshrpc.IsValidCap(cap) {
+			t.Errorf("command %q has an invalid cap %q", command, cap)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"encoding/json"
+	"log"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// events are delivered to each route through a bounded queue (one goroutine per route)
+// so a stuck route (hung connserver, frozen window) cannot block Publish or the router.
+// when a queue is full the event type's policy decides what happens:
+//   dropoldest -- the oldest queued event is dropped to make room for the new event
+//   coalesce   -- a queued event with the same name and scopes is removed and the new event is added at the end
+//                 (falls back to dropoldest).  events are always delivered in publish (seq) order.
+// subscription replays (see SendReplayEvents) wait for room instead, and replayed events are never dropped or coalesced.
+
+const DefaultEventQueueSize = 1024
+const EventDelayThreshold = 1 * time.Second
+const DropLogInterval = 100
+
+const (
+	EventQueuePolicy_DropOldest = "dropoldest"
+	EventQueuePolicy_Coalesce   = "coalesce"
+)
+
+// events not in this map use EventQueuePolicy_DropOldest
+var EventQueuePolicies = map[string]string{
+	wps.Event_SysInfo:          EventQueuePolicy_Coalesce,
+	wps.Event_ControllerStatus: EventQueuePolicy_Coalesce,
+	wps.Event_WaveObjUpdate:    EventQueuePolicy_Coalesce,
+	wps.Event_ConnChange:       EventQueuePolicy_Coalesce,
+	wps.Event_Config:           EventQueuePolicy_Coalesce,
+}
+
+type queuedEvent struct {
+	Event    wps.WaveEvent
+	QueuedTs time.Time
+	Replay   bool
+}
+
+type routeEventQueue struct {
+	Lock      *sync.Mutex
+	RouteId   string
+	Events    []queuedEvent
+	NumReplay int        // replayed events in Events
+	TakenCond *sync.Cond // signaled when events are taken (or the queue is closed)
+	NotifyCh  chan struct{}
+	Closed    bool
+	Stats     wshrpc.EventQueueStats
+}
+
+func getEventQueuePolicy(eventName string) string {
+	policy := EventQueuePolicies[eventName]
+	if policy == "" {
+		return EventQueuePolicy_DropOldest
+	}
+	return policy
+}
+
+func makeRouteEventQueue(routeId string) *routeEventQueue {
+	lock := &sync.Mutex{}
+	return &routeEventQueue{
+		Lock:      lock,
+		RouteId:   routeId,
+		TakenCond: sync.NewCond(lock),
+		NotifyCh:  make(chan struct{}, 1),
+		Stats:     wshrpc.EventQueueStats{RouteId: routeId},
+	}
+}
+
+func coalesceKey(event wps.WaveEvent) string {
+	return event.Event + "|" + strings.Join(event.Scopes, ",")
+}
+
+// never blocks
+func (q *routeEventQueue) enqueue(event wps.WaveEvent) {
+	q.Lock.Lock()
+	defer q.Lock.Unlock()
+	if q.Closed {
+		return
+	}
+	if len(q.Events) >= DefaultEventQueueSize {
+		q.handleFullQueue_nolock(event)
+		return
+	}
+	q.append_nolock(queuedEvent{Event: event, QueuedTs: time.Now()})
+}
+
+// waits for room in the queue, returns false if the queue was closed
+func (q *routeEventQueue) enqueueReplay(event wps.WaveEvent) bool {
+	q.Lock.Lock()
+	defer q.Lock.Unlock()
+	for len(q.Events) >= DefaultEventQueueSize && !q.Closed {
+		q.TakenCond.Wait()
+	}
+	if q.Closed {
+		return false
+	}
+	q.append_nolock(queuedEvent{Event: event, QueuedTs: time.Now(), Replay: true})
+	q.NumReplay++
+	return true
+}
+
+// waits until every replayed event has been taken off the queue (or the queue is closed)
+func (q *routeEventQueue) waitForReplay() {
+	q.Lock.Lock()
+	defer q.Lock.Unlock()
+	for q.NumReplay > 0 && !q.Closed {
+		q.TakenCond.Wait()
+	}
+}
+
+func (q *routeEventQueue) append_nolock(qe queuedEvent) {
+	q.Events = append(q.Events, qe)
+	if len(q.Events) > q.Stats.MaxDepth {
+		q.Stats.MaxDepth = len(q.Events)
+	}
+	select {
+	case q.NotifyCh <- struct{}{}:
+	default:
+	}
+}
+
+func (q *routeEventQueue) handleFullQueue_nolock(event wps.WaveEvent) {
+	if getEventQueuePolicy(event.Event) == EventQueuePolicy_Coalesce {
+		key := coalesceKey(event)
+		for idx := len(q.Events) - 1; idx >= 0; idx-- {
+			if !q.Events[idx].Replay && coalesceKey(q.Events[idx].Event) == key {
+				// keep the original queued time (used for delay stats)
+				queuedTs := q.Events[idx].QueuedTs
+				q.Events = append(q.Events[:idx], q.Events[idx+1:]...)
+				q.Events = append(q.Events, queuedEvent{Event: event, QueuedTs: queuedTs})
+				q.Stats.Coalesced++
+				return
+			}
+		}
+	}
+	q.Stats.Dropped++
+	dropIdx := -1
+	for idx := range q.Events {
+		if !q.Events[idx].Replay {
+			dropIdx = idx
+			break
+		}
+	}
+	if dropIdx >= 0 {
+		// otherwise the queue only has replayed events, and the new event is dropped
+		q.Events = append(q.Events[:dropIdx], q.Events[dropIdx+1:]...)
+		q.Events = append(q.Events, queuedEvent{Event: event, QueuedTs: time.Now()})
+	}
+	if q.Stats.Dropped%DropLogInterval == 1 {
+		log.Printf("[router] event queue full for route %q, dropping events (total dropped:%d)\n", q.RouteId, q.Stats.Dropped)
+	}
+}
+
+// returns (events, closed)
+func (q *routeEventQueue) takeEvents() ([]queuedEvent, bool) {
+	q.Lock.Lock()
+	defer q.Lock.Unlock()
+	rtn := q.Events
+	q.Events = nil
+	q.NumReplay = 0
+	q.TakenCond.Broadcast()
+	return rtn, q.Closed
+}
+
+func (q *routeEventQueue) close() {
+	q.Lock.Lock()
+	defer q.Lock.Unlock()
+	q.Closed = true
+	q.Events = nil
+	q.NumReplay = 0
+	q.TakenCond.Broadcast()
+	select {
+	case q.NotifyCh <- struct{}{}:
+	default:
+	}
+}
+
+func (q *routeEventQueue) getStats() wshrpc.EventQueueStats {
+	q.Lock.Lock()
+	defer q.Lock.Unlock()
+	rtn := q.Stats
+	rtn.QueueDepth = len(q.Events)
+	return rtn
+}
+
+func (q *routeEventQueue) recordSent(delayed bool) {
+	q.Lock.Lock()
+	defer q.Lock.Unlock()
+	q.Stats.Sent++
+	if delayed {
+		q.Stats.Delayed++
+	}
+}
+
+func (router *WshRouter) runEventQueue(q *routeEventQueue) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[router] panic in event queue for route %q: %v\n", q.RouteId, r)
+			debug.PrintStack()
+		}
+	}()
+	for range q.NotifyCh {
+		events, closed := q.takeEvents()
+		if closed {
+			return
+		}
+		for _, qe := range events {
+			rpc := router.getLocalRouteClient(q.RouteId)
+			if rpc == nil {
+				continue
+			}
+			msg := RpcMessage{
+				Command: wshrpc.Command_EventRecv,
+				Route:   q.RouteId,
+				Data:    qe.Event,
+			}
+			msgBytes, err := json.Marshal(msg)
+			if err != nil {
+				// nothing to do
+				continue
+			}
+			// this can block (slow route), but only this route's queue is affected
+			rpc.SendRpcMessage(msgBytes)
+			q.recordSent(time.Since(qe.QueuedTs) > EventDelayThreshold)
+		}
+	}
+}
+
+func (router *WshRouter) getOrCreateEventQueue(routeId string) *routeEventQueue {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	if router.RouteMap[routeId] == nil && router.AnnouncedRoutes[routeId] == "" {
+		return nil
+	}
+	q := router.EventQueues[routeId]
+	if q == nil {
+		q = makeRouteEventQueue(routeId)
+		router.EventQueues[routeId] = q
+		go router.runEventQueue(q)
+	}
+	return q
+}
+
+func (router *WshRouter) removeEventQueue_nolock(routeId string) {
+	q := router.EventQueues[routeId]
+	if q == nil {
+		return
+	}
+	delete(router.EventQueues, routeId)
+	q.close()
+}
+
+// returns stats for each route's event queue (sorted by routeid)
+func (router *WshRouter) GetEventQueueStats() []wshrpc.EventQueueStats {
+	router.Lock.Lock()
+	queues := make([]*routeEventQueue, 0, len(router.EventQueues))
+	for _, q := range router.EventQueues {
+		queues = append(queues, q)
+	}
+	router.Lock.Unlock()
+	rtn := make([]wshrpc.EventQueueStats, 0, len(queues))
+	for _, q := range queues {
+		rtn = append(rtn, q.getStats())
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		return rtn[i].RouteId < rtn[j].RouteId
+	})
+	return rtn
+}
@@ -0,0 +1,192 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func fillEventQueue(q *routeEventQueue, eventName string, num int) {
+	for idx := 0; idx < num; idx++ {
+		q.enqueue(wps.WaveEvent{Event: eventName, Scopes: []string{"block:1"}, Data: idx})
+	}
+}
+
+func TestEventQueueDropOldest(t *testing.T) {
+	q := makeRouteEventQueue("test-route")
+	fillEventQueue(q, "test:drop", DefaultEventQueueSize+2)
+	stats := q.getStats()
+	if stats.Dropped != 2 || stats.Coalesced != 0 {
+		t.Errorf("expected 2 dropped events, got dropped:%d coalesced:%d", stats.Dropped, stats.Coalesced)
+	}
+	if stats.QueueDepth != DefaultEventQueueSize || stats.MaxDepth != DefaultEventQueueSize {
+		t.Errorf("expected the queue to stay at %d, got depth:%d maxdepth:%d", DefaultEventQueueSize, stats.QueueDepth, stats.MaxDepth)
+	}
+	events, closed := q.takeEvents()
+	if closed || len(events) != DefaultEventQueueSize {
+		t.Fatalf("expected %d queued events, got %d (closed:%v)", DefaultEventQueueSize, len(events), closed)
+	}
+	if events[0].Event.Data != 2 || events[len(events)-1].Event.Data != DefaultEventQueueSize+1 {
+		t.Errorf("expected the oldest events to be dropped, queue is %v..%v", events[0].Event.Data, events[len(events)-1].Event.Data)
+	}
+	if stats = q.getStats(); stats.QueueDepth != 0 || stats.MaxDepth != DefaultEventQueueSize {
+		t.Errorf("unexpected stats after taking events: %+v", stats)
+	}
+}
+
+func TestEventQueueCoalesce(t *testing.T) {
+	q := makeRouteEventQueue("test-route")
+	q.enqueue(wps.WaveEvent{Event: wps.Event_SysInfo, Scopes: []string{"conn:a"}, Data: "a1"})
+	q.enqueue(wps.WaveEvent{Event: wps.Event_SysInfo, Scopes: []string{"conn:b"}, Data: "b1"})
+	fillEventQueue(q, "test:drop", DefaultEventQueueSize-2)
+
+	// the older event is removed, the new one goes at the end
+	q.enqueue(wps.WaveEvent{Event: wps.Event_SysInfo, Scopes: []string{"conn:b"}, Data: "b2"})
+	stats := q.getStats()
+	if stats.Coalesced != 1 || stats.Dropped != 0 {
+		t.Errorf("expected 1 coalesced event, got coalesced:%d dropped:%d", stats.Coalesced, stats.Dropped)
+	}
+	// no queued event to coalesce with, falls back to dropping the oldest
+	q.enqueue(wps.WaveEvent{Event: wps.Event_SysInfo, Scopes: []string{"conn:c"}, Data: "c1"})
+	stats = q.getStats()
+	if stats.Coalesced != 1 || stats.Dropped != 1 || stats.QueueDepth != DefaultEventQueueSize {
+		t.Errorf("unexpected stats after overflow: %+v", stats)
+	}
+	events, _ := q.takeEvents()
+	if events[0].Event.Data != 0 {
+		t.Errorf("expected a1 to be dropped as the oldest event, queue starts with %v", events[0].Event.Data)
+	}
+	if events[len(events)-2].Event.Data != "b2" || events[len(events)-1].Event.Data != "c1" {
+		t.Errorf("expected b2 and c1 at the end of the queue, got %v %v", events[len(events)-2].Event.Data, events[len(events)-1].Event.Data)
+	}
+}
+
+func TestEventQueueCoalesceOrder(t *testing.T) {
+	q := makeRouteEventQueue("test-route")
+	var seq int64
+	enqueue := func(eventName string, scope string) {
+		seq++
+		q.enqueue(wps.WaveEvent{Event: eventName, Scopes: []string{scope}, Seq: seq})
+	}
+	enqueue(wps.Event_SysInfo, "conn:a")
+	for idx := 0; idx < DefaultEventQueueSize-1; idx++ {
+		enqueue("test:drop", "block:1")
+	}
+	enqueue(wps.Event_SysInfo, "conn:a")
+	enqueue(wps.Event_ControllerStatus, "block:1")
+	enqueue(wps.Event_SysInfo, "conn:a")
+	events, _ := q.takeEvents()
+	if stats := q.getStats(); stats.Coalesced != 2 {
+		t.Errorf("expected 2 coalesced events: %+v", stats)
+	}
+	for idx := 1; idx < len(events); idx++ {
+		if events[idx].Event.Seq <= events[idx-1].Event.Seq {
+			t.Fatalf("delivered seqs are not increasing: %d after %d", events[idx].Event.Seq, events[idx-1].Event.Seq)
+		}
+	}
+	if events[len(events)-1].Event.Seq != seq {
+		t.Errorf("expected the newest event at the end of the queue, got seq %d", events[len(events)-1].Event.Seq)
+	}
+}
+
+func TestEventQueueStats(t *testing.T) {
+	q := makeRouteEventQueue("test-route")
+	fillEventQueue(q, "test:drop", 3)
+	q.recordSent(false)
+	q.recordSent(true)
+	stats := q.getStats()
+	if stats.RouteId != "test-route" || stats.Sent != 2 || stats.Delayed != 1 || stats.QueueDepth != 3 || stats.MaxDepth != 3 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	q.close()
+	q.enqueue(wps.WaveEvent{Event: "test:drop"})
+	events, closed := q.takeEvents()
+	if !closed || len(events) != 0 {
+		t.Errorf("closed queue should not accept events (closed:%v events:%d)", closed, len(events))
+	}
+	if stats = q.getStats(); stats.Dropped != 0 {
+		t.Errorf("events sent to a closed queue should not count as dropped: %+v", stats)
+	}
+}
+
+func TestEventQueueReplayNotDropped(t *testing.T) {
+	q := makeRouteEventQueue("test-route")
+	for idx := 0; idx < DefaultEventQueueSize; idx++ {
+		if !q.enqueueReplay(wps.WaveEvent{Event: "test:replay", Data: idx}) {
+			t.Fatalf("replay enqueue failed")
+		}
+	}
+	// live events can't push out replayed events
+	q.enqueue(wps.WaveEvent{Event: "test:drop"})
+	q.enqueue(wps.WaveEvent{Event: wps.Event_SysInfo})
+	events, _ := q.takeEvents()
+	if len(events) != DefaultEventQueueSize || events[0].Event.Data != 0 || events[len(events)-1].Event.Event != "test:replay" {
+		t.Errorf("replayed events were dropped (%d events)", len(events))
+	}
+	if stats := q.getStats(); stats.Dropped != 2 {
+		t.Errorf("expected the live events to be dropped: %+v", stats)
+	}
+}
+
+// a replay much longer than the queue, with events published while it runs, reaches a slow route in order
+func TestReplayThroughRouter(t *testing.T) {
+	const numReplay = 3000
+	const numLive = 500
+	router := NewWshRouter()
+	client := makeTestRpcClient()
+	routeId := MakeProcRouteId("replay")
+	router.RegisterRoute(routeId, client)
+	defer router.UnregisterRoute(routeId)
+	broker := wps.MakeBroker()
+	broker.SetClient(router)
+	for idx := 0; idx < numReplay+1; idx++ {
+		broker.Publish(wps.WaveEvent{Event: "test:replay", Persist: wps.MaxPersist})
+	}
+	err := broker.Subscribe(routeId, wps.SubscriptionRequest{Event: "test:replay", AllScopes: true, Since: 1})
+	if err != nil {
+		t.Fatalf("subscribe error: %v", err)
+	}
+	go func() {
+		for idx := 0; idx < numLive; idx++ {
+			broker.Publish(wps.WaveEvent{Event: "test:replay"})
+		}
+	}()
+	var lastSeq int64 = 1
+	for idx := 0; idx < numReplay+numLive; idx++ {
+		var msgBytes []byte
+		select {
+		case msgBytes = <-client.SentCh:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout after %d events (last seq %d)", idx, lastSeq)
+		}
+		var msg RpcMessage
+		json.Unmarshal(msgBytes, &msg)
+		if msg.Command != wshrpc.Command_EventRecv {
+			t.Fatalf("unexpected message: %#v", msg)
+		}
+		var event wps.WaveEvent
+		json.Unmarshal(mustMarshal(msg.Data), &event)
+		if event.Seq != lastSeq+1 {
+			t.Fatalf("expected seq %d, got %d", lastSeq+1, event.Seq)
+		}
+		lastSeq = event.Seq
+		if idx%100 == 0 {
+			// slow consumer
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if stats := router.GetEventQueueStats(); len(stats) != 1 || stats[0].Dropped != 0 {
+		t.Errorf("expected no dropped events: %+v", stats)
+	}
+}
+
+func mustMarshal(v any) []byte {
+	barr, _ := json.Marshal(v)
+	return barr
+}
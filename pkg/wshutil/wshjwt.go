@@ -0,0 +1,169 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// jwt tokens (WAVETERM_JWT) are signed with a random key that only lives in wavesrv memory.
+// the signing key is rotated every JwtKeyRotationInterval, old keys are kept until every token they
+// signed has expired (tokens carry the key id in the "kid" header).
+// tokens for a block are revoked when the block is deleted (checked on authentication and on every
+// command sent over an already authenticated route, so a revocation is kept while the block has routes).
+// tokens are short-lived.  the controllers mint new tokens when a shell or connserver (re)starts, and
+// long-running shells refresh their WAVETERM_JWT with "wsh token refresh" (the rc files do it from the prompt).
+// a block token that expired less than JwtRefreshGracePeriod ago (a shell that was idle, a script that never
+// draws a prompt) can still authenticate a session that only refreshes it, wsh does this by itself.
+
+const JwtTokenExpiry = 12 * time.Hour
+const JwtRefreshGracePeriod = 30 * 24 * time.Hour
+const JwtKeyRotationInterval = 4 * time.Hour
+
+// how long a key (or revocation) is needed: a token can be refreshed until JwtRefreshGracePeriod after it expires
+const jwtTokenMaxUseTime = JwtTokenExpiry + JwtRefreshGracePeriod
+
+type jwtSigningKey struct {
+	KeyId     string
+	Secret    []byte
+	CreatedTs time.Time
+}
+
+type jwtKeyStore struct {
+	Lock          *sync.Mutex
+	Keys          map[string]*jwtSigningKey
+	CurrentKey    *jwtSigningKey
+	RevokedBlocks map[string]time.Time // blockid -> revoked time
+}
+
+var jwtKeys = &jwtKeyStore{
+	Lock:          &sync.Mutex{},
+	Keys:          make(map[string]*jwtSigningKey),
+	RevokedBlocks: make(map[string]time.Time),
+}
+
+func makeJwtSigningKey() (*jwtSigningKey, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, fmt.Errorf("error generating jwt signing key: %w", err)
+	}
+	keyIdBytes := make([]byte, 8)
+	_, err = rand.Read(keyIdBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error generating jwt key id: %w", err)
+	}
+	return &jwtSigningKey{KeyId: hex.EncodeToString(keyIdBytes), Secret: secret, CreatedTs: time.Now()}, nil
+}
+
+// removes keys that can no longer have usable tokens
+func (ks *jwtKeyStore) prune_nolock() {
+	now := time.Now()
+	for keyId, key := range ks.Keys {
+		if key != ks.CurrentKey && now.Sub(key.CreatedTs) > JwtKeyRotationInterval+jwtTokenMaxUseTime {
+			delete(ks.Keys, keyId)
+		}
+	}
+}
+
+// removes revocations for blocks that can no longer have usable tokens, or routes authenticated with them
+// (routes are checked outside of the key store lock)
+func (ks *jwtKeyStore) pruneRevokedBlocks(router *WshRouter) {
+	var expiredBlockIds []string
+	ks.Lock.Lock()
+	for blockId, revokedTs := range ks.RevokedBlocks {
+		if time.Since(revokedTs) > jwtTokenMaxUseTime {
+			expiredBlockIds = append(expiredBlockIds, blockId)
+		}
+	}
+	ks.Lock.Unlock()
+	for _, blockId := range expiredBlockIds {
+		if router != nil && router.hasBlockRoute(blockId) {
+			continue
+		}
+		ks.Lock.Lock()
+		delete(ks.RevokedBlocks, blockId)
+		ks.Lock.Unlock()
+	}
+}
+
+// returns the current signing key (rotating it if it is too old)
+func (ks *jwtKeyStore) getSigningKey() (*jwtSigningKey, error) {
+	ks.Lock.Lock()
+	defer ks.Lock.Unlock()
+	if ks.CurrentKey != nil && time.Since(ks.CurrentKey.CreatedTs) < JwtKeyRotationInterval {
+		return ks.CurrentKey, nil
+	}
+	newKey, err := makeJwtSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	if ks.CurrentKey != nil {
+		log.Printf("rotating jwt signing key\n")
+	}
+	ks.Keys[newKey.KeyId] = newKey
+	ks.CurrentKey = newKey
+	ks.prune_nolock()
+	return newKey, nil
+}
+
+func (ks *jwtKeyStore) getVerifyKey(keyId string) ([]byte, error) {
+	ks.Lock.Lock()
+	defer ks.Lock.Unlock()
+	ks.prune_nolock()
+	key := ks.Keys[keyId]
+	if key == nil {
+		return nil, fmt.Errorf("unknown or expired signing key")
+	}
+	return key.Secret, nil
+}
+
+// revokes all tokens issued for the block (called when the block is deleted)
+func RevokeBlockTokens(blockId string) {
+	if blockId == "" {
+		return
+	}
+	jwtKeys.pruneRevokedBlocks(DefaultRouter)
+	jwtKeys.Lock.Lock()
+	defer jwtKeys.Lock.Unlock()
+	jwtKeys.RevokedBlocks[blockId] = time.Now()
+}
+
+func IsBlockTokenRevoked(blockId string) bool {
+	if blockId == "" {
+		return false
+	}
+	jwtKeys.Lock.Lock()
+	defer jwtKeys.Lock.Unlock()
+	_, revoked := jwtKeys.RevokedBlocks[blockId]
+	return revoked
+}
+
+// returns a new token with the same claims as a valid (unrevoked) token, expired block tokens can be
+// refreshed for JwtRefreshGracePeriod
+func RefreshClientJWTToken(tokenStr string) (string, *wshrpc.RpcContext, error) {
+	rpcCtx, expiry, err := validateToken(tokenStr)
+	if err != nil {
+		return "", nil, err
+	}
+	if expiry.Before(time.Now()) && !canRefreshExpiredToken(rpcCtx, expiry) {
+		return "", nil, ErrTokenExpired
+	}
+	sockName, err := ExtractUnverifiedSocketName(tokenStr)
+	if err != nil {
+		return "", nil, err
+	}
+	newTokenStr, err := MakeClientJWTToken(*rpcCtx, sockName)
+	if err != nil {
+		return "", nil, err
+	}
+	return newTokenStr, rpcCtx, nil
+}
@@ -0,0 +1,218 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestJwtTokens(t *testing.T) {
+	blockId := uuid.New().String()
+	tokenStr, err := MakeClientJWTToken(wshrpc.RpcContext{BlockId: blockId, TabId: testTabId}, "/tmp/wave.sock")
+	if err != nil {
+		t.Fatalf("error making token: %v", err)
+	}
+	rpcCtx, err := ValidateAndExtractRpcContextFromToken(tokenStr)
+	if err != nil {
+		t.Fatalf("error validating token: %v", err)
+	}
+	if rpcCtx.BlockId != blockId || rpcCtx.TabId != testTabId {
+		t.Errorf("wrong context: %#v", rpcCtx)
+	}
+
+	// rotated keys still validate old tokens
+	jwtKeys.Lock.Lock()
+	jwtKeys.CurrentKey.CreatedTs = time.Now().Add(-JwtKeyRotationInterval - time.Minute)
+	jwtKeys.Lock.Unlock()
+	newTokenStr, err := MakeClientJWTToken(wshrpc.RpcContext{BlockId: blockId}, "/tmp/wave.sock")
+	if err != nil {
+		t.Fatalf("error making token: %v", err)
+	}
+	if _, err := ValidateAndExtractRpcContextFromToken(tokenStr); err != nil {
+		t.Errorf("old token should still be valid after rotation: %v", err)
+	}
+	if _, err := ValidateAndExtractRpcContextFromToken(newTokenStr); err != nil {
+		t.Errorf("new token should be valid: %v", err)
+	}
+
+	// retired keys do not
+	jwtKeys.Lock.Lock()
+	for _, key := range jwtKeys.Keys {
+		if key != jwtKeys.CurrentKey {
+			key.CreatedTs = time.Now().Add(-JwtKeyRotationInterval - jwtTokenMaxUseTime - time.Minute)
+		}
+	}
+	jwtKeys.Lock.Unlock()
+	if _, err := ValidateAndExtractRpcContextFromToken(tokenStr); err == nil {
+		t.Errorf("token signed with a retired key should be invalid")
+	}
+
+	RevokeBlockTokens(blockId)
+	if _, err := ValidateAndExtractRpcContextFromToken(newTokenStr); err == nil {
+		t.Errorf("revoked token should be invalid")
+	}
+}
+
+func TestRefreshJwtToken(t *testing.T) {
+	blockId := uuid.New().String()
+	rpcCtx := wshrpc.RpcContext{BlockId: blockId, TabId: testTabId, Conn: "user@host", Caps: wshrpc.DefaultRemoteCaps}
+	tokenStr, err := MakeClientJWTToken(rpcCtx, "/tmp/wave.sock")
+	if err != nil {
+		t.Fatalf("error making token: %v", err)
+	}
+	newTokenStr, refreshCtx, err := RefreshClientJWTToken(tokenStr)
+	if err != nil {
+		t.Fatalf("error refreshing token: %v", err)
+	}
+	if refreshCtx.BlockId != blockId || refreshCtx.Conn != "user@host" {
+		t.Errorf("wrong refresh context: %#v", refreshCtx)
+	}
+	newCtx, err := ValidateAndExtractRpcContextFromToken(newTokenStr)
+	if err != nil {
+		t.Fatalf("refreshed token should be valid: %v", err)
+	}
+	if newCtx.BlockId != blockId || newCtx.TabId != testTabId || newCtx.Conn != "user@host" || len(newCtx.Caps) != len(rpcCtx.Caps) {
+		t.Errorf("refreshed token has different claims: %#v", newCtx)
+	}
+	if sockName, _ := ExtractUnverifiedSocketName(newTokenStr); sockName != "/tmp/wave.sock" {
+		t.Errorf("refreshed token has the wrong socket: %q", sockName)
+	}
+	RevokeBlockTokens(blockId)
+	if _, _, err := RefreshClientJWTToken(newTokenStr); err == nil {
+		t.Errorf("revoked token should not be refreshed")
+	}
+}
+
+func TestPruneRevokedBlocks(t *testing.T) {
+	blockId := uuid.New().String()
+	router := NewWshRouter()
+	proxy := MakeRpcProxy()
+	proxy.SetRpcContext(&wshrpc.RpcContext{BlockId: blockId, Caps: []string{wshrpc.Cap_All}})
+	routeId := MakeProcRouteId("prune-test")
+	router.RegisterRoute(routeId, proxy)
+
+	RevokeBlockTokens(blockId)
+	jwtKeys.pruneRevokedBlocks(router)
+	if !IsBlockTokenRevoked(blockId) {
+		t.Errorf("revocation was pruned before its tokens expired")
+	}
+	jwtKeys.Lock.Lock()
+	jwtKeys.RevokedBlocks[blockId] = time.Now().Add(-jwtTokenMaxUseTime - time.Minute)
+	jwtKeys.Lock.Unlock()
+	jwtKeys.pruneRevokedBlocks(router)
+	if !IsBlockTokenRevoked(blockId) {
+		t.Errorf("revocation was pruned while the block still has a route")
+	}
+	router.UnregisterRoute(routeId)
+	jwtKeys.pruneRevokedBlocks(router)
+	if IsBlockTokenRevoked(blockId) {
+		t.Errorf("revocation was kept after its tokens expired and its routes were closed")
+	}
+}
+
+func makeExpiredTestToken(t *testing.T, rpcCtx wshrpc.RpcContext, expiredFor time.Duration) string {
+	signingKey, err := jwtKeys.getSigningKey()
+	if err != nil {
+		t.Fatalf("error getting signing key: %v", err)
+	}
+	claims := jwt.MapClaims{"iss": "waveterm", "sock": "/tmp/wave.sock", "exp": time.Now().Add(-expiredFor).Unix()}
+	if rpcCtx.BlockId != "" {
+		claims["blockid"] = rpcCtx.BlockId
+	}
+	if rpcCtx.Conn != "" {
+		claims["conn"] = rpcCtx.Conn
+	}
+	if rpcCtx.ClientType != "" {
+		claims["ctype"] = rpcCtx.ClientType
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = signingKey.KeyId
+	tokenStr, err := token.SignedString(signingKey.Secret)
+	if err != nil {
+		t.Fatalf("error signing token: %v", err)
+	}
+	return tokenStr
+}
+
+func TestExpiredTokenRefresh(t *testing.T) {
+	blockId := uuid.New().String()
+	tokenStr := makeExpiredTestToken(t, wshrpc.RpcContext{BlockId: blockId}, time.Hour)
+	if _, err := ValidateAndExtractRpcContextFromToken(tokenStr); err != ErrTokenExpired {
+		t.Errorf("expected an expired token error, got %v", err)
+	}
+	if !IsUnverifiedTokenExpired(tokenStr) {
+		t.Errorf("expected the client to see the token as expired")
+	}
+
+	// an expired block token authenticates a session with no caps
+	for _, extractFn := range []func(string) (*wshrpc.RpcContext, error){ValidateAndExtractAuthContext, ExtractUnverifiedRpcContext} {
+		authCtx, err := extractFn(tokenStr)
+		if err != nil {
+			t.Fatalf("expected the expired token to authenticate: %v", err)
+		}
+		if authCtx.BlockId != blockId || authCtx.Caps == nil || len(authCtx.Caps) != 0 {
+			t.Errorf("expected a refresh-only context, got %#v", authCtx)
+		}
+	}
+	router := NewWshRouter()
+	proxy := MakeRpcProxy()
+	proxy.SetRpcContext(&wshrpc.RpcContext{BlockId: blockId, Caps: []string{}})
+	routeId := MakeProcRouteId("refresh-test")
+	router.RegisterRoute(routeId, proxy)
+	defer router.UnregisterRoute(routeId)
+	if err := router.checkPermission(routeId, &RpcMessage{Command: wshrpc.Command_ConnStatus, Source: routeId}); err == nil {
+		t.Errorf("a refresh-only session should not run other commands")
+	}
+	if err := router.checkPermission(routeId, &RpcMessage{Command: wshrpc.Command_AuthRefresh, Source: routeId}); err != nil {
+		t.Errorf("a refresh-only session should refresh its token: %v", err)
+	}
+
+	newTokenStr, _, err := RefreshClientJWTToken(tokenStr)
+	if err != nil {
+		t.Fatalf("error refreshing an expired token: %v", err)
+	}
+	if newCtx, err := ValidateAndExtractRpcContextFromToken(newTokenStr); err != nil || newCtx.BlockId != blockId || newCtx.Caps != nil {
+		t.Errorf("refreshed token should be valid with the original claims: %#v (%v)", newCtx, err)
+	}
+
+	// not after the grace period, and not for tokens without a block
+	oldTokenStr := makeExpiredTestToken(t, wshrpc.RpcContext{BlockId: blockId}, JwtRefreshGracePeriod+time.Hour)
+	connTokenStr := makeExpiredTestToken(t, wshrpc.RpcContext{ClientType: wshrpc.ClientType_ConnServer, Conn: "user@host"}, time.Hour)
+	for _, badToken := range []string{oldTokenStr, connTokenStr} {
+		if _, err := ValidateAndExtractAuthContext(badToken); err == nil {
+			t.Errorf("token should not authenticate")
+		}
+		if _, _, err := RefreshClientJWTToken(badToken); err == nil {
+			t.Errorf("token should not be refreshed")
+		}
+	}
+	RevokeBlockTokens(blockId)
+	if _, _, err := RefreshClientJWTToken(tokenStr); err == nil {
+		t.Errorf("revoked token should not be refreshed")
+	}
+}
+
+// revocation also cuts off routes that are already authenticated
+func TestRevokedRoute(t *testing.T) {
+	blockId := uuid.New().String()
+	router := NewWshRouter()
+	proxy := MakeRpcProxy()
+	proxy.SetRpcContext(&wshrpc.RpcContext{BlockId: blockId, Caps: []string{wshrpc.Cap_All}})
+	routeId := MakeProcRouteId("revoke-test")
+	router.RegisterRoute(routeId, proxy)
+	defer router.UnregisterRoute(routeId)
+	msg := &RpcMessage{Command: wshrpc.Command_ConnStatus, Source: routeId}
+	if err := router.checkPermission(routeId, msg); err != nil {
+		t.Fatalf("expected the route to be allowed: %v", err)
+	}
+	RevokeBlockTokens(blockId)
+	if err := router.checkPermission(routeId, msg); err == nil {
+		t.Errorf("expected commands from a revoked block to be denied")
+	}
+}
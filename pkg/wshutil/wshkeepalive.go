@@ -0,0 +1,165 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// the router pings its routes (routeping, answered by WshRpc itself) so links that die silently
+// (an ssh connection that stops passing packets) are detected.  any response counts, so old clients
+// that answer with an error are still alive.  a route that misses MaxMissed pings in a row is
+// unregistered and the unresponsive handler is called (conncontroller marks the connection unresponsive).
+
+const DefaultKeepAliveIntervalMs = 15000
+const DefaultKeepAliveMaxMissed = 3
+
+// by default only connserver routes are pinged (the routes that cross an ssh link)
+var DefaultKeepAliveRoutePrefixes = []string{"conn:"}
+
+type KeepAliveOpts struct {
+	IntervalMs    int // <= 0 disables keepalives
+	MaxMissed     int
+	RoutePrefixes []string
+}
+
+type RouteUnresponsiveFn func(routeId string)
+
+type routeKeepAlive struct {
+	Client       AbstractRpcClient
+	PendingReqId string
+	Missed       int
+}
+
+func (opts KeepAliveOpts) matchesRoute(routeId string) bool {
+	for _, prefix := range opts.RoutePrefixes {
+		if strings.HasPrefix(routeId, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (router *WshRouter) SetRouteUnresponsiveHandler(fn RouteUnresponsiveFn) {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	router.UnresponsiveFn = fn
+}
+
+// optsFn is called before every round of pings (so settings changes take effect)
+func (router *WshRouter) StartKeepAlive(optsFn func() KeepAliveOpts) {
+	go func() {
+		for {
+			opts := optsFn()
+			if opts.IntervalMs <= 0 {
+				router.clearKeepAlive()
+				time.Sleep(DefaultKeepAliveIntervalMs * time.Millisecond)
+				continue
+			}
+			router.runKeepAliveRound(opts)
+			time.Sleep(time.Duration(opts.IntervalMs) * time.Millisecond)
+		}
+	}()
+}
+
+func (router *WshRouter) clearKeepAlive() {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	clear(router.KeepAliveMap)
+	clear(router.PingMap)
+}
+
+func (router *WshRouter) removeKeepAlive_nolock(routeId string) {
+	delete(router.KeepAliveMap, routeId)
+	for reqId, pingRouteId := range router.PingMap {
+		if pingRouteId == routeId {
+			delete(router.PingMap, reqId)
+		}
+	}
+}
+
+func (router *WshRouter) runKeepAliveRound(opts KeepAliveOpts) {
+	if opts.MaxMissed <= 0 {
+		opts.MaxMissed = DefaultKeepAliveMaxMissed
+	}
+	pings := make(map[string]AbstractRpcClient)      // reqid => client
+	pingRoutes := make(map[string]string)            // reqid => routeid
+	deadRoutes := make(map[string]AbstractRpcClient) // routeid => client
+	router.Lock.Lock()
+	for routeId := range router.KeepAliveMap {
+		if router.RouteMap[routeId] == nil || !opts.matchesRoute(routeId) {
+			router.removeKeepAlive_nolock(routeId)
+		}
+	}
+	for routeId, client := range router.RouteMap {
+		if !opts.matchesRoute(routeId) {
+			continue
+		}
+		state := router.KeepAliveMap[routeId]
+		if state == nil || state.Client != client {
+			// new (or re-registered) route
+			router.removeKeepAlive_nolock(routeId)
+			state = &routeKeepAlive{Client: client}
+			router.KeepAliveMap[routeId] = state
+		}
+		if state.PendingReqId != "" {
+			// a late response still counts (the reqid stays in the ping map)
+			state.Missed++
+			state.PendingReqId = ""
+		}
+		if state.Missed >= opts.MaxMissed {
+			router.removeKeepAlive_nolock(routeId)
+			deadRoutes[routeId] = client
+			continue
+		}
+		reqId := uuid.New().String()
+		state.PendingReqId = reqId
+		router.PingMap[reqId] = routeId
+		pings[reqId] = client
+		pingRoutes[reqId] = routeId
+	}
+	unresponsiveFn := router.UnresponsiveFn
+	router.Lock.Unlock()
+	for reqId, client := range pings {
+		pingMsg := RpcMessage{Command: wshrpc.Command_RoutePing, ReqId: reqId, Source: SysRoute, Route: pingRoutes[reqId], Timeout: opts.IntervalMs}
+		pingBytes, _ := json.Marshal(pingMsg)
+		// a dead link can block its client, never block the keepalive loop
+		go client.SendRpcMessage(pingBytes)
+	}
+	for routeId, client := range deadRoutes {
+		if router.GetRpc(routeId) != client {
+			// re-registered in the meantime
+			continue
+		}
+		log.Printf("[router] route %q is unresponsive (%d keepalive pings missed)\n", routeId, opts.MaxMissed)
+		router.UnregisterRoute(routeId)
+		if unresponsiveFn != nil {
+			go unresponsiveFn(routeId)
+		}
+	}
+}
+
+// returns true if resId is a keepalive ping (the response is consumed)
+func (router *WshRouter) handleKeepAliveResponse(resId string) bool {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	routeId, ok := router.PingMap[resId]
+	if !ok {
+		return false
+	}
+	delete(router.PingMap, resId)
+	if state := router.KeepAliveMap[routeId]; state != nil {
+		state.Missed = 0
+		if state.PendingReqId == resId {
+			state.PendingReqId = ""
+		}
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func waitForPong(t *testing.T, router *WshRouter, routeId string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		router.Lock.Lock()
+		pending := router.KeepAliveMap[routeId].PendingReqId
+		router.Lock.Unlock()
+		if pending == "" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no keepalive response from %q", routeId)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRouteKeepAlive(t *testing.T) {
+	router := NewWshRouter()
+	aliveRpc := MakeWshRpc(nil, nil, wshrpc.RpcContext{}, nil)
+	router.RegisterRoute("conn:alive", aliveRpc)
+	deadClient := makeTestRpcClient()
+	router.RegisterRoute("conn:dead", deadClient)
+	router.RegisterRoute("proc:other", makeTestRpcClient())
+	unresponsiveCh := make(chan string, 1)
+	router.SetRouteUnresponsiveHandler(func(routeId string) {
+		unresponsiveCh <- routeId
+	})
+	opts := KeepAliveOpts{IntervalMs: 1000, MaxMissed: 2, RoutePrefixes: DefaultKeepAliveRoutePrefixes}
+	for i := 0; i < 3; i++ {
+		router.runKeepAliveRound(opts)
+		if i < 2 {
+			waitForPong(t, router, "conn:alive")
+			msg := recvTestMsg(t, deadClient.SentCh)
+			if msg.Command != wshrpc.Command_RoutePing || msg.Route != "conn:dead" {
+				t.Fatalf("expected a ping, got %#v", msg)
+			}
+		}
+	}
+	select {
+	case routeId := <-unresponsiveCh:
+		if routeId != "conn:dead" {
+			t.Fatalf("wrong unresponsive route %q", routeId)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("dead route was not reported")
+	}
+	if router.GetRpc("conn:dead") != nil {
+		t.Fatalf("dead route is still registered")
+	}
+	if router.GetRpc("conn:alive") == nil || router.GetRpc("proc:other") == nil {
+		t.Fatalf("live routes were unregistered")
+	}
+}
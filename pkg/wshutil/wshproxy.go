@@ -16,6 +16,7 @@ import (
 type WshRpcProxy struct {
 	Lock         *sync.Mutex
 	RpcContext   *wshrpc.RpcContext
+	AuthToken    string // the jwt this proxy authenticated with (sub-routers announce it upstream)
 	ToRemoteCh   chan []byte
 	FromRemoteCh chan []byte
 }
@@ -40,6 +41,12 @@ func (p *WshRpcProxy) GetRpcContext() *wshrpc.RpcContext {
 	return p.RpcContext
 }
 
+func (p *WshRpcProxy) GetAuthToken() string {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	return p.AuthToken
+}
+
 func (p *WshRpcProxy) sendResponseError(msg RpcMessage, sendErr error) {
 	if msg.ReqId == "" {
 		// no response needed
@@ -76,7 +83,14 @@ func handleAuthenticationCommand(msg RpcMessage) (*wshrpc.RpcContext, string, er
 	if !ok {
 		return nil, "", fmt.Errorf("data in authenticate message not a string")
 	}
-	newCtx, err := ValidateAndExtractRpcContextFromToken(strData)
+	var newCtx *wshrpc.RpcContext
+	var err error
+	if DefaultRouter.GetUpstreamClient() != nil {
+		// sub-routers can't validate tokens, the terminal router validates it when the route is announced
+		newCtx, err = ExtractUnverifiedRpcContext(strData)
+	} else {
+		newCtx, err = ValidateAndExtractAuthContext(strData)
+	}
 	if err != nil {
 		return nil, "", fmt.Errorf("error validating token: %w", err)
 	}
@@ -105,7 +119,7 @@ func (p *WshRpcProxy) HandleAuthentication() (*wshrpc.RpcContext, error) {
 			return nil, fmt.Errorf("remote closed, not authenticated")
 		}
 		var msg RpcMessage
-		err := json.Unmarshal(msgBytes, &msg)
+		err := UnmarshalRpcMessage(msgBytes, &msg)
 		if err != nil {
 			// nothing to do, can't even send a response since we don't have Source or ReqId
 			continue
@@ -126,6 +140,9 @@ func (p *WshRpcProxy) HandleAuthentication() (*wshrpc.RpcContext, error) {
 			p.sendResponseError(msg, err)
 			continue
 		}
+		p.Lock.Lock()
+		p.AuthToken, _ = msg.Data.(string)
+		p.Lock.Unlock()
 		p.sendResponse(msg, routeId)
 		return newCtx, nil
 	}
@@ -141,17 +158,20 @@ func (p *WshRpcProxy) RecvRpcMessage() ([]byte, bool) {
 		return msgBytes, ok
 	}
 	var msg RpcMessage
-	err := json.Unmarshal(msgBytes, &msg)
-	if err != nil {
-		// nothing to do here -- will error out at another level
+	err := UnmarshalRpcMessage(msgBytes, &msg)
+	if err != nil || msg.Command == "" {
+		// nothing to do here -- will error out at another level (or not a command)
 		return msgBytes, true
 	}
-	msg.Data, err = recodeCommandData(msg.Command, msg.Data, p.RpcContext)
+	msg.Data, err = recodeCommandData(&msg, p.RpcContext)
 	if err != nil {
 		// nothing to do here -- will error out at another level
 		return msgBytes, true
 	}
-	newBytes, err := json.Marshal(msg)
+	// the recoded data holds the binary payload (if any), it gets split out again when encoding
+	msg.BinField = ""
+	msg.BinData = nil
+	newBytes, err := EncodeRpcMessage(&msg)
 	if err != nil {
 		// nothing to do here
 		return msgBytes, true
@@ -12,6 +12,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/wavetermdev/waveterm/pkg/wps"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 )
@@ -19,6 +20,7 @@ import (
 const DefaultRoute = "wavesrv"
 const SysRoute = "sys" // this route doesn't exist, just a placeholder for system messages
 const ElectronRoute = "electron"
+const UpstreamRoute = "upstream" // this route doesn't exist, placeholder for messages from the upstream client (see wshsubrouter.go)
 
 // this works like a network switch
 
@@ -28,6 +30,8 @@ type routeInfo struct {
 	RpcId         string
 	SourceRouteId string
 	DestRouteId   string
+	Command       string
+	StartTs       time.Time
 }
 
 type msgAndRoute struct {
@@ -37,10 +41,19 @@ type msgAndRoute struct {
 
 type WshRouter struct {
 	Lock            *sync.Mutex
-	RouteMap        map[string]AbstractRpcClient // routeid => client
-	UpstreamClient  AbstractRpcClient            // upstream client (if we are not the terminal router)
-	AnnouncedRoutes map[string]string            // routeid => local routeid
-	RpcMap          map[string]*routeInfo        // rpcid => routeinfo
+	RouteMap        map[string]AbstractRpcClient  // routeid => client
+	UpstreamClient  AbstractRpcClient             // upstream client (if we are not the terminal router)
+	AnnouncedRoutes map[string]string             // routeid => local routeid
+	AnnouncedCtx    map[string]*wshrpc.RpcContext // routeid => validated context (sub-routers: once the upstream has accepted the announcement)
+	PendingRoutes   map[string]bool               // downstream routes waiting for the upstream to validate their announcement (sub-routers only)
+	PendingAnnounce map[string]*pendingAnnounce   // announce reqid => pending announcement (sub-routers only, see wshsubrouter.go)
+	RpcMap          map[string]*routeInfo         // rpcid => routeinfo
+	EventQueues     map[string]*routeEventQueue   // routeid => event queue (see wsheventqueue.go)
+	Tracer          *rpcTracer                    // rpc stats and tracing (see wshrpctrace.go)
+	ConnResolver    ConnResolverFn                // used for Cap_BlockSelf checks on connserver routes (see wshauth.go)
+	KeepAliveMap    map[string]*routeKeepAlive    // routeid => keepalive state (see wshkeepalive.go)
+	PingMap         map[string]string             // keepalive ping reqid => routeid
+	UnresponsiveFn  RouteUnresponsiveFn           // called when a route stops answering keepalive pings
 	InputCh         chan msgAndRoute
 }
 
@@ -60,6 +73,10 @@ func MakeProcRouteId(procId string) string {
 	return "proc:" + procId
 }
 
+func MakeGatewayRouteId(sessionId string) string {
+	return "gateway:" + sessionId
+}
+
 var DefaultRouter = NewWshRouter()
 
 func NewWshRouter() *WshRouter {
@@ -67,7 +84,14 @@ func NewWshRouter() *WshRouter {
 		Lock:            &sync.Mutex{},
 		RouteMap:        make(map[string]AbstractRpcClient),
 		AnnouncedRoutes: make(map[string]string),
+		AnnouncedCtx:    make(map[string]*wshrpc.RpcContext),
+		PendingRoutes:   make(map[string]bool),
+		PendingAnnounce: make(map[string]*pendingAnnounce),
 		RpcMap:          make(map[string]*routeInfo),
+		EventQueues:     make(map[string]*routeEventQueue),
+		Tracer:          makeRpcTracer(),
+		KeepAliveMap:    make(map[string]*routeKeepAlive),
+		PingMap:         make(map[string]string),
 		InputCh:         make(chan msgAndRoute, DefaultInputChSize),
 	}
 	go rtn.runServer()
@@ -81,22 +105,28 @@ func noRouteErr(routeId string) error {
 	return fmt.Errorf("no route for %q", routeId)
 }
 
+// does not block, events are queued per route (see wsheventqueue.go)
 func (router *WshRouter) SendEvent(routeId string, event wps.WaveEvent) {
-	rpc := router.GetRpc(routeId)
-	if rpc == nil {
+	q := router.getOrCreateEventQueue(routeId)
+	if q == nil {
 		return
 	}
-	msg := RpcMessage{
-		Command: wshrpc.Command_EventRecv,
-		Route:   routeId,
-		Data:    event,
-	}
-	msgBytes, err := json.Marshal(msg)
-	if err != nil {
-		// nothing to do
+	q.enqueue(event)
+}
+
+// implements wps.ReplayClient.  waits for room in the route's queue (replayed events are never dropped), and returns
+// once the events have been taken off the queue so the live events that follow have the whole queue
+func (router *WshRouter) SendReplayEvents(routeId string, events []wps.WaveEvent) {
+	q := router.getOrCreateEventQueue(routeId)
+	if q == nil {
 		return
 	}
-	rpc.SendRpcMessage(msgBytes)
+	for _, event := range events {
+		if !q.enqueueReplay(event) {
+			return
+		}
+	}
+	q.waitForReplay()
 }
 
 func (router *WshRouter) handleNoRoute(msg RpcMessage) {
@@ -121,13 +151,28 @@ func (router *WshRouter) handleNoRoute(msg RpcMessage) {
 	router.sendRoutedMessage(respBytes, msg.Source)
 }
 
-func (router *WshRouter) registerRouteInfo(rpcId string, sourceRouteId string, destRouteId string) {
+func (router *WshRouter) handlePermissionDenied(msg RpcMessage, permErr error) {
+	log.Printf("[router] %s (source:%q)\n", permErr, msg.Source)
+	if msg.ReqId == "" {
+		return
+	}
+	info := &routeInfo{RpcId: msg.ReqId, SourceRouteId: msg.Source, DestRouteId: msg.Route, Command: msg.Command, StartTs: time.Now()}
+	response := RpcMessage{
+		ResId: msg.ReqId,
+		Error: permErr.Error(),
+	}
+	respBytes, _ := json.Marshal(response)
+	router.sendRoutedMessage(respBytes, msg.Source)
+	router.Tracer.recordResponse(info, &response, len(respBytes), true)
+}
+
+func (router *WshRouter) registerRouteInfo(rpcId string, sourceRouteId string, destRouteId string, command string) {
 	if rpcId == "" {
 		return
 	}
 	router.Lock.Lock()
 	defer router.Lock.Unlock()
-	router.RpcMap[rpcId] = &routeInfo{RpcId: rpcId, SourceRouteId: sourceRouteId, DestRouteId: destRouteId}
+	router.RpcMap[rpcId] = &routeInfo{RpcId: rpcId, SourceRouteId: sourceRouteId, DestRouteId: destRouteId, Command: command, StartTs: time.Now()}
 }
 
 func (router *WshRouter) unregisterRouteInfo(rpcId string) {
@@ -143,26 +188,66 @@ func (router *WshRouter) getRouteInfo(rpcId string) *routeInfo {
 }
 
 func (router *WshRouter) handleAnnounceMessage(msg RpcMessage, input msgAndRoute) {
-	// if we have an upstream, send it there
-	// if we don't (we are the terminal router), then add it to our announced route map
-	upstream := router.GetUpstreamClient()
-	if upstream != nil {
-		upstream.SendRpcMessage(input.msgBytes)
+	// every router adds the route to its announced route map (so messages coming back down can find it)
+	// sub-routers then send it upstream, the terminal router validates the announced route's token
+	if msg.Source == input.fromRouteId || input.fromRouteId == UpstreamRoute {
+		// local routes are announced when they are registered
 		return
 	}
-	if msg.Source == input.fromRouteId {
-		// not necessary to save the id mapping
+	if router.GetRpc(msg.Source) != nil {
+		log.Printf("[router] ignoring announce for local route %q (from %q)\n", msg.Source, input.fromRouteId)
 		return
 	}
+	if upstream := router.GetUpstreamClient(); upstream != nil {
+		// the route is added when the upstream accepts the announcement
+		err := router.addPendingAnnounce(msg, input.fromRouteId)
+		if err != nil {
+			log.Printf("[router] rejecting announce for route %q (from %q): %v\n", msg.Source, input.fromRouteId, err)
+			router.sendAnnounceResponse(input.fromRouteId, msg.ReqId, err)
+			return
+		}
+		upstream.SendRpcMessage(input.msgBytes)
+		return
+	}
+	var announcedCtx *wshrpc.RpcContext
+	if router.getRouteRpcContext(input.fromRouteId) != nil {
+		var err error
+		announcedCtx, err = validateAnnouncedRoute(msg)
+		if err != nil {
+			log.Printf("[router] rejecting announce for route %q (from %q): %v\n", msg.Source, input.fromRouteId, err)
+			router.sendAnnounceResponse(input.fromRouteId, msg.ReqId, err)
+			return
+		}
+	}
 	router.Lock.Lock()
-	defer router.Lock.Unlock()
 	router.AnnouncedRoutes[msg.Source] = input.fromRouteId
+	if announcedCtx != nil {
+		router.AnnouncedCtx[msg.Source] = announcedCtx
+	}
+	router.Lock.Unlock()
+	router.sendAnnounceResponse(input.fromRouteId, msg.ReqId, nil)
 }
 
-func (router *WshRouter) handleUnannounceMessage(msg RpcMessage) {
+func (router *WshRouter) handleUnannounceMessage(msg RpcMessage, input msgAndRoute) {
 	router.Lock.Lock()
-	defer router.Lock.Unlock()
-	delete(router.AnnouncedRoutes, msg.Source)
+	if router.AnnouncedRoutes[msg.Source] != input.fromRouteId {
+		router.Lock.Unlock()
+		return
+	}
+	router.removeAnnouncedRoute_nolock(msg.Source)
+	router.Lock.Unlock()
+	if upstream := router.GetUpstreamClient(); upstream != nil {
+		upstream.SendRpcMessage(input.msgBytes)
+	}
+}
+
+func (router *WshRouter) removeAnnouncedRoute_nolock(routeId string) {
+	delete(router.AnnouncedRoutes, routeId)
+	delete(router.AnnouncedCtx, routeId)
+	router.removeEventQueue_nolock(routeId)
+	go func() {
+		wps.Broker.UnsubscribeAll(routeId)
+	}()
 }
 
 func (router *WshRouter) getAnnouncedRoute(routeId string) string {
@@ -171,34 +256,54 @@ func (router *WshRouter) getAnnouncedRoute(routeId string) string {
 	return router.AnnouncedRoutes[routeId]
 }
 
+// returns the client for a local route or an announced route (nil if not found)
+func (router *WshRouter) getLocalRouteClient(routeId string) AbstractRpcClient {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	if router.PendingRoutes[routeId] {
+		return nil
+	}
+	rpc := router.RouteMap[routeId]
+	if rpc != nil {
+		return rpc
+	}
+	localRouteId := router.AnnouncedRoutes[routeId]
+	if localRouteId == "" {
+		return nil
+	}
+	return router.RouteMap[localRouteId]
+}
+
 // returns true if message was sent, false if failed
 func (router *WshRouter) sendRoutedMessage(msgBytes []byte, routeId string) bool {
-	rpc := router.GetRpc(routeId)
+	rpc := router.getLocalRouteClient(routeId)
 	if rpc != nil {
 		rpc.SendRpcMessage(msgBytes)
 		return true
 	}
 	upstream := router.GetUpstreamClient()
-	if upstream != nil {
-		upstream.SendRpcMessage(msgBytes)
-		return true
-	} else {
-		// we are the upstream, so consult our announced routes map
-		localRouteId := router.getAnnouncedRoute(routeId)
-		rpc := router.GetRpc(localRouteId)
-		if rpc == nil {
-			return false
-		}
-		rpc.SendRpcMessage(msgBytes)
-		return true
+	if upstream == nil {
+		return false
 	}
+	upstream.SendRpcMessage(msgBytes)
+	return true
+}
+
+// messages from the upstream are never sent back upstream (prevents routing loops)
+func (router *WshRouter) sendLocalMessage(msgBytes []byte, routeId string) bool {
+	rpc := router.getLocalRouteClient(routeId)
+	if rpc == nil {
+		return false
+	}
+	rpc.SendRpcMessage(msgBytes)
+	return true
 }
 
 func (router *WshRouter) runServer() {
 	for input := range router.InputCh {
 		msgBytes := input.msgBytes
 		var msg RpcMessage
-		err := json.Unmarshal(msgBytes, &msg)
+		err := UnmarshalRpcMessage(msgBytes, &msg)
 		if err != nil {
 			fmt.Println("error unmarshalling message: ", err)
 			continue
@@ -209,17 +314,31 @@ func (router *WshRouter) runServer() {
 			continue
 		}
 		if msg.Command == wshrpc.Command_RouteUnannounce {
-			router.handleUnannounceMessage(msg)
+			router.handleUnannounceMessage(msg, input)
 			continue
 		}
+		sendFn := router.sendRoutedMessage
+		if input.fromRouteId == UpstreamRoute {
+			sendFn = router.sendLocalMessage
+		}
 		if msg.Command != "" {
 			// new comand, setup new rpc
-			ok := router.sendRoutedMessage(msgBytes, routeId)
+			router.Tracer.recordRequest(&msg, msgBytes)
+			permErr := router.checkPermission(input.fromRouteId, &msg)
+			if permErr != nil {
+				router.handlePermissionDenied(msg, permErr)
+				continue
+			}
+			ok := sendFn(msgBytes, routeId)
 			if !ok {
 				router.handleNoRoute(msg)
+				if msg.ReqId != "" {
+					info := &routeInfo{RpcId: msg.ReqId, SourceRouteId: msg.Source, DestRouteId: routeId, Command: msg.Command, StartTs: time.Now()}
+					router.Tracer.recordResponse(info, &RpcMessage{ResId: msg.ReqId, Error: noRouteErr(routeId).Error()}, 0, true)
+				}
 				continue
 			}
-			router.registerRouteInfo(msg.ReqId, msg.Source, routeId)
+			router.registerRouteInfo(msg.ReqId, msg.Source, routeId, msg.Command)
 			continue
 		}
 		// look at reqid or resid to route correctly
@@ -230,15 +349,22 @@ func (router *WshRouter) runServer() {
 				continue
 			}
 			// no need to check the return value here (noop if failed)
-			router.sendRoutedMessage(msgBytes, routeInfo.DestRouteId)
+			sendFn(msgBytes, routeInfo.DestRouteId)
 			continue
 		} else if msg.ResId != "" {
+			if router.handleKeepAliveResponse(msg.ResId) {
+				continue
+			}
+			if input.fromRouteId == UpstreamRoute && router.handleAnnounceResponse(msg, msgBytes) {
+				continue
+			}
 			routeInfo := router.getRouteInfo(msg.ResId)
 			if routeInfo == nil {
 				// no route info, nothing to do
 				continue
 			}
-			router.sendRoutedMessage(msgBytes, routeInfo.SourceRouteId)
+			sendFn(msgBytes, routeInfo.SourceRouteId)
+			router.Tracer.recordResponse(routeInfo, &msg, len(msgBytes), !msg.Cont)
 			if !msg.Cont {
 				router.unregisterRouteInfo(msg.ResId)
 			}
@@ -266,29 +392,72 @@ func (router *WshRouter) WaitForRegister(ctx context.Context, routeId string) er
 
 // this will also consume the output channel of the abstract client
 func (router *WshRouter) RegisterRoute(routeId string, rpc AbstractRpcClient) {
-	if routeId == SysRoute {
-		// cannot register sys route
-		log.Printf("error: WshRouter cannot register sys route\n")
-		return
+	router.registerRoute(routeId, rpc, false)
+}
+
+// for clients that authenticated with a sub-router (their tokens can't be verified locally).  the route cannot replace
+// an existing route, and it is not routable (and its messages are not read) until the upstream accepts its announcement
+func (router *WshRouter) RegisterDownstreamRoute(routeId string, proxy *WshRpcProxy) error {
+	return router.registerRoute(routeId, proxy, true)
+}
+
+func (router *WshRouter) registerRoute(routeId string, rpc AbstractRpcClient, downstream bool) error {
+	if routeId == SysRoute || routeId == UpstreamRoute {
+		// cannot register placeholder routes
+		log.Printf("error: WshRouter cannot register route %q\n", routeId)
+		return fmt.Errorf("cannot register route %q", routeId)
 	}
 	log.Printf("[router] registering wsh route %q\n", routeId)
 	router.Lock.Lock()
 	defer router.Lock.Unlock()
+	var announceReqId string
+	var announceDoneCh chan error
+	if downstream {
+		if router.RouteMap[routeId] != nil || router.AnnouncedRoutes[routeId] != "" {
+			return fmt.Errorf("route %q already exists", routeId)
+		}
+		if router.UpstreamClient == nil {
+			return fmt.Errorf("no upstream to validate route %q", routeId)
+		}
+		announceReqId = uuid.New().String()
+		announceDoneCh = make(chan error, 1)
+		router.PendingRoutes[routeId] = true
+		router.PendingAnnounce[announceReqId] = &pendingAnnounce{RouteId: routeId, FromRouteId: routeId, DoneCh: announceDoneCh}
+	}
 	router.RouteMap[routeId] = rpc
 	go func() {
 		// announce
 		if router.GetUpstreamClient() != nil {
-			announceMsg := RpcMessage{Command: wshrpc.Command_RouteAnnounce, Source: routeId}
+			announceMsg := RpcMessage{Command: wshrpc.Command_RouteAnnounce, Source: routeId, ReqId: announceReqId}
+			if proxy, ok := rpc.(*WshRpcProxy); ok {
+				// the terminal router validates the token (see wshsubrouter.go)
+				if authToken := proxy.GetAuthToken(); authToken != "" {
+					announceMsg.Data = authToken
+				}
+			}
 			announceBytes, _ := json.Marshal(announceMsg)
 			router.GetUpstreamClient().SendRpcMessage(announceBytes)
 		}
+		if announceDoneCh != nil {
+			err := router.waitForAnnounce(announceReqId, announceDoneCh)
+			if err != nil {
+				log.Printf("[router] downstream route %q was not accepted: %v\n", routeId, err)
+				router.UnregisterRoute(routeId)
+				// discard anything the client sends until it disconnects
+				for {
+					if _, ok := rpc.RecvRpcMessage(); !ok {
+						return
+					}
+				}
+			}
+		}
 		for {
 			msgBytes, ok := rpc.RecvRpcMessage()
 			if !ok {
 				break
 			}
 			var rpcMsg RpcMessage
-			err := json.Unmarshal(msgBytes, &rpcMsg)
+			err := UnmarshalRpcMessage(msgBytes, &rpcMsg)
 			if err != nil {
 				continue
 			}
@@ -299,7 +468,7 @@ func (router *WshRouter) RegisterRoute(routeId string, rpc AbstractRpcClient) {
 				if rpcMsg.Route == "" {
 					rpcMsg.Route = DefaultRoute
 				}
-				msgBytes, err = json.Marshal(rpcMsg)
+				msgBytes, err = EncodeRpcMessage(&rpcMsg)
 				if err != nil {
 					continue
 				}
@@ -307,17 +476,31 @@ func (router *WshRouter) RegisterRoute(routeId string, rpc AbstractRpcClient) {
 			router.InputCh <- msgAndRoute{msgBytes: msgBytes, fromRouteId: routeId}
 		}
 	}()
+	return nil
 }
 
 func (router *WshRouter) UnregisterRoute(routeId string) {
 	log.Printf("[router] unregistering wsh route %q\n", routeId)
 	router.Lock.Lock()
-	defer router.Lock.Unlock()
 	delete(router.RouteMap, routeId)
+	delete(router.PendingRoutes, routeId)
+	router.removeEventQueue_nolock(routeId)
 	// clear out announced routes
-	for routeId, localRouteId := range router.AnnouncedRoutes {
+	removedRouteIds := []string{routeId}
+	for announcedRouteId, localRouteId := range router.AnnouncedRoutes {
 		if localRouteId == routeId {
-			delete(router.AnnouncedRoutes, routeId)
+			router.removeAnnouncedRoute_nolock(announcedRouteId)
+			removedRouteIds = append(removedRouteIds, announcedRouteId)
+		}
+	}
+	upstream := router.UpstreamClient
+	router.Lock.Unlock()
+	// sent outside the lock, a blocked upstream must not block route lookups
+	if upstream != nil {
+		for _, removedRouteId := range removedRouteIds {
+			unannounceMsg := RpcMessage{Command: wshrpc.Command_RouteUnannounce, Source: removedRouteId}
+			unannounceBytes, _ := json.Marshal(unannounceMsg)
+			upstream.SendRpcMessage(unannounceBytes)
 		}
 	}
 	go func() {
@@ -325,6 +508,11 @@ func (router *WshRouter) UnregisterRoute(routeId string) {
 	}()
 }
 
+// true for local and announced routes
+func (router *WshRouter) HasRoute(routeId string) bool {
+	return router.getLocalRouteClient(routeId) != nil
+}
+
 // this may return nil (returns default only for empty routeId)
 func (router *WshRouter) GetRpc(routeId string) AbstractRpcClient {
 	router.Lock.Lock()
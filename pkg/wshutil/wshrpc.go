@@ -22,7 +22,16 @@ import (
 )
 
 const DefaultTimeoutMs = 5000
+const MinStreamTimeoutMs = 60000
+const MinStreamBytesPerMs = 256 // 256KB/s
+
+// timeout for a streaming request/response that transfers size bytes
+func StreamTimeoutMs(size int64) int {
+	return MinStreamTimeoutMs + int(size/MinStreamBytesPerMs)
+}
+
 const RespChSize = 32
+const MaxRequestStreamQueue = 1024 // queued request stream messages before the stream fails (the handler is too slow)
 const DefaultMessageChSize = 32
 
 type ResponseFnType = func(any) error
@@ -49,6 +58,8 @@ type WshRpc struct {
 	ServerImpl         ServerImpl
 	EventListener      *EventListener
 	ResponseHandlerMap map[string]*RpcResponseHandler // reqId => handler
+	RequestStreamMap   map[string]*rpcRequestStream   // reqId => request stream (for streaming requests)
+	DisconnectCh       chan struct{}                  // closed when the underlying connection is gone (only set by SetupConnRpcClient)
 }
 
 type wshRpcContextKey struct{}
@@ -115,6 +126,8 @@ type RpcMessage struct {
 	Error    string `json:"error,omitempty"`
 	DataType string `json:"datatype,omitempty"`
 	Data     any    `json:"data,omitempty"`
+	BinField string `json:"binfield,omitempty"` // data field holding the binary payload (see wshrpcframe.go)
+	BinData  []byte `json:"-"`                  // binary payload (only set for binary frames)
 }
 
 func (r *RpcMessage) IsRpcRequest() bool {
@@ -178,6 +191,90 @@ type rpcData struct {
 	Ctx   context.Context
 }
 
+// streaming requests send their command with cont set, followed by request messages (reqid, no command),
+// the last one without cont.  runServer queues them (it never waits for a handler) and the stream's pump
+// passes them to the handler in order over Ch.
+type rpcRequestStream struct {
+	Ch         chan *RpcMessage
+	DoneCh     chan struct{} // closed when the handler is done (no more messages are accepted)
+	CancelCh   chan struct{} // closed when the sender cancels, the handler gets an error (not a clean end of stream)
+	Lock       *sync.Mutex
+	Queue      []*RpcMessage
+	QueueCh    chan struct{} // signals the pump
+	Overflow   bool          // canceled because the queue was full
+	doneOnce   sync.Once
+	cancelOnce sync.Once
+}
+
+func (rs *rpcRequestStream) close() {
+	rs.doneOnce.Do(func() {
+		close(rs.DoneCh)
+	})
+}
+
+func (rs *rpcRequestStream) cancel() {
+	rs.cancelOnce.Do(func() {
+		close(rs.CancelCh)
+	})
+}
+
+// returns false if the queue is full (the caller fails the stream)
+func (rs *rpcRequestStream) enqueue(msg *RpcMessage) bool {
+	rs.Lock.Lock()
+	if len(rs.Queue) >= MaxRequestStreamQueue {
+		rs.Overflow = true
+		rs.Lock.Unlock()
+		return false
+	}
+	rs.Queue = append(rs.Queue, msg)
+	rs.Lock.Unlock()
+	select {
+	case rs.QueueCh <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (rs *rpcRequestStream) isOverflow() bool {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	return rs.Overflow
+}
+
+func (rs *rpcRequestStream) dequeue() *RpcMessage {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	if len(rs.Queue) == 0 {
+		return nil
+	}
+	msg := rs.Queue[0]
+	rs.Queue[0] = nil
+	rs.Queue = rs.Queue[1:]
+	return msg
+}
+
+// moves queued messages to the handler (blocks on the handler, not on the rpc input loop)
+func (rs *rpcRequestStream) runPump() {
+	for {
+		select {
+		case <-rs.QueueCh:
+		case <-rs.DoneCh:
+			return
+		case <-rs.CancelCh:
+			return
+		}
+		for msg := rs.dequeue(); msg != nil; msg = rs.dequeue() {
+			select {
+			case rs.Ch <- msg:
+			case <-rs.DoneCh:
+				return
+			case <-rs.CancelCh:
+				return
+			}
+		}
+	}
+}
+
 func validateServerImpl(serverImpl ServerImpl) {
 	if serverImpl == nil {
 		return
@@ -207,6 +304,7 @@ func MakeWshRpc(inputCh chan []byte, outputCh chan []byte, rpcCtx wshrpc.RpcCont
 		EventListener:      MakeEventListener(),
 		ServerImpl:         serverImpl,
 		ResponseHandlerMap: make(map[string]*RpcResponseHandler),
+		RequestStreamMap:   make(map[string]*rpcRequestStream),
 	}
 	rtn.RpcContext.Store(&rpcCtx)
 	go rtn.runServer()
@@ -247,11 +345,80 @@ func (w *WshRpc) cancelRequest(reqId string) {
 	handler := w.ResponseHandlerMap[reqId]
 	if handler != nil {
 		handler.canceled.Store(true)
+		if handler.reqStream != nil {
+			// streaming request handlers are reading the request stream, cancel their context
+			cancelFnPtr := handler.contextCancelFn.Load()
+			if cancelFnPtr != nil && *cancelFnPtr != nil {
+				(*cancelFnPtr)()
+			}
+		}
 	}
+	if reqStream := w.RequestStreamMap[reqId]; reqStream != nil {
+		delete(w.RequestStreamMap, reqId)
+		reqStream.cancel()
+	}
+}
+
+// registered before the handler runs so no request messages are dropped
+func (w *WshRpc) registerRequestStream(reqId string) *rpcRequestStream {
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	reqStream := &rpcRequestStream{
+		Ch:       make(chan *RpcMessage, RespChSize),
+		DoneCh:   make(chan struct{}),
+		CancelCh: make(chan struct{}),
+		Lock:     &sync.Mutex{},
+		QueueCh:  make(chan struct{}, 1),
+	}
+	w.RequestStreamMap[reqId] = reqStream
+	go reqStream.runPump()
+	return reqStream
+}
+
+// the stream may already be out of the map (last message received, or canceled)
+func (w *WshRpc) unregisterRequestStream(reqId string, reqStream *rpcRequestStream) {
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	if w.RequestStreamMap[reqId] == reqStream {
+		delete(w.RequestStreamMap, reqId)
+	}
+	reqStream.close()
+}
+
+// never blocks, a stream whose handler falls MaxRequestStreamQueue messages behind is failed
+func (w *WshRpc) sendToRequestStream(msg *RpcMessage) {
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	reqStream := w.RequestStreamMap[msg.ReqId]
+	if reqStream == nil {
+		return
+	}
+	if !msg.Cont {
+		// last message
+		delete(w.RequestStreamMap, msg.ReqId)
+	}
+	if !reqStream.enqueue(msg) {
+		log.Printf("wshrpc request stream %s overflowed, canceling\n", msg.ReqId)
+		delete(w.RequestStreamMap, msg.ReqId)
+		reqStream.cancel()
+	}
+}
 
+func (w *WshRpc) sendPingResponse(reqId string) {
+	if reqId == "" {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			// this is likely a write to closed channel
+			log.Printf("panic in sendPingResponse: %v\n", r)
+		}
+	}()
+	respBytes, _ := json.Marshal(RpcMessage{ResId: reqId}) // will never fail
+	w.OutputCh <- respBytes
 }
 
-func (w *WshRpc) handleRequest(req *RpcMessage) {
+func (w *WshRpc) handleRequest(req *RpcMessage, reqStream *rpcRequestStream) {
 	// events first
 	if req.Command == wshrpc.Command_EventRecv {
 		if req.Data == nil {
@@ -267,6 +434,11 @@ func (w *WshRpc) handleRequest(req *RpcMessage) {
 		w.EventListener.RecvEvent(&waveEvent)
 		return
 	}
+	// keepalive pings are answered here (no server impl required)
+	if req.Command == wshrpc.Command_RoutePing {
+		w.sendPingResponse(req.ReqId)
+		return
+	}
 
 	var respHandler *RpcResponseHandler
 	defer func() {
@@ -289,7 +461,8 @@ func (w *WshRpc) handleRequest(req *RpcMessage) {
 		ctx:             ctx,
 		reqId:           req.ReqId,
 		command:         req.Command,
-		commandData:     req.Data,
+		commandMsg:      req,
+		reqStream:       reqStream,
 		source:          req.Source,
 		done:            &atomic.Bool{},
 		canceled:        &atomic.Bool{},
@@ -306,6 +479,9 @@ func (w *WshRpc) handleRequest(req *RpcMessage) {
 			debug.PrintStack()
 			respHandler.SendResponseError(fmt.Errorf("panic: %v", r))
 		}
+		if reqStream != nil {
+			w.unregisterRequestStream(req.ReqId, reqStream)
+		}
 		if isAsync {
 			go func() {
 				<-ctx.Done()
@@ -324,7 +500,7 @@ func (w *WshRpc) runServer() {
 	defer close(w.OutputCh)
 	for msgBytes := range w.InputCh {
 		var msg RpcMessage
-		err := json.Unmarshal(msgBytes, &msg)
+		err := UnmarshalRpcMessage(msgBytes, &msg)
 		if err != nil {
 			log.Printf("wshrpc received bad message: %v\n", err)
 			continue
@@ -335,8 +511,14 @@ func (w *WshRpc) runServer() {
 			}
 			continue
 		}
-		if msg.IsRpcRequest() {
-			go w.handleRequest(&msg)
+		if msg.Command != "" {
+			var reqStream *rpcRequestStream
+			if msg.Cont && msg.ReqId != "" {
+				reqStream = w.registerRequestStream(msg.ReqId)
+			}
+			go w.handleRequest(&msg, reqStream)
+		} else if msg.ReqId != "" {
+			w.sendToRequestStream(&msg)
 		} else {
 			respCh := w.getResponseCh(msg.ResId)
 			if respCh == nil {
@@ -434,6 +616,63 @@ func (w *WshRpc) SendRpcRequest(command string, data any, opts *wshrpc.RpcOpts)
 	return handler.NextResponse()
 }
 
+// single response, decoded into respPtr
+func (w *WshRpc) SendRpcRequestDecode(command string, data any, opts *wshrpc.RpcOpts, respPtr any) error {
+	var optsCopy wshrpc.RpcOpts
+	if opts != nil {
+		optsCopy = *opts
+	}
+	optsCopy.NoResponse = false
+	handler, err := w.SendComplexRequest(command, data, &optsCopy)
+	if err != nil {
+		return err
+	}
+	defer handler.finalize()
+	return handler.DecodeNextResponse(respPtr)
+}
+
+// sends a streaming request with the request stream from reqCh and decodes the response into respPtr.
+// an error from reqCh cancels the request (and is returned).  reqCh is always drained (even if the request fails early).
+func SendStreamingRequestDecode[T any](w *WshRpc, command string, data any, reqCh <-chan wshrpc.RespOrErrorUnion[T], opts *wshrpc.RpcOpts, respPtr any) error {
+	drainFn := func() {
+		for range reqCh {
+		}
+	}
+	handler, err := w.SendStreamingRequest(command, data, opts)
+	if err != nil {
+		go drainFn()
+		return err
+	}
+	defer handler.finalize()
+	streamErrCh := make(chan error, 1)
+	go func() {
+		defer drainFn()
+		for req := range reqCh {
+			if req.Error != nil {
+				streamErrCh <- req.Error
+				handler.SendCancel()
+				return
+			}
+			err := handler.SendRequestData(req.Response, false)
+			if err != nil {
+				// the request is done (error response or timeout)
+				return
+			}
+		}
+		handler.SendRequestData(nil, true)
+	}()
+	err = handler.DecodeNextResponse(respPtr)
+	if err != nil {
+		select {
+		case streamErr := <-streamErrCh:
+			return streamErr
+		default:
+		}
+		return err
+	}
+	return nil
+}
+
 type RpcRequestHandler struct {
 	w           *WshRpc
 	ctx         context.Context
@@ -463,6 +702,33 @@ func (handler *RpcRequestHandler) SendCancel() {
 	handler.finalize()
 }
 
+// sends the next message of a streaming request (see SendStreamingRequest), done is set for the last one
+func (handler *RpcRequestHandler) SendRequestData(data any, done bool) error {
+	defer func() {
+		if r := recover(); r != nil {
+			// this is likely a write to closed channel
+			log.Printf("panic in SendRequestData: %v\n", r)
+		}
+	}()
+	if handler.reqId == "" {
+		return fmt.Errorf("cannot send request data, no reqid")
+	}
+	if handler.ctx.Err() != nil {
+		return fmt.Errorf("cannot send request data: %w", handler.ctx.Err())
+	}
+	msg := &RpcMessage{
+		ReqId: handler.reqId,
+		Data:  data,
+		Cont:  !done,
+	}
+	barr, err := EncodeRpcMessage(msg)
+	if err != nil {
+		return err
+	}
+	handler.w.OutputCh <- barr
+	return nil
+}
+
 func (handler *RpcRequestHandler) ResponseDone() bool {
 	if handler.cachedResp != nil {
 		return false
@@ -480,6 +746,23 @@ func (handler *RpcRequestHandler) ResponseDone() bool {
 }
 
 func (handler *RpcRequestHandler) NextResponse() (any, error) {
+	resp, err := handler.nextResponseMsg()
+	if err != nil {
+		return nil, err
+	}
+	return resp.getInlinedData(), nil
+}
+
+// like NextResponse, but decodes into respPtr (binary payloads are copied directly instead of going through base64)
+func (handler *RpcRequestHandler) DecodeNextResponse(respPtr any) error {
+	resp, err := handler.nextResponseMsg()
+	if err != nil {
+		return err
+	}
+	return resp.decodeData(respPtr)
+}
+
+func (handler *RpcRequestHandler) nextResponseMsg() (*RpcMessage, error) {
 	var resp *RpcMessage
 	if handler.cachedResp != nil {
 		resp = handler.cachedResp
@@ -493,7 +776,7 @@ func (handler *RpcRequestHandler) NextResponse() (any, error) {
 	if resp.Error != "" {
 		return nil, errors.New(resp.Error)
 	}
-	return resp.Data, nil
+	return resp, nil
 }
 
 func (handler *RpcRequestHandler) finalize() {
@@ -514,7 +797,8 @@ type RpcResponseHandler struct {
 	reqId           string
 	source          string
 	command         string
-	commandData     any
+	commandMsg      *RpcMessage
+	reqStream       *rpcRequestStream // only for streaming requests
 	rpcCtx          wshrpc.RpcContext
 	canceled        *atomic.Bool // canceled by requestor
 	done            *atomic.Bool
@@ -529,7 +813,7 @@ func (handler *RpcResponseHandler) GetCommand() string {
 }
 
 func (handler *RpcResponseHandler) GetCommandRawData() any {
-	return handler.commandData
+	return handler.commandMsg.getInlinedData()
 }
 
 func (handler *RpcResponseHandler) GetRpcContext() wshrpc.RpcContext {
@@ -577,7 +861,7 @@ func (handler *RpcResponseHandler) SendResponse(data any, done bool) error {
 		Data:  data,
 		Cont:  !done,
 	}
-	barr, err := json.Marshal(msg)
+	barr, err := EncodeRpcMessage(msg)
 	if err != nil {
 		return err
 	}
@@ -633,6 +917,18 @@ func (handler *RpcResponseHandler) IsDone() bool {
 }
 
 func (w *WshRpc) SendComplexRequest(command string, data any, opts *wshrpc.RpcOpts) (rtnHandler *RpcRequestHandler, rtnErr error) {
+	return w.sendComplexRequest(command, data, opts, false)
+}
+
+// sends the command for a streaming request, the caller sends the request stream with SendRequestData and reads the response
+func (w *WshRpc) SendStreamingRequest(command string, data any, opts *wshrpc.RpcOpts) (*RpcRequestHandler, error) {
+	if opts != nil && opts.NoResponse {
+		return nil, fmt.Errorf("noresponse not supported for streaming requests")
+	}
+	return w.sendComplexRequest(command, data, opts, true)
+}
+
+func (w *WshRpc) sendComplexRequest(command string, data any, opts *wshrpc.RpcOpts, streamingReq bool) (rtnHandler *RpcRequestHandler, rtnErr error) {
 	if opts == nil {
 		opts = &wshrpc.RpcOpts{}
 	}
@@ -665,8 +961,9 @@ func (w *WshRpc) SendComplexRequest(command string, data any, opts *wshrpc.RpcOp
 		Data:    data,
 		Timeout: timeoutMs,
 		Route:   opts.Route,
+		Cont:    streamingReq,
 	}
-	barr, err := json.Marshal(req)
+	barr, err := EncodeRpcMessage(req)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,262 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
+)
+
+// binary frames carry a message's raw data payload after its json header (no base64 encoding):
+//   0x00 | header length (uint32 BE) | payload length (uint32 BE) | header (RpcMessage json) | payload
+// json messages never start with 0x00.  the header's "binfield" names the data field the payload belongs to
+// ("" means the payload is the data itself).
+//
+// command/response data opts in with a []byte field tagged `wshbinary:"true"` (the json tag must have
+// omitempty), or by being a []byte.  in json the payload is base64 encoded (the normal []byte encoding),
+// so frames can always be converted for peers that only speak json (the frontend, the terminal/OSC
+// transport, and stream links where the peer didn't send a link hello, see wshrpcio.go).
+
+const BinFrameMarker = 0x00
+const BinFramePrefixLen = 9
+const MaxBinFramePayload = 16 * 1024 * 1024
+const BinaryFieldTag = "wshbinary"
+
+func IsBinFrame(msgBytes []byte) bool {
+	return len(msgBytes) > 0 && msgBytes[0] == BinFrameMarker
+}
+
+func makeBinFrame(header []byte, payload []byte) []byte {
+	frame := make([]byte, BinFramePrefixLen+len(header)+len(payload))
+	frame[0] = BinFrameMarker
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(header)))
+	binary.BigEndian.PutUint32(frame[5:9], uint32(len(payload)))
+	copy(frame[BinFramePrefixLen:], header)
+	copy(frame[BinFramePrefixLen+len(header):], payload)
+	return frame
+}
+
+// returns the lengths from a frame prefix
+func parseBinFramePrefix(prefix []byte) (int, int, error) {
+	if len(prefix) < BinFramePrefixLen || prefix[0] != BinFrameMarker {
+		return 0, 0, fmt.Errorf("invalid binary frame prefix")
+	}
+	headerLen := binary.BigEndian.Uint32(prefix[1:5])
+	payloadLen := binary.BigEndian.Uint32(prefix[5:9])
+	if headerLen > maxLineLength {
+		return 0, 0, fmt.Errorf("binary frame header too large (%d bytes)", headerLen)
+	}
+	if payloadLen > MaxBinFramePayload {
+		return 0, 0, fmt.Errorf("binary frame payload too large (%d bytes)", payloadLen)
+	}
+	return int(headerLen), int(payloadLen), nil
+}
+
+func splitBinFrame(frame []byte) ([]byte, []byte, error) {
+	headerLen, payloadLen, err := parseBinFramePrefix(frame)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(frame) != BinFramePrefixLen+headerLen+payloadLen {
+		return nil, nil, fmt.Errorf("invalid binary frame length")
+	}
+	headerEnd := BinFramePrefixLen + headerLen
+	return frame[BinFramePrefixLen:headerEnd], frame[headerEnd:], nil
+}
+
+// returns the json part of a message (the header for frames)
+func GetRpcMessageJson(msgBytes []byte) []byte {
+	if !IsBinFrame(msgBytes) {
+		return msgBytes
+	}
+	header, _, err := splitBinFrame(msgBytes)
+	if err != nil {
+		return nil
+	}
+	return header
+}
+
+// unmarshals a json message or a binary frame (msg.BinData points into msgBytes, it is not copied)
+func UnmarshalRpcMessage(msgBytes []byte, msg *RpcMessage) error {
+	if !IsBinFrame(msgBytes) {
+		return json.Unmarshal(msgBytes, msg)
+	}
+	header, payload, err := splitBinFrame(msgBytes)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(header, msg)
+	if err != nil {
+		return err
+	}
+	msg.BinData = payload
+	return nil
+}
+
+// encodes msg as a binary frame if it (or its data) has a binary payload, otherwise as json
+func EncodeRpcMessage(msg *RpcMessage) ([]byte, error) {
+	if msg.BinData == nil {
+		if data, binField, binData, ok := extractBinData(msg.Data); ok {
+			msgCopy := *msg
+			msgCopy.Data = data
+			msgCopy.BinField = binField
+			msgCopy.BinData = binData
+			msg = &msgCopy
+		}
+	}
+	header, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	if msg.BinData == nil {
+		return header, nil
+	}
+	if len(msg.BinData) > MaxBinFramePayload {
+		return nil, fmt.Errorf("binary payload too large (%d bytes, max %d)", len(msg.BinData), MaxBinFramePayload)
+	}
+	return makeBinFrame(header, msg.BinData), nil
+}
+
+// converts a binary frame to the equivalent json message (json messages are returned unchanged)
+func BinFrameToJson(msgBytes []byte) ([]byte, error) {
+	if !IsBinFrame(msgBytes) {
+		return msgBytes, nil
+	}
+	var msg RpcMessage
+	err := UnmarshalRpcMessage(msgBytes, &msg)
+	if err != nil {
+		return nil, err
+	}
+	msg.Data = msg.getInlinedData()
+	msg.BinField = ""
+	msg.BinData = nil
+	return json.Marshal(msg)
+}
+
+// returns the message data with the binary payload base64 encoded into it (the json representation)
+func (msg *RpcMessage) getInlinedData() any {
+	if msg.BinData == nil {
+		return msg.Data
+	}
+	data64 := base64.StdEncoding.EncodeToString(msg.BinData)
+	if msg.BinField == "" {
+		return data64
+	}
+	dataMap, ok := msg.Data.(map[string]any)
+	if !ok || dataMap == nil {
+		dataMap = make(map[string]any)
+	}
+	dataMap[msg.BinField] = data64
+	return dataMap
+}
+
+// unmarshals msg's data into dataPtr, binary payloads are copied directly into their field
+func (msg *RpcMessage) decodeData(dataPtr any) error {
+	if msg.BinData == nil {
+		return utilfn.ReUnmarshal(dataPtr, msg.Data)
+	}
+	if msg.BinField == "" {
+		if bytesPtr, ok := dataPtr.(*[]byte); ok {
+			*bytesPtr = msg.BinData
+			return nil
+		}
+	} else {
+		if msg.Data != nil {
+			err := utilfn.ReUnmarshal(dataPtr, msg.Data)
+			if err != nil {
+				return err
+			}
+		}
+		if setBinData(dataPtr, msg.BinField, msg.BinData) {
+			return nil
+		}
+	}
+	// not a type with a matching binary field, use the json representation
+	return utilfn.ReUnmarshal(dataPtr, msg.getInlinedData())
+}
+
+type binFieldInfo struct {
+	Index    int // -1 if there is no binary field
+	JsonName string
+}
+
+var binFieldCache = &sync.Map{} // reflect.Type => binFieldInfo
+
+func getBinField(rtype reflect.Type) binFieldInfo {
+	if cached, ok := binFieldCache.Load(rtype); ok {
+		return cached.(binFieldInfo)
+	}
+	rtn := binFieldInfo{Index: -1}
+	for i := 0; i < rtype.NumField(); i++ {
+		field := rtype.Field(i)
+		if field.Tag.Get(BinaryFieldTag) != "true" || field.Type.Kind() != reflect.Slice || field.Type.Elem().Kind() != reflect.Uint8 {
+			continue
+		}
+		jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if jsonName == "" || jsonName == "-" {
+			continue
+		}
+		rtn = binFieldInfo{Index: i, JsonName: jsonName}
+		break
+	}
+	binFieldCache.Store(rtype, rtn)
+	return rtn
+}
+
+// splits the binary payload out of typed data, returns (data without the payload, binfield, payload, ok)
+func extractBinData(data any) (any, string, []byte, bool) {
+	if barr, ok := data.([]byte); ok {
+		if barr == nil {
+			return data, "", nil, false
+		}
+		return nil, "", barr, true
+	}
+	rval := reflect.ValueOf(data)
+	isPtr := false
+	if rval.Kind() == reflect.Pointer {
+		if rval.IsNil() {
+			return data, "", nil, false
+		}
+		rval = rval.Elem()
+		isPtr = true
+	}
+	if rval.Kind() != reflect.Struct {
+		return data, "", nil, false
+	}
+	binField := getBinField(rval.Type())
+	if binField.Index == -1 {
+		return data, "", nil, false
+	}
+	binData := rval.Field(binField.Index).Bytes()
+	if binData == nil {
+		return data, "", nil, false
+	}
+	dataCopy := reflect.New(rval.Type())
+	dataCopy.Elem().Set(rval)
+	dataCopy.Elem().Field(binField.Index).SetBytes(nil)
+	if isPtr {
+		return dataCopy.Interface(), binField.JsonName, binData, true
+	}
+	return dataCopy.Elem().Interface(), binField.JsonName, binData, true
+}
+
+func setBinData(dataPtr any, jsonName string, binData []byte) bool {
+	rval := reflect.ValueOf(dataPtr)
+	if rval.Kind() != reflect.Pointer || rval.IsNil() || rval.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	binField := getBinField(rval.Elem().Type())
+	if binField.Index == -1 || binField.JsonName != jsonName {
+		return false
+	}
+	rval.Elem().Field(binField.Index).SetBytes(binData)
+	return true
+}
@@ -0,0 +1,160 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestBinFrames(t *testing.T) {
+	payload := []byte("binary\x00data\n\xff")
+	resp := wshrpc.CommandRemoteStreamFileRtnData{Data: payload}
+	msgBytes, err := EncodeRpcMessage(&RpcMessage{ResId: "req1", Cont: true, Data: resp})
+	if err != nil {
+		t.Fatalf("error encoding message: %v", err)
+	}
+	if !IsBinFrame(msgBytes) {
+		t.Fatalf("expected a binary frame")
+	}
+	if resp.Data == nil {
+		t.Fatalf("encoding modified the original data")
+	}
+	var msg RpcMessage
+	err = UnmarshalRpcMessage(msgBytes, &msg)
+	if err != nil {
+		t.Fatalf("error unmarshalling frame: %v", err)
+	}
+	if msg.ResId != "req1" || !msg.Cont || msg.BinField != "data64" {
+		t.Fatalf("bad header: %#v", msg)
+	}
+	var decoded wshrpc.CommandRemoteStreamFileRtnData
+	err = msg.decodeData(&decoded)
+	if err != nil || !bytes.Equal(decoded.Data, payload) {
+		t.Fatalf("bad payload %q (err: %v)", decoded.Data, err)
+	}
+
+	// json peers get the same message with base64 data
+	jsonBytes, err := BinFrameToJson(msgBytes)
+	if err != nil {
+		t.Fatalf("error converting frame: %v", err)
+	}
+	var jsonMsg RpcMessage
+	err = json.Unmarshal(jsonBytes, &jsonMsg)
+	if err != nil {
+		t.Fatalf("bad json message: %v", err)
+	}
+	decoded = wshrpc.CommandRemoteStreamFileRtnData{}
+	err = jsonMsg.decodeData(&decoded)
+	if err != nil || !bytes.Equal(decoded.Data, payload) {
+		t.Fatalf("bad json payload %q (err: %v)", decoded.Data, err)
+	}
+
+	// []byte data is the payload itself
+	msgBytes, _ = EncodeRpcMessage(&RpcMessage{ResId: "req2", Data: payload})
+	msg = RpcMessage{}
+	UnmarshalRpcMessage(msgBytes, &msg)
+	var rawData []byte
+	err = msg.decodeData(&rawData)
+	if err != nil || !bytes.Equal(rawData, payload) {
+		t.Fatalf("bad raw payload %q (err: %v)", rawData, err)
+	}
+
+	// no payload, no frame
+	msgBytes, _ = EncodeRpcMessage(&RpcMessage{ResId: "req3", Data: wshrpc.CommandRemoteStreamFileRtnData{}})
+	if IsBinFrame(msgBytes) {
+		t.Fatalf("expected json for data without a payload")
+	}
+}
+
+func recvStreamMsg(t *testing.T, ch chan []byte) []byte {
+	t.Helper()
+	select {
+	case msgBytes := <-ch:
+		return msgBytes
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timeout waiting for message")
+	}
+	return nil
+}
+
+func TestRpcStreamLink(t *testing.T) {
+	payload := bytes.Repeat([]byte{0, '\n', 1}, 100*1024)
+	frame, _ := EncodeRpcMessage(&RpcMessage{Command: wshrpc.Command_RemoteWriteFile, Data: wshrpc.CommandRemoteWriteFileData{Path: "/tmp/x", Data: payload}})
+
+	// both sides accept frames, they pass through unchanged (after the hellos).  frames aren't subject
+	// to the json line length limit.
+	conn1, conn2 := net.Pipe()
+	defer conn1.Close()
+	defer conn2.Close()
+	link1, link2 := MakeRpcStreamLink(), MakeRpcStreamLink()
+	outCh1, inCh1 := make(chan []byte, 1), make(chan []byte, 1)
+	outCh2, inCh2 := make(chan []byte, 1), make(chan []byte, 1)
+	go link1.AdaptOutputChToStream(outCh1, conn1)
+	go link1.AdaptStreamToMsgCh(conn1, inCh1)
+	go link2.AdaptOutputChToStream(outCh2, conn2)
+	go link2.AdaptStreamToMsgCh(conn2, inCh2)
+	deadline := time.Now().Add(2 * time.Second)
+	for !link1.PeerAcceptsBinFrames() || !link2.PeerAcceptsBinFrames() {
+		if time.Now().After(deadline) {
+			t.Fatalf("link hellos were not received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	outCh1 <- frame
+	if msgBytes := recvStreamMsg(t, inCh2); !bytes.Equal(msgBytes, frame) {
+		t.Fatalf("frame was modified in transit")
+	}
+	outCh2 <- []byte(`{"command":"message"}`)
+	if msgBytes := recvStreamMsg(t, inCh1); string(msgBytes) != `{"command":"message"}` {
+		t.Fatalf("bad json message: %q", msgBytes)
+	}
+
+	// a json only writer converts frames
+	payload = payload[:32*1024]
+	frame, _ = EncodeRpcMessage(&RpcMessage{Command: wshrpc.Command_RemoteWriteFile, Data: wshrpc.CommandRemoteWriteFileData{Path: "/tmp/x", Data: payload}})
+	conn3, conn4 := net.Pipe()
+	defer conn3.Close()
+	defer conn4.Close()
+	outCh3, inCh4 := make(chan []byte, 1), make(chan []byte, 1)
+	go AdaptOutputChToStream(outCh3, conn3)
+	go MakeRpcStreamLink().AdaptStreamToMsgCh(conn4, inCh4)
+	outCh3 <- frame
+	msgBytes := recvStreamMsg(t, inCh4)
+	if IsBinFrame(msgBytes) {
+		t.Fatalf("expected json from a json only writer")
+	}
+	var msg RpcMessage
+	json.Unmarshal(msgBytes, &msg)
+	var writeData wshrpc.CommandRemoteWriteFileData
+	err := msg.decodeData(&writeData)
+	if err != nil || writeData.Path != "/tmp/x" || !bytes.Equal(writeData.Data, payload) {
+		t.Fatalf("bad converted message (err: %v)", err)
+	}
+}
+
+func TestConnRpcClientDisconnect(t *testing.T) {
+	conn1, conn2 := net.Pipe()
+	defer conn1.Close()
+	client, _, err := SetupConnRpcClient(conn1, nil)
+	if err != nil {
+		t.Fatalf("SetupConnRpcClient: %v", err)
+	}
+	select {
+	case <-client.DisconnectCh:
+		t.Fatalf("DisconnectCh closed before the connection dropped")
+	default:
+	}
+	conn2.Close()
+	select {
+	case <-client.DisconnectCh:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("DisconnectCh not closed after the peer closed the connection")
+	}
+}
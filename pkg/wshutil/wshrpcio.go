@@ -4,15 +4,19 @@
 package wshutil
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"log"
+	"sync/atomic"
 )
 
 // special I/O wrappers for wshrpc
 // * terminal (wrap with OSC codes)
-// * stream (json lines)
-// * websocket (json packets)
+// * stream (json lines + binary frames)
+// * websocket (json packets, binary frames are converted to json)
 
 type lineBuf struct {
 	buf        []byte
@@ -55,14 +59,142 @@ func StreamToLines(input io.Reader, lineFn func([]byte)) error {
 	}
 }
 
-func AdaptStreamToMsgCh(input io.Reader, output chan []byte) error {
-	return StreamToLines(input, func(line []byte) {
+// rpc streams are json lines, mixed with binary frames (see wshrpcframe.go) when the peer accepts them.
+// peers that accept binary frames send a link hello as their first line.  peers that don't know about
+// it ignore it (it has no command, reqid, or resid), so until (unless) we get one we only send json.
+
+const linkHelloLine = `{"linkhello":{"binframes":true}}`
+const linkHelloPrefix = `{"linkhello":`
+
+type linkHello struct {
+	LinkHello *struct {
+		BinFrames bool `json:"binframes,omitempty"`
+	} `json:"linkhello"`
+}
+
+// the two halves of a stream connection, use both the reader and the writer for a connection
+type RpcStreamLink struct {
+	peerBinFrames atomic.Bool
+}
+
+func MakeRpcStreamLink() *RpcStreamLink {
+	return &RpcStreamLink{}
+}
+
+func (link *RpcStreamLink) PeerAcceptsBinFrames() bool {
+	return link.peerBinFrames.Load()
+}
+
+// returns true if line was a link hello
+func (link *RpcStreamLink) handleLinkHello(line []byte) bool {
+	if !bytes.HasPrefix(line, []byte(linkHelloPrefix)) {
+		return false
+	}
+	var hello linkHello
+	if err := json.Unmarshal(line, &hello); err != nil || hello.LinkHello == nil {
+		return false
+	}
+	link.peerBinFrames.Store(hello.LinkHello.BinFrames)
+	return true
+}
+
+// returns nil (and no error) for lines over maxLineLength, they are skipped
+func readRpcLine(reader *bufio.Reader) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			if !tooLong && len(line)+len(chunk) <= maxLineLength {
+				line = append(line, chunk...)
+			} else {
+				line = nil
+				tooLong = true
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if tooLong || len(line)+len(chunk)-1 > maxLineLength {
+			return nil, nil
+		}
+		line = append(line, chunk[:len(chunk)-1]...)
+		if line == nil {
+			line = []byte{}
+		}
+		return line, nil
+	}
+}
+
+func readBinFrame(reader *bufio.Reader) ([]byte, error) {
+	var prefix [BinFramePrefixLen]byte
+	if _, err := io.ReadFull(reader, prefix[:]); err != nil {
+		return nil, err
+	}
+	headerLen, payloadLen, err := parseBinFramePrefix(prefix[:])
+	if err != nil {
+		return nil, err
+	}
+	frame := make([]byte, BinFramePrefixLen+headerLen+payloadLen)
+	copy(frame, prefix[:])
+	if _, err := io.ReadFull(reader, frame[BinFramePrefixLen:]); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+func readRpcStream(input io.Reader, output chan []byte, link *RpcStreamLink) error {
+	reader := bufio.NewReaderSize(input, 16*1024)
+	for {
+		firstByte, err := reader.Peek(1)
+		if err != nil {
+			return err
+		}
+		if firstByte[0] == BinFrameMarker {
+			frame, err := readBinFrame(reader)
+			if err != nil {
+				// can't resync after a bad frame
+				return fmt.Errorf("error reading binary frame: %w", err)
+			}
+			output <- frame
+			continue
+		}
+		line, err := readRpcLine(reader)
+		if err != nil {
+			return err
+		}
+		if line == nil {
+			continue
+		}
+		if link != nil && link.handleLinkHello(line) {
+			continue
+		}
 		output <- line
-	})
+	}
 }
 
-func AdaptOutputChToStream(outputCh chan []byte, output io.Writer) error {
+func writeRpcStream(outputCh chan []byte, output io.Writer, link *RpcStreamLink) error {
+	if link != nil {
+		if _, err := output.Write([]byte(linkHelloLine + "\n")); err != nil {
+			return fmt.Errorf("error writing link hello to output (AdaptOutputChToStream): %w", err)
+		}
+	}
 	for msg := range outputCh {
+		if IsBinFrame(msg) {
+			if link != nil && link.PeerAcceptsBinFrames() {
+				if _, err := output.Write(msg); err != nil {
+					return fmt.Errorf("error writing to output (AdaptOutputChToStream): %w", err)
+				}
+				continue
+			}
+			jsonMsg, err := BinFrameToJson(msg)
+			if err != nil {
+				log.Printf("error converting binary frame to json: %v\n", err)
+				continue
+			}
+			msg = jsonMsg
+		}
 		if _, err := output.Write(msg); err != nil {
 			return fmt.Errorf("error writing to output (AdaptOutputChToStream): %w", err)
 		}
@@ -74,13 +206,37 @@ func AdaptOutputChToStream(outputCh chan []byte, output io.Writer) error {
 	return nil
 }
 
+// accepts binary frames and the peer's link hello
+func (link *RpcStreamLink) AdaptStreamToMsgCh(input io.Reader, output chan []byte) error {
+	return readRpcStream(input, output, link)
+}
+
+// sends a link hello, and binary frames once the peer has sent its link hello
+func (link *RpcStreamLink) AdaptOutputChToStream(outputCh chan []byte, output io.Writer) error {
+	return writeRpcStream(outputCh, output, link)
+}
+
+func AdaptStreamToMsgCh(input io.Reader, output chan []byte) error {
+	return readRpcStream(input, output, nil)
+}
+
+// json only (binary frames are converted), use an RpcStreamLink to send binary frames
+func AdaptOutputChToStream(outputCh chan []byte, output io.Writer) error {
+	return writeRpcStream(outputCh, output, nil)
+}
+
 func AdaptMsgChToPty(outputCh chan []byte, oscEsc string, output io.Writer) error {
 	if len(oscEsc) != 5 {
 		panic("oscEsc must be 5 characters")
 	}
 	for msg := range outputCh {
+		msg, err := BinFrameToJson(msg)
+		if err != nil {
+			log.Printf("error converting binary frame to json: %v\n", err)
+			continue
+		}
 		barr := EncodeWaveOSCBytes(oscEsc, msg)
-		_, err := output.Write(barr)
+		_, err = output.Write(barr)
 		if err != nil {
 			return fmt.Errorf("error writing to output: %w", err)
 		}
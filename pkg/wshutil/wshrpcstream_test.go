@@ -0,0 +1,147 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+type testStreamServer struct {
+	ErrCh   chan error
+	BlockCh chan struct{} // if set, the stream handler waits for it before reading
+}
+
+func (*testStreamServer) WshServerImpl() {}
+
+func (*testStreamServer) ConnListCommand(ctx context.Context) ([]string, error) {
+	return []string{"test"}, nil
+}
+
+func (s *testStreamServer) RemoteWriteFileStreamCommand(ctx context.Context, data wshrpc.CommandRemoteWriteFileStreamData, reqCh <-chan wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData]) (*wshrpc.FileInfo, error) {
+	if s.BlockCh != nil {
+		<-s.BlockCh
+	}
+	var buf bytes.Buffer
+	for chunk := range reqCh {
+		if chunk.Error != nil {
+			s.ErrCh <- chunk.Error
+			return nil, chunk.Error
+		}
+		buf.Write(chunk.Response.Data)
+	}
+	if int64(buf.Len()) != data.Size {
+		return nil, errors.New("size mismatch")
+	}
+	return &wshrpc.FileInfo{Path: data.Path, Size: int64(buf.Len())}, nil
+}
+
+func makeTestRpcPair(serverImpl ServerImpl) *WshRpc {
+	clientOutputCh := make(chan []byte, DefaultOutputChSize)
+	serverOutputCh := make(chan []byte, DefaultOutputChSize)
+	MakeWshRpc(clientOutputCh, serverOutputCh, wshrpc.RpcContext{}, serverImpl)
+	return MakeWshRpc(serverOutputCh, clientOutputCh, wshrpc.RpcContext{}, nil)
+}
+
+func TestStreamingRequest(t *testing.T) {
+	server := &testStreamServer{ErrCh: make(chan error, 1)}
+	client := makeTestRpcPair(server)
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 20*1024)
+	reqCh := make(chan wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData])
+	go func() {
+		defer close(reqCh)
+		for chunkStart := 0; chunkStart < len(payload); chunkStart += 1000 {
+			chunkEnd := min(chunkStart+1000, len(payload))
+			reqCh <- wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData]{Response: wshrpc.CommandFileChunkData{Data: payload[chunkStart:chunkEnd]}}
+		}
+	}()
+	writeData := wshrpc.CommandRemoteWriteFileStreamData{Path: "/tmp/x", Size: int64(len(payload))}
+	var finfo *wshrpc.FileInfo
+	err := SendStreamingRequestDecode(client, wshrpc.Command_RemoteWriteFileStream, writeData, reqCh, &wshrpc.RpcOpts{Timeout: 2000}, &finfo)
+	if err != nil {
+		t.Fatalf("streaming request error: %v", err)
+	}
+	if finfo == nil || finfo.Size != int64(len(payload)) {
+		t.Fatalf("bad response: %#v", finfo)
+	}
+
+	// an error from the producer cancels the request on both sides
+	reqCh = make(chan wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData], 2)
+	reqCh <- wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData]{Response: wshrpc.CommandFileChunkData{Data: payload[:100]}}
+	reqCh <- wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData]{Error: errors.New("read failed")}
+	close(reqCh)
+	err = SendStreamingRequestDecode(client, wshrpc.Command_RemoteWriteFileStream, writeData, reqCh, &wshrpc.RpcOpts{Timeout: 2000}, &finfo)
+	if err == nil || err.Error() != "read failed" {
+		t.Fatalf("expected the producer error, got: %v", err)
+	}
+	select {
+	case <-server.ErrCh:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("handler did not see the cancel")
+	}
+}
+
+func sendTestChunks(numChunks int) chan wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData] {
+	reqCh := make(chan wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData])
+	go func() {
+		defer close(reqCh)
+		for i := 0; i < numChunks; i++ {
+			reqCh <- wshrpc.RespOrErrorUnion[wshrpc.CommandFileChunkData]{Response: wshrpc.CommandFileChunkData{Data: []byte("x")}}
+		}
+	}()
+	return reqCh
+}
+
+// a slow stream handler doesn't stall other requests on the same rpc
+func TestStreamingRequestSlowHandler(t *testing.T) {
+	server := &testStreamServer{ErrCh: make(chan error, 1), BlockCh: make(chan struct{})}
+	client := makeTestRpcPair(server)
+	numChunks := 10 * RespChSize
+	streamErrCh := make(chan error, 1)
+	go func() {
+		writeData := wshrpc.CommandRemoteWriteFileStreamData{Path: "/tmp/x", Size: int64(numChunks)}
+		var finfo *wshrpc.FileInfo
+		streamErrCh <- SendStreamingRequestDecode(client, wshrpc.Command_RemoteWriteFileStream, writeData, sendTestChunks(numChunks), &wshrpc.RpcOpts{Timeout: 5000}, &finfo)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	_, err := client.SendRpcRequest(wshrpc.Command_ConnList, nil, &wshrpc.RpcOpts{Timeout: 1000})
+	if err != nil {
+		t.Errorf("request blocked behind a slow stream handler: %v", err)
+	}
+	close(server.BlockCh)
+	if err := <-streamErrCh; err != nil {
+		t.Errorf("streaming request error: %v", err)
+	}
+}
+
+func TestStreamingRequestOverflow(t *testing.T) {
+	server := &testStreamServer{ErrCh: make(chan error, 1), BlockCh: make(chan struct{})}
+	client := makeTestRpcPair(server)
+	numChunks := MaxRequestStreamQueue + 2*RespChSize
+	streamErrCh := make(chan error, 1)
+	go func() {
+		writeData := wshrpc.CommandRemoteWriteFileStreamData{Path: "/tmp/x", Size: int64(numChunks)}
+		var finfo *wshrpc.FileInfo
+		streamErrCh <- SendStreamingRequestDecode(client, wshrpc.Command_RemoteWriteFileStream, writeData, sendTestChunks(numChunks), &wshrpc.RpcOpts{Timeout: 5000}, &finfo)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	close(server.BlockCh)
+	select {
+	case err := <-server.ErrCh:
+		if !strings.Contains(err.Error(), "overflowed") {
+			t.Errorf("expected an overflow error, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("handler did not see the overflow")
+	}
+	if err := <-streamErrCh; err == nil {
+		t.Errorf("expected the overflowed request to fail")
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// the router records per-command stats (count, errors, latency histogram, payload sizes) for every rpc it routes.
+// latency is measured from when the request passes through the router until its final response does.
+// optionally every request/response is also written to a trace file (jsonl).  request records contain the
+// full RpcMessage so a trace can be replayed.  trace files are always written to the rpctrace dir (in the wave home dir).
+
+const RpcTraceDirName = "rpctrace"
+
+const (
+	RpcTraceType_Req  = "req"
+	RpcTraceType_Resp = "resp"
+)
+
+type RpcTraceRecord struct {
+	Ts         int64           `json:"ts"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command,omitempty"`
+	RpcId      string          `json:"rpcid,omitempty"`
+	Source     string          `json:"source,omitempty"`
+	Route      string          `json:"route,omitempty"`
+	DurationMs int64           `json:"durationms,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Size       int             `json:"size"`
+	Msg        json.RawMessage `json:"msg,omitempty"` // only for requests
+}
+
+type rpcTracer struct {
+	Lock          *sync.Mutex
+	Stats         map[string]*wshrpc.RpcCommandStats
+	TraceFd       *os.File
+	TraceFileName string
+}
+
+func makeRpcTracer() *rpcTracer {
+	return &rpcTracer{
+		Lock:  &sync.Mutex{},
+		Stats: make(map[string]*wshrpc.RpcCommandStats),
+	}
+}
+
+func (t *rpcTracer) getStats_nolock(command string) *wshrpc.RpcCommandStats {
+	stats := t.Stats[command]
+	if stats == nil {
+		stats = &wshrpc.RpcCommandStats{
+			Command:   command,
+			Histogram: make([]int64, len(wshrpc.RpcLatencyBucketsMs)+1),
+		}
+		t.Stats[command] = stats
+	}
+	return stats
+}
+
+func (t *rpcTracer) recordRequest(msg *RpcMessage, msgBytes []byte) {
+	t.Lock.Lock()
+	defer t.Lock.Unlock()
+	stats := t.getStats_nolock(msg.Command)
+	stats.Count++
+	stats.ReqBytes += int64(len(msgBytes))
+	if msg.ReqId == "" {
+		stats.NoResponse++
+	} else {
+		stats.Pending++
+	}
+	t.writeTraceRecord_nolock(RpcTraceRecord{
+		Ts:      time.Now().UnixMilli(),
+		Type:    RpcTraceType_Req,
+		Command: msg.Command,
+		RpcId:   msg.ReqId,
+		Source:  msg.Source,
+		Route:   msg.Route,
+		Size:    len(msgBytes),
+		Msg:     GetRpcMessageJson(msgBytes), // header only for binary frames
+	})
+}
+
+// called for every response message (streaming responses have multiple), final is true for the last one
+func (t *rpcTracer) recordResponse(info *routeInfo, msg *RpcMessage, size int, final bool) {
+	t.Lock.Lock()
+	defer t.Lock.Unlock()
+	stats := t.getStats_nolock(info.Command)
+	stats.RespBytes += int64(size)
+	if !final {
+		return
+	}
+	durationMs := time.Since(info.StartTs).Milliseconds()
+	stats.Pending--
+	stats.TotalMs += durationMs
+	if durationMs > stats.MaxMs {
+		stats.MaxMs = durationMs
+	}
+	stats.Histogram[getLatencyBucket(durationMs)]++
+	if msg.Error != "" {
+		stats.Errors++
+	}
+	t.writeTraceRecord_nolock(RpcTraceRecord{
+		Ts:         time.Now().UnixMilli(),
+		Type:       RpcTraceType_Resp,
+		Command:    info.Command,
+		RpcId:      info.RpcId,
+		Source:     info.DestRouteId,
+		Route:      info.SourceRouteId,
+		DurationMs: durationMs,
+		Error:      msg.Error,
+		Size:       size,
+	})
+}
+
+func getLatencyBucket(durationMs int64) int {
+	for idx, bucketMs := range wshrpc.RpcLatencyBucketsMs {
+		if durationMs <= bucketMs {
+			return idx
+		}
+	}
+	return len(wshrpc.RpcLatencyBucketsMs)
+}
+
+// returns the upper bound of the bucket containing the given percentile (MaxMs for the overflow bucket)
+func estimatePercentileMs(stats *wshrpc.RpcCommandStats, pct float64) int64 {
+	var total int64
+	for _, count := range stats.Histogram {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+	target := int64(float64(total)*pct + 0.5)
+	var cumulative int64
+	for idx, count := range stats.Histogram {
+		cumulative += count
+		if cumulative >= target && count > 0 {
+			if idx < len(wshrpc.RpcLatencyBucketsMs) {
+				return min(wshrpc.RpcLatencyBucketsMs[idx], stats.MaxMs)
+			}
+			break
+		}
+	}
+	return stats.MaxMs
+}
+
+func (t *rpcTracer) writeTraceRecord_nolock(rec RpcTraceRecord) {
+	if t.TraceFd == nil {
+		return
+	}
+	barr, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	barr = append(barr, '\n')
+	_, err = t.TraceFd.Write(barr)
+	if err != nil {
+		log.Printf("[router] error writing rpc trace file %q, stopping trace: %v\n", t.TraceFileName, err)
+		t.closeTrace_nolock()
+	}
+}
+
+func (t *rpcTracer) closeTrace_nolock() {
+	if t.TraceFd == nil {
+		return
+	}
+	t.TraceFd.Close()
+	t.TraceFd = nil
+	t.TraceFileName = ""
+}
+
+// returns stats sorted by command, reset clears the stats (pending counts are kept)
+func (router *WshRouter) GetRpcStats(reset bool) []wshrpc.RpcCommandStats {
+	t := router.Tracer
+	t.Lock.Lock()
+	defer t.Lock.Unlock()
+	rtn := make([]wshrpc.RpcCommandStats, 0, len(t.Stats))
+	for _, stats := range t.Stats {
+		statsCopy := *stats
+		statsCopy.Histogram = append([]int64(nil), stats.Histogram...)
+		statsCopy.P50Ms = estimatePercentileMs(stats, 0.5)
+		statsCopy.P95Ms = estimatePercentileMs(stats, 0.95)
+		rtn = append(rtn, statsCopy)
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		return rtn[i].Command < rtn[j].Command
+	})
+	if reset {
+		for command, stats := range t.Stats {
+			if stats.Pending == 0 {
+				delete(t.Stats, command)
+				continue
+			}
+			t.Stats[command] = &wshrpc.RpcCommandStats{
+				Command:   command,
+				Pending:   stats.Pending,
+				Histogram: make([]int64, len(wshrpc.RpcLatencyBucketsMs)+1),
+			}
+		}
+	}
+	return rtn
+}
+
+// starts (or stops) writing the rpc trace file, returns the trace file name ("" when stopped)
+func (router *WshRouter) SetRpcTrace(data wshrpc.CommandRpcTraceData) (string, error) {
+	t := router.Tracer
+	t.Lock.Lock()
+	defer t.Lock.Unlock()
+	t.closeTrace_nolock()
+	if !data.Enabled {
+		return "", nil
+	}
+	fileName := data.FileName
+	if fileName == "" {
+		fileName = fmt.Sprintf("rpctrace-%d.jsonl", time.Now().UnixMilli())
+	}
+	if err := validateRpcTraceFileName(fileName); err != nil {
+		return "", err
+	}
+	traceDir := GetRpcTraceDir()
+	err := wavebase.TryMkdirs(traceDir, 0700, "rpc trace directory")
+	if err != nil {
+		return "", err
+	}
+	fd, err := os.OpenFile(filepath.Join(traceDir, fileName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return "", fmt.Errorf("cannot open rpc trace file: %w", err)
+	}
+	t.TraceFd = fd
+	t.TraceFileName = fd.Name()
+	log.Printf("[router] writing rpc trace to %q\n", t.TraceFileName)
+	return t.TraceFileName, nil
+}
+
+func GetRpcTraceDir() string {
+	return filepath.Join(wavebase.GetWaveHomeDir(), RpcTraceDirName)
+}
+
+// trace files are plain names in the rpctrace dir (no paths)
+func validateRpcTraceFileName(fileName string) error {
+	if fileName == "." || fileName == ".." || strings.ContainsAny(fileName, `/\`) || filepath.Base(fileName) != fileName {
+		return fmt.Errorf("invalid rpc trace file name %q (must be a file name, traces are written to %s)", fileName, GetRpcTraceDir())
+	}
+	return nil
+}
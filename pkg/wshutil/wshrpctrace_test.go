@@ -0,0 +1,98 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestGetLatencyBucket(t *testing.T) {
+	numBuckets := len(wshrpc.RpcLatencyBucketsMs)
+	tests := []struct {
+		durationMs int64
+		bucket     int
+	}{
+		{0, 0},
+		{1, 0},
+		{2, 1},
+		{10, 2},
+		{11, 3},
+		{10000, numBuckets - 1},
+		{10001, numBuckets},
+		{1000000, numBuckets},
+	}
+	for _, test := range tests {
+		if bucket := getLatencyBucket(test.durationMs); bucket != test.bucket {
+			t.Errorf("getLatencyBucket(%d): expected %d, got %d", test.durationMs, test.bucket, bucket)
+		}
+	}
+}
+
+func makeTestStats(maxMs int64, bucketCounts map[int]int64) *wshrpc.RpcCommandStats {
+	stats := &wshrpc.RpcCommandStats{MaxMs: maxMs, Histogram: make([]int64, len(wshrpc.RpcLatencyBucketsMs)+1)}
+	for bucket, count := range bucketCounts {
+		stats.Histogram[bucket] = count
+	}
+	return stats
+}
+
+func TestEstimatePercentileMs(t *testing.T) {
+	overflow := len(wshrpc.RpcLatencyBucketsMs)
+	stats := makeTestStats(30000, map[int]int64{0: 50, 5: 45, overflow: 5})
+	tests := []struct {
+		pct      float64
+		expected int64
+	}{
+		{0.5, 1},
+		{0.51, 100},
+		{0.95, 100},
+		{0.99, 30000},
+	}
+	for _, test := range tests {
+		if ms := estimatePercentileMs(stats, test.pct); ms != test.expected {
+			t.Errorf("p%v: expected %d, got %d", test.pct*100, test.expected, ms)
+		}
+	}
+	if ms := estimatePercentileMs(makeTestStats(0, nil), 0.5); ms != 0 {
+		t.Errorf("expected 0 for empty stats, got %d", ms)
+	}
+	// bucket upper bounds are capped by the max
+	if ms := estimatePercentileMs(makeTestStats(3, map[int]int64{1: 1}), 0.95); ms != 3 {
+		t.Errorf("expected the percentile to be capped at the max (3), got %d", ms)
+	}
+}
+
+func TestSetRpcTrace(t *testing.T) {
+	waveHome := t.TempDir()
+	t.Setenv(wavebase.WaveHomeVarName, waveHome)
+	router := NewWshRouter()
+	badNames := []string{"../trace.jsonl", "/tmp/trace.jsonl", "sub/trace.jsonl", `..\trace.jsonl`, "..", "."}
+	for _, badName := range badNames {
+		if _, err := router.SetRpcTrace(wshrpc.CommandRpcTraceData{Enabled: true, FileName: badName}); err == nil {
+			t.Errorf("expected an error for trace file %q", badName)
+		}
+	}
+	fileName, err := router.SetRpcTrace(wshrpc.CommandRpcTraceData{Enabled: true, FileName: "trace.jsonl"})
+	if err != nil {
+		t.Fatalf("error starting trace: %v", err)
+	}
+	if fileName != filepath.Join(waveHome, RpcTraceDirName, "trace.jsonl") {
+		t.Errorf("trace file not in the rpctrace dir: %q", fileName)
+	}
+	fileName, err = router.SetRpcTrace(wshrpc.CommandRpcTraceData{Enabled: true})
+	if err != nil || filepath.Dir(fileName) != filepath.Join(waveHome, RpcTraceDirName) {
+		t.Errorf("default trace file not in the rpctrace dir: %q %v", fileName, err)
+	}
+	if fileName, err = router.SetRpcTrace(wshrpc.CommandRpcTraceData{Enabled: false}); err != nil || fileName != "" {
+		t.Errorf("error stopping trace: %q %v", fileName, err)
+	}
+	if _, err := os.Stat(filepath.Join(waveHome, RpcTraceDirName, "trace.jsonl")); err != nil {
+		t.Errorf("trace file was not created: %v", err)
+	}
+}
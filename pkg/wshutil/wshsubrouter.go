@@ -0,0 +1,273 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// connservers run a sub-router so wave can reach nested hosts (ssh from a wave block on host A to host B):
+//   wavesrv <- (domain socket over ssh) <- connserver A (sub-router) <- (ssh -R) <- wsh / connserver on B
+// downstream clients authenticate with the sub-router, which registers them as local routes and announces
+// them upstream.  announcements carry the client's jwt, wavesrv (the terminal router) validates it and
+// checks permissions for the announced route with that context.  sub-routers can't validate tokens (they
+// don't have the signing keys), so a downstream route is pending (not routable, and its messages are not
+// read) until the upstream accepts its announcement, and it can never replace an existing route.  once
+// accepted, the sub-router checks permissions (with the route's context) for commands it delivers locally,
+// everything else goes upstream and is checked by the terminal router.
+
+const SubRouterSockSuffix = "-router.sock"
+const NestedConnSeparator = "/"
+const RouteAnnounceTimeout = 10 * time.Second
+
+// an announcement waiting for the upstream's response
+type pendingAnnounce struct {
+	RouteId     string
+	FromRouteId string             // the local route it was announced through (RouteId for local downstream routes)
+	Ctx         *wshrpc.RpcContext // from the (unverified) token, for routes announced through a downstream sub-router
+	DoneCh      chan error         // only for local downstream routes
+}
+
+// the sub-router listens next to the upstream domain socket (which is unique per connection)
+func MakeSubRouterSockName(upstreamSockName string) string {
+	return strings.TrimSuffix(upstreamSockName, ".sock") + SubRouterSockSuffix
+}
+
+// nested connections are named after the connection they were opened from (e.g. "user@hostA/user@hostB")
+func MakeNestedConnName(parentConn string, host string) string {
+	if parentConn == "" {
+		parentConn = wshrpc.LocalConnName
+	}
+	return parentConn + NestedConnSeparator + host
+}
+
+func IsNestedConnName(connName string) bool {
+	return strings.Contains(connName, NestedConnSeparator)
+}
+
+// validates the token in a route announcement, returns the announced route's context
+func validateAnnouncedRoute(msg RpcMessage) (*wshrpc.RpcContext, error) {
+	tokenStr, ok := msg.Data.(string)
+	if !ok || tokenStr == "" {
+		return nil, fmt.Errorf("no token in route announcement")
+	}
+	rpcCtx, err := ValidateAndExtractAuthContext(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if rpcCtx.ClientType == wshrpc.ClientType_ConnServer {
+		if msg.Source != MakeConnectionRouteId(rpcCtx.Conn) {
+			return nil, fmt.Errorf("route does not match token connection %q", rpcCtx.Conn)
+		}
+		return rpcCtx, nil
+	}
+	if rpcCtx.ClientType != "" || !strings.HasPrefix(msg.Source, MakeProcRouteId("")) {
+		return nil, fmt.Errorf("invalid route for token")
+	}
+	if rpcCtx.BlockId == "" && rpcCtx.Conn == "" {
+		return nil, fmt.Errorf("no blockid or conn found in token")
+	}
+	return rpcCtx, nil
+}
+
+// connects to the upstream router over a domain socket, authenticates with jwtToken, and makes it this router's upstream.
+// returns a channel that is closed when the upstream connection closes.
+func (router *WshRouter) ConnectUpstream(sockName string, jwtToken string) (chan struct{}, error) {
+	conn, err := net.Dial("unix", sockName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to upstream domain socket: %w", err)
+	}
+	upstream := MakeRpcProxy()
+	link := MakeRpcStreamLink()
+	go func() {
+		writeErr := link.AdaptOutputChToStream(upstream.ToRemoteCh, conn)
+		if writeErr != nil {
+			log.Printf("error writing to upstream domain socket: %v\n", writeErr)
+		}
+	}()
+	go func() {
+		defer func() {
+			conn.Close()
+			close(upstream.FromRemoteCh)
+		}()
+		link.AdaptStreamToMsgCh(conn, upstream.FromRemoteCh)
+	}()
+	// must be the first message (before any announcements)
+	authMsg := RpcMessage{Command: wshrpc.Command_Authenticate, Data: jwtToken}
+	authBytes, _ := json.Marshal(authMsg)
+	upstream.SendRpcMessage(authBytes)
+	return router.runUpstream(upstream), nil
+}
+
+// sets the upstream client and consumes its messages, the returned channel is closed when the upstream closes
+func (router *WshRouter) runUpstream(upstream AbstractRpcClient) chan struct{} {
+	router.SetUpstreamClient(upstream)
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		for {
+			msgBytes, ok := upstream.RecvRpcMessage()
+			if !ok {
+				log.Printf("[router] upstream connection closed\n")
+				return
+			}
+			router.InputCh <- msgAndRoute{msgBytes: msgBytes, fromRouteId: UpstreamRoute}
+		}
+	}()
+	return doneCh
+}
+
+// accepts downstream clients on a new domain socket (removes any stale socket file first)
+func RunSubRouterListener(sockName string) (net.Listener, error) {
+	os.Remove(sockName)
+	listener, err := net.Listen("unix", sockName)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on sub-router domain socket: %w", err)
+	}
+	err = os.Chmod(sockName, 0600)
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("error setting sub-router domain socket permissions: %w", err)
+	}
+	// closing the listener removes the socket file
+	go RunWshRpcOverListener(listener)
+	return listener, nil
+}
+
+// records an announcement from a downstream sub-router, the route is added when the upstream accepts it
+func (router *WshRouter) addPendingAnnounce(msg RpcMessage, fromRouteId string) error {
+	if msg.ReqId == "" {
+		return fmt.Errorf("no reqid in route announcement")
+	}
+	tokenStr, ok := msg.Data.(string)
+	if !ok || tokenStr == "" {
+		return fmt.Errorf("no token in route announcement")
+	}
+	rpcCtx, err := ExtractUnverifiedRpcContext(tokenStr)
+	if err != nil {
+		return err
+	}
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	if router.RouteMap[fromRouteId] == nil || router.PendingRoutes[fromRouteId] {
+		return fmt.Errorf("route %q has not been accepted", fromRouteId)
+	}
+	if announcedFrom := router.AnnouncedRoutes[msg.Source]; announcedFrom != "" && announcedFrom != fromRouteId {
+		return fmt.Errorf("route %q already exists", msg.Source)
+	}
+	if router.PendingAnnounce[msg.ReqId] != nil {
+		return fmt.Errorf("duplicate route announcement")
+	}
+	router.PendingAnnounce[msg.ReqId] = &pendingAnnounce{RouteId: msg.Source, FromRouteId: fromRouteId, Ctx: rpcCtx}
+	return nil
+}
+
+// handles the upstream's response to an announcement, returns false if msg is not an announcement response
+func (router *WshRouter) handleAnnounceResponse(msg RpcMessage, msgBytes []byte) bool {
+	var respErr error
+	if msg.Error != "" {
+		respErr = errors.New(msg.Error)
+	}
+	router.Lock.Lock()
+	pa := router.PendingAnnounce[msg.ResId]
+	if pa == nil {
+		router.Lock.Unlock()
+		return false
+	}
+	delete(router.PendingAnnounce, msg.ResId)
+	if pa.DoneCh != nil {
+		if respErr == nil && router.RouteMap[pa.RouteId] != nil {
+			delete(router.PendingRoutes, pa.RouteId)
+		}
+		pa.DoneCh <- respErr
+		router.Lock.Unlock()
+		return true
+	}
+	if respErr == nil && router.RouteMap[pa.FromRouteId] != nil {
+		router.AnnouncedRoutes[pa.RouteId] = pa.FromRouteId
+		router.AnnouncedCtx[pa.RouteId] = pa.Ctx
+	}
+	router.Lock.Unlock()
+	// pass the response down to the sub-router that sent the announcement
+	router.sendAnnounceResponseBytes(pa.FromRouteId, msgBytes)
+	return true
+}
+
+func (router *WshRouter) waitForAnnounce(reqId string, doneCh chan error) error {
+	select {
+	case err := <-doneCh:
+		return err
+	case <-time.After(RouteAnnounceTimeout):
+		router.Lock.Lock()
+		delete(router.PendingAnnounce, reqId)
+		router.Lock.Unlock()
+		return fmt.Errorf("timeout waiting for the upstream to accept the route")
+	}
+}
+
+// announcements without a reqid (local routes of a sub-router) don't get a response
+func (router *WshRouter) sendAnnounceResponse(routeId string, reqId string, respErr error) {
+	if reqId == "" {
+		return
+	}
+	resp := RpcMessage{ResId: reqId}
+	if respErr != nil {
+		resp.Error = respErr.Error()
+	}
+	respBytes, _ := json.Marshal(resp)
+	router.sendAnnounceResponseBytes(routeId, respBytes)
+}
+
+func (router *WshRouter) sendAnnounceResponseBytes(routeId string, respBytes []byte) {
+	rpc := router.GetRpc(routeId)
+	if rpc == nil {
+		return
+	}
+	rpc.SendRpcMessage(respBytes)
+}
+
+// sub-routers check commands they deliver locally (e.g. to the connserver's own route) with the context of the
+// accepted route, commands that go upstream are checked by the terminal router
+func (router *WshRouter) checkSubRouterPermission(fromRouteId string, msg *RpcMessage) error {
+	if fromRouteId == UpstreamRoute || fromRouteId == SysRoute {
+		return nil
+	}
+	router.Lock.Lock()
+	accepted := router.RouteMap[fromRouteId] != nil && !router.PendingRoutes[fromRouteId]
+	announcedFrom := router.AnnouncedRoutes[msg.Source]
+	announcedCtx := router.AnnouncedCtx[msg.Source]
+	router.Lock.Unlock()
+	if !accepted {
+		return fmt.Errorf("permission denied: route %q has not been accepted", fromRouteId)
+	}
+	rpcCtx := router.getRouteRpcContext(fromRouteId)
+	if rpcCtx == nil {
+		// local routes (the connserver's own client) are trusted
+		return nil
+	}
+	if msg.Source != fromRouteId {
+		// forwarded by a downstream sub-router, the source must have been announced through it
+		if announcedFrom != fromRouteId || announcedCtx == nil {
+			return fmt.Errorf("permission denied: unknown source route %q", msg.Source)
+		}
+		rpcCtx = announcedCtx
+	}
+	if router.getLocalRouteClient(msg.Route) == nil {
+		return nil
+	}
+	if rpcCtx.Caps == nil {
+		return nil
+	}
+	// no conn resolver here (it needs the wave object store), connserver contexts only get their own routes
+	return CheckRpcPermission(rpcCtx, msg, nil)
+}
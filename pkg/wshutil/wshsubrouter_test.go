@@ -0,0 +1,247 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+type testRpcClient struct {
+	SentCh chan []byte
+	RecvCh chan []byte
+}
+
+func makeTestRpcClient() *testRpcClient {
+	return &testRpcClient{SentCh: make(chan []byte, 10), RecvCh: make(chan []byte, 10)}
+}
+
+func (c *testRpcClient) SendRpcMessage(msg []byte) {
+	c.SentCh <- msg
+}
+
+func (c *testRpcClient) RecvRpcMessage() ([]byte, bool) {
+	msg, ok := <-c.RecvCh
+	return msg, ok
+}
+
+func pipeMsgs(from chan []byte, to chan []byte) {
+	for msg := range from {
+		to <- msg
+	}
+}
+
+func recvTestMsg(t *testing.T, ch chan []byte) RpcMessage {
+	select {
+	case msgBytes := <-ch:
+		var msg RpcMessage
+		err := json.Unmarshal(msgBytes, &msg)
+		if err != nil {
+			t.Fatalf("bad message: %v", err)
+		}
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timeout waiting for message")
+	}
+	return RpcMessage{}
+}
+
+func sendTestMsg(ch chan []byte, msg RpcMessage) {
+	msgBytes, _ := json.Marshal(msg)
+	ch <- msgBytes
+}
+
+func TestSubRouter(t *testing.T) {
+	// terminal router, with a connserver proxy for "user@a" that links to a sub-router
+	termRouter := NewWshRouter()
+	mainClient := makeTestRpcClient()
+	termRouter.RegisterRoute(DefaultRoute, mainClient)
+	connProxy := MakeRpcProxy()
+	connProxy.SetRpcContext(&wshrpc.RpcContext{ClientType: wshrpc.ClientType_ConnServer, Conn: "user@a", Caps: wshrpc.DefaultRemoteCaps})
+	termRouter.RegisterRoute(MakeConnectionRouteId("user@a"), connProxy)
+	subRouter := NewWshRouter()
+	upstream := MakeRpcProxy()
+	go pipeMsgs(upstream.ToRemoteCh, connProxy.FromRemoteCh)
+	go pipeMsgs(connProxy.ToRemoteCh, upstream.FromRemoteCh)
+	subRouter.runUpstream(upstream)
+
+	// a nested shell connects to the sub-router
+	shellCtx := wshrpc.RpcContext{BlockId: testBlockId, TabId: testTabId, Conn: "user@a/user@b", Caps: wshrpc.DefaultRemoteCaps}
+	shellToken, err := MakeClientJWTToken(shellCtx, "/tmp/test.sock")
+	if err != nil {
+		t.Fatalf("error making token: %v", err)
+	}
+	shellProxy := MakeRpcProxy()
+	shellProxy.SetRpcContext(&shellCtx)
+	shellProxy.AuthToken = shellToken
+	shellRouteId := MakeProcRouteId("nested-shell")
+	subRouter.RegisterRoute(shellRouteId, shellProxy)
+	deadline := time.Now().Add(2 * time.Second)
+	for termRouter.GetRouteRpcContext(shellRouteId) == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("route was not announced to the terminal router")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// request goes up to wavesrv, response comes back down
+	sendTestMsg(shellProxy.FromRemoteCh, RpcMessage{Command: wshrpc.Command_GetMeta, ReqId: "req1", Data: map[string]any{"oref": "block:" + testBlockId}})
+	req := recvTestMsg(t, mainClient.SentCh)
+	if req.Source != shellRouteId || req.Command != wshrpc.Command_GetMeta {
+		t.Fatalf("unexpected request at wavesrv: %#v", req)
+	}
+	sendTestMsg(mainClient.RecvCh, RpcMessage{ResId: "req1", Data: "ok"})
+	resp := recvTestMsg(t, shellProxy.ToRemoteCh)
+	if resp.ResId != "req1" || resp.Error != "" {
+		t.Fatalf("unexpected response: %#v", resp)
+	}
+
+	// permissions use the announced context
+	sendTestMsg(shellProxy.FromRemoteCh, RpcMessage{Command: wshrpc.Command_SetConfig, ReqId: "req2", Data: map[string]any{}})
+	resp = recvTestMsg(t, shellProxy.ToRemoteCh)
+	if resp.ResId != "req2" || resp.Error == "" {
+		t.Fatalf("expected permission denied: %#v", resp)
+	}
+
+	// a connserver can't send commands for routes it didn't announce
+	sendTestMsg(connProxy.FromRemoteCh, RpcMessage{Command: wshrpc.Command_ConnStatus, ReqId: "req3", Source: MakeProcRouteId("spoofed")})
+	sendTestMsg(connProxy.FromRemoteCh, RpcMessage{Command: wshrpc.Command_ConnStatus, ReqId: "req4"})
+	req = recvTestMsg(t, mainClient.SentCh)
+	if req.ReqId != "req4" {
+		t.Fatalf("spoofed request was routed: %#v", req)
+	}
+
+	// announcements without a valid token are rejected
+	sendTestMsg(connProxy.FromRemoteCh, RpcMessage{Command: wshrpc.Command_RouteAnnounce, Source: MakeProcRouteId("notoken")})
+	sendTestMsg(connProxy.FromRemoteCh, RpcMessage{Command: wshrpc.Command_RouteAnnounce, Source: MakeConnectionRouteId("user@c"), Data: shellToken})
+	time.Sleep(50 * time.Millisecond)
+	if termRouter.HasRoute(MakeProcRouteId("notoken")) || termRouter.HasRoute(MakeConnectionRouteId("user@c")) {
+		t.Fatalf("invalid announcement was accepted")
+	}
+
+	// unregistering the downstream route unannounces it
+	subRouter.UnregisterRoute(shellRouteId)
+	deadline = time.Now().Add(2 * time.Second)
+	for termRouter.HasRoute(shellRouteId) {
+		if time.Now().After(deadline) {
+			t.Fatalf("route was not unannounced")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubRouterDownstreamRoute(t *testing.T) {
+	subRouter := NewWshRouter()
+	upstream := makeTestRpcClient()
+	subRouter.runUpstream(upstream)
+	connClient := makeTestRpcClient()
+	connRouteId := MakeConnectionRouteId("user@a")
+	subRouter.RegisterRoute(connRouteId, connClient)
+	recvTestMsg(t, upstream.SentCh) // plain announcement for the connserver's own route
+
+	shellCtx := wshrpc.RpcContext{BlockId: testBlockId, TabId: testTabId, Conn: "user@a", Caps: wshrpc.DefaultRemoteCaps}
+	shellToken, err := MakeClientJWTToken(shellCtx, "/tmp/test.sock")
+	if err != nil {
+		t.Fatalf("error making token: %v", err)
+	}
+	makeShellProxy := func() *WshRpcProxy {
+		proxy := MakeRpcProxy()
+		proxy.SetRpcContext(&shellCtx)
+		proxy.AuthToken = shellToken
+		return proxy
+	}
+
+	// downstream routes can't replace existing routes
+	err = subRouter.RegisterDownstreamRoute(connRouteId, makeShellProxy())
+	if err == nil {
+		t.Fatalf("downstream route replaced an existing route")
+	}
+
+	// pending routes are not routable and their messages are not read
+	shellProxy := makeShellProxy()
+	shellRouteId := MakeProcRouteId("shell")
+	err = subRouter.RegisterDownstreamRoute(shellRouteId, shellProxy)
+	if err != nil {
+		t.Fatalf("error registering downstream route: %v", err)
+	}
+	announce := recvTestMsg(t, upstream.SentCh)
+	if announce.Command != wshrpc.Command_RouteAnnounce || announce.Source != shellRouteId || announce.ReqId == "" || announce.Data != shellToken {
+		t.Fatalf("unexpected announcement: %#v", announce)
+	}
+	sendTestMsg(shellProxy.FromRemoteCh, RpcMessage{Command: wshrpc.Command_ConnStatus, ReqId: "req1", Route: connRouteId})
+	sendTestMsg(upstream.RecvCh, RpcMessage{Command: wshrpc.Command_GetMeta, ReqId: "req2", Route: shellRouteId, Source: DefaultRoute})
+	resp := recvTestMsg(t, upstream.SentCh)
+	if resp.ResId != "req2" || resp.Error == "" {
+		t.Fatalf("pending route was routable: %#v", resp)
+	}
+	select {
+	case <-connClient.SentCh:
+		t.Fatalf("message from a pending route was delivered")
+	default:
+	}
+
+	// once accepted, queued messages are read and the route is routable
+	sendTestMsg(upstream.RecvCh, RpcMessage{ResId: announce.ReqId})
+	req := recvTestMsg(t, connClient.SentCh)
+	if req.ReqId != "req1" || req.Source != shellRouteId {
+		t.Fatalf("unexpected request: %#v", req)
+	}
+	sendTestMsg(upstream.RecvCh, RpcMessage{Command: wshrpc.Command_GetMeta, ReqId: "req3", Route: shellRouteId, Source: DefaultRoute})
+	req = recvTestMsg(t, shellProxy.ToRemoteCh)
+	if req.ReqId != "req3" {
+		t.Fatalf("unexpected request: %#v", req)
+	}
+
+	// rejected routes are unregistered
+	rejectedRouteId := MakeProcRouteId("rejected")
+	err = subRouter.RegisterDownstreamRoute(rejectedRouteId, makeShellProxy())
+	if err != nil {
+		t.Fatalf("error registering downstream route: %v", err)
+	}
+	announce = recvTestMsg(t, upstream.SentCh)
+	sendTestMsg(upstream.RecvCh, RpcMessage{ResId: announce.ReqId, Error: "invalid token"})
+	deadline := time.Now().Add(2 * time.Second)
+	for subRouter.GetRpc(rejectedRouteId) != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("rejected route was not unregistered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// unannouncing a route doesn't hold the router lock while the upstream is blocked
+func TestUnregisterRouteBlockedUpstream(t *testing.T) {
+	router := NewWshRouter()
+	upstream := &testRpcClient{SentCh: make(chan []byte), RecvCh: make(chan []byte)}
+	router.SetUpstreamClient(upstream)
+	routeId := MakeProcRouteId("blocked-upstream")
+	router.RegisterRoute(routeId, makeTestRpcClient())
+	unregisterDoneCh := make(chan struct{})
+	go func() {
+		router.UnregisterRoute(routeId)
+		close(unregisterDoneCh)
+	}()
+	lookupDoneCh := make(chan struct{})
+	go func() {
+		router.HasRoute(routeId)
+		close(lookupDoneCh)
+	}()
+	select {
+	case <-lookupDoneCh:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("route lookup blocked behind the upstream send")
+	}
+	for {
+		select {
+		case <-upstream.SentCh:
+		case <-unregisterDoneCh:
+			return
+		case <-time.After(2 * time.Second):
+			t.Fatalf("unregister did not finish")
+		}
+	}
+}
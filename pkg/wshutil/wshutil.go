@@ -6,6 +6,7 @@ package wshutil
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -19,7 +20,6 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"github.com/wavetermdev/waveterm/pkg/wavebase"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"golang.org/x/term"
 )
@@ -194,6 +194,11 @@ func SetupTerminalRpcClient(serverImpl ServerImpl) (*WshRpc, io.Reader) {
 	rpcClient := MakeWshRpc(messageCh, outputCh, wshrpc.RpcContext{}, serverImpl)
 	go func() {
 		for msg := range outputCh {
+			msg, err := BinFrameToJson(msg)
+			if err != nil {
+				log.Printf("error converting binary frame to json: %v\n", err)
+				continue
+			}
 			barr := EncodeWaveOSCBytes(WaveOSC, msg)
 			os.Stdout.Write(barr)
 		}
@@ -205,8 +210,10 @@ func SetupConnRpcClient(conn net.Conn, serverImpl ServerImpl) (*WshRpc, chan err
 	inputCh := make(chan []byte, DefaultInputChSize)
 	outputCh := make(chan []byte, DefaultOutputChSize)
 	writeErrCh := make(chan error, 1)
+	disconnectCh := make(chan struct{})
+	link := MakeRpcStreamLink()
 	go func() {
-		writeErr := AdaptOutputChToStream(outputCh, conn)
+		writeErr := link.AdaptOutputChToStream(outputCh, conn)
 		if writeErr != nil {
 			writeErrCh <- writeErr
 			close(writeErrCh)
@@ -214,10 +221,12 @@ func SetupConnRpcClient(conn net.Conn, serverImpl ServerImpl) (*WshRpc, chan err
 	}()
 	go func() {
 		// when input is closed, close the connection
+		defer close(disconnectCh)
 		defer conn.Close()
-		AdaptStreamToMsgCh(conn, inputCh)
+		link.AdaptStreamToMsgCh(conn, inputCh)
 	}()
 	rtn := MakeWshRpc(inputCh, outputCh, wshrpc.RpcContext{}, serverImpl)
+	rtn.DisconnectCh = disconnectCh
 	return rtn, writeErrCh, nil
 }
 
@@ -242,7 +251,7 @@ func MakeClientJWTToken(rpcCtx wshrpc.RpcContext, sockName string) (string, erro
 	claims["iat"] = time.Now().Unix()
 	claims["iss"] = "waveterm"
 	claims["sock"] = sockName
-	claims["exp"] = time.Now().Add(time.Hour * 24 * 365).Unix()
+	claims["exp"] = time.Now().Add(JwtTokenExpiry).Unix()
 	if rpcCtx.BlockId != "" {
 		claims["blockid"] = rpcCtx.BlockId
 	}
@@ -255,43 +264,108 @@ func MakeClientJWTToken(rpcCtx wshrpc.RpcContext, sockName string) (string, erro
 	if rpcCtx.ClientType != "" {
 		claims["ctype"] = rpcCtx.ClientType
 	}
+	if rpcCtx.Caps != nil {
+		claims["caps"] = rpcCtx.Caps
+	}
+	signingKey, err := jwtKeys.getSigningKey()
+	if err != nil {
+		return "", err
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenStr, err := token.SignedString([]byte(wavebase.JwtSecret))
+	token.Header["kid"] = signingKey.KeyId
+	tokenStr, err := token.SignedString(signingKey.Secret)
 	if err != nil {
 		return "", fmt.Errorf("error signing token: %w", err)
 	}
 	return tokenStr, nil
 }
 
-func ValidateAndExtractRpcContextFromToken(tokenStr string) (*wshrpc.RpcContext, error) {
-	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
+var ErrTokenExpired = errors.New("token has expired")
+
+// checks the signature, issuer and revocation, the caller checks the returned expiry
+func validateToken(tokenStr string) (*wshrpc.RpcContext, time.Time, error) {
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}), jwt.WithoutClaimsValidation())
 	token, err := parser.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		return []byte(wavebase.JwtSecret), nil
+		keyId, ok := token.Header["kid"].(string)
+		if !ok {
+			return nil, fmt.Errorf("kid header is missing or invalid")
+		}
+		return jwtKeys.getVerifyKey(keyId)
 	})
 	if err != nil {
-		return nil, fmt.Errorf("error parsing token: %w", err)
+		return nil, time.Time{}, fmt.Errorf("error parsing token: %w", err)
 	}
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return nil, fmt.Errorf("error getting claims from token")
+		return nil, time.Time{}, fmt.Errorf("error getting claims from token")
 	}
-	// validate "exp" claim
-	if exp, ok := claims["exp"].(float64); ok {
-		if int64(exp) < time.Now().Unix() {
-			return nil, fmt.Errorf("token has expired")
-		}
-	} else {
-		return nil, fmt.Errorf("exp claim is missing or invalid")
+	expiry, err := getTokenExpiry(claims)
+	if err != nil {
+		return nil, time.Time{}, err
 	}
 	// validate "iss" claim
 	if iss, ok := claims["iss"].(string); ok {
 		if iss != "waveterm" {
-			return nil, fmt.Errorf("unexpected issuer: %s", iss)
+			return nil, time.Time{}, fmt.Errorf("unexpected issuer: %s", iss)
 		}
 	} else {
-		return nil, fmt.Errorf("iss claim is missing or invalid")
+		return nil, time.Time{}, fmt.Errorf("iss claim is missing or invalid")
+	}
+	rpcCtx := mapClaimsToRpcContext(claims)
+	if IsBlockTokenRevoked(rpcCtx.BlockId) {
+		return nil, time.Time{}, fmt.Errorf("token has been revoked")
+	}
+	return rpcCtx, expiry, nil
+}
+
+func getTokenExpiry(claims jwt.MapClaims) (time.Time, error) {
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return time.Time{}, fmt.Errorf("exp claim is missing or invalid")
+	}
+	return time.Unix(int64(exp), 0), nil
+}
+
+// block tokens can be refreshed for JwtRefreshGracePeriod after they expire
+func canRefreshExpiredToken(rpcCtx *wshrpc.RpcContext, expiry time.Time) bool {
+	return rpcCtx.BlockId != "" && time.Since(expiry) <= JwtRefreshGracePeriod
+}
+
+// an expired token that can still be refreshed gets a context with no caps, the session can only run the
+// commands every route can run (authrefresh)
+func applyTokenExpiry(rpcCtx *wshrpc.RpcContext, expiry time.Time) error {
+	if !expiry.Before(time.Now()) {
+		return nil
+	}
+	if !canRefreshExpiredToken(rpcCtx, expiry) {
+		return ErrTokenExpired
 	}
-	return mapClaimsToRpcContext(claims), nil
+	rpcCtx.Caps = []string{}
+	return nil
+}
+
+func ValidateAndExtractRpcContextFromToken(tokenStr string) (*wshrpc.RpcContext, error) {
+	rpcCtx, expiry, err := validateToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if expiry.Before(time.Now()) {
+		return nil, ErrTokenExpired
+	}
+	return rpcCtx, nil
+}
+
+// for authenticating routes, accepts expired tokens that can still be refreshed (see applyTokenExpiry)
+func ValidateAndExtractAuthContext(tokenStr string) (*wshrpc.RpcContext, error) {
+	rpcCtx, expiry, err := validateToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	err = applyTokenExpiry(rpcCtx, expiry)
+	if err != nil {
+		return nil, err
+	}
+	return rpcCtx, nil
 }
 
 func mapClaimsToRpcContext(claims jwt.MapClaims) *wshrpc.RpcContext {
@@ -316,6 +390,16 @@ func mapClaimsToRpcContext(claims jwt.MapClaims) *wshrpc.RpcContext {
 			rpcCtx.ClientType = ctype
 		}
 	}
+	if claims["caps"] != nil {
+		// a malformed caps claim means no caps (not full access)
+		rpcCtx.Caps = []string{}
+		caps, _ := claims["caps"].([]any)
+		for _, cap := range caps {
+			if capStr, ok := cap.(string); ok {
+				rpcCtx.Caps = append(rpcCtx.Caps, capStr)
+			}
+		}
+	}
 	return rpcCtx
 }
 
@@ -358,8 +442,9 @@ func MakeRouteIdFromCtx(rpcCtx *wshrpc.RpcContext) (string, error) {
 func handleDomainSocketClient(conn net.Conn) {
 	var routeIdContainer atomic.Pointer[string]
 	proxy := MakeRpcProxy()
+	link := MakeRpcStreamLink()
 	go func() {
-		writeErr := AdaptOutputChToStream(proxy.ToRemoteCh, conn)
+		writeErr := link.AdaptOutputChToStream(proxy.ToRemoteCh, conn)
 		if writeErr != nil {
 			log.Printf("error writing to domain socket: %v\n", writeErr)
 		}
@@ -373,7 +458,7 @@ func handleDomainSocketClient(conn net.Conn) {
 				DefaultRouter.UnregisterRoute(*routeIdPtr)
 			}
 		}()
-		AdaptStreamToMsgCh(conn, proxy.FromRemoteCh)
+		link.AdaptStreamToMsgCh(conn, proxy.FromRemoteCh)
 	}()
 	rpcCtx, err := proxy.HandleAuthentication()
 	if err != nil {
@@ -390,8 +475,18 @@ func handleDomainSocketClient(conn net.Conn) {
 		log.Printf("error making route id: %v\n", err)
 		return
 	}
+	if DefaultRouter.GetUpstreamClient() != nil {
+		// sub-router, the token is validated upstream (see wshsubrouter.go)
+		err = DefaultRouter.RegisterDownstreamRoute(routeId, proxy)
+		if err != nil {
+			conn.Close()
+			log.Printf("error registering downstream route: %v\n", err)
+			return
+		}
+	} else {
+		DefaultRouter.RegisterRoute(routeId, proxy)
+	}
 	routeIdContainer.Store(&routeId)
-	DefaultRouter.RegisterRoute(routeId, proxy)
 }
 
 // only for use on client
@@ -406,7 +501,31 @@ func ExtractUnverifiedRpcContext(tokenStr string) (*wshrpc.RpcContext, error) {
 	if !ok {
 		return nil, fmt.Errorf("error getting claims from token")
 	}
-	return mapClaimsToRpcContext(claims), nil
+	rpcCtx := mapClaimsToRpcContext(claims)
+	// the upstream validates the expiry again, sub-routers apply it to the routes they hold
+	expiry, err := getTokenExpiry(claims)
+	if err != nil {
+		return nil, err
+	}
+	err = applyTokenExpiry(rpcCtx, expiry)
+	if err != nil {
+		return nil, err
+	}
+	return rpcCtx, nil
+}
+
+// only for use on client (the token needs a refresh before it can be used, see RefreshClientJWTToken)
+func IsUnverifiedTokenExpired(tokenStr string) bool {
+	token, _, err := new(jwt.Parser).ParseUnverified(tokenStr, jwt.MapClaims{})
+	if err != nil {
+		return false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	expiry, err := getTokenExpiry(claims)
+	return err == nil && expiry.Before(time.Now())
 }
 
 // only for use on client
@@ -0,0 +1,133 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wstore
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// api tokens authenticate external tools with the local rpc gateway (see web/webgateway.go).
+// the token itself is only returned when it is created, we store its sha256.
+
+const ApiTokenPrefix = "wavetok_"
+const apiTokenLastUsedResolution = time.Minute
+
+type ApiToken struct {
+	TokenId    string   `json:"tokenid"`
+	Name       string   `json:"name"`
+	Caps       []string `json:"caps"`
+	CreatedTs  int64    `json:"createdts"`
+	LastUsedTs int64    `json:"lastusedts,omitempty"`
+}
+
+type apiTokenRow struct {
+	TokenId    string
+	Name       string
+	TokenHash  string
+	Caps       string
+	CreatedTs  int64
+	LastUsedTs int64
+}
+
+func (row *apiTokenRow) toApiToken() (*ApiToken, error) {
+	rtn := &ApiToken{TokenId: row.TokenId, Name: row.Name, CreatedTs: row.CreatedTs, LastUsedTs: row.LastUsedTs}
+	err := json.Unmarshal([]byte(row.Caps), &rtn.Caps)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling caps for api token %q: %w", row.TokenId, err)
+	}
+	if rtn.Caps == nil {
+		// nil caps would mean full access
+		rtn.Caps = []string{}
+	}
+	return rtn, nil
+}
+
+func hashApiToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// returns the new token's info and the token (it can't be retrieved again)
+func CreateApiToken(ctx context.Context, name string, caps []string) (*ApiToken, string, error) {
+	if caps == nil {
+		caps = []string{}
+	}
+	randBytes := make([]byte, 32)
+	_, err := rand.Read(randBytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating api token: %w", err)
+	}
+	token := ApiTokenPrefix + hex.EncodeToString(randBytes)
+	capsJson, err := json.Marshal(caps)
+	if err != nil {
+		return nil, "", err
+	}
+	rtn := &ApiToken{TokenId: uuid.New().String(), Name: name, Caps: caps, CreatedTs: time.Now().UnixMilli()}
+	err = WithTx(ctx, func(tx *TxWrap) error {
+		query := `INSERT INTO db_apitoken (tokenid, name, tokenhash, caps, createdts, lastusedts) VALUES (?, ?, ?, ?, ?, 0)`
+		tx.Exec(query, rtn.TokenId, name, hashApiToken(token), string(capsJson), rtn.CreatedTs)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return rtn, token, nil
+}
+
+func ListApiTokens(ctx context.Context) ([]*ApiToken, error) {
+	return WithTxRtn(ctx, func(tx *TxWrap) ([]*ApiToken, error) {
+		var rows []*apiTokenRow
+		query := `SELECT tokenid, name, tokenhash, caps, createdts, lastusedts FROM db_apitoken ORDER BY createdts`
+		tx.Select(&rows, query)
+		rtn := make([]*ApiToken, 0, len(rows))
+		for _, row := range rows {
+			apiToken, err := row.toApiToken()
+			if err != nil {
+				return nil, err
+			}
+			rtn = append(rtn, apiToken)
+		}
+		return rtn, nil
+	})
+}
+
+func DeleteApiToken(ctx context.Context, tokenId string) error {
+	return WithTx(ctx, func(tx *TxWrap) error {
+		query := `DELETE FROM db_apitoken WHERE tokenid = ?`
+		result := tx.Exec(query, tokenId)
+		if result == nil {
+			return nil
+		}
+		if count, _ := result.RowsAffected(); count == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// returns ErrNotFound for unknown (or deleted) tokens, also updates the token's last used time
+func ValidateApiToken(ctx context.Context, token string) (*ApiToken, error) {
+	return WithTxRtn(ctx, func(tx *TxWrap) (*ApiToken, error) {
+		var row apiTokenRow
+		query := `SELECT tokenid, name, tokenhash, caps, createdts, lastusedts FROM db_apitoken WHERE tokenhash = ?`
+		if !tx.Get(&row, query, hashApiToken(token)) {
+			return nil, ErrNotFound
+		}
+		now := time.Now().UnixMilli()
+		if now-row.LastUsedTs > apiTokenLastUsedResolution.Milliseconds() {
+			query = `UPDATE db_apitoken SET lastusedts = ? WHERE tokenid = ?`
+			tx.Exec(query, now, row.TokenId)
+			row.LastUsedTs = now
+		}
+		return row.toApiToken()
+	})
+}
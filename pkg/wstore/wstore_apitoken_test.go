@@ -0,0 +1,75 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestApiTokens(t *testing.T) {
+	err := InitWStoreForTesting()
+	if err != nil {
+		t.Fatalf("error initializing wstore: %v", err)
+	}
+	ctx := context.Background()
+	info, token, err := CreateApiToken(ctx, "test", []string{"read"})
+	if err != nil {
+		t.Fatalf("error creating token: %v", err)
+	}
+	if !strings.HasPrefix(token, ApiTokenPrefix) {
+		t.Errorf("expected token prefix %q: %q", ApiTokenPrefix, token)
+	}
+
+	// only the hash is stored
+	storedHash, err := WithTxRtn(ctx, func(tx *TxWrap) (string, error) {
+		return tx.GetString(`SELECT tokenhash FROM db_apitoken WHERE tokenid = ?`, info.TokenId), nil
+	})
+	if err != nil {
+		t.Fatalf("error reading token hash: %v", err)
+	}
+	if storedHash != hashApiToken(token) || strings.Contains(storedHash, token) {
+		t.Errorf("expected the token's sha256 to be stored, got %q", storedHash)
+	}
+
+	validated, err := ValidateApiToken(ctx, token)
+	if err != nil {
+		t.Fatalf("error validating token: %v", err)
+	}
+	if validated.TokenId != info.TokenId || len(validated.Caps) != 1 || validated.Caps[0] != "read" || validated.LastUsedTs == 0 {
+		t.Errorf("unexpected validated token: %+v", validated)
+	}
+	if _, err := ValidateApiToken(ctx, token+"x"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for an unknown token, got %v", err)
+	}
+	if _, err := ValidateApiToken(ctx, storedHash); err != ErrNotFound {
+		t.Errorf("the stored hash should not validate, got %v", err)
+	}
+
+	// tokens without caps don't get full access
+	noCapsInfo, noCapsToken, err := CreateApiToken(ctx, "nocaps", nil)
+	if err != nil {
+		t.Fatalf("error creating token: %v", err)
+	}
+	noCaps, err := ValidateApiToken(ctx, noCapsToken)
+	if err != nil || noCaps.Caps == nil || len(noCaps.Caps) != 0 {
+		t.Errorf("expected empty (non-nil) caps: %+v (%v)", noCaps, err)
+	}
+
+	tokens, err := ListApiTokens(ctx)
+	if err != nil || len(tokens) != 2 {
+		t.Fatalf("expected 2 tokens: %v (%v)", tokens, err)
+	}
+	err = DeleteApiToken(ctx, noCapsInfo.TokenId)
+	if err != nil {
+		t.Fatalf("error deleting token: %v", err)
+	}
+	if _, err := ValidateApiToken(ctx, noCapsToken); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for a deleted token, got %v", err)
+	}
+	if err := DeleteApiToken(ctx, noCapsInfo.TokenId); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound deleting a deleted token, got %v", err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/sawka/txwrap"
 	"github.com/wavetermdev/waveterm/pkg/util/migrateutil"
 	"github.com/wavetermdev/waveterm/pkg/wavebase"
@@ -24,6 +25,7 @@ const WStoreDBName = "waveterm.db"
 type TxWrap = txwrap.TxWrap
 
 var globalDB *sqlx.DB
+var useTestingDb bool // just for testing (forces MakeDB() to return an in-memory db)
 
 func InitWStore() error {
 	ctx, cancelFn := context.WithTimeout(context.Background(), 2*time.Second)
@@ -41,14 +43,26 @@ func InitWStore() error {
 	return nil
 }
 
+// initializes wstore with an in-memory db (for tests in other packages)
+func InitWStoreForTesting() error {
+	useTestingDb = true
+	return InitWStore()
+}
+
 func GetDBName() string {
 	waveHome := wavebase.GetWaveHomeDir()
 	return filepath.Join(waveHome, wavebase.WaveDBDir, WStoreDBName)
 }
 
 func MakeDB(ctx context.Context) (*sqlx.DB, error) {
-	dbName := GetDBName()
-	rtn, err := sqlx.Open("sqlite3", fmt.Sprintf("file:%s?mode=rwc&_journal_mode=WAL&_busy_timeout=5000", dbName))
+	var rtn *sqlx.DB
+	var err error
+	if useTestingDb {
+		rtn, err = sqlx.Open("sqlite3", ":memory:")
+	} else {
+		dbName := GetDBName()
+		rtn, err = sqlx.Open("sqlite3", fmt.Sprintf("file:%s?mode=rwc&_journal_mode=WAL&_busy_timeout=5000", dbName))
+	}
 	if err != nil {
 		return nil, err
 	}